@@ -34,6 +34,14 @@ func (b *BlockChain) maybeAcceptBlock(block *btcutil.Block, flags BehaviorFlags)
 		return false, ruleError(ErrInvalidAncestorBlock, str)
 	}
 
+	// The header of the block might have been processed on its own already,
+	// in which case it must not be known to be invalid.
+	node := b.index.LookupNode(block.Hash())
+	if node != nil && b.index.NodeStatus(node).KnownInvalid() {
+		str := fmt.Sprintf("block %s is known to be invalid", block.Hash())
+		return false, ruleError(ErrDuplicateBlock, str)
+	}
+
 	blockHeight := prevNode.height + 1
 	block.SetHeight(blockHeight)
 
@@ -60,14 +68,17 @@ func (b *BlockChain) maybeAcceptBlock(block *btcutil.Block, flags BehaviorFlags)
 		return false, err
 	}
 
-	// Create a new block node for the block and add it to the node index. Even
-	// if the block ultimately gets connected to the main chain, it starts out
-	// on a side chain.
-	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, prevNode)
-	newNode.status = statusDataStored
-
-	b.index.AddNode(newNode)
+	// Create a new block node for the block and add it to the node index,
+	// unless its header has already been processed on its own. Even if the
+	// block ultimately gets connected to the main chain, it starts out on a
+	// side chain.
+	if node == nil {
+		blockHeader := &block.MsgBlock().Header
+		node = newBlockNode(blockHeader, prevNode)
+		b.index.AddNode(node)
+		b.updateBestHeader(node)
+	}
+	b.index.SetStatusFlags(node, statusDataStored)
 	err = b.index.flushToDB()
 	if err != nil {
 		return false, err
@@ -76,7 +87,7 @@ func (b *BlockChain) maybeAcceptBlock(block *btcutil.Block, flags BehaviorFlags)
 	// Connect the passed block to the chain while respecting proper chain
 	// selection according to the chain with the most proof of work.  This
 	// also handles validation of the transaction scripts.
-	isMainChain, err := b.connectBestChain(newNode, block, flags)
+	isMainChain, err := b.connectBestChain(node, block, flags)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// assumeValidMinBurial is the minimum amount of time the blocks whose scripts
+// are assumed valid must be buried by in the best header chain.  The time is
+// estimated from the work of the blocks on top of them.  It ensures a chain
+// which contains the assume-valid block can't be forged without a significant
+// amount of work, and that the scripts of recent blocks are always checked.
+const assumeValidMinBurial = 14 * 24 * time.Hour
+
+// isAssumedValid returns whether the scripts of the passed block node are
+// assumed to be valid.  That is the case when the node is an ancestor of the
+// assume-valid block, or the block itself, and that block is in the best
+// header chain, which has at least the minimum chain work of the network and
+// also buries the node deep enough.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode) bool {
+	if b.assumeValid == nil {
+		return false
+	}
+
+	assumeValidNode := b.index.LookupNode(b.assumeValid)
+	if assumeValidNode == nil || node.height > assumeValidNode.height ||
+		!b.bestHeader.Contains(assumeValidNode) ||
+		!b.bestHeader.Contains(node) {
+
+		return false
+	}
+	bestHeader := b.bestHeader.Tip()
+	if b.index.NodeStatus(bestHeader).KnownInvalid() {
+		return false
+	}
+	minWork := b.chainParams.MinimumChainWork
+	if minWork != nil && bestHeader.workSum.Cmp(minWork) < 0 {
+		return false
+	}
+
+	// Estimate the time it took to mine the blocks on top of the node by
+	// comparing their work to the one of the best header.
+	work := new(big.Int).Sub(bestHeader.workSum, node.workSum)
+	work.Mul(work, big.NewInt(int64(b.chainParams.TargetTimePerBlock/time.Second)))
+	work.Div(work, CalcWork(bestHeader.bits))
+	return work.Cmp(big.NewInt(int64(assumeValidMinBurial/time.Second))) >= 0
+}
+
+// skipScripts returns whether the scripts of the passed block node don't need
+// to be checked when it's connected.  That is the case when the node is covered
+// by the latest checkpoint, or is assumed valid.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) skipScripts(node *blockNode) bool {
+	// The validity of the blocks before the latest known good checkpoint is
+	// verified via the checkpoints since all transactions are included in
+	// the merkle root hash and any changes will therefore be detected by
+	// the next checkpoint.
+	checkpoint := b.LatestCheckpoint()
+	if checkpoint != nil && node.height <= checkpoint.Height {
+		return true
+	}
+
+	if !b.isAssumedValid(node) {
+		return false
+	}
+	if !b.assumeValidLogged {
+		log.Infof("Skipping script checks for the ancestors of "+
+			"assume-valid block %v", b.assumeValid)
+		b.assumeValidLogged = true
+	}
+	return true
+}
+
+// AssumeValid returns the hash of the block whose scripts, along with the ones
+// of its ancestors, are assumed to be valid, or nil when the scripts of all
+// blocks are checked.  It also returns whether the assumption is in effect,
+// meaning the scripts of the next block to be connected to the main chain
+// won't be checked.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AssumeValid() (*chainhash.Hash, bool) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	next := b.bestHeader.Next(b.bestChain.Tip())
+	return b.assumeValid, next != nil && b.isAssumedValid(next)
+}
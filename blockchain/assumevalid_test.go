@@ -0,0 +1,153 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestAssumeValid ensures the scripts of a block are only assumed valid when
+// it's an ancestor of the assume-valid block in the best header chain, which
+// has the minimum chain work and buries the block deep enough, and that the
+// scripts of those blocks and the ones covered by a checkpoint are skipped.
+func TestAssumeValid(t *testing.T) {
+	params := chaincfg.MainNetParams
+	chain := newFakeChain(&params)
+
+	// Construct a header chain which buries the blocks up to height 36 by
+	// two weeks worth of blocks, along with a side chain after block 5.
+	burial := int(assumeValidMinBurial / params.TargetTimePerBlock)
+	genesis := chain.bestChain.Genesis()
+	newChain := func(parent *blockNode, numNodes int) []*blockNode {
+		nodes := make([]*blockNode, numNodes)
+		timestamp := time.Unix(parent.timestamp, 0)
+		for i := range nodes {
+			timestamp = timestamp.Add(params.TargetTimePerBlock)
+			nodes[i] = newFakeNode(parent, 1, params.PowLimitBits,
+				timestamp)
+			chain.index.AddNode(nodes[i])
+			parent = nodes[i]
+		}
+		return nodes
+	}
+	headers := newChain(genesis, burial+36)
+	sideChain := newChain(headers[4], 1)
+	bestHeader := tstTip(headers)
+	chain.bestHeader.SetTip(bestHeader)
+	node := func(height int32) *blockNode {
+		return headers[height-1]
+	}
+
+	tests := []struct {
+		name        string
+		assumeValid *chainhash.Hash
+		minWork     *big.Int
+		node        *blockNode
+		want        bool
+	}{
+		{
+			name: "no assume-valid block",
+			node: node(10),
+		},
+		{
+			name:        "unknown assume-valid block",
+			assumeValid: &chainhash.Hash{1},
+			node:        node(10),
+		},
+		{
+			name:        "ancestor",
+			assumeValid: &node(30).hash,
+			node:        node(10),
+			want:        true,
+		},
+		{
+			name:        "assume-valid block",
+			assumeValid: &node(30).hash,
+			node:        node(30),
+			want:        true,
+		},
+		{
+			name:        "descendant",
+			assumeValid: &node(30).hash,
+			node:        node(31),
+		},
+		{
+			name:        "buried deep enough",
+			assumeValid: &node(40).hash,
+			node:        node(36),
+			want:        true,
+		},
+		{
+			name:        "not buried deep enough",
+			assumeValid: &node(40).hash,
+			node:        node(37),
+		},
+		{
+			name:        "side chain",
+			assumeValid: &node(30).hash,
+			node:        sideChain[0],
+		},
+		{
+			name:        "minimum chain work",
+			assumeValid: &node(30).hash,
+			minWork:     bestHeader.workSum,
+			node:        node(10),
+			want:        true,
+		},
+		{
+			name:        "below minimum chain work",
+			assumeValid: &node(30).hash,
+			minWork:     new(big.Int).Add(bestHeader.workSum, big.NewInt(1)),
+			node:        node(10),
+		},
+	}
+
+	for _, test := range tests {
+		chain.assumeValid = test.assumeValid
+		chain.chainParams.MinimumChainWork = test.minWork
+		if got := chain.isAssumedValid(test.node); got != test.want {
+			t.Errorf("%s: isAssumedValid: got %v, want %v", test.name,
+				got, test.want)
+		}
+		if got := chain.skipScripts(test.node); got != test.want {
+			t.Errorf("%s: skipScripts: got %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+
+	// The assumption is reported to be in effect for the next block of
+	// the main chain.
+	chain.assumeValid = &node(30).hash
+	chain.chainParams.MinimumChainWork = nil
+	hash, active := chain.AssumeValid()
+	if *hash != node(30).hash || !active {
+		t.Fatalf("AssumeValid: got %v, %v", hash, active)
+	}
+
+	// Nothing is assumed valid once the best header is known to be
+	// invalid.
+	chain.index.SetStatusFlags(bestHeader, statusValidateFailed)
+	if chain.isAssumedValid(node(10)) {
+		t.Fatalf("isAssumedValid: block assumed valid with an invalid " +
+			"best header")
+	}
+	chain.index.UnsetStatusFlags(bestHeader, statusValidateFailed)
+
+	// The scripts of the blocks covered by a checkpoint are skipped
+	// regardless of the assume-valid block.
+	chain.assumeValid = nil
+	chain.checkpoints = []chaincfg.Checkpoint{
+		{Height: 50, Hash: &node(50).hash},
+	}
+	if !chain.skipScripts(node(50)) || chain.skipScripts(node(51)) {
+		t.Fatalf("skipScripts: scripts of the blocks covered by the " +
+			"checkpoint not skipped")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// utxoOverhead is the estimated number of bytes each unspent transaction output
+// takes in the utxo set in addition to the serialized output.  It accounts for
+// the outpoint, the height, and the coinbase flag.
+const utxoOverhead = 41
+
+// feeRatePercentiles are the percentiles of the fee rates of the transactions
+// in a block, weighted by transaction weight, that BlockStats reports.
+var feeRatePercentiles = [5]int64{10, 25, 50, 75, 90}
+
+// BlockStats houses statistics about a block and its transactions.  Unless
+// noted otherwise, the coinbase transaction is not included in the statistics.
+// Amounts are in satoshi, and fee rates in satoshi per virtual byte.
+type BlockStats struct {
+	Height int32
+	Time   int64
+
+	// Txs is the number of transactions including the coinbase.  Ins is the
+	// number of inputs, and Outs the number of outputs including the ones
+	// of the coinbase.
+	Txs  int64
+	Ins  int64
+	Outs int64
+
+	TotalSize   int64
+	TotalWeight int64
+	MinTxSize   int64
+	MaxTxSize   int64
+
+	// SegWitTxs is the number of transactions with witness data, whose
+	// total size and weight are SegWitTotalSize and SegWitTotalWeight.
+	SegWitTxs         int64
+	SegWitTotalSize   int64
+	SegWitTotalWeight int64
+
+	TotalFee  int64
+	MinFee    int64
+	MaxFee    int64
+	MedianFee int64
+
+	// MinFeeRate and MaxFeeRate are the lowest and highest fee rates, and
+	// FeeRatePercentiles the 10th, 25th, 50th, 75th, and 90th percentiles
+	// of the fee rates, weighted by transaction weight.
+	MinFeeRate         int64
+	MaxFeeRate         int64
+	FeeRatePercentiles [5]int64
+
+	// TotalOut is the amount of all outputs, and Subsidy the block subsidy
+	// the coinbase is allowed to claim in addition to the fees.
+	TotalOut int64
+	Subsidy  int64
+
+	// UtxoIncrease is the change in the number of unspent transaction
+	// outputs, and UtxoSizeIncrease the estimated change in the size of the
+	// utxo set in bytes.  They include the outputs of the coinbase.
+	UtxoIncrease     int64
+	UtxoSizeIncrease int64
+
+	// Claims, Supports and Updates are the number of outputs with the
+	// respective claim scripts, including the ones of the coinbase, and
+	// Staked is their total amount.
+	Claims   int64
+	Supports int64
+	Updates  int64
+	Staked   int64
+}
+
+// utxoSize returns the estimated number of bytes an unspent transaction output
+// with the passed script takes in the utxo set.
+func utxoSize(pkScript []byte) int64 {
+	txOut := wire.TxOut{PkScript: pkScript}
+	return int64(txOut.SerializeSize() + utxoOverhead)
+}
+
+// CalcBlockStats calculates the statistics of the passed block, whose height
+// must be set.  The spent transaction outputs are the ones of the spend journal
+// of the block, in the order the inputs of its transactions spend them.
+func CalcBlockStats(block *btcutil.Block, stxos []SpentTxOut, chainParams *chaincfg.Params) (*BlockStats, error) {
+	stats := &BlockStats{
+		Height:  block.Height(),
+		Time:    block.MsgBlock().Header.Timestamp.Unix(),
+		Txs:     int64(len(block.Transactions())),
+		Subsidy: CalcBlockSubsidy(block.Height(), chainParams),
+	}
+
+	type txFeeRate struct {
+		feeRate int64
+		weight  int64
+	}
+	var fees []int64
+	var feeRates []txFeeRate
+	stxoIdx := 0
+	for i, tx := range block.Transactions() {
+		msgTx := tx.MsgTx()
+		stats.Outs += int64(len(msgTx.TxOut))
+
+		var outAmount int64
+		for _, txOut := range msgTx.TxOut {
+			outAmount += txOut.Value
+			if !txscript.IsUnspendable(txOut.PkScript) {
+				stats.UtxoIncrease++
+				stats.UtxoSizeIncrease += utxoSize(txOut.PkScript)
+			}
+
+			if len(txOut.PkScript) == 0 {
+				continue
+			}
+			cs, err := txscript.DecodeClaimScript(txOut.PkScript)
+			if err != nil {
+				continue
+			}
+			switch cs.Opcode() {
+			case txscript.OP_CLAIMNAME:
+				stats.Claims++
+			case txscript.OP_SUPPORTCLAIM:
+				stats.Supports++
+			case txscript.OP_UPDATECLAIM:
+				stats.Updates++
+			}
+			stats.Staked += txOut.Value
+		}
+
+		// The coinbase only counts towards the number of outputs and the
+		// utxo set.
+		if i == 0 {
+			continue
+		}
+
+		var inAmount int64
+		for range msgTx.TxIn {
+			if stxoIdx >= len(stxos) {
+				return nil, AssertError("the spend journal " +
+					"doesn't match the inputs of the block")
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+			inAmount += stxo.Amount
+			stats.UtxoIncrease--
+			stats.UtxoSizeIncrease -= utxoSize(stxo.PkScript)
+		}
+		stats.Ins += int64(len(msgTx.TxIn))
+		stats.TotalOut += outAmount
+
+		size := int64(msgTx.SerializeSize())
+		weight := GetTransactionWeight(tx)
+		stats.TotalSize += size
+		stats.TotalWeight += weight
+		if stats.MinTxSize == 0 || size < stats.MinTxSize {
+			stats.MinTxSize = size
+		}
+		if size > stats.MaxTxSize {
+			stats.MaxTxSize = size
+		}
+		if msgTx.HasWitness() {
+			stats.SegWitTxs++
+			stats.SegWitTotalSize += size
+			stats.SegWitTotalWeight += weight
+		}
+
+		fee := inAmount - outAmount
+		feeRate := fee * WitnessScaleFactor / weight
+		stats.TotalFee += fee
+		fees = append(fees, fee)
+		feeRates = append(feeRates, txFeeRate{feeRate, weight})
+	}
+	if stxoIdx != len(stxos) {
+		return nil, AssertError("the spend journal doesn't match the " +
+			"inputs of the block")
+	}
+	if len(fees) == 0 {
+		return stats, nil
+	}
+
+	sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+	stats.MinFee = fees[0]
+	stats.MaxFee = fees[len(fees)-1]
+	stats.MedianFee = fees[len(fees)/2]
+	if len(fees)%2 == 0 {
+		stats.MedianFee = (fees[len(fees)/2-1] + fees[len(fees)/2]) / 2
+	}
+
+	// The fee rate percentiles are weighted by the transaction weights, so
+	// the median is the fee rate paid by the transaction which occupies the
+	// middle of the block space used by the transactions.
+	sort.Slice(feeRates, func(i, j int) bool {
+		return feeRates[i].feeRate < feeRates[j].feeRate
+	})
+	stats.MinFeeRate = feeRates[0].feeRate
+	stats.MaxFeeRate = feeRates[len(feeRates)-1].feeRate
+	var cumulativeWeight int64
+	p := 0
+	for _, fr := range feeRates {
+		cumulativeWeight += fr.weight
+		for p < len(feeRatePercentiles) && cumulativeWeight >=
+			stats.TotalWeight*feeRatePercentiles[p]/100 {
+
+			stats.FeeRatePercentiles[p] = fr.feeRate
+			p++
+		}
+	}
+	for ; p < len(feeRatePercentiles); p++ {
+		stats.FeeRatePercentiles[p] = stats.MaxFeeRate
+	}
+
+	return stats, nil
+}
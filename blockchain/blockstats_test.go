@@ -0,0 +1,95 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestCalcBlockStats ensures the statistics of a block are calculated from its
+// transactions and the outputs they spend.
+func TestCalcBlockStats(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	p2pkh := []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}
+	p2pkh = append(p2pkh, make([]byte, 20)...)
+	p2pkh = append(p2pkh, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+	claimScript, err := txscript.ClaimNameScript("name", "value")
+	if err != nil {
+		t.Fatalf("ClaimNameScript: unexpected error: %v", err)
+	}
+	claimScript = append(claimScript, p2pkh...)
+
+	// Construct a block with a coinbase and two transactions which pay fees
+	// of 100 and 500, the second of which creates a claim.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), []byte{0x51, 0x51}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(CalcBlockSubsidy(1, params)+600, p2pkh))
+	tx1 := wire.NewMsgTx(wire.TxVersion)
+	tx1.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	tx1.AddTxOut(wire.NewTxOut(900, p2pkh))
+	tx2 := wire.NewMsgTx(wire.TxVersion)
+	tx2.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil, nil))
+	tx2.AddTxOut(wire.NewTxOut(1500, claimScript))
+	msgBlock := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{},
+		&chainhash.Hash{}, &chainhash.Hash{}, 0, 0))
+	msgBlock.Header.Timestamp = time.Unix(1530000000, 0)
+	msgBlock.AddTransaction(coinbase)
+	msgBlock.AddTransaction(tx1)
+	msgBlock.AddTransaction(tx2)
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(1)
+	stxos := []SpentTxOut{
+		{Amount: 1000, PkScript: p2pkh, Height: 1},
+		{Amount: 2000, PkScript: p2pkh, Height: 1},
+	}
+
+	stats, err := CalcBlockStats(block, stxos, params)
+	if err != nil {
+		t.Fatalf("CalcBlockStats: unexpected error: %v", err)
+	}
+	tests := []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"Txs", stats.Txs, 3},
+		{"Ins", stats.Ins, 2},
+		{"Outs", stats.Outs, 3},
+		{"TotalFee", stats.TotalFee, 600},
+		{"MinFee", stats.MinFee, 100},
+		{"MaxFee", stats.MaxFee, 500},
+		{"MedianFee", stats.MedianFee, 300},
+		{"TotalOut", stats.TotalOut, 2400},
+		{"Subsidy", stats.Subsidy, CalcBlockSubsidy(1, params)},
+		{"UtxoIncrease", stats.UtxoIncrease, 1},
+		{"UtxoSizeIncrease", stats.UtxoSizeIncrease, utxoSize(claimScript)},
+		{"Claims", stats.Claims, 1},
+		{"Staked", stats.Staked, 1500},
+		{"TotalSize", stats.TotalSize, int64(tx1.SerializeSize() +
+			tx2.SerializeSize())},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("CalcBlockStats: unexpected %s -- got %d, want %d",
+				test.name, test.got, test.want)
+		}
+	}
+
+	// A spend journal which doesn't match the inputs of the block must be
+	// rejected.
+	_, err = CalcBlockStats(block, stxos[:1], params)
+	if _, ok := err.(AssertError); !ok {
+		t.Fatalf("CalcBlockStats: unexpected error for mismatched "+
+			"spend journal: %v", err)
+	}
+}
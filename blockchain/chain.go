@@ -24,6 +24,11 @@ const (
 	// maxOrphanBlocks is the maximum number of orphan blocks that can be
 	// queued.
 	maxOrphanBlocks = 100
+
+	// defaultReorgWarnDepth is the number of disconnected blocks above
+	// which a reorganization of the main chain is logged as a warning when
+	// the configuration doesn't specify one.
+	defaultReorgWarnDepth = 6
 )
 
 // BlockLocator is used to help locate a specific block.  The algorithm for
@@ -102,6 +107,9 @@ type BlockChain struct {
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	hashCache           *txscript.HashCache
+	assumeValid         *chainhash.Hash
+	reorgWarnDepth      int32
+	interrupt           <-chan struct{}
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -115,6 +123,16 @@ type BlockChain struct {
 	// fields in this struct below this point.
 	chainLock sync.RWMutex
 
+	// commitLock protects the state of the main chain which has been
+	// committed by connecting or disconnecting blocks: the end of the best
+	// chain, the utxo cache and the utxo set, the spend journal, and the
+	// stored blocks.  Writers must hold the chain lock for writes as well,
+	// but only hold this lock while they change that state.  This allows
+	// the read-only functions which only depend on it to hold this lock
+	// instead of the chain lock, so they aren't blocked while a block is
+	// being validated.
+	commitLock sync.RWMutex
+
 	// These fields are related to the memory block index.  They both have
 	// their own locks, however they are often also protected by the chain
 	// lock to help prevent logic races when blocks are being processed.
@@ -127,6 +145,35 @@ type BlockChain struct {
 	index     *blockIndex
 	bestChain *chainView
 
+	// bestHeader tracks the chain of blocks with the most cumulative work
+	// which isn't known to be invalid, regardless of whether they have
+	// been connected to the main chain.
+	bestHeader *chainView
+
+	// assumeValidLogged indicates the script checks of blocks have been
+	// skipped since the chain was created, which is logged once.
+	assumeValidLogged bool
+
+	// utxoCache caches the unspent transaction outputs in memory and
+	// writes them to the database in batches.
+	utxoCache *utxoCache
+
+	// pruneTarget is the size in bytes the stored blocks are pruned to.
+	// Pruning is disabled when it is zero.
+	//
+	// pruned indicates blocks have been deleted from the database.
+	pruneTarget uint64
+	pruned      bool
+
+	// snapshot tracks the validation of the history below a loaded utxo
+	// snapshot, which happens in the background.  It is nil when no
+	// snapshot has been loaded, or its history has been validated.
+	//
+	// It is changed while holding both the chain lock and the snapshot
+	// lock for writes, so it may be read while holding either of them.
+	snapshotLock sync.RWMutex
+	snapshot     *snapshotValidation
+
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
 	orphanLock   sync.RWMutex
@@ -611,6 +658,7 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 		curTotalTxns+numTxns, node.CalcPastMedianTime())
 
 	// Atomically insert info into the database.
+	b.commitLock.Lock()
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -625,14 +673,6 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
-		if err != nil {
-			return err
-		}
-
 		// Update the transaction spend journal by adding a record for
 		// the block that contains all txos spent by it.
 		err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
@@ -653,16 +693,37 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 		return nil
 	})
 	if err != nil {
+		b.commitLock.Unlock()
 		return err
 	}
 
+	// Update the utxo cache using the state of the utxo view.  This entails
+	// removing all of the utxos spent and adding the new ones created by
+	// the block.  The cache writes them to the database once it grows too
+	// large or has not been flushed for a while.
+	b.utxoCache.commit(view)
+
 	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// now that the modifications have been committed to the utxo cache.
 	view.commit()
 
 	// This node is now the end of the best chain.
 	b.bestChain.SetTip(node)
 
+	if err := b.utxoCache.flush(flushPeriodic, &node.hash); err != nil {
+		b.commitLock.Unlock()
+		return err
+	}
+
+	// Prune the stored blocks whenever the utxo cache has just been
+	// flushed, which allows the blocks up to the new tip to be pruned.
+	if b.pruneTarget != 0 && b.utxoCache.lastFlushHash == node.hash {
+		if err := b.pruneBlocks(); err != nil {
+			b.commitLock.Unlock()
+			return err
+		}
+	}
+
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
 	// allows the old version to act as a snapshot which callers can use
@@ -671,6 +732,7 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 	b.stateLock.Lock()
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
+	b.commitLock.Unlock()
 
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
@@ -711,6 +773,16 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 		return err
 	}
 
+	// The utxo set is updated directly in the database below, so the utxo
+	// cache must not hold any entries.
+	b.commitLock.Lock()
+	err = b.utxoCache.flush(flushRequired, &node.hash)
+	if err != nil {
+		b.commitLock.Unlock()
+		return err
+	}
+	b.utxoCache.purge()
+
 	// Generate a new best state snapshot that will be used to update the
 	// database and later memory if all database updates are successful.
 	b.stateLock.RLock()
@@ -744,6 +816,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 		if err != nil {
 			return err
 		}
+		err = dbPutUtxoStateConsistency(dbTx, &prevNode.hash)
+		if err != nil {
+			return err
+		}
 
 		// Before we delete the spend journal entry for this back,
 		// we'll fetch it as is so the indexers can utilize if needed.
@@ -772,16 +848,21 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 		return nil
 	})
 	if err != nil {
+		b.commitLock.Unlock()
 		return err
 	}
 
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.commit()
+	b.utxoCache.lastFlushHash = prevNode.hash
 
-	// This node's parent is now the end of the best chain.
+	// This node's parent is now the end of the best chain.  The claimtrie
+	// has already been reset past it when the block is disconnected as part
+	// of a reorganize to another chain.
 	b.bestChain.SetTip(node.parent)
-	if err = b.ClaimTrie().Reset(claimtrie.Height(node.parent.height)); err != nil {
+	if err := b.resetClaimTrie(node.parent.height); err != nil {
+		b.commitLock.Unlock()
 		return err
 	}
 
@@ -793,6 +874,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	b.stateLock.Lock()
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
+	b.commitLock.Unlock()
 
 	// Notify the caller that the block was disconnected from the main
 	// chain.  The caller would typically want to react with actions such as
@@ -854,6 +936,29 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 	}
 
+	// The blocks up to a loaded utxo snapshot can't be disconnected before
+	// they have been validated, which provides their spend journal entries.
+	if sv := b.snapshot; sv != nil && detachNodes.Len() != 0 {
+		lastDetachNode := detachNodes.Back().Value.(*blockNode)
+		if lastDetachNode.height <= sv.node.height {
+			return fmt.Errorf("the blocks up to the utxo snapshot "+
+				"at height %d can't be disconnected before they "+
+				"have been validated", sv.node.height)
+		}
+	}
+
+	// Flush the utxo cache before disconnecting any blocks so the utxo set
+	// in the database is consistent with the current best chain.  This is
+	// required by the lookups of legacy spend journal entries below.
+	if detachNodes.Len() != 0 {
+		b.commitLock.Lock()
+		err := b.utxoCache.flush(flushRequired, &tip.hash)
+		b.commitLock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Track the old and new best chains heads.
 	oldBest := tip
 	newBest := tip
@@ -892,7 +997,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = view.fetchInputUtxos(b.db, block)
+		err = view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -912,7 +1017,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		detachBlocks = append(detachBlocks, block)
 		detachSpentTxOuts = append(detachSpentTxOuts, stxos)
 
-		err = view.disconnectTransactions(b.db, block, stxos)
+		err = view.disconnectTransactions(b.utxoCache, block, stxos)
 		if err != nil {
 			return err
 		}
@@ -927,6 +1032,34 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		forkNode = newBest
 	}
 
+	// Unlike the utxo set, the claimtrie can't be updated through a view,
+	// so it is reset to the fork point before the blocks to attach are
+	// checked, which applies their claims to it.  Should any of the checks
+	// fail, the claims of the detached blocks are applied again.
+	forkHeight := newBest.height
+	if forkNode != nil {
+		if err := b.resetClaimTrie(forkHeight); err != nil {
+			return err
+		}
+	}
+	replayDetached := func() error {
+		err := b.resetClaimTrie(forkHeight)
+		e := detachNodes.Back()
+		for i := len(detachBlocks) - 1; err == nil && i >= 0; i-- {
+			n := e.Value.(*blockNode)
+			err = b.replayClaimScripts(n, detachBlocks[i],
+				detachSpentTxOuts[i])
+			e = e.Prev()
+		}
+		return err
+	}
+	restoreClaimTrie := func() {
+		if err := replayDetached(); err != nil {
+			log.Errorf("Unable to restore the claimtrie to block %v: %v",
+				&oldBest.hash, err)
+		}
+	}
+
 	// Perform several checks to verify each block that needs to be attached
 	// to the main chain can be connected without violating any rules and
 	// without actually connecting the block.
@@ -949,6 +1082,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 			return err
 		})
 		if err != nil {
+			restoreClaimTrie()
 			return err
 		}
 
@@ -959,14 +1093,21 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() {
-			err = view.fetchInputUtxos(b.db, block)
+			err = view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
+				restoreClaimTrie()
 				return err
 			}
 			err = view.connectTransactions(block, nil)
 			if err != nil {
+				restoreClaimTrie()
 				return err
 			}
+			err = b.CheckClaimScripts(block, n, view)
+			if err != nil {
+				restoreClaimTrie()
+				return ruleError(ErrBadClaimTrie, err.Error())
+			}
 
 			newBest = n
 			continue
@@ -982,6 +1123,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// descendants as having an invalid ancestor.
 		err = b.checkConnectBlock(n, block, view, nil)
 		if err != nil {
+			restoreClaimTrie()
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
 				for de := e.Next(); de != nil; de = de.Next() {
@@ -1004,6 +1146,17 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	view = NewUtxoViewpoint()
 	view.SetBestHash(&b.bestChain.Tip().hash)
 
+	// The claims of the attached blocks are applied again as they are
+	// connected below.  Until then, the claimtrie has to follow the blocks
+	// being disconnected, since the chain lock is released to notify each
+	// of them, so the claims of the detached blocks are applied again and
+	// each disconnect resets the claimtrie to the parent of its block.
+	if forkNode != nil {
+		if err := replayDetached(); err != nil {
+			return err
+		}
+	}
+
 	// Disconnect blocks from the main chain.
 	for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
 		n := e.Value.(*blockNode)
@@ -1011,14 +1164,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
 
 		// Update the view to unspend all of the spent txos and remove
 		// the utxos created by the block.
-		err = view.disconnectTransactions(b.db, block,
+		err = view.disconnectTransactions(b.utxoCache, block,
 			detachSpentTxOuts[i])
 		if err != nil {
 			return err
@@ -1038,7 +1191,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1052,6 +1205,10 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		if err != nil {
 			return err
 		}
+		err = b.CheckClaimScripts(block, n, view)
+		if err != nil {
+			return err
+		}
 
 		// Update the database and chain state.
 		err = b.connectBlock(n, block, view, stxos)
@@ -1061,16 +1218,38 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	}
 
 	// Log the point where the chain forked and old and new best chain
-	// heads.
+	// heads.  Reorganizations deeper than the configured depth are logged
+	// as warnings since they might indicate an attack or a split network.
+	logf := log.Infof
+	if int32(detachNodes.Len()) > b.reorgWarnDepth {
+		logf = log.Warnf
+		logf("REORGANIZE: Disconnected %d blocks from the main chain",
+			detachNodes.Len())
+	}
 	if forkNode != nil {
-		log.Infof("REORGANIZE: Chain forks at %v (height %v)", forkNode.hash,
+		logf("REORGANIZE: Chain forks at %v (height %v)", forkNode.hash,
 			forkNode.height)
 	}
-	log.Infof("REORGANIZE: Old best chain head was %v (height %v)",
+	logf("REORGANIZE: Old best chain head was %v (height %v)",
 		&oldBest.hash, oldBest.height)
-	log.Infof("REORGANIZE: New best chain head is %v (height %v)",
+	logf("REORGANIZE: New best chain head is %v (height %v)",
 		newBest.hash, newBest.height)
 
+	// Notify the caller about the whole reorganization once all of the
+	// blocks have been disconnected and connected.
+	if detachNodes.Len() != 0 {
+		lastDetachNode := detachNodes.Back().Value.(*blockNode)
+		reorg := &ChainReorganization{
+			ForkHash:       lastDetachNode.parent.hash,
+			ForkHeight:     lastDetachNode.parent.height,
+			DetachedBlocks: detachBlocks,
+			AttachedBlocks: attachBlocks,
+		}
+		b.chainLock.Unlock()
+		b.sendNotification(NTChainReorganized, reorg)
+		b.chainLock.Lock()
+	}
+
 	return nil
 }
 
@@ -1137,7 +1316,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := view.fetchInputUtxos(b.db, block)
+			err := view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
@@ -1221,6 +1400,42 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 	return err == nil, err
 }
 
+// findBestHeader returns the block node with the most cumulative work which is
+// not known to be invalid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) findBestHeader() *blockNode {
+	b.index.RLock()
+	defer b.index.RUnlock()
+
+	best := b.bestChain.Tip()
+	for _, node := range b.index.index {
+		if node.workSum.Cmp(best.workSum) > 0 &&
+			!node.status.KnownInvalid() {
+
+			best = node
+		}
+	}
+	return best
+}
+
+// updateBestHeader makes the passed node the end of the best header chain when
+// it has more cumulative work, or the current end is known to be invalid.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) updateBestHeader(node *blockNode) {
+	tip := b.bestHeader.Tip()
+	if b.index.NodeStatus(tip).KnownInvalid() {
+		b.bestHeader.SetTip(b.findBestHeader())
+		tip = b.bestHeader.Tip()
+	}
+	if node.workSum.Cmp(tip.workSum) > 0 &&
+		!b.index.NodeStatus(node).KnownInvalid() {
+
+		b.bestHeader.SetTip(node)
+	}
+}
+
 // isCurrent returns whether or not the chain believes it is current.  Several
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
@@ -1302,10 +1517,10 @@ func (b *BlockChain) MainChainHasBlock(hash *chainhash.Hash) bool {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BlockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
-	b.chainLock.RLock()
+	b.commitLock.RLock()
 	node := b.index.LookupNode(hash)
 	locator := b.bestChain.blockLocator(node)
-	b.chainLock.RUnlock()
+	b.commitLock.RUnlock()
 	return locator
 }
 
@@ -1314,12 +1529,82 @@ func (b *BlockChain) BlockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) LatestBlockLocator() (BlockLocator, error) {
-	b.chainLock.RLock()
+	b.commitLock.RLock()
 	locator := b.bestChain.BlockLocator(nil)
-	b.chainLock.RUnlock()
+	b.commitLock.RUnlock()
 	return locator, nil
 }
 
+// LatestHeaderLocator returns a block locator for the end of the best header
+// chain, which might be ahead of the main chain when the headers of blocks
+// have been processed before the blocks themselves.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LatestHeaderLocator() BlockLocator {
+	// The chain view is locked while the locator is built, so the chain
+	// lock isn't needed.
+	return b.bestHeader.BlockLocator(nil)
+}
+
+// BestHeader returns the hash and height of the end of the best header chain,
+// which is the chain with the most cumulative work that isn't known to be
+// invalid, regardless of whether its blocks are available.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BestHeader() (*chainhash.Hash, int32) {
+	tip := b.bestHeader.Tip()
+	return &tip.hash, tip.height
+}
+
+// BlocksToDownload returns the hashes of up to maxBlocks blocks of the best
+// header chain which are not part of the main chain and whose data is not
+// stored yet, in order of height.  These are the blocks which need to be
+// downloaded to make the best header chain the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlocksToDownload(maxBlocks int) []*chainhash.Hash {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	tip := b.bestHeader.Tip()
+	fork := b.bestChain.FindFork(tip)
+	if fork == nil {
+		return nil
+	}
+
+	var hashes []*chainhash.Hash
+	for height := fork.height + 1; height <= tip.height; height++ {
+		if len(hashes) >= maxBlocks {
+			break
+		}
+		node := b.bestHeader.NodeByHeight(height)
+		if !b.index.NodeStatus(node).HaveData() {
+			hashes = append(hashes, &node.hash)
+		}
+	}
+
+	// The blocks below a loaded utxo snapshot are downloaded afterwards,
+	// within the same window after the last one validated.
+	sv := b.snapshot
+	if sv == nil || sv.invalid {
+		return hashes
+	}
+	end := sv.tip.height + int32(maxBlocks)
+	if end > sv.node.height {
+		end = sv.node.height
+	}
+	for height := sv.tip.height + 1; height <= end; height++ {
+		if len(hashes) >= maxBlocks {
+			break
+		}
+		node := b.bestChain.NodeByHeight(height)
+		if !b.index.NodeStatus(node).HaveData() {
+			hashes = append(hashes, &node.hash)
+		}
+	}
+	return hashes
+}
+
 // BlockHeightByHash returns the height of the block with the given hash in the
 // main chain.
 //
@@ -1334,6 +1619,20 @@ func (b *BlockChain) BlockHeightByHash(hash *chainhash.Hash) (int32, error) {
 	return node.height, nil
 }
 
+// BlockMedianTimeByHash returns the median time of the few blocks prior to,
+// and including, the block with the given hash in the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockMedianTimeByHash(hash *chainhash.Hash) (time.Time, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return time.Time{}, errNotInMainChain(str)
+	}
+
+	return node.CalcPastMedianTime(), nil
+}
+
 // BlockHashByHeight returns the hash of the block at the given height in the
 // main chain.
 //
@@ -1493,7 +1792,8 @@ func (b *BlockChain) IntervalBlockHashes(endHash *chainhash.Hash, interval int,
 // This is primarily a helper function for the locateBlocks and locateHeaders
 // functions.
 //
-// This function MUST be called with the chain state lock held (for reads).
+// This function MUST be called with either the chain state lock or the commit
+// lock held (for reads).
 func (b *BlockChain) locateInventory(locator BlockLocator, hashStop *chainhash.Hash, maxEntries uint32) (*blockNode, uint32) {
 	// There are no block locators so a specific block is being requested
 	// as identified by the stop hash.
@@ -1547,7 +1847,8 @@ func (b *BlockChain) locateInventory(locator BlockLocator, hashStop *chainhash.H
 //
 // See the comment on the exported function for more details on special cases.
 //
-// This function MUST be called with the chain state lock held (for reads).
+// This function MUST be called with either the chain state lock or the commit
+// lock held (for reads).
 func (b *BlockChain) locateBlocks(locator BlockLocator, hashStop *chainhash.Hash, maxHashes uint32) []chainhash.Hash {
 	// Find the node after the first known block in the locator and the
 	// total number of nodes after it needed while respecting the stop hash
@@ -1580,9 +1881,9 @@ func (b *BlockChain) locateBlocks(locator BlockLocator, hashStop *chainhash.Hash
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) LocateBlocks(locator BlockLocator, hashStop *chainhash.Hash, maxHashes uint32) []chainhash.Hash {
-	b.chainLock.RLock()
+	b.commitLock.RLock()
 	hashes := b.locateBlocks(locator, hashStop, maxHashes)
-	b.chainLock.RUnlock()
+	b.commitLock.RUnlock()
 	return hashes
 }
 
@@ -1592,7 +1893,8 @@ func (b *BlockChain) LocateBlocks(locator BlockLocator, hashStop *chainhash.Hash
 //
 // See the comment on the exported function for more details on special cases.
 //
-// This function MUST be called with the chain state lock held (for reads).
+// This function MUST be called with either the chain state lock or the commit
+// lock held (for reads).
 func (b *BlockChain) locateHeaders(locator BlockLocator, hashStop *chainhash.Hash, maxHeaders uint32) []wire.BlockHeader {
 	// Find the node after the first known block in the locator and the
 	// total number of nodes after it needed while respecting the stop hash
@@ -1625,9 +1927,9 @@ func (b *BlockChain) locateHeaders(locator BlockLocator, hashStop *chainhash.Has
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) LocateHeaders(locator BlockLocator, hashStop *chainhash.Hash) []wire.BlockHeader {
-	b.chainLock.RLock()
+	b.commitLock.RLock()
 	headers := b.locateHeaders(locator, hashStop, wire.MaxBlockHeadersPerMsg)
-	b.chainLock.RUnlock()
+	b.commitLock.RUnlock()
 	return headers
 }
 
@@ -1689,6 +1991,14 @@ type Config struct {
 	// checkpoints.
 	Checkpoints []chaincfg.Checkpoint
 
+	// AssumeValid is the hash of a block whose scripts, along with the
+	// ones of its ancestors, are assumed to be valid.  The scripts of those
+	// blocks aren't checked when the block is in the best header chain and
+	// is buried deep enough.
+	//
+	// This field can be nil to check the scripts of all blocks.
+	AssumeValid *chainhash.Hash
+
 	// TimeSource defines the median time source to use for things such as
 	// block processing and determining whether or not the chain is current.
 	//
@@ -1722,6 +2032,38 @@ type Config struct {
 	// This field can be nil if the caller is not interested in using a
 	// signature cache.
 	HashCache *txscript.HashCache
+
+	// UtxoCacheMaxSize defines the maximum size in bytes of the cache of
+	// unspent transaction outputs.  The cached outputs are written to the
+	// database when the cache grows larger.  Callers must call
+	// FlushUtxoCache before closing the database.
+	//
+	// A default size of 250 MiB is used when this field is zero.
+	UtxoCacheMaxSize uint64
+
+	// Prune defines the size in bytes the stored blocks are pruned to.
+	// The oldest blocks are deleted once the stored blocks grow larger,
+	// except for the last MinBlocksToKeep blocks of the main chain.  The
+	// target may be exceeded by the blocks connected between flushes of
+	// the utxo cache.
+	//
+	// Pruning is disabled when this field is zero.  Once a database has
+	// been pruned, it must remain enabled.
+	Prune uint64
+
+	// ReorgWarnDepth defines the number of disconnected blocks above which
+	// a reorganization of the main chain is logged as a warning rather
+	// than informational.
+	//
+	// A default depth of 6 blocks is used when this field is zero.
+	ReorgWarnDepth int32
+
+	// ClaimTrie defines the ClaimTrie which tracks the claims of the main
+	// chain.  It must be consistent with the chain state in the database.
+	//
+	// The ClaimTrie in the default data directory is opened when this
+	// field is nil.
+	ClaimTrie *claimtrie.ClaimTrie
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1755,6 +2097,11 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	reorgWarnDepth := config.ReorgWarnDepth
+	if reorgWarnDepth == 0 {
+		reorgWarnDepth = defaultReorgWarnDepth
+	}
+
 	params := config.ChainParams
 	targetTimespan := int64(params.TargetTimespan / time.Second)
 	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
@@ -1770,12 +2117,19 @@ func New(config *Config) (*BlockChain, error) {
 		maxRetargetTimespan: targetTimespan + (targetTimespan / 2),
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		index:               newBlockIndex(config.DB, params),
+		utxoCache:           newUtxoCache(config.DB, utxoSetBucketName,
+			utxoStateConsistencyKeyName, config.UtxoCacheMaxSize),
+		pruneTarget:         config.Prune,
 		hashCache:           config.HashCache,
+		assumeValid:         config.AssumeValid,
+		reorgWarnDepth:      reorgWarnDepth,
+		interrupt:           config.Interrupt,
 		bestChain:           newChainView(nil),
+		bestHeader:          newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
 		warningCaches:       newThresholdCaches(vbNumBits),
-		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
+		deploymentCaches:    newThresholdCaches(uint32(len(params.Deployments))),
 	}
 
 	// Initialize the chain state from the passed database.  When the db
@@ -1784,6 +2138,13 @@ func New(config *Config) (*BlockChain, error) {
 	if err := b.initChainState(); err != nil {
 		return nil, err
 	}
+	b.bestHeader.SetTip(b.findBestHeader())
+
+	// Discard the outputs of a utxo snapshot which weren't loaded
+	// completely before the last shutdown.
+	if err := b.discardIncompleteUtxoSnapshot(); err != nil {
+		return nil, err
+	}
 
 	// Helper function to insert the output in genesis block in to the
 	// transaction database.
@@ -1799,6 +2160,34 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Bring the utxo set up to date with the best chain in case the utxo
+	// cache wasn't flushed before the last shutdown.
+	if err := b.initUtxoCache(config.Interrupt); err != nil {
+		return nil, err
+	}
+
+	// Resume the validation of the blocks below a loaded utxo snapshot.
+	if err := b.initUtxoSnapshot(); err != nil {
+		return nil, err
+	}
+
+	// A pruned database no longer has the full history of the chain, so
+	// it can only be used with pruning enabled.
+	pruned, err := b.db.BeenPruned()
+	if err != nil {
+		return nil, err
+	}
+	if pruned && b.pruneTarget == 0 {
+		return nil, AssertError("blockchain.New the database has been " +
+			"pruned, so pruning must be enabled")
+	}
+	b.pruned = pruned
+	if b.pruneTarget != 0 {
+		if err := b.pruneBlocks(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Perform any upgrades to the various chain-specific buckets as needed.
 	if err := b.maybeUpgradeDbBuckets(config.Interrupt); err != nil {
 		return nil, err
@@ -1820,15 +2209,66 @@ func New(config *Config) (*BlockChain, error) {
 
 	bestNode := b.bestChain.Tip()
 
-	ct, err := claimtrie.New()
-	if err != nil {
-		log.Criticalf("can't create ClaimTrie, err %s", err)
+	ct := config.ClaimTrie
+	if ct == nil {
+		ct, err = claimtrie.New()
+		if err != nil {
+			log.Criticalf("can't create ClaimTrie, err %s", err)
+		}
 	}
 	b.claimTrie = ct
 
+	// The ClaimTrie is saved separately from the chain state, so it might
+	// not be at the end of the main chain after an unclean shutdown.  It is
+	// rewound when it is ahead of the main chain, and caught up by
+	// replaying the claims of the missing blocks when it is behind.  A
+	// ClaimTrie imported from a snapshot beyond the end of the main chain
+	// is only rewound to the snapshot, since the claims of the blocks up to
+	// it are skipped as they are connected.
+	if ct != nil {
+		height := claimtrie.Height(bestNode.height)
+		switch {
+		case ct.Base() > height:
+			if ct.Height() > ct.Base() {
+				log.Infof("Rewinding ClaimTrie from height %d to "+
+					"the snapshot at height %d", ct.Height(),
+					ct.Base())
+				if err := ct.Reset(ct.Base()); err != nil {
+					return nil, err
+				}
+			}
+
+		case ct.Height() > height:
+			log.Infof("Rewinding ClaimTrie from height %d to %d",
+				ct.Height(), height)
+			if err := ct.Reset(height); err != nil {
+				return nil, err
+			}
+			if bestNode.parent != nil && *ct.MerkleHash() != bestNode.claimTrie {
+				return nil, AssertError(fmt.Sprintf("ClaimTrie "+
+					"root %v at height %d does not match "+
+					"the root %v of the main chain",
+					ct.MerkleHash(), height,
+					bestNode.claimTrie))
+			}
+
+		case ct.Height() < height:
+			if err := b.replayClaims(int32(ct.Height()) + 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	log.Infof("Chain state (height %d, hash %v, totaltx %d, work %v)",
 		bestNode.height, bestNode.hash, b.stateSnapshot.TotalTxns,
 		bestNode.workSum)
+	if b.assumeValid != nil {
+		log.Infof("Assuming the scripts of block %v and its ancestors "+
+			"are valid", b.assumeValid)
+	}
+	if sv := b.snapshot; sv != nil && !sv.invalid {
+		go b.validateSnapshotHistory(sv)
+	}
 
 	return &b, nil
 }
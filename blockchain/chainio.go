@@ -51,6 +51,10 @@ var (
 	// chain state.
 	chainStateKeyName = []byte("chainstate")
 
+	// utxoStateConsistencyKeyName is the name of the db key used to store
+	// the hash of the block the utxo set is consistent with.
+	utxoStateConsistencyKeyName = []byte("utxostateconsistency")
+
 	// spendJournalVersionKeyName is the name of the db key used to store
 	// the version of the spend journal currently in the database.
 	spendJournalVersionKeyName = []byte("spendjournalversion")
@@ -260,8 +264,8 @@ type SpentTxOut struct {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) FetchSpendJournal(targetBlock *btcutil.Block) ([]SpentTxOut, error) {
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
 
 	var spendEntries []SpentTxOut
 	err := b.db.View(func(dbTx database.Tx) error {
@@ -692,17 +696,18 @@ func deserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 	return entry, nil
 }
 
-// dbFetchUtxoEntryByHash attempts to find and fetch a utxo for the given hash.
-// It uses a cursor and seek to try and do this as efficiently as possible.
+// dbFetchUtxoEntryByHash attempts to find and fetch a utxo for the given hash
+// from the utxo set in the bucket with the given name.  It uses a cursor and
+// seek to try and do this as efficiently as possible.
 //
 // When there are no entries for the provided hash, nil will be returned for the
 // both the entry and the error.
-func dbFetchUtxoEntryByHash(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry, error) {
+func dbFetchUtxoEntryByHash(dbTx database.Tx, bucketName []byte, hash *chainhash.Hash) (*UtxoEntry, error) {
 	// Attempt to find an entry by seeking for the hash along with a zero
 	// index.  Due to the fact the keys are serialized as <hash><index>,
 	// where the index uses an MSB encoding, if there are any entries for
 	// the hash at all, one will be found.
-	cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	cursor := dbTx.Metadata().Bucket(bucketName).Cursor()
 	key := outpointKey(wire.OutPoint{Hash: *hash, Index: 0})
 	ok := cursor.Seek(*key)
 	recycleOutpointKey(key)
@@ -725,15 +730,15 @@ func dbFetchUtxoEntryByHash(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry,
 }
 
 // dbFetchUtxoEntry uses an existing database transaction to fetch the specified
-// transaction output from the utxo set.
+// transaction output from the utxo set in the bucket with the given name.
 //
 // When there is no entry for the provided output, nil will be returned for both
 // the entry and the error.
-func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, error) {
+func dbFetchUtxoEntry(dbTx database.Tx, bucketName []byte, outpoint wire.OutPoint) (*UtxoEntry, error) {
 	// Fetch the unspent transaction output information for the passed
 	// transaction output.  Return now when there is no entry.
 	key := outpointKey(outpoint)
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	utxoBucket := dbTx.Metadata().Bucket(bucketName)
 	serializedUtxo := utxoBucket.Get(*key)
 	recycleOutpointKey(key)
 	if serializedUtxo == nil {
@@ -999,6 +1004,25 @@ func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) err
 	return dbTx.Metadata().Put(chainStateKeyName, serializedData)
 }
 
+// dbPutUtxoStateConsistency uses an existing database transaction to record the
+// hash of the block the utxo set in the database is consistent with.
+func dbPutUtxoStateConsistency(dbTx database.Tx, hash *chainhash.Hash) error {
+	return dbTx.Metadata().Put(utxoStateConsistencyKeyName, hash[:])
+}
+
+// dbFetchUtxoStateConsistency uses an existing database transaction to fetch
+// the hash of the block the utxo set in the database is consistent with.
+//
+// When the hash has never been recorded, nil will be returned for both the hash
+// and the error.
+func dbFetchUtxoStateConsistency(dbTx database.Tx) (*chainhash.Hash, error) {
+	serialized := dbTx.Metadata().Get(utxoStateConsistencyKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	return chainhash.NewHash(serialized)
+}
+
 // createChainState initializes both the database and the chain state to the
 // genesis block.  This includes creating the necessary buckets and inserting
 // the genesis block, so it must only be called on an uninitialized database.
@@ -1092,6 +1116,12 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// The utxo set is consistent with the genesis block.
+		err = dbPutUtxoStateConsistency(dbTx, &node.hash)
+		if err != nil {
+			return err
+		}
+
 		// Store the genesis block into the database.
 		return dbStoreBlock(dbTx, genesisBlock)
 	})
@@ -1375,6 +1405,9 @@ func blockIndexKey(blockHash *chainhash.Hash, blockHeight uint32) []byte {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BlockByHeight(blockHeight int32) (*btcutil.Block, error) {
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
+
 	// Lookup the block height in the best chain.
 	node := b.bestChain.NodeByHeight(blockHeight)
 	if node == nil {
@@ -1397,6 +1430,9 @@ func (b *BlockChain) BlockByHeight(blockHeight int32) (*btcutil.Block, error) {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BlockByHash(hash *chainhash.Hash) (*btcutil.Block, error) {
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
+
 	// Lookup the block hash in block index and ensure it is in the best
 	// chain.
 	node := b.index.LookupNode(hash)
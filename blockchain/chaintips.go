@@ -0,0 +1,150 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ChainTipStatus describes the state of the branch which ends at a chain tip.
+type ChainTipStatus byte
+
+// These constants are used to identify the state of a chain tip.
+const (
+	// ChainTipActive is the status of the tip of the main chain.
+	ChainTipActive ChainTipStatus = iota
+
+	// ChainTipValidFork is the status of a side chain tip whose blocks
+	// have all been fully validated, typically because they were part of
+	// the main chain before a reorganization.
+	ChainTipValidFork
+
+	// ChainTipValidHeaders is the status of a side chain tip whose blocks
+	// have all been downloaded, but not all of them fully validated.
+	ChainTipValidHeaders
+
+	// ChainTipHeadersOnly is the status of a side chain tip for which not
+	// all of the blocks have been downloaded.
+	ChainTipHeadersOnly
+
+	// ChainTipInvalid is the status of a side chain tip when at least one
+	// of the blocks in its branch is known to be invalid.
+	ChainTipInvalid
+)
+
+// chainTipStatusStrings is a map of ChainTipStatus values back to the names
+// used by the getchaintips RPC.
+var chainTipStatusStrings = map[ChainTipStatus]string{
+	ChainTipActive:       "active",
+	ChainTipValidFork:    "valid-fork",
+	ChainTipValidHeaders: "valid-headers",
+	ChainTipHeadersOnly:  "headers-only",
+	ChainTipInvalid:      "invalid",
+}
+
+// String returns the ChainTipStatus as a human-readable name.
+func (s ChainTipStatus) String() string {
+	if str := chainTipStatusStrings[s]; str != "" {
+		return str
+	}
+	return fmt.Sprintf("Unknown ChainTipStatus (%d)", int(s))
+}
+
+// ChainTip describes a block of the block index which has no children, or the
+// tip of the main chain.
+type ChainTip struct {
+	// Hash is the hash of the block at the tip.
+	Hash chainhash.Hash
+
+	// Height is the height of the block at the tip.
+	Height int32
+
+	// BranchLen is the number of blocks between the tip and the block at
+	// which its branch forks from the main chain.  It is zero for the tip
+	// of the main chain.
+	BranchLen int32
+
+	// Status is the state of the branch.
+	Status ChainTipStatus
+}
+
+// chainTipStatus returns the state of the branch which ends at the passed node
+// and forks from the main chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) chainTipStatus(tip *blockNode) ChainTipStatus {
+	if b.bestChain.Contains(tip) {
+		return ChainTipActive
+	}
+
+	status := ChainTipValidFork
+	for n := tip; n != nil && !b.bestChain.Contains(n); n = n.parent {
+		nodeStatus := b.index.NodeStatus(n)
+		switch {
+		case nodeStatus.KnownInvalid():
+			return ChainTipInvalid
+		case !nodeStatus.HaveData():
+			status = ChainTipHeadersOnly
+		case !nodeStatus.KnownValid() && status == ChainTipValidFork:
+			status = ChainTipValidHeaders
+		}
+	}
+	return status
+}
+
+// ChainTips returns all of the tips of the block index, which are the blocks
+// without any children, along with the tip of the main chain, ordered by height
+// from the highest to the lowest.  They include the branches of which only the
+// headers are known, as well as the ones known to be invalid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() []ChainTip {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	b.index.RLock()
+	hasChildren := make(map[*blockNode]struct{}, len(b.index.index))
+	for _, n := range b.index.index {
+		if n.parent != nil {
+			hasChildren[n.parent] = struct{}{}
+		}
+	}
+	var tips []*blockNode
+	for _, n := range b.index.index {
+		if _, ok := hasChildren[n]; !ok {
+			tips = append(tips, n)
+		}
+	}
+	b.index.RUnlock()
+
+	// The tip of the main chain has children when the headers of the
+	// blocks after it are already known.
+	bestTip := b.bestChain.Tip()
+	if _, ok := hasChildren[bestTip]; ok {
+		tips = append(tips, bestTip)
+	}
+
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].height != tips[j].height {
+			return tips[i].height > tips[j].height
+		}
+		return tips[i].workSum.Cmp(tips[j].workSum) > 0
+	})
+
+	chainTips := make([]ChainTip, 0, len(tips))
+	for _, tip := range tips {
+		fork := b.bestChain.FindFork(tip)
+		chainTips = append(chainTips, ChainTip{
+			Hash:      tip.hash,
+			Height:    tip.height,
+			BranchLen: tip.height - fork.height,
+			Status:    b.chainTipStatus(tip),
+		})
+	}
+	return chainTips
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestChainTips ensures the tips of the block index are reported with the
+// expected branch lengths and statuses.
+func TestChainTips(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	genesis := chain.bestChain.Genesis()
+
+	// Construct a main chain with blocks at heights 1 through 5, followed
+	// by the header of the block at height 6, along with these side chains:
+	//  - two validated blocks after block 2
+	//  - one block after block 3 whose data is stored, but not validated
+	//  - a validated block after block 3 followed by a header
+	//  - an invalid block after block 4
+	mainChain := chainedNodes(genesis, 5)
+	validFork := chainedNodes(mainChain[1], 2)
+	dataFork := chainedNodes(mainChain[2], 1)
+	headersFork := chainedNodes(mainChain[2], 2)
+	invalidFork := chainedNodes(mainChain[3], 1)
+	headerAfterTip := chainedNodes(mainChain[4], 1)
+	for _, nodes := range [][]*blockNode{mainChain, validFork} {
+		for _, node := range nodes {
+			node.status = statusDataStored | statusValid
+			chain.index.AddNode(node)
+		}
+	}
+	dataFork[0].status = statusDataStored
+	chain.index.AddNode(dataFork[0])
+	headersFork[0].status = statusDataStored | statusValid
+	chain.index.AddNode(headersFork[0])
+	chain.index.AddNode(headersFork[1])
+	invalidFork[0].status = statusDataStored | statusValidateFailed
+	chain.index.AddNode(invalidFork[0])
+	chain.index.AddNode(headerAfterTip[0])
+	chain.bestChain.SetTip(tstTip(mainChain))
+
+	expected := map[*blockNode]ChainTip{
+		headerAfterTip[0]: {BranchLen: 1, Status: ChainTipHeadersOnly},
+		mainChain[4]:      {BranchLen: 0, Status: ChainTipActive},
+		invalidFork[0]:    {BranchLen: 1, Status: ChainTipInvalid},
+		headersFork[1]:    {BranchLen: 2, Status: ChainTipHeadersOnly},
+		dataFork[0]:       {BranchLen: 1, Status: ChainTipValidHeaders},
+		validFork[1]:      {BranchLen: 2, Status: ChainTipValidFork},
+	}
+
+	tips := chain.ChainTips()
+	if len(tips) != len(expected) {
+		t.Fatalf("ChainTips: unexpected number of tips -- got %d, "+
+			"want %d", len(tips), len(expected))
+	}
+	for i, tip := range tips {
+		if i > 0 && tip.Height > tips[i-1].Height {
+			t.Errorf("ChainTips: tip %v at height %d is not ordered "+
+				"by height", tip.Hash, tip.Height)
+		}
+
+		node := chain.index.LookupNode(&tip.Hash)
+		want, ok := expected[node]
+		if !ok {
+			t.Errorf("ChainTips: unexpected tip %v", tip.Hash)
+			continue
+		}
+		if tip.Height != node.height {
+			t.Errorf("ChainTips: unexpected height for tip %v -- "+
+				"got %d, want %d", tip.Hash, tip.Height,
+				node.height)
+		}
+		if tip.BranchLen != want.BranchLen {
+			t.Errorf("ChainTips: unexpected branch length for tip "+
+				"%v -- got %d, want %d", tip.Hash, tip.BranchLen,
+				want.BranchLen)
+		}
+		if tip.Status != want.Status {
+			t.Errorf("ChainTips: unexpected status for tip %v -- "+
+				"got %v, want %v", tip.Hash, tip.Status,
+				want.Status)
+		}
+	}
+}
@@ -55,6 +55,25 @@ func (b *BlockChain) LatestCheckpoint() *chaincfg.Checkpoint {
 	return &b.checkpoints[len(b.checkpoints)-1]
 }
 
+// IsCheckpointed returns whether the block with the passed hash is covered by
+// the latest checkpoint.  That is the case when it's the checkpoint block, or
+// one of its ancestors, in the best header chain.  The headers of such blocks
+// are known to link to the checkpoint, so some of the checks of their blocks
+// may be skipped.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsCheckpointed(hash *chainhash.Hash) bool {
+	checkpoint := b.LatestCheckpoint()
+	if checkpoint == nil {
+		return false
+	}
+	node := b.index.LookupNode(hash)
+	checkpointNode := b.bestHeader.NodeByHeight(checkpoint.Height)
+	return node != nil && checkpointNode != nil &&
+		checkpointNode.hash == *checkpoint.Hash &&
+		node.height <= checkpoint.Height && b.bestHeader.Contains(node)
+}
+
 // verifyCheckpoint returns whether the passed block height and hash combination
 // match the checkpoint data.  It also returns true if there is no checkpoint
 // data for the passed block height.
@@ -198,8 +217,8 @@ func isNonstandardTransaction(tx *btcutil.Tx) bool {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) IsCheckpointCandidate(block *btcutil.Block) (bool, error) {
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
 
 	// A checkpoint must be in the main chain.
 	node := b.index.LookupNode(block.Hash())
@@ -2,8 +2,11 @@ package blockchain
 
 import (
 	"fmt"
+	"io"
 
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -12,25 +15,131 @@ import (
 )
 
 func (b *BlockChain) CheckClaimScripts(block *btcutil.Block, node *blockNode, view *UtxoViewpoint) error {
+	return checkClaimScripts(b.claimTrie, block, node, view)
+}
+
+// checkClaimScripts applies the claims of the block to the passed ClaimTrie,
+// and ensures the resulting root matches the one in the header of the block.
+func checkClaimScripts(ct *claimtrie.ClaimTrie, block *btcutil.Block, node *blockNode, view *UtxoViewpoint) error {
 	ht := block.Height()
 
+	// The claims of the blocks up to an imported snapshot are already
+	// accounted for by the snapshot.
+	if claimtrie.Height(ht) <= ct.Base() {
+		return nil
+	}
+
+	if err := applyClaimScripts(ct, ht, block, view); err != nil {
+		return err
+	}
+	hash := ct.MerkleHash()
+
+	if node.claimTrie != *hash {
+		return fmt.Errorf("height: %d, ct.MerkleHash: %s != node.ClaimTrie: %s", ht, *hash, node.claimTrie)
+	}
+	return nil
+}
+
+// applyClaimScripts applies the claims of the block at the passed height to the
+// ClaimTrie and commits them at that height.  The view must contain the outputs
+// the block spends.
+func applyClaimScripts(ct *claimtrie.ClaimTrie, ht int32, block *btcutil.Block, view *UtxoViewpoint) error {
 	for _, tx := range block.Transactions() {
 		h := handler{ht, tx, view, map[string]bool{}}
-		if err := h.handleTxIns(b.claimTrie); err != nil {
+		if err := h.handleTxIns(ct); err != nil {
 			return err
 		}
-		if err := h.handleTxOuts(b.claimTrie); err != nil {
+		if err := h.handleTxOuts(ct); err != nil {
 			return err
 		}
 	}
 
-	b.claimTrie.Commit(claimtrie.Height(ht))
-	hash := b.claimTrie.MerkleHash()
+	ct.Commit(claimtrie.Height(ht))
+	return nil
+}
+
+// CalcTemplateClaimTrieRoot returns the ClaimTrie root for the header of the
+// passed block template, which is the root after its claims have been applied
+// on top of the end of the main chain.  The block must connect to the current
+// tip of the main chain.  The claims are applied to a scratch copy of the
+// ClaimTrie, so the one of the main chain is left untouched.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcTemplateClaimTrieRoot(block *btcutil.Block) (*chainhash.Hash, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
 
-	if node.claimTrie != *hash {
-		return fmt.Errorf("height: %d, ct.MerkleHash: %s != node.ClaimTrie: %s", ht, *hash, node.claimTrie)
+	tip := b.bestChain.Tip()
+	header := &block.MsgBlock().Header
+	if tip.hash != header.PrevBlock {
+		str := fmt.Sprintf("previous block must be the current chain tip %v, "+
+			"instead got %v", tip.hash, header.PrevBlock)
+		return nil, ruleError(ErrPrevBlockNotBest, str)
 	}
-	return nil
+
+	// The claims spent by the block are looked up in a view of the outputs
+	// it spends, including the ones created by the block itself.
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	err := view.fetchInputUtxos(b.utxoCache, block)
+	if err != nil {
+		return nil, err
+	}
+	err = view.connectTransactions(block, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := b.scratchClaimTrie(tip)
+	if err != nil {
+		return nil, err
+	}
+	defer ct.Close()
+
+	err = applyClaimScripts(ct, tip.height+1, block, view)
+	if err != nil {
+		return nil, ruleError(ErrBadClaimTrie, err.Error())
+	}
+	return ct.MerkleHash(), nil
+}
+
+// replayClaimScripts applies the claims of a block which was connected before
+// to the claimtrie.  The scripts of the outputs it spends are taken from its
+// spend journal entry since they might no longer be in the utxo set.
+func (b *BlockChain) replayClaimScripts(node *blockNode, block *btcutil.Block, stxos []SpentTxOut) error {
+	return replayClaimScripts(b.claimTrie, node, block, stxos)
+}
+
+// replayClaimScripts applies the claims of a block which was connected before
+// to the passed ClaimTrie, taking the outputs it spends from its spend journal
+// entry.
+func replayClaimScripts(ct *claimtrie.ClaimTrie, node *blockNode, block *btcutil.Block, stxos []SpentTxOut) error {
+	// Only the scripts of the spent outputs are needed to handle the
+	// claims.
+	view := NewUtxoViewpoint()
+	var stxoIdx int
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			if stxoIdx >= len(stxos) {
+				return AssertError(fmt.Sprintf("spend journal entry "+
+					"of block %v is missing outputs", node.hash))
+			}
+			stxo := &stxos[stxoIdx]
+			entry := &UtxoEntry{
+				amount:      stxo.Amount,
+				pkScript:    stxo.PkScript,
+				blockHeight: stxo.Height,
+				packedFlags: tfSpent,
+			}
+			if stxo.IsCoinBase {
+				entry.packedFlags |= tfCoinBase
+			}
+			view.entries[txIn.PreviousOutPoint] = entry
+			stxoIdx++
+		}
+	}
+
+	return checkClaimScripts(ct, block, node, view)
 }
 
 type handler struct {
@@ -116,3 +225,153 @@ func (h *handler) handleTxOuts(ct *claimtrie.ClaimTrie) error {
 	}
 	return nil
 }
+
+// ViewClaimTrie invokes fn with the ClaimTrie of the main chain while holding
+// the chain lock for reads, so no block is connected to or disconnected from
+// the ClaimTrie meanwhile.  fn must only use the read-only methods of the
+// ClaimTrie, and must not keep references to the nodes it visits after it
+// returns.  The error returned by fn is passed through.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ViewClaimTrie(fn func(ct *claimtrie.ClaimTrie) error) error {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	return fn(b.claimTrie)
+}
+
+// ExportClaimTrie writes a snapshot of the ClaimTrie at the specified height
+// of the main chain to w.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportClaimTrie(w io.Writer, height int32) (*claimtrie.SnapshotHeader, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil {
+		str := fmt.Sprintf("no block at height %d exists", height)
+		return nil, errNotInMainChain(str)
+	}
+	hdr, err := b.claimTrie.Export(w, claimtrie.Height(height), &node.hash)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.MerkleRoot != node.claimTrie {
+		return nil, AssertError(fmt.Sprintf("ClaimTrie root %v at "+
+			"height %d does not match block %v", hdr.MerkleRoot,
+			height, node.claimTrie))
+	}
+	return hdr, nil
+}
+
+// ImportClaimTrie replaces the ClaimTrie with the snapshot read from r.  The
+// snapshot must have been taken at a block of the best header chain, and is
+// refused unless the rebuilt ClaimTrie root matches the one in the header of
+// that block.  The block itself doesn't have to be downloaded yet.  When it is
+// already in the main chain, the claims of the blocks after the snapshot are
+// replayed from the database up to the tip of the main chain.  Otherwise, the
+// claims of the blocks up to the snapshot are skipped as the main chain
+// reaches it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ImportClaimTrie(r io.Reader) (*claimtrie.SnapshotHeader, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	hdr, err := claimtrie.ReadSnapshotHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	height := int32(hdr.Height)
+	node := b.bestHeader.NodeByHeight(height)
+	if node == nil {
+		str := fmt.Sprintf("snapshot height %d is beyond the best "+
+			"header height %d", height, b.bestHeader.Height())
+		return nil, errNotInMainChain(str)
+	}
+	if node.hash != hdr.BlockHash {
+		str := fmt.Sprintf("snapshot block %v is not in the best "+
+			"header chain", hdr.BlockHash)
+		return nil, errNotInMainChain(str)
+	}
+
+	// The claims of the blocks in the main chain beyond the snapshot can't
+	// be undone, so the snapshot must not be behind the part of the main
+	// chain which isn't part of the best header chain.
+	if !b.bestChain.Contains(node) && b.bestChain.Height() >= height {
+		str := fmt.Sprintf("snapshot block %v is not in the main "+
+			"chain", hdr.BlockHash)
+		return nil, errNotInMainChain(str)
+	}
+	if err := b.claimTrie.Import(r, hdr, &node.claimTrie); err != nil {
+		return nil, err
+	}
+	log.Infof("Imported ClaimTrie snapshot at height %d (hash %v, "+
+		"root %v)", height, hdr.BlockHash, hdr.MerkleRoot)
+
+	if b.bestChain.Contains(node) {
+		if err := b.replayClaims(height + 1); err != nil {
+			return nil, err
+		}
+	}
+	return hdr, nil
+}
+
+// resetClaimTrie rewinds the ClaimTrie to the passed height of the main chain
+// unless it is already behind it, which also drops the claims of a block whose
+// checks failed before they were committed.  An imported ClaimTrie holds no
+// state below its base, so it is rewound to the base instead while the main
+// chain is below it and no claims of later blocks have been committed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) resetClaimTrie(height int32) error {
+	ct := b.claimTrie
+	ht := claimtrie.Height(height)
+	if ht < ct.Base() && ct.Height() == ct.Base() {
+		ht = ct.Base()
+	}
+	if ht > ct.Height() {
+		return nil
+	}
+	return ct.Reset(ht)
+}
+
+// replayClaims applies the claims of the blocks in the main chain from the
+// specified height up to the tip to the ClaimTrie.  The outputs spent by each
+// block are loaded from the spend journal.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) replayClaims(from int32) error {
+	tip := b.bestChain.Tip()
+	for height := from; height <= tip.height; height++ {
+		node := b.bestChain.NodeByHeight(height)
+		var block *btcutil.Block
+		var stxos []SpentTxOut
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			if err != nil {
+				return err
+			}
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		err = b.replayClaimScripts(node, block, stxos)
+		if _, ok := err.(AssertError); ok {
+			return err
+		}
+		if err != nil {
+			return ruleError(ErrBadClaimTrie, err.Error())
+		}
+	}
+	if from <= tip.height {
+		log.Infof("Replayed ClaimTrie from height %d to %d", from,
+			tip.height)
+	}
+	return nil
+}
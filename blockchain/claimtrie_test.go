@@ -0,0 +1,167 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestClaimTrieCatchUp ensures a chain which is started with a ClaimTrie that
+// lags behind the end of the main chain replays the claims of the missing
+// blocks, and one which is ahead of it is rewound.
+func TestClaimTrieCatchUp(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	params := *fullblocktests.RegressionNetParams
+	dbPath, err := ioutil.TempDir("", "claimtriecatchup")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("database.Create: %v", err)
+	}
+	defer db.Close()
+	newChain := func(ct *claimtrie.ClaimTrie) *blockchain.BlockChain {
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:          db,
+			ChainParams: &params,
+			TimeSource:  blockchain.NewMedianTime(),
+			SigCache:    txscript.NewSigCache(1000),
+			ClaimTrie:   ct,
+		})
+		if err != nil {
+			t.Fatalf("failed to create chain instance: %v", err)
+		}
+		return chain
+	}
+	newClaimTrie := func() *claimtrie.ClaimTrie {
+		ct, err := claimtrie.NewMemory()
+		if err != nil {
+			t.Fatalf("claimtrie.NewMemory: %v", err)
+		}
+		return ct
+	}
+
+	ct := newClaimTrie()
+	defer ct.Close()
+	chain := newChain(ct)
+	processGeneratedBlocks(chain, tests)
+	best := chain.BestSnapshot()
+	root := *ct.MerkleHash()
+	if ct.Height() != claimtrie.Height(best.Height) {
+		t.Fatalf("ClaimTrie height %d, want %d", ct.Height(), best.Height)
+	}
+
+	// An empty ClaimTrie is caught up to the end of the main chain.
+	lagging := newClaimTrie()
+	defer lagging.Close()
+	newChain(lagging)
+	if lagging.Height() != claimtrie.Height(best.Height) {
+		t.Fatalf("caught up ClaimTrie height %d, want %d",
+			lagging.Height(), best.Height)
+	}
+	if got := *lagging.MerkleHash(); got != root {
+		t.Fatalf("caught up ClaimTrie root %v, want %v", got, root)
+	}
+
+	// A ClaimTrie with claims beyond the end of the main chain is rewound.
+	ct.Commit(ct.Height() + 1)
+	newChain(ct)
+	if ct.Height() != claimtrie.Height(best.Height) {
+		t.Fatalf("rewound ClaimTrie height %d, want %d", ct.Height(),
+			best.Height)
+	}
+	if got := *ct.MerkleHash(); got != root {
+		t.Fatalf("rewound ClaimTrie root %v, want %v", got, root)
+	}
+}
+
+// TestImportClaimTrieHeadersOnly ensures a ClaimTrie snapshot is validated
+// against the best header chain, so it can be imported into a chain which has
+// the headers up to the snapshot but not the blocks, and that the claims of the
+// blocks up to the snapshot are skipped as the blocks are connected.
+func TestImportClaimTrieHeadersOnly(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	source, teardown, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(source, tests)
+	best := source.BestSnapshot()
+	root := *source.ClaimTrie().MerkleHash()
+
+	height := best.Height / 2
+	var snapshot bytes.Buffer
+	if _, err := source.ExportClaimTrie(&snapshot, height); err != nil {
+		t.Fatalf("ExportClaimTrie: %v", err)
+	}
+
+	chain, teardown, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+
+	// The snapshot is refused before the header of its block is known.
+	_, err = chain.ImportClaimTrie(bytes.NewReader(snapshot.Bytes()))
+	if err == nil {
+		t.Fatal("ImportClaimTrie: snapshot beyond the best header " +
+			"chain was accepted")
+	}
+
+	blocks := make([]*btcutil.Block, best.Height)
+	for i := range blocks {
+		blocks[i], err = source.BlockByHeight(int32(i) + 1)
+		if err != nil {
+			t.Fatalf("BlockByHeight: %v", err)
+		}
+		err = chain.ProcessBlockHeader(&blocks[i].MsgBlock().Header,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlockHeader #%d: %v", i+1, err)
+		}
+	}
+	_, err = chain.ImportClaimTrie(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportClaimTrie: %v", err)
+	}
+
+	for _, block := range blocks {
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock at height %d: %v", block.Height(),
+				err)
+		}
+	}
+	ct := chain.ClaimTrie()
+	if ct.Height() != claimtrie.Height(best.Height) {
+		t.Fatalf("ClaimTrie height %d, want %d", ct.Height(), best.Height)
+	}
+	if got := *ct.MerkleHash(); got != root {
+		t.Fatalf("ClaimTrie root %v, want %v", got, root)
+	}
+}
@@ -365,8 +365,9 @@ func newFakeChain(params *chaincfg.Params) *BlockChain {
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		index:               index,
 		bestChain:           newChainView(node),
+		bestHeader:          newChainView(node),
 		warningCaches:       newThresholdCaches(vbNumBits),
-		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
+		deploymentCaches:    newThresholdCaches(uint32(len(params.Deployments))),
 	}
 }
 
@@ -0,0 +1,128 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestConcurrentReads ensures the functions which read the committed state of
+// the main chain, along with the ClaimTrie queries, observe a consistent main
+// chain while the blocks of the generated tests, including reorganizations,
+// are processed.  It's mostly useful with the race detector enabled.
+func TestConcurrentReads(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardown, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+
+	// Connect the first block so its coinbase output can be looked up
+	// throughout the test.
+	genesisHash := fullblocktests.RegressionNetParams.GenesisHash
+	firstBlock := tests[0][0].(fullblocktests.AcceptedBlock).Block
+	processGeneratedBlocks(chain, tests[:1])
+	coinbase := wire.OutPoint{Hash: firstBlock.Transactions[0].TxHash()}
+
+	read := func() {
+		best := chain.BestSnapshot()
+		block, err := chain.BlockByHeight(best.Height)
+		if err == nil {
+			// The block may have been disconnected since the
+			// snapshot, so only a block at the height is expected.
+			if block.Height() != best.Height {
+				t.Errorf("BlockByHeight(%d): got block at height %d",
+					best.Height, block.Height())
+			}
+			if best.Height > 0 {
+				_, err := chain.FetchSpendJournal(block)
+				if err != nil && chain.MainChainHasBlock(block.Hash()) {
+					t.Errorf("FetchSpendJournal: %v", err)
+				}
+			}
+		}
+
+		// The headers of the main chain must link to each other, even
+		// during a reorganization.
+		headers := chain.LocateHeaders(blockchain.BlockLocator{genesisHash},
+			&chainhash.Hash{})
+		prevHash := *genesisHash
+		for i := range headers {
+			if headers[i].PrevBlock != prevHash {
+				t.Errorf("LocateHeaders: header %d doesn't link to "+
+					"the previous one", i)
+				break
+			}
+			prevHash = headers[i].BlockHash()
+		}
+
+		locator, err := chain.LatestBlockLocator()
+		if err != nil || len(locator) == 0 ||
+			*locator[len(locator)-1] != *genesisHash {
+
+			t.Errorf("LatestBlockLocator: got %v, %v", locator, err)
+		}
+		if len(chain.BlockLocatorFromHash(&best.Hash)) == 0 {
+			t.Errorf("BlockLocatorFromHash: empty locator")
+		}
+
+		if _, err := chain.FetchUtxoEntry(coinbase); err != nil {
+			t.Errorf("FetchUtxoEntry: %v", err)
+		}
+
+		if chain.IsPruned() || chain.BlockPruned(&best.Hash) {
+			t.Errorf("blocks pruned by a chain without pruning")
+		}
+
+		// The ClaimTrie is never observed in the middle of a block.
+		err = chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+			tip := chain.BestSnapshot()
+			if ct.Height() != claimtrie.Height(tip.Height) {
+				t.Errorf("ViewClaimTrie: ClaimTrie at height %d, "+
+					"best block at %d", ct.Height(), tip.Height)
+			}
+			ct.Visit(func(*claimtrie.Node) bool { return false })
+			return nil
+		})
+		if err != nil {
+			t.Errorf("ViewClaimTrie: %v", err)
+		}
+	}
+
+	// Read the chain from several goroutines while the blocks are
+	// processed.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				read()
+			}
+		}()
+	}
+	processGeneratedBlocks(chain, tests[1:])
+	close(done)
+	wg.Wait()
+}
@@ -61,6 +61,34 @@ is by no means exhaustive:
    coins
  - Insert the block into the block database
 
+Concurrency
+
+All exported functions of BlockChain are safe for concurrent access.  Blocks are
+processed one at a time, and the processing of a block, including the
+validation of its scripts, holds the chain lock for its entire duration.  The
+functions which only depend on the committed state of the main chain don't
+take the chain lock, so they aren't blocked while a block is being validated:
+
+ - BlockByHash, BlockByHeight, and HeaderByHash
+ - FetchUtxoEntry, FetchUtxoView, and FetchSpendJournal
+ - BlockLocatorFromHash, LatestBlockLocator, LocateBlocks, and LocateHeaders
+ - BestSnapshot, BestHeader, and LatestHeaderLocator
+ - IsPruned, BlockPruned, PruneHeight, and IsCheckpointCandidate
+
+Each call of these functions observes the main chain as of the last block which
+was connected to or disconnected from it.  A block which is being validated is
+not visible until it has been connected, and during a reorganization the calls
+may observe one of the intermediate chains between the old and the new main
+chain.  Separate calls may observe different chains, so callers which need a
+consistent view across calls should check that the best block reported by
+BestSnapshot didn't change in between.
+
+The other functions still take the chain lock, so they wait for the block being
+processed.  That includes the queries of the claimtrie, which is updated while
+blocks are validated: ViewClaimTrie, which serves the claimtrie RPCs, and
+ExportClaimTrie hold the chain lock for reads while they run, so they observe
+the claimtrie of the main chain as of a block which was fully processed.
+
 Errors
 
 Errors returned by this package are either the raw errors provided by underlying
@@ -224,6 +224,10 @@ const (
 	// ErrBadClaimTrie indicates the calculated ClaimTrie root does not match
 	// the expected value.
 	ErrBadClaimTrie
+
+	// ErrLowChainWork indicates a block header processed without its block
+	// ends a chain whose work falls too far short of the best header chain.
+	ErrLowChainWork
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -272,6 +276,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
 	ErrBadClaimTrie:              "ErrBadClaimTrie",
+	ErrLowChainWork:              "ErrLowChainWork",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -0,0 +1,369 @@
+// Copyright (c) 2016 The btcsuite developers
+// Copyright (c) 2018-2018 The LBRY developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// chainSetup is used to create a new db and chain instance with the genesis
+// block already inserted.  The chain uses a ClaimTrie kept in memory.  In
+// addition to the new chain instance, it returns a teardown function the
+// caller should invoke when done testing to clean up.
+func chainSetup(params *chaincfg.Params) (*blockchain.BlockChain, func(), error) {
+	chain, _, teardown, err := chainSetupDB(params)
+	return chain, teardown, err
+}
+
+// chainSetupDB is like chainSetup, but also returns the database of the chain
+// so tests can inspect or modify it.
+func chainSetupDB(params *chaincfg.Params) (*blockchain.BlockChain, database.DB, func(), error) {
+	dbPath, err := ioutil.TempDir("", "fullblocktest")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		return nil, nil, nil, err
+	}
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbPath)
+		return nil, nil, nil, err
+	}
+	teardown := func() {
+		ct.Close()
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	// Copy the chain params to ensure any modifications the tests do to
+	// the chain parameters do not affect the global instance.  The
+	// checkpoints of the parameters are used as is.
+	paramsCopy := *params
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &paramsCopy,
+		Checkpoints: params.Checkpoints,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+		ClaimTrie:   ct,
+	})
+	if err != nil {
+		teardown()
+		return nil, nil, nil, err
+	}
+	return chain, db, teardown, nil
+}
+
+// processGeneratedBlocks processes all of the blocks of the tests generated by
+// the fullblocktests package with the passed chain.  Whether they are accepted
+// doesn't matter, which leaves the chain at the end of the generated main
+// chain.
+func processGeneratedBlocks(chain *blockchain.BlockChain, tests [][]fullblocktests.TestInstance) {
+	for _, test := range tests {
+		for _, item := range test {
+			var block *btcutil.Block
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				block = btcutil.NewBlock(item.Block)
+			case fullblocktests.RejectedBlock:
+				block = btcutil.NewBlock(item.Block)
+			case fullblocktests.OrphanOrRejectedBlock:
+				block = btcutil.NewBlock(item.Block)
+			default:
+				continue
+			}
+			chain.ProcessBlock(block, blockchain.BFNone)
+		}
+	}
+}
+
+// TestFullBlocksGenesis ensures the genesis block of the network parameters
+// used by the fullblocktests package hashes, with its ClaimTrie root, to the
+// genesis hash of the parameters and satisfies their proof of work limit.
+func TestFullBlocksGenesis(t *testing.T) {
+	params := fullblocktests.RegressionNetParams
+	genesis := btcutil.NewBlock(params.GenesisBlock)
+	if *genesis.Hash() != *params.GenesisHash {
+		t.Fatalf("genesis block hash is %v, parameters have %v",
+			genesis.Hash(), params.GenesisHash)
+	}
+	if err := blockchain.CheckProofOfWork(genesis, params.PowLimit); err != nil {
+		t.Fatalf("CheckProofOfWork: %v", err)
+	}
+}
+
+// TestFullBlocks ensures all tests generated by the fullblocktests package
+// have the expected result when processed via ProcessBlock.
+func TestFullBlocks(t *testing.T) {
+	// The generated claims rely on the shortened activation delays and
+	// expiration times of the generator.
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// testAcceptedBlock attempts to process the block in the provided test
+	// instance and ensures that it was accepted according to the flags
+	// specified in the test.
+	testAcceptedBlock := func(item fullblocktests.AcceptedBlock) {
+		blockHeight := item.Height
+		block := btcutil.NewBlock(item.Block)
+		block.SetHeight(blockHeight)
+		t.Logf("Testing block %s (hash %s, height %d)",
+			item.Name, block.Hash(), blockHeight)
+
+		isMainChain, isOrphan, err := chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("block %q (hash %s, height %d) should "+
+				"have been accepted: %v", item.Name,
+				block.Hash(), blockHeight, err)
+		}
+
+		// Ensure the main chain and orphan flags match the values
+		// specified in the test.
+		if isMainChain != item.IsMainChain {
+			t.Fatalf("block %q (hash %s, height %d) unexpected main "+
+				"chain flag -- got %v, want %v", item.Name,
+				block.Hash(), blockHeight, isMainChain,
+				item.IsMainChain)
+		}
+		if isOrphan != item.IsOrphan {
+			t.Fatalf("block %q (hash %s, height %d) unexpected "+
+				"orphan flag -- got %v, want %v", item.Name,
+				block.Hash(), blockHeight, isOrphan,
+				item.IsOrphan)
+		}
+	}
+
+	// testRejectedBlock attempts to process the block in the provided test
+	// instance and ensures that it was rejected with the reject code
+	// specified in the test.
+	testRejectedBlock := func(item fullblocktests.RejectedBlock) {
+		blockHeight := item.Height
+		block := btcutil.NewBlock(item.Block)
+		block.SetHeight(blockHeight)
+		t.Logf("Testing block %s (hash %s, height %d)",
+			item.Name, block.Hash(), blockHeight)
+
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err == nil {
+			t.Fatalf("block %q (hash %s, height %d) should not "+
+				"have been accepted", item.Name, block.Hash(),
+				blockHeight)
+		}
+
+		// Ensure the error code is of the expected type and the reject
+		// code matches the value specified in the test instance.
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok {
+			t.Fatalf("block %q (hash %s, height %d) returned "+
+				"unexpected error type -- got %T, want "+
+				"blockchain.RuleError", item.Name, block.Hash(),
+				blockHeight, err)
+		}
+		if rerr.ErrorCode != item.RejectCode {
+			t.Fatalf("block %q (hash %s, height %d) does not have "+
+				"expected reject code -- got %v, want %v",
+				item.Name, block.Hash(), blockHeight,
+				rerr.ErrorCode, item.RejectCode)
+		}
+	}
+
+	// testRejectedNonCanonicalBlock attempts to decode the block in the
+	// provided test instance and ensures that it failed to decode with a
+	// message error.
+	testRejectedNonCanonicalBlock := func(item fullblocktests.RejectedNonCanonicalBlock) {
+		headerLen := len(item.RawBlock)
+		if headerLen > wire.MaxBlockHeaderPayload {
+			headerLen = wire.MaxBlockHeaderPayload
+		}
+		blockHash := chainhash.DoubleHashH(item.RawBlock[0:headerLen])
+		blockHeight := item.Height
+		t.Logf("Testing block %s (hash %s, height %d)", item.Name,
+			blockHash, blockHeight)
+
+		// Ensure there is an error due to deserializing the block.
+		var msgBlock wire.MsgBlock
+		err := msgBlock.BtcDecode(bytes.NewReader(item.RawBlock), 0,
+			wire.BaseEncoding)
+		if _, ok := err.(*wire.MessageError); !ok {
+			t.Fatalf("block %q (hash %s, height %d) should have "+
+				"failed to decode", item.Name, blockHash,
+				blockHeight)
+		}
+	}
+
+	// testOrphanOrRejectedBlock attempts to process the block in the
+	// provided test instance and ensures that it was either accepted as an
+	// orphan or rejected with a rule violation.
+	testOrphanOrRejectedBlock := func(item fullblocktests.OrphanOrRejectedBlock) {
+		blockHeight := item.Height
+		block := btcutil.NewBlock(item.Block)
+		block.SetHeight(blockHeight)
+		t.Logf("Testing block %s (hash %s, height %d)",
+			item.Name, block.Hash(), blockHeight)
+
+		_, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			// Ensure the error code is of the expected type.
+			if _, ok := err.(blockchain.RuleError); !ok {
+				t.Fatalf("block %q (hash %s, height %d) "+
+					"returned unexpected error type -- "+
+					"got %T, want blockchain.RuleError",
+					item.Name, block.Hash(), blockHeight,
+					err)
+			}
+		}
+
+		if !isOrphan {
+			t.Fatalf("block %q (hash %s, height %d) was accepted, "+
+				"but is not considered an orphan", item.Name,
+				block.Hash(), blockHeight)
+		}
+	}
+
+	// testExpectedTip ensures the current tip of the blockchain is the
+	// block specified in the provided test instance.
+	testExpectedTip := func(item fullblocktests.ExpectedTip) {
+		blockHeight := item.Height
+		block := btcutil.NewBlock(item.Block)
+		block.SetHeight(blockHeight)
+		t.Logf("Testing tip for block %s (hash %s, height %d)",
+			item.Name, block.Hash(), blockHeight)
+
+		// Ensure hash and height match.
+		best := chain.BestSnapshot()
+		if best.Hash != item.Block.BlockHash() ||
+			best.Height != blockHeight {
+
+			t.Fatalf("block %q (hash %s, height %d) should be "+
+				"the current tip -- got (hash %s, height %d)",
+				item.Name, block.Hash(), blockHeight, best.Hash,
+				best.Height)
+		}
+	}
+
+	for testNum, test := range tests {
+		for itemNum, item := range test {
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				testAcceptedBlock(item)
+			case fullblocktests.RejectedBlock:
+				testRejectedBlock(item)
+			case fullblocktests.RejectedNonCanonicalBlock:
+				testRejectedNonCanonicalBlock(item)
+			case fullblocktests.OrphanOrRejectedBlock:
+				testOrphanOrRejectedBlock(item)
+			case fullblocktests.ExpectedTip:
+				testExpectedTip(item)
+			default:
+				t.Fatalf("test #%d, item #%d is not one of "+
+					"the supported test instance types -- "+
+					"got type: %T", testNum, itemNum, item)
+			}
+		}
+	}
+}
+
+// TestUtxoCacheRecovery ensures the blocks connected after the last flush of
+// the utxo cache are connected to the utxo set again when the chain is loaded
+// after a crash, that is without flushing the utxo cache.
+func TestUtxoCacheRecovery(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	params := *fullblocktests.RegressionNetParams
+	chain, db, teardown, err := chainSetupDB(&params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(chain, tests)
+	best := chain.BestSnapshot()
+
+	consistentHash := func() chainhash.Hash {
+		var hash chainhash.Hash
+		err := db.View(func(dbTx database.Tx) error {
+			v := dbTx.Metadata().Get([]byte("utxostateconsistency"))
+			copy(hash[:], v)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to fetch utxo state consistency: %v", err)
+		}
+		return hash
+	}
+	if consistentHash() == best.Hash {
+		t.Fatalf("utxo set already consistent with the tip")
+	}
+
+	// Load the chain again from the database as if the process had
+	// crashed.  The ClaimTrie is kept in memory, so it's shared.
+	restarted, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+		ClaimTrie:   chain.ClaimTrie(),
+	})
+	if err != nil {
+		t.Fatalf("failed to load chain instance: %v", err)
+	}
+	if restarted.BestSnapshot().Hash != best.Hash {
+		t.Fatalf("restarted chain at %v instead of %v",
+			restarted.BestSnapshot().Hash, best.Hash)
+	}
+	if consistentHash() != best.Hash {
+		t.Fatalf("utxo set consistent with %v instead of %v",
+			consistentHash(), best.Hash)
+	}
+	recovered, err := restarted.CalcUtxoSetStats(blockchain.UtxoSetHashMuHash)
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: %v", err)
+	}
+
+	// Writing the entries of the original cache must not change the
+	// recovered utxo set.
+	stats, err := chain.CalcUtxoSetStats(blockchain.UtxoSetHashMuHash)
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: %v", err)
+	}
+	if *recovered != *stats {
+		t.Fatalf("recovered utxo set %+v instead of %+v", recovered,
+			stats)
+	}
+}
@@ -13,6 +13,11 @@ goal, each test contains additional information about the expected result,
 however that information can be ignored when doing comparison tests between two
 independent versions over the peer-to-peer network.
 
+The tests also exercise the ClaimTrie rules with claims, supports and updates,
+and the blocks commit to the resulting ClaimTrie roots.  Since the claims rely
+on much shorter activation delays and expiration times than the LBRY networks,
+ClaimTrieParams must be in effect while the blocks are processed.
+
 This package has intentionally been designed so it can be used as a standalone
 package for any projects needing to test their implementation against a full set
 of blocks that exercise the consensus validation rules.
@@ -22,6 +22,7 @@ import (
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -193,6 +194,14 @@ type testGenerator struct {
 
 	// Common key for any tests which require signed transactions.
 	privKey *btcec.PrivateKey
+
+	// Used for calculating the ClaimTrie roots of the blocks.  The
+	// ClaimTrie holds the claims of the blocks in claimTrieBranch, which
+	// is indexed by height, and claimScripts houses the scripts of all of
+	// the claim outputs created by the blocks.
+	claimTrie       *claimtrie.ClaimTrie
+	claimTrieBranch []chainhash.Hash
+	claimScripts    map[wire.OutPoint][]byte
 }
 
 // makeTestGenerator returns a test generator instance initialized with the
@@ -201,15 +210,22 @@ func makeTestGenerator(params *chaincfg.Params) (testGenerator, error) {
 	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
 	genesis := params.GenesisBlock
 	genesisHash := genesis.BlockHash()
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		return testGenerator{}, err
+	}
 	return testGenerator{
-		params:       params,
-		blocks:       map[chainhash.Hash]*wire.MsgBlock{genesisHash: genesis},
-		blocksByName: map[string]*wire.MsgBlock{"genesis": genesis},
-		blockHeights: map[string]int32{"genesis": 0},
-		tip:          genesis,
-		tipName:      "genesis",
-		tipHeight:    0,
-		privKey:      privKey,
+		params:          params,
+		blocks:          map[chainhash.Hash]*wire.MsgBlock{genesisHash: genesis},
+		blocksByName:    map[string]*wire.MsgBlock{"genesis": genesis},
+		blockHeights:    map[string]int32{"genesis": 0},
+		tip:             genesis,
+		tipName:         "genesis",
+		tipHeight:       0,
+		privKey:         privKey,
+		claimTrie:       ct,
+		claimTrieBranch: []chainhash.Hash{genesisHash},
+		claimScripts:    make(map[wire.OutPoint][]byte),
 	}, nil
 }
 
@@ -248,6 +264,37 @@ func standardCoinbaseScript(blockHeight int32, extraNonce uint64) ([]byte, error
 		AddInt64(int64(extraNonce)).Script()
 }
 
+// claimNameScript returns a public key script which claims the provided name
+// with the provided value.  Like the other claim scripts, it is followed by a
+// simple OP_TRUE script, so the claim can be spent without a signature.
+func claimNameScript(name, value string) []byte {
+	script, err := txscript.ClaimNameScript(name, value)
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// supportClaimScript returns a public key script which supports the claim with
+// the provided id for the provided name.
+func supportClaimScript(name string, claimID claimtrie.ClaimID) []byte {
+	script, err := txscript.SupportClaimScript(name, claimID[:])
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// updateClaimScript returns a public key script which updates the claim with
+// the provided id for the provided name to the provided value.
+func updateClaimScript(name string, claimID claimtrie.ClaimID, value string) []byte {
+	script, err := txscript.UpdateClaimScript(name, claimID[:], value)
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
 // opReturnScript returns a provably-pruneable OP_RETURN script with the
 // provided data.
 func opReturnScript(data []byte) []byte {
@@ -342,7 +389,7 @@ func solveBlock(header *wire.BlockHeader) bool {
 				return
 			default:
 				hdr.Nonce = i
-				hash := hdr.BlockHash()
+				hash := hdr.BlockPoWHash()
 				if blockchain.HashToBig(&hash).Cmp(
 					targetDifficulty) <= 0 {
 
@@ -414,6 +461,35 @@ func replaceSpendScript(pkScript []byte) func(*wire.MsgBlock) {
 	}
 }
 
+// replaceSpendOut returns a function that itself takes a block and modifies it
+// by replacing the public key script and the amount of the first output of the
+// spending transaction.
+//
+// NOTE: The coinbase value is NOT updated to reflect the changed fee.  Any
+// amount the output no longer pays is simply left unclaimed.
+func replaceSpendOut(pkScript []byte, amount btcutil.Amount) func(*wire.MsgBlock) {
+	return func(b *wire.MsgBlock) {
+		b.Transactions[1].TxOut[0].PkScript = pkScript
+		b.Transactions[1].TxOut[0].Value = int64(amount)
+	}
+}
+
+// additionalSpendInput returns a function that itself takes a block and
+// modifies it by adding an input which spends the provided output to the
+// spending transaction.
+//
+// NOTE: The outputs of the spending transaction are NOT updated to reflect the
+// additional amount.  Use 'replaceSpendOut' for that purpose.
+func additionalSpendInput(spend *spendableOut) func(*wire.MsgBlock) {
+	return func(b *wire.MsgBlock) {
+		b.Transactions[1].AddTxIn(&wire.TxIn{
+			PreviousOutPoint: spend.prevOut,
+			Sequence:         wire.MaxTxInSequenceNum,
+			SignatureScript:  nil,
+		})
+	}
+}
+
 // replaceCoinbaseSigScript returns a function that itself takes a block and
 // modifies it by replacing the signature key script of the coinbase.
 func replaceCoinbaseSigScript(script []byte) func(*wire.MsgBlock) {
@@ -477,6 +553,7 @@ func createSpendTxForTx(tx *wire.MsgTx, fee btcutil.Amount) *wire.MsgTx {
 // In order to simply the logic in the munge functions, the following rules are
 // applied after all munge functions have been invoked:
 // - The merkle root will be recalculated unless it was manually changed
+// - The ClaimTrie root will be calculated unless it was manually changed
 // - The block will be solved unless the nonce was changed
 func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers ...func(*wire.MsgBlock)) *wire.MsgBlock {
 	// Create coinbase transaction for the block using any additional
@@ -523,6 +600,7 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 	// Perform any block munging just before solving.  Only recalculate the
 	// merkle root if it wasn't manually changed by a munge function.
 	curMerkleRoot := block.Header.MerkleRoot
+	curClaimTrie := block.Header.ClaimTrie
 	curNonce := block.Header.Nonce
 	for _, f := range mungers {
 		f(&block)
@@ -531,6 +609,12 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 		block.Header.MerkleRoot = calcMerkleRoot(block.Transactions)
 	}
 
+	// Only calculate the ClaimTrie root if it wasn't manually changed by a
+	// munge function.
+	if block.Header.ClaimTrie == curClaimTrie {
+		block.Header.ClaimTrie = g.calcClaimTrieRoot(&block, nextHeight)
+	}
+
 	// Only solve the block if the nonce wasn't manually changed by a munge
 	// function.
 	if block.Header.Nonce == curNonce && !solveBlock(&block.Header) {
@@ -549,6 +633,127 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 	return &block
 }
 
+// applyClaims applies the claims, supports and updates of the passed block to
+// the ClaimTrie and commits them at the passed height.  It mirrors the way the
+// consensus rules apply them, so an update is only accepted when the claim it
+// updates is spent by the same transaction.
+func (g *testGenerator) applyClaims(block *wire.MsgBlock, blockHeight int32) {
+	ct := g.claimTrie
+	for txIdx, tx := range block.Transactions {
+		// Spend the claims and supports referenced by the inputs and
+		// note the spent claims which may be updated.
+		spent := make(map[claimtrie.ClaimID]bool)
+		for _, txIn := range tx.TxIn {
+			if txIdx == 0 {
+				break
+			}
+			op := txIn.PreviousOutPoint
+			script, ok := g.claimScripts[op]
+			if !ok {
+				continue
+			}
+			cs, err := txscript.DecodeClaimScript(script)
+			if err != nil {
+				panic(err)
+			}
+
+			var id claimtrie.ClaimID
+			name := string(cs.Name())
+			switch cs.Opcode() {
+			case txscript.OP_CLAIMNAME:
+				spent[claimtrie.NewID(op)] = true
+				err = ct.SpendClaim(name, op)
+			case txscript.OP_UPDATECLAIM:
+				copy(id[:], cs.ClaimID())
+				spent[id] = true
+				err = ct.SpendClaim(name, op)
+			case txscript.OP_SUPPORTCLAIM:
+				err = ct.SpendSupport(name, op)
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		// Add the claims, supports and updates of the outputs.
+		txHash := tx.TxHash()
+		for txOutIdx, txOut := range tx.TxOut {
+			cs, err := txscript.DecodeClaimScript(txOut.PkScript)
+			if err == txscript.ErrNotClaimScript {
+				continue
+			}
+			if err != nil {
+				panic(err)
+			}
+
+			op := wire.OutPoint{Hash: txHash, Index: uint32(txOutIdx)}
+			g.claimScripts[op] = txOut.PkScript
+
+			var id claimtrie.ClaimID
+			name := string(cs.Name())
+			amt := claimtrie.Amount(txOut.Value)
+			switch cs.Opcode() {
+			case txscript.OP_CLAIMNAME:
+				err = ct.AddClaim(name, op, amt, cs.Value())
+			case txscript.OP_SUPPORTCLAIM:
+				copy(id[:], cs.ClaimID())
+				err = ct.AddSupport(name, op, amt, id)
+			case txscript.OP_UPDATECLAIM:
+				copy(id[:], cs.ClaimID())
+				if !spent[id] {
+					continue
+				}
+				delete(spent, id)
+				err = ct.UpdateClaim(name, op, amt, id, cs.Value())
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+	ct.Commit(claimtrie.Height(blockHeight))
+}
+
+// resetClaimTrie resets the ClaimTrie to the block with the passed hash, which
+// is at the passed height.  The ClaimTrie is rolled back to the point where the
+// branch it holds forks from the one of the block, and the claims of the blocks
+// after the fork point are then replayed.
+func (g *testGenerator) resetClaimTrie(blockHash chainhash.Hash, blockHeight int32) {
+	// Find the blocks which aren't in the branch held by the ClaimTrie.
+	var attachBlocks []*wire.MsgBlock
+	forkHeight := blockHeight
+	for forkHeight >= int32(len(g.claimTrieBranch)) ||
+		g.claimTrieBranch[forkHeight] != blockHash {
+
+		block := g.blocks[blockHash]
+		attachBlocks = append(attachBlocks, block)
+		blockHash = block.Header.PrevBlock
+		forkHeight--
+	}
+	if err := g.claimTrie.Reset(claimtrie.Height(forkHeight)); err != nil {
+		panic(err)
+	}
+	g.claimTrieBranch = g.claimTrieBranch[:forkHeight+1]
+	for i := len(attachBlocks) - 1; i >= 0; i-- {
+		g.applyClaims(attachBlocks[i], int32(len(g.claimTrieBranch)))
+		g.claimTrieBranch = append(g.claimTrieBranch,
+			attachBlocks[i].BlockHash())
+	}
+}
+
+// calcClaimTrieRoot returns the ClaimTrie root of the passed block, which is to
+// be at the passed height.  The ClaimTrie is left at the parent of the block
+// since the block is yet to be solved.
+func (g *testGenerator) calcClaimTrieRoot(block *wire.MsgBlock, blockHeight int32) chainhash.Hash {
+	g.resetClaimTrie(block.Header.PrevBlock, blockHeight-1)
+	g.applyClaims(block, blockHeight)
+	root := *g.claimTrie.MerkleHash()
+	if err := g.claimTrie.Reset(claimtrie.Height(blockHeight - 1)); err != nil {
+		panic(err)
+	}
+	return root
+}
+
 // updateBlockState manually updates the generator state to remove all internal
 // map references to a block via its old hash and insert new ones for the new
 // block hash.  This is useful if the test code has to manually change a block
@@ -756,6 +961,22 @@ func (g *testGenerator) assertTipBlockMerkleRoot(expected chainhash.Hash) {
 	}
 }
 
+// assertTipBestClaim panics if the best claim for the provided name as of the
+// current tip block associated with the generator is not the one with the
+// provided outpoint.  A nil outpoint expects the name to have no best claim.
+func (g *testGenerator) assertTipBestClaim(name string, expected *wire.OutPoint) {
+	g.resetClaimTrie(g.tip.BlockHash(), g.tipHeight)
+	var op *wire.OutPoint
+	if best := g.claimTrie.Node(name).BestClaim; best != nil {
+		op = &best.OutPoint
+	}
+	if (op == nil) != (expected == nil) || (op != nil && *op != *expected) {
+		panic(fmt.Sprintf("best claim for name %q as of block %q "+
+			"(height %d) is %v instead of expected %v", name,
+			g.tipName, g.tipHeight, op, expected))
+	}
+}
+
 // assertTipBlockTxOutOpReturn panics if the current tip block associated with
 // the generator does not have an OP_RETURN script for the transaction output at
 // the provided tx index and output index.
@@ -809,12 +1030,17 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 		}
 	}()
 
+	// The claims are applied to the ClaimTrie of the generator with the
+	// parameters the tests are valid for.
+	defer claimtrie.SetParams(claimtrie.SetParams(ClaimTrieParams))
+
 	// Create a test generator instance initialized with the genesis block
 	// as the tip.
-	g, err := makeTestGenerator(regressionNetParams)
+	g, err := makeTestGenerator(RegressionNetParams)
 	if err != nil {
 		return nil, err
 	}
+	defer g.claimTrie.Close()
 
 	// Define some convenience helper functions to return an individual test
 	// instance that has the described characteristics.
@@ -1444,8 +1670,8 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 			// Keep incrementing the nonce until the hash treated as
 			// a uint256 is higher than the limit.
 			b46.Header.Nonce++
-			blockHash := b46.BlockHash()
-			hashNum := blockchain.HashToBig(&blockHash)
+			powHash := b46.Header.BlockPoWHash()
+			hashNum := blockchain.HashToBig(&powHash)
 			if hashNum.Cmp(g.params.PowLimit) >= 0 {
 				break
 			}
@@ -2045,6 +2271,218 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	}
 	accepted()
 
+	// ---------------------------------------------------------------------
+	// ClaimTrie tests.
+	//
+	// The claims are applied with the ClaimTrie parameters of the tests, so
+	// a new claim for a name is activated after a delay of one block for
+	// every two blocks since the last takeover of the name, and claims
+	// expire twenty blocks after they are accepted.
+	// ---------------------------------------------------------------------
+
+	// claimOut returns the first output of the spending transaction in the
+	// block with the provided name, which holds the claim, support, or
+	// update of the tests.
+	claimOut := func(blockName string) *spendableOut {
+		out := makeSpendableOut(g.blocksByName[blockName], 1, 0)
+		return &out
+	}
+	claimID := func(blockName string) claimtrie.ClaimID {
+		return claimtrie.NewID(claimOut(blockName).prevOut)
+	}
+
+	// Create a block with a claim for a name which has not been claimed
+	// before.  The claim takes over the name immediately.
+	//
+	//   ... -> b79(26) -> b81(27) -> b82(28)
+	g.setTip("b81")
+	g.nextBlock("b82", outs[28], replaceSpendOut(claimNameScript("test",
+		"one"), 100))
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	// Extend the main chain by a few blocks, so a competing claim for the
+	// name is subject to an activation delay.
+	//
+	//   ... -> b82(28) -> b83 -> ... -> b88
+	for i := 83; i <= 88; i++ {
+		g.nextBlock(fmt.Sprintf("b%d", i), nil)
+		accepted()
+	}
+
+	// Create a block with a larger claim for the name seven blocks after
+	// the takeover, and ensure the first claim stays the best one until
+	// the larger claim is activated three blocks later.
+	//
+	//   ... -> b88 -> b89(29) -> b90 -> b91 -> b92
+	g.nextBlock("b89", outs[29], replaceSpendOut(claimNameScript("test",
+		"two"), 200))
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	g.nextBlock("b90", nil)
+	accepted()
+
+	g.nextBlock("b91", nil)
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	g.nextBlock("b92", nil)
+	g.assertTipBestClaim("test", &claimOut("b89").prevOut)
+	accepted()
+
+	// Create a block with a support for the first claim which makes it
+	// the larger one again.  The support is activated immediately since
+	// the name was just taken over, so the first claim takes it back.
+	//
+	//   ... -> b92 -> b93(30)
+	g.nextBlock("b93", outs[30], replaceSpendOut(supportClaimScript("test",
+		claimID("b82")), 150))
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	// Create a block with an update of the second claim which does not
+	// spend the claim.  The update is ignored, so the much larger amount
+	// does not make the second claim the best one.
+	//
+	//   ... -> b93(30) -> b94(31)
+	g.nextBlock("b94", outs[31], replaceSpendOut(updateClaimScript("test",
+		claimID("b89"), "three"), 1000))
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	// Create a block with an update of the second claim which spends the
+	// claim along with an additional output to increase its amount.  The
+	// updated claim is activated after a delay of one block, and then
+	// takes over the name.
+	//
+	//   ... -> b94(31) -> b95(b89.tx[1].out[0], 32) -> b96
+	g.nextBlock("b95", claimOut("b89"), additionalSpendInput(outs[32]),
+		replaceSpendOut(updateClaimScript("test", claimID("b89"),
+			"three"), 400))
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	g.nextBlock("b96", nil)
+	g.assertTipBestClaim("test", &claimOut("b95").prevOut)
+	accepted()
+
+	// Create a block which spends the updated claim, so the first claim
+	// takes the name back.
+	//
+	//   ... -> b96 -> b97(b95.tx[1].out[0])
+	g.nextBlock("b97", claimOut("b95"))
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+	accepted()
+
+	// Extend the main chain until the first claim expires twenty blocks
+	// after it was accepted, which leaves the name without a best claim
+	// since supports can't be the best claim.
+	//
+	//   ... -> b97 -> b98 -> ... -> b102
+	for i := 98; i <= 101; i++ {
+		g.nextBlock(fmt.Sprintf("b%d", i), nil)
+		accepted()
+	}
+	g.assertTipBestClaim("test", &claimOut("b82").prevOut)
+
+	g.nextBlock("b102", nil)
+	g.assertTipBestClaim("test", nil)
+	accepted()
+
+	// Create a block with a claim for another name followed by a block
+	// with a larger claim for the name, which takes it over immediately.
+	//
+	//   ... -> b102 -> b103(33) -> b104(34)
+	g.nextBlock("b103", outs[33], replaceSpendOut(claimNameScript("reorg",
+		"one"), 100))
+	accepted()
+
+	g.nextBlock("b104", outs[34], replaceSpendOut(claimNameScript("reorg",
+		"two"), 200))
+	g.assertTipBestClaim("reorg", &claimOut("b104").prevOut)
+	accepted()
+
+	// Create a side chain without the takeover which is then extended by
+	// a block with an even larger claim for the name to force a reorg.
+	// The takeover is undone and the larger claim is only activated one
+	// block later, which then takes over the name.
+	//
+	//   ... -> b103(33) -> b104(34)
+	//                  \-> b104a -> b105a(35) -> b106a
+	g.setTip("b103")
+	g.nextBlock("b104a", nil)
+	acceptedToSideChainWithExpectedTip("b104")
+
+	g.nextBlock("b105a", outs[35], replaceSpendOut(claimNameScript("reorg",
+		"three"), 300))
+	g.assertTipBestClaim("reorg", &claimOut("b103").prevOut)
+	accepted()
+
+	g.nextBlock("b106a", nil)
+	g.assertTipBestClaim("reorg", &claimOut("b105a").prevOut)
+	accepted()
+
+	// Extend the original chain to force a reorg back to it, which undoes
+	// the takeover of the side chain and restores the one of the original
+	// chain.
+	//
+	//   ... -> b103(33) -> b104(34) -> b105 -> b106 -> b107
+	//                  \-> b104a -> b105a(35) -> b106a
+	g.setTip("b104")
+	g.nextBlock("b105", nil)
+	acceptedToSideChainWithExpectedTip("b106a")
+
+	g.nextBlock("b106", nil)
+	acceptedToSideChainWithExpectedTip("b106a")
+
+	g.nextBlock("b107", nil)
+	g.assertTipBestClaim("reorg", &claimOut("b104").prevOut)
+	accepted()
+
+	// Create a block with a claim, but with the ClaimTrie root of its
+	// parent, which doesn't account for the claim.
+	//
+	//   ... -> b107 -> b108(36)
+	g.nextBlock("b108", outs[36], replaceSpendOut(claimNameScript("bad",
+		"one"), 100), func(b *wire.MsgBlock) {
+
+		b.Header.ClaimTrie = g.blocksByName["b107"].Header.ClaimTrie
+	})
+	rejected(blockchain.ErrBadClaimTrie)
+
+	// Create a side chain with a block with the same invalid ClaimTrie
+	// root, which can't be detected until the side chain is extended to
+	// force a reorg to it.  Ensure the reorg fails and the original chain
+	// remains the main chain.
+	//
+	//   ... -> b106 -> b107
+	//              \-> b107a(36) -> b108a
+	g.setTip("b106")
+	g.nextBlock("b107a", outs[36], replaceSpendOut(claimNameScript("bad",
+		"one"), 100), func(b *wire.MsgBlock) {
+
+		b.Header.ClaimTrie = g.blocksByName["b106"].Header.ClaimTrie
+	})
+	acceptedToSideChainWithExpectedTip("b107")
+
+	g.nextBlock("b108a", nil)
+	tests = append(tests, []TestInstance{
+		rejectBlock(g.tipName, g.tip, blockchain.ErrBadClaimTrie),
+		expectTipBlock("b107", g.blocksByName["b107"]),
+	})
+
+	// Create a block with the claim and a valid ClaimTrie root to ensure
+	// the ClaimTrie of the main chain has been restored after the failed
+	// reorg.
+	//
+	//   ... -> b107 -> b109(36)
+	g.setTip("b107")
+	g.nextBlock("b109", outs[36], replaceSpendOut(claimNameScript("bad",
+		"one"), 100))
+	g.assertTipBestClaim("bad", &claimOut("b109").prevOut)
+	accepted()
+
 	// ---------------------------------------------------------------------
 	// Large block re-org test.
 	// ---------------------------------------------------------------------
@@ -2055,8 +2493,8 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 
 	// Ensure the tip the re-org test builds on is the best chain tip.
 	//
-	//   ... -> b81(27) -> ...
-	g.setTip("b81")
+	//   ... -> b109(36) -> ...
+	g.setTip("b109")
 
 	// Collect all of the spendable coinbase outputs from the previous
 	// collection point up to the current tip.
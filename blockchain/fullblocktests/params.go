@@ -6,11 +6,13 @@ package fullblocktests
 
 import (
 	"encoding/hex"
+	"math"
 	"math/big"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -85,21 +87,21 @@ var (
 	}
 )
 
-// regressionNetParams defines the network parameters for the regression test
-// network.
+// RegressionNetParams defines the network parameters for the regression test
+// network the generated blocks are valid for.
 //
 // NOTE: The test generator intentionally does not use the existing definitions
 // in the chaincfg package since the intent is to be able to generate known
 // good tests which exercise that code.  Using the chaincfg parameters would
 // allow them to change out from under the tests potentially invalidating them.
-var regressionNetParams = &chaincfg.Params{
+var RegressionNetParams = &chaincfg.Params{
 	Name:        "regtest",
 	Net:         wire.TestNet,
 	DefaultPort: "29246",
 
 	// Chain parameters
 	GenesisBlock:             &regTestGenesisBlock,
-	GenesisHash:              newHashFromStr("5bec7567af40504e0994db3b573c186fffcc4edefe096ff2e58d00523bd7e8a6"),
+	GenesisHash:              newHashFromStr("f26396ed790aaffc2858204f6c3ed1a752cf116b07b99f73422b51e76265f57b"),
 	PowLimit:                 regressionPowLimit,
 	PowLimitBits:             0x207fffff,
 	CoinbaseMaturity:         100,
@@ -117,6 +119,33 @@ var regressionNetParams = &chaincfg.Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   target proof of work timespan / target proof of work spacing
+	RuleChangeActivationThreshold: 108, // 75%  of MinerConfirmationWindow
+	MinerConfirmationWindow:       144,
+	Deployments: []chaincfg.ConsensusDeployment{
+		chaincfg.DeploymentTestDummy: {
+			Name:       "dummy",
+			BitNumber:  28,
+			StartTime:  math.MaxInt64, // Never started
+			ExpireTime: math.MaxInt64, // Never expires
+		},
+		chaincfg.DeploymentCSV: {
+			Name:       "csv",
+			BitNumber:  0,
+			StartTime:  math.MaxInt64, // Never started
+			ExpireTime: math.MaxInt64, // Never expires
+		},
+		chaincfg.DeploymentSegwit: {
+			Name:       "segwit",
+			BitNumber:  1,
+			StartTime:  math.MaxInt64, // Never started
+			ExpireTime: math.MaxInt64, // Never expires
+		},
+	},
+
 	// Mempool parameters
 	RelayNonStdTxs: true,
 
@@ -133,3 +162,19 @@ var regressionNetParams = &chaincfg.Params{
 	// address generation.
 	HDCoinType: 1,
 }
+
+// ClaimTrieParams defines the ClaimTrie consensus parameters the generated
+// blocks are valid for.  The activation delays and expiration times are much
+// shorter than the ones of the LBRY networks, so the tests can exercise them
+// with a reasonable number of blocks.  The extended expiration time never takes
+// effect.
+//
+// They must be set with claimtrie.SetParams while the tests are processed.
+var ClaimTrieParams = claimtrie.Params{
+	MaxActiveDelay:    4,
+	ActiveDelayFactor: 2,
+
+	OriginalClaimExpirationTime:       20,
+	ExtendedClaimExpirationTime:       40,
+	ExtendedClaimExpirationForkHeight: 1 << 30,
+}
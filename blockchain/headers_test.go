@@ -0,0 +1,219 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// solveHeaders returns a chain of numHeaders block headers after the passed
+// one, at the difficulty of the proof of work limit.  The merkle roots are
+// derived from the passed branch so different branches have distinct headers.
+func solveHeaders(prev *wire.BlockHeader, numHeaders int, branch byte) []*wire.BlockHeader {
+	target := blockchain.CompactToBig(prev.Bits)
+	headers := make([]*wire.BlockHeader, numHeaders)
+	for i := range headers {
+		header := &wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  prev.BlockHash(),
+			MerkleRoot: chainhash.Hash{branch},
+			Timestamp:  prev.Timestamp.Add(time.Second),
+			Bits:       prev.Bits,
+		}
+		for {
+			hash := header.BlockPoWHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			header.Nonce++
+		}
+		headers[i] = header
+		prev = header
+	}
+	return headers
+}
+
+// TestProcessBlockHeader ensures headers processed without their blocks extend
+// the best header chain, whose blocks are then reported to be downloaded, and
+// that headers of chains with too little work compared to the best header chain
+// are rejected, whether the network has a minimum chain work or not.
+func TestProcessBlockHeader(t *testing.T) {
+	genesis := &fullblocktests.RegressionNetParams.GenesisBlock.Header
+	mainChain := solveHeaders(genesis, 400, 1)
+	deepFork := solveHeaders(genesis, 1, 2)
+	nearFork := solveHeaders(mainChain[200], 1, 3)
+
+	params := *fullblocktests.RegressionNetParams
+	tests := []struct {
+		name    string
+		minWork *big.Int
+	}{
+		{
+			name: "no minimum chain work",
+		},
+		{
+			// The genesis block and the 400 headers of the main chain
+			// have the minimum chain work.
+			name: "minimum chain work",
+			minWork: new(big.Int).Mul(blockchain.CalcWork(genesis.Bits),
+				big.NewInt(401)),
+		},
+	}
+
+	for _, test := range tests {
+		params.MinimumChainWork = test.minWork
+		chain, teardown, err := chainSetup(&params)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		defer teardown()
+
+		// The headers of the main chain are accepted even though the
+		// chain has less than the minimum chain work until the last one.
+		for i, header := range mainChain {
+			err := chain.ProcessBlockHeader(header, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("%s: ProcessBlockHeader #%d: %v", test.name,
+					i, err)
+			}
+		}
+		tipHash := mainChain[len(mainChain)-1].BlockHash()
+		if hash, height := chain.BestHeader(); *hash != tipHash ||
+			height != int32(len(mainChain)) {
+
+			t.Fatalf("%s: BestHeader: got %v at %d, want %v at %d",
+				test.name, hash, height, tipHash, len(mainChain))
+		}
+		locator := chain.LatestHeaderLocator()
+		if *locator[0] != tipHash ||
+			*locator[len(locator)-1] != *params.GenesisHash {
+
+			t.Fatalf("%s: LatestHeaderLocator: locator %v doesn't "+
+				"span the best header chain", test.name, locator)
+		}
+		if best := chain.BestSnapshot(); best.Height != 0 {
+			t.Fatalf("%s: main chain moved to height %d", test.name,
+				best.Height)
+		}
+
+		// The blocks of the best header chain are downloaded in order.
+		hashes := chain.BlocksToDownload(10)
+		if len(hashes) != 10 {
+			t.Fatalf("%s: BlocksToDownload: got %d blocks, want 10",
+				test.name, len(hashes))
+		}
+		for i, hash := range hashes {
+			if *hash != mainChain[i].BlockHash() {
+				t.Fatalf("%s: BlocksToDownload: block #%d is %v, "+
+					"want %v", test.name, i, hash,
+					mainChain[i].BlockHash())
+			}
+		}
+		if n := len(chain.BlocksToDownload(1000)); n != len(mainChain) {
+			t.Fatalf("%s: BlocksToDownload: got %d blocks, want %d",
+				test.name, n, len(mainChain))
+		}
+
+		// A fork near the best header is accepted, while a deep one is
+		// refused.
+		err = chain.ProcessBlockHeader(nearFork[0], blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("%s: ProcessBlockHeader of near fork: %v",
+				test.name, err)
+		}
+		err = chain.ProcessBlockHeader(deepFork[0], blockchain.BFNone)
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrLowChainWork {
+			t.Fatalf("%s: ProcessBlockHeader of deep fork: got %v, "+
+				"want %v", test.name, err, blockchain.ErrLowChainWork)
+		}
+		if hash, _ := chain.BestHeader(); *hash != tipHash {
+			t.Fatalf("%s: BestHeader moved to fork %v", test.name, hash)
+		}
+
+		// Known headers are ignored, while headers of unknown parents
+		// are refused.
+		err = chain.ProcessBlockHeader(mainChain[10], blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("%s: ProcessBlockHeader of known header: %v",
+				test.name, err)
+		}
+		unknown := *genesis
+		unknown.Nonce++
+		orphan := solveHeaders(&unknown, 1, 4)[0]
+		err = chain.ProcessBlockHeader(orphan, blockchain.BFNone)
+		rerr, ok = err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrPreviousBlockUnknown {
+			t.Fatalf("%s: ProcessBlockHeader of orphan: got %v, want "+
+				"%v", test.name, err, blockchain.ErrPreviousBlockUnknown)
+		}
+	}
+}
+
+// TestIsCheckpointed ensures only the blocks of the best header chain up to the
+// latest checkpoint are reported to be covered by it.
+func TestIsCheckpointed(t *testing.T) {
+	genesis := &fullblocktests.RegressionNetParams.GenesisBlock.Header
+	mainChain := solveHeaders(genesis, 20, 1)
+	fork := solveHeaders(mainChain[4], 1, 2)
+	checkpointHash := mainChain[9].BlockHash()
+
+	params := *fullblocktests.RegressionNetParams
+	params.Checkpoints = []chaincfg.Checkpoint{
+		{Height: 10, Hash: &checkpointHash},
+	}
+	chain, teardown, err := chainSetup(&params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+
+	// Nothing is covered until the header of the checkpoint is known.
+	hash := mainChain[0].BlockHash()
+	for _, header := range mainChain[:5] {
+		err := chain.ProcessBlockHeader(header, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlockHeader: %v", err)
+		}
+	}
+	if chain.IsCheckpointed(&hash) {
+		t.Fatalf("IsCheckpointed: block covered before the checkpoint " +
+			"is known")
+	}
+
+	for _, header := range append(mainChain[5:], fork...) {
+		err := chain.ProcessBlockHeader(header, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlockHeader: %v", err)
+		}
+	}
+	tests := []struct {
+		name   string
+		header *wire.BlockHeader
+		want   bool
+	}{
+		{name: "ancestor", header: mainChain[0], want: true},
+		{name: "checkpoint", header: mainChain[9], want: true},
+		{name: "descendant", header: mainChain[10]},
+		{name: "side chain", header: fork[0]},
+		{name: "unknown", header: solveHeaders(mainChain[19], 1, 3)[0]},
+	}
+	for _, test := range tests {
+		hash := test.header.BlockHash()
+		if got := chain.IsCheckpointed(&hash); got != test.want {
+			t.Errorf("%s: IsCheckpointed: got %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// coinStatsIndexName is the human-readable name for the index.
+	coinStatsIndexName = "utxo set statistics index"
+
+	// coinStatsSize is the size of the serialized statistics of the utxo
+	// set without the MuHash state.
+	coinStatsSize = 44
+)
+
+var (
+	// coinStatsIndexKey is the key of the utxo set statistics index and
+	// the db bucket used to house it.
+	coinStatsIndexKey = []byte("coinstatsbyhashidx")
+)
+
+// -----------------------------------------------------------------------------
+// The utxo set statistics index consists of an entry for every block in the
+// main chain which maps the hash of the block to the statistics of the utxo set
+// at that block, so they can be returned for any block without reading the utxo
+// set.  Along with the statistics, the state of the MuHash of the utxo set is
+// stored, which allows the entry of each block to be derived from the one of
+// its parent.
+//
+// The serialized format for keys and values in the bucket is:
+//   <hash> = <height><num utxos><serialized size><total><claims><supports><muhash>
+//
+//   Field           Type              Size
+//   hash            chainhash.Hash    32 bytes
+//   height          uint32            4 bytes
+//   num utxos       uint64            8 bytes
+//   serialized size uint64            8 bytes
+//   total           int64             8 bytes
+//   claims          int64             8 bytes
+//   supports        int64             8 bytes
+//   muhash          []byte            768 bytes
+//
+// The total, claims and supports are the amounts held by all outputs, by claims
+// and updates of claims, and by supports respectively.  The MuHash is serialized
+// by blockchain.MuHash.Bytes.
+// -----------------------------------------------------------------------------
+
+// serializeCoinStats returns the passed statistics of the utxo set and the
+// state of its MuHash serialized according to the format described above.
+func serializeCoinStats(stats *blockchain.UtxoSetStats, muHash *blockchain.MuHash) []byte {
+	serialized := make([]byte, coinStatsSize)
+	byteOrder.PutUint32(serialized, uint32(stats.Height))
+	byteOrder.PutUint64(serialized[4:], stats.NumUtxos)
+	byteOrder.PutUint64(serialized[12:], stats.SerializedSize)
+	byteOrder.PutUint64(serialized[20:], uint64(stats.TotalAmount))
+	byteOrder.PutUint64(serialized[28:], uint64(stats.ClaimAmount))
+	byteOrder.PutUint64(serialized[36:], uint64(stats.SupportAmount))
+	return append(serialized, muHash.Bytes()...)
+}
+
+// deserializeCoinStats decodes the statistics of the utxo set at the block with
+// the passed hash and the state of its MuHash serialized according to the
+// format described above.
+func deserializeCoinStats(hash *chainhash.Hash, serialized []byte) (*blockchain.UtxoSetStats, *blockchain.MuHash, error) {
+	if len(serialized) < coinStatsSize {
+		return nil, nil, errDeserialize("unexpected length of utxo " +
+			"set statistics")
+	}
+	muHash, err := blockchain.MuHashFromBytes(serialized[coinStatsSize:])
+	if err != nil {
+		return nil, nil, errDeserialize(err.Error())
+	}
+
+	stats := &blockchain.UtxoSetStats{
+		Height:         int32(byteOrder.Uint32(serialized)),
+		BlockHash:      *hash,
+		NumUtxos:       byteOrder.Uint64(serialized[4:]),
+		SerializedSize: byteOrder.Uint64(serialized[12:]),
+		TotalAmount:    int64(byteOrder.Uint64(serialized[20:])),
+		ClaimAmount:    int64(byteOrder.Uint64(serialized[28:])),
+		SupportAmount:  int64(byteOrder.Uint64(serialized[36:])),
+	}
+	return stats, muHash, nil
+}
+
+// CoinStatsIndex implements a utxo set statistics by block hash index.
+type CoinStatsIndex struct {
+	db database.DB
+}
+
+// Ensure the CoinStatsIndex type implements the Indexer interface.
+var _ Indexer = (*CoinStatsIndex)(nil)
+
+// Ensure the CoinStatsIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*CoinStatsIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *CoinStatsIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init initializes the hash-based utxo set statistics index.  This is part of
+// the Indexer interface.
+func (idx *CoinStatsIndex) Init() error {
+	return nil // Nothing to do.
+}
+
+// Key returns the database key to use for the index as a byte slice.  This is
+// part of the Indexer interface.
+func (idx *CoinStatsIndex) Key() []byte {
+	return coinStatsIndexKey
+}
+
+// Name returns the human-readable name of the index.  This is part of the
+// Indexer interface.
+func (idx *CoinStatsIndex) Name() string {
+	return coinStatsIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the bucket for the index.  This is
+// part of the Indexer interface.
+func (idx *CoinStatsIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(coinStatsIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer stores the statistics of the utxo
+// set at the block, which are derived from the ones of its parent and the
+// outputs the block creates and spends.  This is part of the Indexer interface.
+func (idx *CoinStatsIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(coinStatsIndexKey)
+
+	// The outputs of the genesis block are not part of the utxo set, so it
+	// is empty at the genesis block.
+	if block.Height() == 0 {
+		stats := &blockchain.UtxoSetStats{BlockHash: *block.Hash()}
+		serialized := serializeCoinStats(stats, blockchain.NewMuHash())
+		return bucket.Put(block.Hash()[:], serialized)
+	}
+
+	prevHash := &block.MsgBlock().Header.PrevBlock
+	serialized := bucket.Get(prevHash[:])
+	if serialized == nil {
+		return AssertError(fmt.Sprintf("missing utxo set statistics "+
+			"of block %v", prevHash))
+	}
+	stats, muHash, err := deserializeCoinStats(prevHash, serialized)
+	if err != nil {
+		return err
+	}
+	err = blockchain.ConnectUtxoSetStats(stats, muHash, block, stxos)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(block.Hash()[:], serializeCoinStats(stats, muHash))
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the statistics of the
+// utxo set at the block.  This is part of the Indexer interface.
+func (idx *CoinStatsIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	_ []blockchain.SpentTxOut) error {
+
+	return dbTx.Metadata().Bucket(coinStatsIndexKey).Delete(block.Hash()[:])
+}
+
+// StatsByBlockHash returns the statistics of the utxo set at the main chain
+// block with the passed hash, along with its MuHash, or nil when the block has
+// not been indexed.
+//
+// This function is safe for concurrent access.
+func (idx *CoinStatsIndex) StatsByBlockHash(hash *chainhash.Hash) (*blockchain.UtxoSetStats, error) {
+	var stats *blockchain.UtxoSetStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(coinStatsIndexKey)
+		serialized := bucket.Get(hash[:])
+		if serialized == nil {
+			return nil
+		}
+
+		var muHash *blockchain.MuHash
+		var err error
+		stats, muHash, err = deserializeCoinStats(hash, serialized)
+		if err != nil {
+			return err
+		}
+		stats.HashType = blockchain.UtxoSetHashMuHash
+		stats.Hash = muHash.Hash()
+		return nil
+	})
+	return stats, err
+}
+
+// NewCoinStatsIndex returns a new instance of an indexer that is used to create
+// a mapping of the hashes of all blocks in the main chain to the statistics of
+// the utxo set at those blocks.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewCoinStatsIndex(db database.DB) *CoinStatsIndex {
+	return &CoinStatsIndex{db: db}
+}
+
+// DropCoinStatsIndex drops the utxo set statistics index from the provided
+// database if it exists.
+func DropCoinStatsIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, coinStatsIndexKey, coinStatsIndexName, interrupt)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestCoinStatsSerialization ensures utxo set statistics and the state of their
+// MuHash round trip through the serialization used by the utxo set statistics
+// index.
+func TestCoinStatsSerialization(t *testing.T) {
+	hash := chainhash.Hash{0x01, 0x02, 0x03}
+	stats := blockchain.UtxoSetStats{
+		Height:         123456,
+		BlockHash:      hash,
+		NumUtxos:       1000,
+		SerializedSize: 68000,
+		TotalAmount:    5000000000000,
+		ClaimAmount:    2500000000,
+		SupportAmount:  100000000,
+	}
+	muHash := blockchain.NewMuHash()
+	muHash.Add([]byte{0x01})
+	muHash.Remove([]byte{0x02})
+
+	serialized := serializeCoinStats(&stats, muHash)
+	gotStats, gotMuHash, err := deserializeCoinStats(&hash, serialized)
+	if err != nil {
+		t.Fatalf("deserializeCoinStats: unexpected error: %v", err)
+	}
+	if *gotStats != stats {
+		t.Fatalf("deserializeCoinStats: mismatched stats -- got %+v, "+
+			"want %+v", *gotStats, stats)
+	}
+	if !bytes.Equal(gotMuHash.Bytes(), muHash.Bytes()) {
+		t.Fatal("deserializeCoinStats: mismatched MuHash state")
+	}
+
+	// Truncated data must be rejected.
+	_, _, err = deserializeCoinStats(&hash, serialized[:len(serialized)-1])
+	if !isDeserializeErr(err) {
+		t.Fatalf("deserializeCoinStats: unexpected error for "+
+			"truncated data: %v", err)
+	}
+}
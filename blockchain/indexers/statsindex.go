@@ -0,0 +1,203 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// statsIndexName is the human-readable name for the index.
+	statsIndexName = "block statistics index"
+)
+
+var (
+	// statsIndexKey is the key of the block statistics index and the db
+	// bucket used to house it.
+	statsIndexKey = []byte("statsbyhashidx")
+)
+
+// -----------------------------------------------------------------------------
+// The block statistics index consists of an entry for every block in the main
+// chain which maps the hash of the block to its statistics, so they don't need
+// to be calculated from the block and its spend journal each time they are
+// requested.  Building the index requires every block of the main chain, so it
+// can't be combined with pruning.
+//
+// The serialized format for keys and values in the bucket is:
+//   <hash> = <height><time><fields>
+//
+//   Field           Type              Size
+//   hash            chainhash.Hash    32 bytes
+//   height          uint32            4 bytes
+//   time            int64             8 bytes
+//   fields          []int64           8 bytes each
+//
+// The fields are the remaining int64 fields of blockchain.BlockStats in the
+// order they are declared, with the fee rate percentiles in ascending order.
+// -----------------------------------------------------------------------------
+
+// blockStatsFields returns pointers to the int64 fields of the passed block
+// statistics other than the time, in serialization order.
+func blockStatsFields(stats *blockchain.BlockStats) []*int64 {
+	return []*int64{
+		&stats.Txs, &stats.Ins, &stats.Outs,
+		&stats.TotalSize, &stats.TotalWeight, &stats.MinTxSize,
+		&stats.MaxTxSize, &stats.SegWitTxs, &stats.SegWitTotalSize,
+		&stats.SegWitTotalWeight, &stats.TotalFee, &stats.MinFee,
+		&stats.MaxFee, &stats.MedianFee, &stats.MinFeeRate,
+		&stats.MaxFeeRate, &stats.FeeRatePercentiles[0],
+		&stats.FeeRatePercentiles[1], &stats.FeeRatePercentiles[2],
+		&stats.FeeRatePercentiles[3], &stats.FeeRatePercentiles[4],
+		&stats.TotalOut, &stats.Subsidy, &stats.UtxoIncrease,
+		&stats.UtxoSizeIncrease, &stats.Claims, &stats.Supports,
+		&stats.Updates, &stats.Staked,
+	}
+}
+
+// serializeBlockStats returns the passed block statistics serialized according
+// to the format described above.
+func serializeBlockStats(stats *blockchain.BlockStats) []byte {
+	fields := blockStatsFields(stats)
+	serialized := make([]byte, 12+8*len(fields))
+	byteOrder.PutUint32(serialized, uint32(stats.Height))
+	byteOrder.PutUint64(serialized[4:], uint64(stats.Time))
+	offset := 12
+	for _, field := range fields {
+		byteOrder.PutUint64(serialized[offset:], uint64(*field))
+		offset += 8
+	}
+	return serialized
+}
+
+// deserializeBlockStats decodes block statistics serialized according to the
+// format described above.
+func deserializeBlockStats(serialized []byte) (*blockchain.BlockStats, error) {
+	var stats blockchain.BlockStats
+	fields := blockStatsFields(&stats)
+	if len(serialized) != 12+8*len(fields) {
+		return nil, errDeserialize("unexpected length of block " +
+			"statistics")
+	}
+
+	stats.Height = int32(byteOrder.Uint32(serialized))
+	stats.Time = int64(byteOrder.Uint64(serialized[4:]))
+	offset := 12
+	for _, field := range fields {
+		*field = int64(byteOrder.Uint64(serialized[offset:]))
+		offset += 8
+	}
+	return &stats, nil
+}
+
+// StatsIndex implements a block statistics by hash index.
+type StatsIndex struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+}
+
+// Ensure the StatsIndex type implements the Indexer interface.
+var _ Indexer = (*StatsIndex)(nil)
+
+// Ensure the StatsIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*StatsIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *StatsIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init initializes the hash-based block statistics index.  This is part of the
+// Indexer interface.
+func (idx *StatsIndex) Init() error {
+	return nil // Nothing to do.
+}
+
+// Key returns the database key to use for the index as a byte slice.  This is
+// part of the Indexer interface.
+func (idx *StatsIndex) Key() []byte {
+	return statsIndexKey
+}
+
+// Name returns the human-readable name of the index.  This is part of the
+// Indexer interface.
+func (idx *StatsIndex) Name() string {
+	return statsIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the bucket for the index.  This is
+// part of the Indexer interface.
+func (idx *StatsIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(statsIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer stores the statistics of the block
+// calculated from the block and the outputs it spends.  This is part of the
+// Indexer interface.
+func (idx *StatsIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	stats, err := blockchain.CalcBlockStats(block, stxos, idx.chainParams)
+	if err != nil {
+		return err
+	}
+
+	bucket := dbTx.Metadata().Bucket(statsIndexKey)
+	return bucket.Put(block.Hash()[:], serializeBlockStats(stats))
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the statistics of the
+// block.  This is part of the Indexer interface.
+func (idx *StatsIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	_ []blockchain.SpentTxOut) error {
+
+	return dbTx.Metadata().Bucket(statsIndexKey).Delete(block.Hash()[:])
+}
+
+// StatsByBlockHash returns the statistics of the main chain block with the
+// passed hash, or nil when the block has not been indexed.
+//
+// This function is safe for concurrent access.
+func (idx *StatsIndex) StatsByBlockHash(hash *chainhash.Hash) (*blockchain.BlockStats, error) {
+	var stats *blockchain.BlockStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Bucket(statsIndexKey).Get(hash[:])
+		if serialized == nil {
+			return nil
+		}
+
+		var err error
+		stats, err = deserializeBlockStats(serialized)
+		return err
+	})
+	return stats, err
+}
+
+// NewStatsIndex returns a new instance of an indexer that is used to create a
+// mapping of the hashes of all blocks in the main chain to their statistics.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewStatsIndex(db database.DB, chainParams *chaincfg.Params) *StatsIndex {
+	return &StatsIndex{db: db, chainParams: chainParams}
+}
+
+// DropStatsIndex drops the block statistics index from the provided database
+// if it exists.
+func DropStatsIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, statsIndexKey, statsIndexName, interrupt)
+}
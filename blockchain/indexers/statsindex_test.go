@@ -0,0 +1,63 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// TestBlockStatsSerialization ensures block statistics round trip through the
+// serialization used by the block statistics index.
+func TestBlockStatsSerialization(t *testing.T) {
+	stats := blockchain.BlockStats{
+		Height:             123456,
+		Time:               1530000000,
+		Txs:                3,
+		Ins:                4,
+		Outs:               6,
+		TotalSize:          600,
+		TotalWeight:        2100,
+		MinTxSize:          250,
+		MaxTxSize:          350,
+		SegWitTxs:          1,
+		SegWitTotalSize:    250,
+		SegWitTotalWeight:  700,
+		TotalFee:           30000,
+		MinFee:             10000,
+		MaxFee:             20000,
+		MedianFee:          15000,
+		MinFeeRate:         40,
+		MaxFeeRate:         57,
+		FeeRatePercentiles: [5]int64{40, 40, 57, 57, 57},
+		TotalOut:           5000000000,
+		Subsidy:            100000000,
+		UtxoIncrease:       2,
+		UtxoSizeIncrease:   -34,
+		Claims:             1,
+		Supports:           1,
+		Updates:            0,
+		Staked:             150000000,
+	}
+
+	serialized := serializeBlockStats(&stats)
+	got, err := deserializeBlockStats(serialized)
+	if err != nil {
+		t.Fatalf("deserializeBlockStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*got, stats) {
+		t.Fatalf("deserializeBlockStats: mismatched stats -- got %+v, "+
+			"want %+v", *got, stats)
+	}
+
+	// Truncated data must be rejected.
+	_, err = deserializeBlockStats(serialized[:len(serialized)-1])
+	if !isDeserializeErr(err) {
+		t.Fatalf("deserializeBlockStats: unexpected error for "+
+			"truncated data: %v", err)
+	}
+}
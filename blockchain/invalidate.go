@@ -0,0 +1,218 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// descendants returns all of the block nodes in the block index which descend
+// from the passed node, ordered by height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) descendants(node *blockNode) []*blockNode {
+	b.index.RLock()
+	var higher []*blockNode
+	for _, n := range b.index.index {
+		if n.height > node.height {
+			higher = append(higher, n)
+		}
+	}
+	b.index.RUnlock()
+
+	// Since the nodes are ordered by height, the parent of each node is
+	// visited before the node itself.
+	sort.Slice(higher, func(i, j int) bool {
+		return higher[i].height < higher[j].height
+	})
+	found := map[*blockNode]struct{}{node: {}}
+	var descendants []*blockNode
+	for _, n := range higher {
+		if _, ok := found[n.parent]; ok {
+			found[n] = struct{}{}
+			descendants = append(descendants, n)
+		}
+	}
+	return descendants
+}
+
+// findBestChainTip returns the block node with the most cumulative work the
+// main chain can be reorganized to.  That is, neither it nor any of its
+// ancestors are known to be invalid, and the data of those which are not in
+// the main chain is stored.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) findBestChainTip() *blockNode {
+	best := b.bestChain.Tip()
+
+	b.index.RLock()
+	var candidates []*blockNode
+	for _, n := range b.index.index {
+		if n.workSum.Cmp(best.workSum) > 0 {
+			candidates = append(candidates, n)
+		}
+	}
+	b.index.RUnlock()
+
+	// Remember the nodes which were already checked since the candidates
+	// typically share most of their ancestors.
+	usable := make(map[*blockNode]bool)
+	isUsable := func(node *blockNode) bool {
+		var checked []*blockNode
+		ok := true
+		for n := node; !b.bestChain.Contains(n); n = n.parent {
+			if known, found := usable[n]; found {
+				ok = known
+				break
+			}
+			status := b.index.NodeStatus(n)
+			if status.KnownInvalid() || !status.HaveData() {
+				ok = false
+				break
+			}
+			checked = append(checked, n)
+		}
+		for _, n := range checked {
+			usable[n] = ok
+		}
+		return ok
+	}
+
+	for _, n := range candidates {
+		if n.workSum.Cmp(best.workSum) > 0 && isUsable(n) {
+			best = n
+		}
+	}
+	return best
+}
+
+// activateBestChain reorganizes the main chain to the best chain which is not
+// known to be invalid.  Should a chain turn out to be invalid while it is
+// being connected, the next best one is tried.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) activateBestChain() error {
+	for {
+		tip := b.findBestChainTip()
+		if tip == b.bestChain.Tip() {
+			return nil
+		}
+
+		log.Infof("REORGANIZE: Block %v is the best valid chain tip",
+			tip.hash)
+		detachNodes, attachNodes := b.getReorganizeNodes(tip)
+		err := b.reorganizeChain(detachNodes, attachNodes)
+		if err == nil {
+			return nil
+		}
+
+		// The blocks which violate the rules are marked invalid, so
+		// the chain won't be selected again.
+		if _, ok := err.(RuleError); !ok ||
+			!b.index.NodeStatus(tip).KnownInvalid() {
+
+			return err
+		}
+		log.Warnf("Unable to connect the chain ending at block %v: %v",
+			tip.hash, err)
+	}
+}
+
+// InvalidateBlock marks the block with the given hash and all of its
+// descendants invalid.  When the block is in the main chain, the block and its
+// descendants are disconnected, and the chain is reorganized to the best
+// remaining chain which isn't known to be invalid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	if node.parent == nil {
+		return fmt.Errorf("the genesis block can't be invalidated")
+	}
+
+	// Disconnect the block and its descendants from the main chain.  The
+	// data of all of them, and their spend journal entries, are needed to
+	// do so, which isn't the case for blocks which have been pruned.
+	if b.bestChain.Contains(node) {
+		detachNodes := list.New()
+		for n := b.bestChain.Tip(); n != node.parent; n = n.parent {
+			if !b.index.NodeStatus(n).HaveData() {
+				return fmt.Errorf("block %s at height %d has been "+
+					"pruned and can't be disconnected", n.hash,
+					n.height)
+			}
+			detachNodes.PushBack(n)
+		}
+
+		log.Infof("Disconnecting %d blocks to invalidate block %v",
+			detachNodes.Len(), hash)
+		err := b.reorganizeChain(detachNodes, list.New())
+		if writeErr := b.index.flushToDB(); writeErr != nil {
+			log.Warnf("Error flushing block index changes to disk: %v",
+				writeErr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	for _, n := range b.descendants(node) {
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+
+	err := b.activateBestChain()
+	b.bestHeader.SetTip(b.findBestHeader())
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+	return err
+}
+
+// ReconsiderBlock removes the invalid status of the block with the given hash,
+// its ancestors, and its descendants, which undoes InvalidateBlock.  The chain
+// is then reorganized to the best chain which isn't known to be invalid.  The
+// blocks which actually violate the rules are marked invalid again once they
+// are validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	for n := node; n != nil; n = n.parent {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+	for _, n := range b.descendants(node) {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+
+	err := b.activateBestChain()
+	b.bestHeader.SetTip(b.findBestHeader())
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcutil"
+)
+
+// checkClaimTrieAtTip ensures the ClaimTrie of the chain is at the height of
+// the best block, and has the root committed to by its header.
+func checkClaimTrieAtTip(t *testing.T, chain *blockchain.BlockChain, context string) {
+	t.Helper()
+
+	best := chain.BestSnapshot()
+	header, err := chain.HeaderByHash(&best.Hash)
+	if err != nil {
+		t.Fatalf("%s: HeaderByHash: %v", context, err)
+	}
+	ct := chain.ClaimTrie()
+	if ct.Height() != claimtrie.Height(best.Height) {
+		t.Fatalf("%s: ClaimTrie at height %d, best block at %d",
+			context, ct.Height(), best.Height)
+	}
+	if *ct.MerkleHash() != header.ClaimTrie {
+		t.Fatalf("%s: ClaimTrie root %v, block %v commits to %v",
+			context, ct.MerkleHash(), best.Hash, header.ClaimTrie)
+	}
+}
+
+// TestReorgClaimTrie ensures the ClaimTrie follows the main chain through the
+// reorganizations of the generated tests, including those which fail part way
+// through and have the claims of the detached blocks applied again.
+func TestReorgClaimTrie(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardown, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+
+	var reorgs, failedReorgs int
+	for _, test := range tests {
+		for _, item := range test {
+			var block *btcutil.Block
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				block = btcutil.NewBlock(item.Block)
+			case fullblocktests.RejectedBlock:
+				block = btcutil.NewBlock(item.Block)
+			case fullblocktests.OrphanOrRejectedBlock:
+				block = btcutil.NewBlock(item.Block)
+			default:
+				continue
+			}
+
+			prev := chain.BestSnapshot()
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			best := chain.BestSnapshot()
+			header := block.MsgBlock().Header
+			if header.PrevBlock != prev.Hash {
+				switch {
+				case best.Hash == *block.Hash():
+					reorgs++
+				case err != nil && block.Height() > prev.Height:
+					failedReorgs++
+				}
+			}
+			checkClaimTrieAtTip(t, chain, block.Hash().String())
+		}
+	}
+	if reorgs == 0 || failedReorgs == 0 {
+		t.Fatalf("the generated tests made %d reorgs and %d failed "+
+			"reorgs", reorgs, failedReorgs)
+	}
+}
+
+// TestInvalidateBlock ensures invalidating a block of the main chain
+// disconnects it along with its descendants, and that reconsidering it
+// connects them again, with the ClaimTrie following the main chain.
+func TestInvalidateBlock(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardown, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(chain, tests)
+	tip := chain.BestSnapshot()
+
+	// Find the last block of the main chain after which the ClaimTrie root
+	// changed, so invalidating it changes the claims.
+	var invalidated *chainhash.Hash
+	var parent *chainhash.Hash
+	tipRoot := *chain.ClaimTrie().MerkleHash()
+	for height := tip.Height; height > 1 && invalidated == nil; height-- {
+		hash, err := chain.BlockHashByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockHashByHeight(%d): %v", height, err)
+		}
+		header, err := chain.HeaderByHash(hash)
+		if err != nil {
+			t.Fatalf("HeaderByHash: %v", err)
+		}
+		prevHeader, err := chain.HeaderByHash(&header.PrevBlock)
+		if err != nil {
+			t.Fatalf("HeaderByHash: %v", err)
+		}
+		if prevHeader.ClaimTrie != tipRoot {
+			invalidated, parent = hash, &header.PrevBlock
+		}
+	}
+	if invalidated == nil {
+		t.Fatal("no block of the main chain changes the ClaimTrie")
+	}
+
+	if err := chain.InvalidateBlock(invalidated); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	if chain.MainChainHasBlock(invalidated) || !chain.MainChainHasBlock(parent) {
+		t.Fatalf("InvalidateBlock: block %v still in the main chain",
+			invalidated)
+	}
+	if *chain.ClaimTrie().MerkleHash() == tipRoot {
+		t.Fatalf("InvalidateBlock: claims of block %v still applied",
+			invalidated)
+	}
+	checkClaimTrieAtTip(t, chain, "InvalidateBlock")
+
+	if err := chain.ReconsiderBlock(invalidated); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Hash != tip.Hash {
+		t.Fatalf("ReconsiderBlock: best block %v, want %v", best.Hash,
+			tip.Hash)
+	}
+	checkClaimTrieAtTip(t, chain, "ReconsiderBlock")
+
+	// Neither unknown blocks nor the genesis block can be invalidated.
+	if err := chain.InvalidateBlock(&chainhash.Hash{1}); err == nil {
+		t.Fatalf("InvalidateBlock: unknown block invalidated")
+	}
+	genesis := fullblocktests.RegressionNetParams.GenesisHash
+	if err := chain.InvalidateBlock(genesis); err == nil {
+		t.Fatalf("InvalidateBlock: genesis block invalidated")
+	}
+}
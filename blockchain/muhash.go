@@ -0,0 +1,128 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"golang.org/x/crypto/chacha20"
+)
+
+// muHashSize is the size in bytes of the numbers MuHash operates on.
+const muHashSize = 384
+
+// muHashPrime is the modulus of MuHash, 2^3072 - 1103717.
+var muHashPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072),
+	big.NewInt(1103717))
+
+// MuHash is a hash of a set of byte strings, which allows elements to be added
+// and removed in any order.  Each element is mapped to a number modulo a 3072
+// bit prime.  The numbers of the added elements are multiplied into the
+// numerator and the ones of the removed elements into the denominator, so the
+// hash of a set can be updated incrementally as its elements change.
+//
+// It is the MuHash3072 construction used by Bitcoin Core for hashing the utxo
+// set, and produces the same hashes for the same elements.
+//
+// The zero value is not usable.  Use NewMuHash instead.
+type MuHash struct {
+	numerator   big.Int
+	denominator big.Int
+}
+
+// NewMuHash returns the MuHash of an empty set.
+func NewMuHash() *MuHash {
+	var m MuHash
+	m.numerator.SetInt64(1)
+	m.denominator.SetInt64(1)
+	return &m
+}
+
+// muHashElement maps the passed element to a number by expanding its sha256
+// hash to 3072 bits with ChaCha20, which are read as a little-endian number.
+func muHashElement(data []byte) *big.Int {
+	key := sha256.Sum256(data)
+	var nonce [chacha20.NonceSize]byte
+	cipher, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	if err != nil {
+		// Impossible since the key and nonce have valid sizes.
+		panic(err)
+	}
+	var buf [muHashSize]byte
+	cipher.XORKeyStream(buf[:], buf[:])
+	reverseBytes(buf[:])
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// reverseBytes reverses the passed bytes in place to convert between the
+// little-endian serialization of MuHash numbers and the big-endian one of
+// big.Int.
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// Add adds the passed element to the set.
+func (m *MuHash) Add(data []byte) {
+	m.numerator.Mul(&m.numerator, muHashElement(data))
+	m.numerator.Mod(&m.numerator, muHashPrime)
+}
+
+// Remove removes the passed element from the set.  It must have been added
+// before, or be added afterwards.
+func (m *MuHash) Remove(data []byte) {
+	m.denominator.Mul(&m.denominator, muHashElement(data))
+	m.denominator.Mod(&m.denominator, muHashPrime)
+}
+
+// Hash returns the hash of the set, which is the sha256 of the numerator
+// divided by the denominator.
+func (m *MuHash) Hash() chainhash.Hash {
+	var n big.Int
+	n.ModInverse(&m.denominator, muHashPrime)
+	n.Mul(&n, &m.numerator)
+	n.Mod(&n, muHashPrime)
+
+	var buf [muHashSize]byte
+	n.FillBytes(buf[:])
+	reverseBytes(buf[:])
+	return chainhash.Hash(sha256.Sum256(buf[:]))
+}
+
+// Bytes returns the serialized state of the hash, which is the numerator and
+// the denominator as little-endian numbers.
+func (m *MuHash) Bytes() []byte {
+	serialized := make([]byte, 2*muHashSize)
+	m.numerator.FillBytes(serialized[:muHashSize])
+	reverseBytes(serialized[:muHashSize])
+	m.denominator.FillBytes(serialized[muHashSize:])
+	reverseBytes(serialized[muHashSize:])
+	return serialized
+}
+
+// MuHashFromBytes returns the hash whose state was serialized by Bytes.
+func MuHashFromBytes(serialized []byte) (*MuHash, error) {
+	if len(serialized) != 2*muHashSize {
+		return nil, errDeserialize("unexpected length of MuHash state")
+	}
+
+	var m MuHash
+	buf := make([]byte, muHashSize)
+	copy(buf, serialized[:muHashSize])
+	reverseBytes(buf)
+	m.numerator.SetBytes(buf)
+	copy(buf, serialized[muHashSize:])
+	reverseBytes(buf)
+	m.denominator.SetBytes(buf)
+	if m.numerator.Cmp(muHashPrime) >= 0 || m.denominator.Sign() == 0 ||
+		m.denominator.Cmp(muHashPrime) >= 0 {
+
+		return nil, errDeserialize("invalid MuHash state")
+	}
+	return &m, nil
+}
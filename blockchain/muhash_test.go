@@ -0,0 +1,80 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// muHashTestElement returns the test element of Bitcoin Core's MuHash3072
+// tests for the passed number.
+func muHashTestElement(i byte) []byte {
+	element := make([]byte, 32)
+	element[0] = i
+	return element
+}
+
+// TestMuHash ensures MuHash produces the hashes of Bitcoin Core's MuHash3072
+// regardless of the order elements are added and removed in, and that its
+// state survives serialization.
+func TestMuHash(t *testing.T) {
+	t.Parallel()
+
+	// Hash of the set containing elements 0 and 1 after element 2 has been
+	// removed, from Bitcoin Core's muhash_tests.
+	const want = "10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863"
+
+	m := NewMuHash()
+	m.Add(muHashTestElement(0))
+	m.Add(muHashTestElement(1))
+	m.Remove(muHashTestElement(2))
+	if got := m.Hash().String(); got != want {
+		t.Fatalf("unexpected hash: got %s, want %s", got, want)
+	}
+
+	reordered := NewMuHash()
+	reordered.Remove(muHashTestElement(2))
+	reordered.Add(muHashTestElement(1))
+	reordered.Add(muHashTestElement(0))
+	if got := reordered.Hash().String(); got != want {
+		t.Fatalf("unexpected hash of reordered elements: got %s, "+
+			"want %s", got, want)
+	}
+
+	// Adding and removing the same element leaves the hash unchanged.
+	m.Add(muHashTestElement(3))
+	m.Remove(muHashTestElement(3))
+	if got := m.Hash().String(); got != want {
+		t.Fatalf("unexpected hash after adding and removing an "+
+			"element: got %s, want %s", got, want)
+	}
+
+	serialized := m.Bytes()
+	restored, err := MuHashFromBytes(serialized)
+	if err != nil {
+		t.Fatalf("MuHashFromBytes: %v", err)
+	}
+	if !bytes.Equal(restored.Bytes(), serialized) {
+		t.Fatal("MuHashFromBytes: state changed by serialization")
+	}
+	if got := restored.Hash().String(); got != want {
+		t.Fatalf("unexpected hash of restored state: got %s, want %s",
+			got, want)
+	}
+
+	if _, err := MuHashFromBytes(serialized[1:]); !isDeserializeErr(err) {
+		t.Fatalf("MuHashFromBytes: unexpected error for truncated "+
+			"state: %v", err)
+	}
+	zeroDenominator := append([]byte(nil), serialized...)
+	for i := muHashSize; i < len(zeroDenominator); i++ {
+		zeroDenominator[i] = 0
+	}
+	if _, err := MuHashFromBytes(zeroDenominator); !isDeserializeErr(err) {
+		t.Fatalf("MuHashFromBytes: unexpected error for zero "+
+			"denominator: %v", err)
+	}
+}
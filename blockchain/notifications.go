@@ -6,6 +6,9 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -29,6 +32,13 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTChainReorganized indicates blocks were disconnected from the main
+	// chain, and other blocks possibly connected in their place.  It is
+	// sent once all of the blocks have been disconnected and connected,
+	// after the individual NTBlockDisconnected and NTBlockConnected
+	// notifications.
+	NTChainReorganized
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -37,6 +47,7 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTChainReorganized:  "NTChainReorganized",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -53,11 +64,30 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *btcutil.Block
 // 	- NTBlockConnected:    *btcutil.Block
 // 	- NTBlockDisconnected: *btcutil.Block
+// 	- NTChainReorganized:  *ChainReorganization
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// ChainReorganization describes a reorganization of the main chain.  It is the
+// data of the NTChainReorganized notification.
+type ChainReorganization struct {
+	// ForkHash and ForkHeight identify the last block the old and the new
+	// main chains have in common.
+	ForkHash   chainhash.Hash
+	ForkHeight int32
+
+	// DetachedBlocks are the blocks disconnected from the main chain, in
+	// the order they were disconnected, starting with the old tip.
+	DetachedBlocks []*btcutil.Block
+
+	// AttachedBlocks are the blocks connected to the main chain, in the
+	// order they were connected, ending with the new tip.  It is empty when
+	// blocks were only disconnected.
+	AttachedBlocks []*btcutil.Block
+}
+
 // Subscribe to block chain notifications. Registers a callback to be executed
 // when various events take place. See the documentation on Notification and
 // NotificationType for details on the types and contents of notifications.
@@ -0,0 +1,165 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcutil"
+)
+
+// checkLinked ensures each of the passed blocks is the parent of the previous
+// one when descending is set, or the child of it otherwise.
+func checkLinked(t *testing.T, context string, blocks []*btcutil.Block, descending bool) {
+	t.Helper()
+	for i := 1; i < len(blocks); i++ {
+		parent, child := blocks[i-1], blocks[i]
+		if descending {
+			parent, child = child, parent
+		}
+		if child.MsgBlock().Header.PrevBlock != *parent.Hash() {
+			t.Fatalf("%s: block %v doesn't follow block %v", context,
+				child.Hash(), parent.Hash())
+		}
+	}
+}
+
+// TestChainReorganizedNotification ensures the NTChainReorganized notification
+// of each reorganization of the generated tests identifies the fork point, and
+// lists the blocks disconnected from the old tip down to the fork point and the
+// blocks connected from the fork point up to the new tip, in the order of their
+// NTBlockDisconnected and NTBlockConnected notifications.
+func TestChainReorganizedNotification(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardown, err := chainSetup(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+
+	var connected, disconnected []*btcutil.Block
+	var reorgs []*blockchain.ChainReorganization
+	chain.Subscribe(func(n *blockchain.Notification) {
+		switch n.Type {
+		case blockchain.NTBlockConnected:
+			connected = append(connected, n.Data.(*btcutil.Block))
+		case blockchain.NTBlockDisconnected:
+			disconnected = append(disconnected, n.Data.(*btcutil.Block))
+		case blockchain.NTChainReorganized:
+			reorgs = append(reorgs, n.Data.(*blockchain.ChainReorganization))
+		}
+	})
+
+	sameBlocks := func(a, b []*btcutil.Block) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if *a[i].Hash() != *b[i].Hash() {
+				return false
+			}
+		}
+		return true
+	}
+
+	var numReorgs int
+	for _, test := range tests {
+		for _, item := range test {
+			var block *btcutil.Block
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				block = btcutil.NewBlock(item.Block)
+			case fullblocktests.RejectedBlock:
+				block = btcutil.NewBlock(item.Block)
+			case fullblocktests.OrphanOrRejectedBlock:
+				block = btcutil.NewBlock(item.Block)
+			default:
+				continue
+			}
+
+			connected, disconnected, reorgs = nil, nil, nil
+			prev := chain.BestSnapshot()
+			chain.ProcessBlock(block, blockchain.BFNone)
+			best := chain.BestSnapshot()
+			context := block.Hash().String()
+
+			// Only the blocks which disconnect blocks from the main
+			// chain reorganize it.
+			if len(disconnected) == 0 {
+				if len(reorgs) != 0 {
+					t.Fatalf("%s: reorganization notified without "+
+						"disconnected blocks", context)
+				}
+				continue
+			}
+			if len(reorgs) != 1 {
+				t.Fatalf("%s: got %d reorganization notifications, "+
+					"want 1", context, len(reorgs))
+			}
+			numReorgs++
+			reorg := reorgs[0]
+
+			if !sameBlocks(reorg.DetachedBlocks, disconnected) ||
+				!sameBlocks(reorg.AttachedBlocks, connected) {
+
+				t.Fatalf("%s: reorganization lists don't match the "+
+					"disconnected and connected blocks", context)
+			}
+			checkLinked(t, context, reorg.DetachedBlocks, true)
+			checkLinked(t, context, reorg.AttachedBlocks, false)
+
+			// The detached blocks span the old tip down to the fork
+			// point, and the attached ones the fork point up to the
+			// new tip.
+			detached := reorg.DetachedBlocks
+			if *detached[0].Hash() != prev.Hash {
+				t.Fatalf("%s: first detached block %v isn't the old "+
+					"tip %v", context, detached[0].Hash(), prev.Hash)
+			}
+			last := detached[len(detached)-1]
+			if last.MsgBlock().Header.PrevBlock != reorg.ForkHash {
+				t.Fatalf("%s: last detached block %v doesn't follow "+
+					"the fork point %v", context, last.Hash(),
+					reorg.ForkHash)
+			}
+			if int32(len(detached)) != prev.Height-reorg.ForkHeight {
+				t.Fatalf("%s: %d blocks detached from height %d to "+
+					"fork height %d", context, len(detached),
+					prev.Height, reorg.ForkHeight)
+			}
+			height, err := chain.BlockHeightByHash(&reorg.ForkHash)
+			if err != nil || height != reorg.ForkHeight {
+				t.Fatalf("%s: fork point %v at height %d isn't in "+
+					"the main chain at height %d", context,
+					reorg.ForkHash, reorg.ForkHeight, height)
+			}
+			tipHash := reorg.ForkHash
+			if attached := reorg.AttachedBlocks; len(attached) != 0 {
+				first := attached[0]
+				if first.MsgBlock().Header.PrevBlock != reorg.ForkHash {
+					t.Fatalf("%s: first attached block %v doesn't "+
+						"follow the fork point %v", context,
+						first.Hash(), reorg.ForkHash)
+				}
+				tipHash = *attached[len(attached)-1].Hash()
+			}
+			if tipHash != best.Hash {
+				t.Fatalf("%s: reorganization ends at %v, new tip is %v",
+					context, tipHash, best.Hash)
+			}
+		}
+	}
+	if numReorgs == 0 {
+		t.Fatal("the generated tests made no reorganizations")
+	}
+}
@@ -6,10 +6,12 @@ package blockchain
 
 import (
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
@@ -34,13 +36,19 @@ const (
 )
 
 // blockExists determines whether a block with the given hash exists either in
-// the main chain or any side chains.
+// the main chain or any side chains.  Blocks of which only the header is known
+// don't exist yet.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
 	// Check block index first (could be main chain or side chain blocks).
-	if b.index.HaveBlock(hash) {
-		return true, nil
+	// The blocks of the main chain whose data has been pruned still exist
+	// since they have been processed already.
+	if node := b.index.LookupNode(hash); node != nil {
+		exists := b.index.NodeStatus(node).HaveData() ||
+			(b.bestChain.Contains(node) &&
+				!b.awaitsSnapshotValidation(node))
+		return exists, nil
 	}
 
 	// Check in the database.
@@ -71,6 +79,56 @@ func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
 	return exists, err
 }
 
+// checkPreviousCheckpoint performs some additional checks on the passed block
+// header based on the previous checkpoint.  This provides a few nice properties
+// such as preventing old side chain blocks before the last checkpoint,
+// rejecting easy to mine, but otherwise bogus, blocks that could be used to eat
+// memory, and ensuring expected (versus claimed) proof of work requirements
+// since the previous checkpoint are met.
+//
+// The flags modify the behavior of this function as follows:
+//  - BFFastAdd: The proof of work is not compared to the minimum expected
+//    based on the previous checkpoint.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkPreviousCheckpoint(header *wire.BlockHeader, flags BehaviorFlags) error {
+	checkpointNode, err := b.findPreviousCheckpoint()
+	if err != nil || checkpointNode == nil {
+		return err
+	}
+
+	// Ensure the block timestamp is after the checkpoint timestamp.
+	checkpointTime := time.Unix(checkpointNode.timestamp, 0)
+	if header.Timestamp.Before(checkpointTime) {
+		str := fmt.Sprintf("block %v has timestamp %v before "+
+			"last checkpoint timestamp %v", header.BlockHash(),
+			header.Timestamp, checkpointTime)
+		return ruleError(ErrCheckpointTimeTooOld, str)
+	}
+
+	fastAdd := flags&BFFastAdd == BFFastAdd
+	if !fastAdd {
+		// Even though the checks prior to now have already ensured the
+		// proof of work exceeds the claimed amount, the claimed amount
+		// is a field in the block header which could be forged.  This
+		// check ensures the proof of work is at least the minimum
+		// expected based on elapsed time since the last checkpoint and
+		// maximum adjustment allowed by the retarget rules.
+		duration := header.Timestamp.Sub(checkpointTime)
+		requiredTarget := CompactToBig(b.calcEasiestDifficulty(
+			checkpointNode.bits, duration))
+		currentTarget := CompactToBig(header.Bits)
+		if currentTarget.Cmp(requiredTarget) > 0 {
+			str := fmt.Sprintf("block target difficulty of %064x "+
+				"is too low when compared to the previous "+
+				"checkpoint", currentTarget)
+			return ruleError(ErrDifficultyTooLow, str)
+		}
+	}
+
+	return nil
+}
+
 // processOrphans determines if there are any orphans which depend on the passed
 // block hash (they are no longer orphans if true) and potentially accepts them.
 // It repeats the process for the newly accepted blocks (to detect further
@@ -143,8 +201,6 @@ func (b *BlockChain) ProcessBlock(block *btcutil.Block, flags BehaviorFlags) (bo
 	b.chainLock.Lock()
 	defer b.chainLock.Unlock()
 
-	fastAdd := flags&BFFastAdd == BFFastAdd
-
 	blockHash := block.Hash()
 	log.Tracef("Processing block %v", blockHash)
 
@@ -170,45 +226,22 @@ func (b *BlockChain) ProcessBlock(block *btcutil.Block, flags BehaviorFlags) (bo
 		return false, false, err
 	}
 
-	// Find the previous checkpoint and perform some additional checks based
-	// on the checkpoint.  This provides a few nice properties such as
-	// preventing old side chain blocks before the last checkpoint,
-	// rejecting easy to mine, but otherwise bogus, blocks that could be
-	// used to eat memory, and ensuring expected (versus claimed) proof of
-	// work requirements since the previous checkpoint are met.
+	// The blocks below a loaded utxo snapshot are part of the main chain
+	// already.  They are only stored so they can be validated in the
+	// background.
+	if node := b.index.LookupNode(blockHash); node != nil &&
+		b.awaitsSnapshotValidation(node) {
+
+		err := b.storeSnapshotHistoryBlock(node, block, flags)
+		return err == nil, false, err
+	}
+
+	// Perform some additional checks based on the previous checkpoint.
 	blockHeader := &block.MsgBlock().Header
-	checkpointNode, err := b.findPreviousCheckpoint()
+	err = b.checkPreviousCheckpoint(blockHeader, flags)
 	if err != nil {
 		return false, false, err
 	}
-	if checkpointNode != nil {
-		// Ensure the block timestamp is after the checkpoint timestamp.
-		checkpointTime := time.Unix(checkpointNode.timestamp, 0)
-		if blockHeader.Timestamp.Before(checkpointTime) {
-			str := fmt.Sprintf("block %v has timestamp %v before "+
-				"last checkpoint timestamp %v", blockHash,
-				blockHeader.Timestamp, checkpointTime)
-			return false, false, ruleError(ErrCheckpointTimeTooOld, str)
-		}
-		if !fastAdd {
-			// Even though the checks prior to now have already ensured the
-			// proof of work exceeds the claimed amount, the claimed amount
-			// is a field in the block header which could be forged.  This
-			// check ensures the proof of work is at least the minimum
-			// expected based on elapsed time since the last checkpoint and
-			// maximum adjustment allowed by the retarget rules.
-			duration := blockHeader.Timestamp.Sub(checkpointTime)
-			requiredTarget := CompactToBig(b.calcEasiestDifficulty(
-				checkpointNode.bits, duration))
-			currentTarget := CompactToBig(blockHeader.Bits)
-			if currentTarget.Cmp(requiredTarget) > 0 {
-				str := fmt.Sprintf("block target difficulty of %064x "+
-					"is too low when compared to the previous "+
-					"checkpoint", currentTarget)
-				return false, false, ruleError(ErrDifficultyTooLow, str)
-			}
-		}
-	}
 
 	// Handle orphan blocks.
 	prevHash := &blockHeader.PrevBlock
@@ -242,3 +275,104 @@ func (b *BlockChain) ProcessBlock(block *btcutil.Block, flags BehaviorFlags) (bo
 
 	return isMainChain, false, nil
 }
+
+// maxHeaderForkDepth is the number of blocks, at the difficulty of the best
+// header, the work of a chain whose headers are processed without their blocks
+// may fall short of the best header chain by.  It matches the depth of the
+// reorgs pruned nodes can handle.
+const maxHeaderForkDepth = MinBlocksToKeep
+
+// checkHeaderWork ensures the chain ended by the passed block node, whose
+// header is processed without its block, has enough work to be added to the
+// block index.  That is the case when its work falls short of the best header
+// chain by no more than maxHeaderForkDepth blocks.  Otherwise, the headers of
+// cheap forks from the low difficulty blocks at the start of the chain could
+// grow the block index without bounds.
+//
+// The headers of the chain being synced always extend the best header chain, so
+// they are never refused.  Deeper forks with more work than the best header
+// chain can still be reached by processing their blocks.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkHeaderWork(node *blockNode) error {
+	best := b.bestHeader.Tip()
+	maxShortfall := new(big.Int).Mul(CalcWork(best.bits),
+		big.NewInt(maxHeaderForkDepth))
+	shortfall := new(big.Int).Sub(best.workSum, node.workSum)
+	if shortfall.Cmp(maxShortfall) > 0 {
+		str := fmt.Sprintf("block header %v at height %d has too "+
+			"little cumulative work compared to the best header %v",
+			node.hash, node.height, best.hash)
+		return ruleError(ErrLowChainWork, str)
+	}
+	return nil
+}
+
+// ProcessBlockHeader handles the insertion of a block header into the block
+// index without the rest of the block.  The header must pass the same header
+// checks as the one of a full block, connect to a block which is already known
+// and not known to be invalid, and end a chain with enough work as described by
+// checkHeaderWork.  This allows the headers of the best chain to be validated
+// and persisted before the blocks themselves are downloaded, which can then
+// happen in any order and from any peer.
+//
+// Headers which are already known are ignored, unless they are known to be
+// invalid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	blockHash := header.BlockHash()
+	log.Tracef("Processing block header %v", blockHash)
+
+	if node := b.index.LookupNode(&blockHash); node != nil {
+		if b.index.NodeStatus(node).KnownInvalid() {
+			str := fmt.Sprintf("block %v is known to be invalid",
+				blockHash)
+			return ruleError(ErrDuplicateBlock, str)
+		}
+		return nil
+	}
+
+	// Perform preliminary sanity checks on the header, and the additional
+	// checks based on the previous checkpoint.
+	err := checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, flags)
+	if err != nil {
+		return err
+	}
+	err = b.checkPreviousCheckpoint(header, flags)
+	if err != nil {
+		return err
+	}
+
+	prevNode := b.index.LookupNode(&header.PrevBlock)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %s is unknown",
+			header.PrevBlock)
+		return ruleError(ErrPreviousBlockUnknown, str)
+	} else if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %s is known to be invalid",
+			header.PrevBlock)
+		return ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	// The header must pass all of the validation rules which depend on its
+	// position within the block chain.
+	err = b.checkBlockHeaderContext(header, prevNode, flags)
+	if err != nil {
+		return err
+	}
+
+	// Create a new block node without any data for the header and add it
+	// to the block index, unless its chain has too little work.
+	newNode := newBlockNode(header, prevNode)
+	if err := b.checkHeaderWork(newNode); err != nil {
+		return err
+	}
+	b.index.AddNode(newNode)
+	b.updateBestHeader(newNode)
+	return b.index.flushToDB()
+}
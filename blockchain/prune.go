@@ -0,0 +1,135 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+)
+
+// MinBlocksToKeep is the number of blocks at the end of the main chain which
+// are never pruned.  It allows reorgs of that depth to be handled, and matches
+// the number of blocks peers expect to be served by nodes which signal
+// NODE_NETWORK_LIMITED.
+const MinBlocksToKeep = 288
+
+// pruneBlocks deletes the oldest stored blocks, along with their spend journal
+// entries, until the stored blocks fit in the prune target.  The block headers
+// are kept in the block index.
+//
+// The blocks connected after the last flush of the utxo cache are kept too
+// since they are needed to bring the utxo set up to date after an unclean
+// shutdown.
+//
+// This function MUST be called with the chain state lock held (for writes),
+// along with the commit lock once the chain has been created.
+func (b *BlockChain) pruneBlocks() error {
+	keepHeight := b.bestChain.Tip().height - MinBlocksToKeep
+	flushed := b.index.LookupNode(&b.utxoCache.lastFlushHash)
+	if flushed != nil && flushed.height < keepHeight {
+		keepHeight = flushed.height
+	}
+	// The blocks up to a loaded utxo snapshot are kept until all of them
+	// have been validated in the background, since the validation reads
+	// the ones it already validated again after a restart.
+	snapshotHeight := int32(-1)
+	if sv := b.snapshot; sv != nil && !sv.invalid {
+		snapshotHeight = sv.node.height
+	}
+	keep := func(hash *chainhash.Hash) bool {
+		node := b.index.LookupNode(hash)
+		return node == nil || node.height > keepHeight ||
+			node.height <= snapshotHeight
+	}
+
+	pruned, err := b.db.PruneBlocks(b.pruneTarget, keep)
+	if err != nil || len(pruned) == 0 {
+		return err
+	}
+
+	// The spend journal entries are only needed to disconnect the blocks,
+	// which is no longer possible.
+	err = b.db.Update(func(dbTx database.Tx) error {
+		for i := range pruned {
+			err := dbRemoveSpendJournalEntry(dbTx, &pruned[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range pruned {
+		if node := b.index.LookupNode(&pruned[i]); node != nil {
+			b.index.UnsetStatusFlags(node, statusDataStored)
+		}
+	}
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+	b.pruned = true
+
+	log.Infof("Pruned %d blocks at or below height %d", len(pruned),
+		keepHeight)
+	return nil
+}
+
+// IsPruned returns whether any blocks have been deleted from the database by
+// pruning.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsPruned() bool {
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
+
+	return b.pruned
+}
+
+// BlockPruned returns whether the block with the given hash is known, but its
+// data has been deleted by pruning.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockPruned(hash *chainhash.Hash) bool {
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
+
+	if !b.pruned {
+		return false
+	}
+	node := b.index.LookupNode(hash)
+	return node != nil && !b.index.NodeStatus(node).HaveData()
+}
+
+// PruneHeight returns the height of the first block in the main chain whose
+// data is still stored, which is the genesis block unless blocks have been
+// pruned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PruneHeight() int32 {
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
+
+	if !b.pruned {
+		return 0
+	}
+
+	// Blocks are pruned oldest first, so a binary search finds the first
+	// one which is still stored.
+	tip := b.bestChain.Tip()
+	low, high := int32(0), tip.height
+	for low < high {
+		mid := low + (high-low)/2
+		node := b.bestChain.NodeByHeight(mid)
+		if b.index.NodeStatus(node).HaveData() {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low
+}
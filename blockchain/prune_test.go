@@ -0,0 +1,138 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+)
+
+// pruneTestDB is a database which prunes the blocks of the main chain of the
+// chain, oldest first, as if each of them was stored in its own file.
+type pruneTestDB struct {
+	database.DB
+	chain  *BlockChain
+	pruned map[chainhash.Hash]bool
+}
+
+// PruneBlocks prunes the main chain blocks up to the first one which must be
+// kept, ignoring the target size.
+func (db *pruneTestDB) PruneBlocks(targetSize uint64, keep func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error) {
+	var pruned []chainhash.Hash
+	for node := db.chain.bestChain.Genesis(); node != nil; node = db.chain.bestChain.Next(node) {
+		if db.pruned[node.hash] {
+			continue
+		}
+		if keep(&node.hash) {
+			break
+		}
+		db.pruned[node.hash] = true
+		pruned = append(pruned, node.hash)
+	}
+	return pruned, nil
+}
+
+// TestPruneBlocks ensures the blocks within MinBlocksToKeep of the tip, and
+// the blocks connected after the last flush of the utxo cache, are never
+// pruned, and that the pruned blocks lose their data and spend journal
+// entries.
+func TestPruneBlocks(t *testing.T) {
+	chain, teardown, err := chainSetup("pruneblocks",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+
+	// Extend the main chain with stored blocks which have spend journal
+	// entries.
+	nodes := chainedNodes(chain.bestChain.Tip(), MinBlocksToKeep+100)
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		for _, node := range nodes {
+			chain.index.AddNode(node)
+			chain.index.SetStatusFlags(node, statusDataStored|statusValid)
+			stxos := []SpentTxOut{{Amount: 1, PkScript: []byte{0x51}}}
+			err := dbPutSpendJournalEntry(dbTx, &node.hash, stxos)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dbPutSpendJournalEntry: %v", err)
+	}
+	tip := tstTip(nodes)
+	chain.bestChain.SetTip(tip)
+	chain.db = &pruneTestDB{
+		DB:     chain.db,
+		chain:  chain,
+		pruned: make(map[chainhash.Hash]bool),
+	}
+	chain.pruneTarget = 1
+
+	hasSpendJournal := func(hash *chainhash.Hash) bool {
+		var has bool
+		err := chain.db.View(func(dbTx database.Tx) error {
+			spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+			has = spendBucket.Get(hash[:]) != nil
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("View: %v", err)
+		}
+		return has
+	}
+
+	tests := []struct {
+		name        string
+		lastFlushed *blockNode
+		pruneHeight int32
+	}{
+		{
+			name:        "flushed below the blocks to keep",
+			lastFlushed: nodes[49],
+			pruneHeight: 51,
+		},
+		{
+			name:        "flushed at the tip",
+			lastFlushed: tip,
+			pruneHeight: tip.height - MinBlocksToKeep + 1,
+		},
+		{
+			name:        "nothing more to prune",
+			lastFlushed: tip,
+			pruneHeight: tip.height - MinBlocksToKeep + 1,
+		},
+	}
+
+	for _, test := range tests {
+		chain.utxoCache.lastFlushHash = test.lastFlushed.hash
+		if err := chain.pruneBlocks(); err != nil {
+			t.Fatalf("%s: pruneBlocks: %v", test.name, err)
+		}
+		if !chain.IsPruned() {
+			t.Fatalf("%s: chain not flagged as pruned", test.name)
+		}
+		if got := chain.PruneHeight(); got != test.pruneHeight {
+			t.Fatalf("%s: prune height %d, want %d", test.name, got,
+				test.pruneHeight)
+		}
+		for _, node := range nodes {
+			pruned := node.height < test.pruneHeight
+			if chain.BlockPruned(&node.hash) != pruned {
+				t.Fatalf("%s: block %d pruned: %v", test.name,
+					node.height, !pruned)
+			}
+			if hasSpendJournal(&node.hash) == pruned {
+				t.Fatalf("%s: spend journal entry of block %d "+
+					"kept: %v", test.name, node.height, !pruned)
+			}
+		}
+	}
+}
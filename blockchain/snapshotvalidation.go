@@ -0,0 +1,565 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+// snapshotProgressInterval is the number of blocks below a loaded utxo snapshot
+// after which the progress of their background validation is logged.
+const snapshotProgressInterval = 10000
+
+// snapshotValidation tracks the validation of the blocks of the main chain up to
+// a loaded utxo snapshot.  The blocks are connected to a separate chain state,
+// starting at the genesis block, as their data arrives.  Once the block of the
+// snapshot has been connected, the resulting utxo set must match the one of
+// the snapshot.
+//
+// The utxo set of the separate chain state is housed in its own bucket, while
+// its ClaimTrie is only kept in memory.  After a restart, the validation
+// resumes at the block the utxo set was last flushed at, and the ClaimTrie is
+// rebuilt up to it from the spend journal entries of the validated blocks.
+type snapshotValidation struct {
+	// node is the block of the snapshot, and utxoSetHash the hash of its
+	// utxo set.
+	node        *blockNode
+	utxoSetHash chainhash.Hash
+
+	// tip is the last block which has been validated, and invalid
+	// indicates the validation failed.
+	tip     *blockNode
+	invalid bool
+
+	utxoCache *utxoCache
+	claimTrie *claimtrie.ClaimTrie
+
+	// blockStored is signaled whenever the data of a block below the
+	// snapshot has been stored.
+	blockStored chan struct{}
+}
+
+// SnapshotValidationState describes the progress of the background validation
+// of the blocks below a loaded utxo snapshot.
+type SnapshotValidationState struct {
+	// SnapshotHeight is the height of the snapshot block, and
+	// ValidatedHeight the one of the last block which has been validated.
+	SnapshotHeight  int32
+	ValidatedHeight int32
+
+	// Invalid indicates one of the blocks is invalid, or the resulting
+	// utxo set does not match the snapshot.
+	Invalid bool
+}
+
+// SnapshotValidation returns the progress of the background validation of the
+// blocks below a loaded utxo snapshot.  It returns nil when no snapshot has
+// been loaded, or its blocks have been validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotValidation() *SnapshotValidationState {
+	b.snapshotLock.RLock()
+	defer b.snapshotLock.RUnlock()
+
+	sv := b.snapshot
+	if sv == nil {
+		return nil
+	}
+	state := &SnapshotValidationState{
+		SnapshotHeight: sv.node.height,
+		Invalid:        sv.invalid,
+	}
+	if sv.tip != nil {
+		state.ValidatedHeight = sv.tip.height
+	}
+	return state
+}
+
+// -----------------------------------------------------------------------------
+// The state of a loaded utxo snapshot is stored until the blocks below it have
+// been validated.
+//
+// The serialized format is:
+//
+//   <block hash><utxo set hash><status>
+//
+//   Field             Type             Size
+//   block hash        chainhash.Hash   32 bytes
+//   utxo set hash     chainhash.Hash   32 bytes
+//   status            byte             1 byte
+// -----------------------------------------------------------------------------
+
+// dbPutUtxoSnapshotState uses an existing database transaction to store the
+// state of a loaded utxo snapshot.
+func dbPutUtxoSnapshotState(dbTx database.Tx, blockHash, utxoSetHash *chainhash.Hash, status byte) error {
+	serialized := make([]byte, 2*chainhash.HashSize+1)
+	copy(serialized, blockHash[:])
+	copy(serialized[chainhash.HashSize:], utxoSetHash[:])
+	serialized[2*chainhash.HashSize] = status
+	return dbTx.Metadata().Put(utxoSnapshotKeyName, serialized)
+}
+
+// dbFetchUtxoSnapshotState uses an existing database transaction to fetch the
+// state of a loaded utxo snapshot.  A nil block hash is returned when there is
+// none.
+func dbFetchUtxoSnapshotState(dbTx database.Tx) (*chainhash.Hash, *chainhash.Hash, byte, error) {
+	serialized := dbTx.Metadata().Get(utxoSnapshotKeyName)
+	if serialized == nil {
+		return nil, nil, 0, nil
+	}
+	if len(serialized) != 2*chainhash.HashSize+1 {
+		return nil, nil, 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo snapshot state",
+		}
+	}
+
+	var blockHash, utxoSetHash chainhash.Hash
+	copy(blockHash[:], serialized)
+	copy(utxoSetHash[:], serialized[chainhash.HashSize:])
+	return &blockHash, &utxoSetHash, serialized[2*chainhash.HashSize], nil
+}
+
+// discardUtxoSnapshot resets the utxo set to the outputs of the genesis block
+// after loading a utxo snapshot failed with the passed error, which is
+// returned.
+//
+// This function MUST be called with the chain state lock and the commit lock
+// held (for writes).
+func (b *BlockChain) discardUtxoSnapshot(err error) error {
+	dbErr := b.db.Update(func(dbTx database.Tx) error {
+		err := dbResetUtxoSet(dbTx, utxoSetBucketName,
+			b.chainParams.GenesisBlock)
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(utxoSnapshotLoadKeyName)
+	})
+	if dbErr != nil {
+		log.Errorf("Unable to discard the outputs of the utxo "+
+			"snapshot: %v", dbErr)
+	}
+	return err
+}
+
+// discardIncompleteUtxoSnapshot resets the utxo set to the outputs of the
+// genesis block when loading a utxo snapshot was interrupted.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) discardIncompleteUtxoSnapshot() error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Get(utxoSnapshotLoadKeyName) == nil {
+			return nil
+		}
+
+		log.Warnf("Discarding the outputs of a utxo snapshot which " +
+			"weren't loaded completely")
+		err := dbResetUtxoSet(dbTx, utxoSetBucketName,
+			b.chainParams.GenesisBlock)
+		if err != nil {
+			return err
+		}
+		tip := b.bestChain.Tip()
+		if err := dbPutUtxoStateConsistency(dbTx, &tip.hash); err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(utxoSnapshotLoadKeyName)
+	})
+}
+
+// initUtxoSnapshot resumes the background validation of the blocks below a
+// loaded utxo snapshot whose history hasn't been validated yet.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) initUtxoSnapshot() error {
+	var blockHash, utxoSetHash *chainhash.Hash
+	var status byte
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		blockHash, utxoSetHash, status, err = dbFetchUtxoSnapshotState(dbTx)
+		return err
+	})
+	if err != nil || blockHash == nil {
+		return err
+	}
+
+	node := b.index.LookupNode(blockHash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return AssertError(fmt.Sprintf("utxo snapshot block %v is not "+
+			"in the main chain", blockHash))
+	}
+	if status == snapshotInvalid {
+		log.Criticalf("The blocks below the utxo snapshot at height %d "+
+			"are invalid, so the main chain can't be trusted",
+			node.height)
+		b.snapshot = &snapshotValidation{node: node, invalid: true}
+		return nil
+	}
+
+	b.snapshot, err = b.resumeSnapshotValidation(node, utxoSetHash)
+	return err
+}
+
+// resumeSnapshotValidation returns the state for validating the blocks up to
+// the passed utxo snapshot block, starting at the block the utxo set of the
+// validation was last flushed at.  It starts over at the genesis block when
+// there is no such block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) resumeSnapshotValidation(node *blockNode, utxoSetHash *chainhash.Hash) (*snapshotValidation, error) {
+	var tip *blockNode
+	err := b.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(snapshotUtxoStateKeyName)
+		if serialized == nil ||
+			dbTx.Metadata().Bucket(snapshotUtxoSetBucketName) == nil {
+
+			return nil
+		}
+		var hash chainhash.Hash
+		if err := hash.SetBytes(serialized); err != nil {
+			return err
+		}
+		tip = b.index.LookupNode(&hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil || tip.height > node.height || !b.bestChain.Contains(tip) {
+		return b.newSnapshotValidation(node, utxoSetHash)
+	}
+
+	log.Infof("Resuming the validation of the blocks up to the utxo "+
+		"snapshot at height %d at height %d", node.height, tip.height)
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		return nil, err
+	}
+	for n := b.bestChain.Genesis(); n != tip; {
+		n = b.bestChain.Next(n)
+		var block *btcutil.Block
+		var stxos []SpentTxOut
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, n)
+			if err != nil {
+				return err
+			}
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+			return err
+		})
+		if err == nil {
+			err = replayClaimScripts(ct, n, block, stxos)
+		}
+		if err != nil {
+			ct.Close()
+			return nil, fmt.Errorf("unable to rebuild the ClaimTrie "+
+				"below the utxo snapshot at height %d: %v",
+				n.height, err)
+		}
+	}
+
+	utxoCache := newUtxoCache(b.db, snapshotUtxoSetBucketName,
+		snapshotUtxoStateKeyName, b.utxoCache.maxSize)
+	utxoCache.lastFlushHash = tip.hash
+	return &snapshotValidation{
+		node:        node,
+		utxoSetHash: *utxoSetHash,
+		tip:         tip,
+		utxoCache:   utxoCache,
+		claimTrie:   ct,
+		blockStored: make(chan struct{}, 1),
+	}, nil
+}
+
+// newSnapshotValidation returns the state for validating the blocks up to the
+// passed utxo snapshot block, starting at the genesis block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) newSnapshotValidation(node *blockNode, utxoSetHash *chainhash.Hash) (*snapshotValidation, error) {
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		return nil, err
+	}
+	genesis := b.bestChain.Genesis()
+	err = b.db.Update(func(dbTx database.Tx) error {
+		err := dbResetUtxoSet(dbTx, snapshotUtxoSetBucketName,
+			b.chainParams.GenesisBlock)
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Put(snapshotUtxoStateKeyName,
+			genesis.hash[:])
+	})
+	if err != nil {
+		ct.Close()
+		return nil, err
+	}
+
+	utxoCache := newUtxoCache(b.db, snapshotUtxoSetBucketName,
+		snapshotUtxoStateKeyName, b.utxoCache.maxSize)
+	utxoCache.lastFlushHash = genesis.hash
+	return &snapshotValidation{
+		node:        node,
+		utxoSetHash: *utxoSetHash,
+		tip:         genesis,
+		utxoCache:   utxoCache,
+		claimTrie:   ct,
+		blockStored: make(chan struct{}, 1),
+	}, nil
+}
+
+// awaitsSnapshotValidation returns whether the passed block of the main chain
+// is below a loaded utxo snapshot, and has not been validated yet.  The data of
+// such blocks is still needed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) awaitsSnapshotValidation(node *blockNode) bool {
+	b.snapshotLock.RLock()
+	defer b.snapshotLock.RUnlock()
+
+	sv := b.snapshot
+	return sv != nil && !sv.invalid && node.height > sv.tip.height &&
+		node.height <= sv.node.height && b.bestChain.Contains(node)
+}
+
+// storeSnapshotHistoryBlock stores the data of the passed block, which is part
+// of the main chain below a loaded utxo snapshot, so it can be validated in
+// the background.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) storeSnapshotHistoryBlock(node *blockNode, block *btcutil.Block, flags BehaviorFlags) error {
+	block.SetHeight(node.height)
+	if err := b.checkBlockContext(block, node.parent, flags); err != nil {
+		return err
+	}
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlock(dbTx, block)
+	})
+	if err != nil {
+		return err
+	}
+	b.index.SetStatusFlags(node, statusDataStored)
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+
+	select {
+	case b.snapshot.blockStored <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// validateSnapshotHistory validates the blocks up to the passed utxo snapshot
+// block as their data arrives, until they have all been validated or the chain
+// is interrupted.  It must be run as a goroutine.
+func (b *BlockChain) validateSnapshotHistory(sv *snapshotValidation) {
+	log.Infof("Validating the blocks up to the utxo snapshot at height %d "+
+		"in the background", sv.node.height)
+
+	for !interruptRequested(b.interrupt) {
+		b.chainLock.Lock()
+		waiting, err := b.validateSnapshotBlock(sv)
+		done := b.snapshot != sv || sv.invalid
+		b.chainLock.Unlock()
+		if err != nil {
+			log.Errorf("Unable to validate the blocks below the utxo "+
+				"snapshot: %v", err)
+			return
+		}
+		if done {
+			return
+		}
+		if !waiting {
+			continue
+		}
+
+		select {
+		case <-sv.blockStored:
+		case <-b.interrupt:
+			return
+		}
+	}
+}
+
+// validateSnapshotBlock connects the next block below a loaded utxo snapshot
+// to the chain state used to validate them, and returns whether its data is
+// still missing.  The validation is completed once the snapshot block itself
+// has been connected.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) validateSnapshotBlock(sv *snapshotValidation) (bool, error) {
+	if sv.tip == sv.node {
+		return false, b.finishSnapshotValidation(sv)
+	}
+
+	node := b.bestChain.Next(sv.tip)
+	if !b.index.NodeStatus(node).HaveData() {
+		return true, nil
+	}
+	var block *btcutil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByNode(dbTx, node)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&sv.tip.hash)
+	stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+	err = b.checkConnectBlockTo(sv.utxoCache, sv.claimTrie, node, block,
+		view, &stxos, false)
+	if _, ok := err.(RuleError); ok {
+		return false, b.invalidateUtxoSnapshot(sv, node, err)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The spend journal entries allow the blocks to be disconnected from
+	// the main chain once the snapshot has been validated.
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
+	})
+	if err != nil {
+		return false, err
+	}
+	// The utxo set is flushed periodically, so a restart doesn't lose much
+	// of the progress.
+	sv.utxoCache.commit(view)
+	if err := sv.utxoCache.flush(flushPeriodic, &node.hash); err != nil {
+		return false, err
+	}
+
+	b.snapshotLock.Lock()
+	sv.tip = node
+	b.snapshotLock.Unlock()
+	if node.height%snapshotProgressInterval == 0 {
+		log.Infof("Validated the blocks up to height %d of %d below "+
+			"the utxo snapshot", node.height, sv.node.height)
+	}
+	return false, nil
+}
+
+// finishSnapshotValidation ensures the utxo set resulting from the validation
+// of the blocks up to a loaded utxo snapshot matches the one of the snapshot.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) finishSnapshotValidation(sv *snapshotValidation) error {
+	err := sv.utxoCache.flush(flushRequired, &sv.node.hash)
+	if err != nil {
+		return err
+	}
+	var utxoSetHash *chainhash.Hash
+	var numUtxos uint64
+	err = b.db.View(func(dbTx database.Tx) error {
+		var err error
+		utxoSetHash, numUtxos, err = dbCalcUtxoSetHash(dbTx,
+			snapshotUtxoSetBucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if *utxoSetHash != sv.utxoSetHash {
+		err := fmt.Errorf("utxo set hash %v does not match the hash %v "+
+			"of the snapshot", utxoSetHash, sv.utxoSetHash)
+		return b.invalidateUtxoSnapshot(sv, sv.node, err)
+	}
+
+	// Matching roots in the block headers don't prove the ClaimTrie of the
+	// snapshot holds the same claims and supports, since unlike the utxo
+	// set it was never hashed as a whole.  Both are exported at the
+	// snapshot block to compare them.
+	digest, err := claimTrieDigest(sv.claimTrie, sv.node)
+	if err != nil {
+		return err
+	}
+	snapshotDigest, err := claimTrieDigest(b.claimTrie, sv.node)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, snapshotDigest) {
+		err := fmt.Errorf("ClaimTrie does not match the ClaimTrie of " +
+			"the snapshot")
+		return b.invalidateUtxoSnapshot(sv, sv.node, err)
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		err := dbTx.Metadata().DeleteBucket(snapshotUtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		err = dbTx.Metadata().Delete(snapshotUtxoStateKeyName)
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(utxoSnapshotKeyName)
+	})
+	if err != nil {
+		return err
+	}
+	sv.claimTrie.Close()
+
+	b.snapshotLock.Lock()
+	b.snapshot = nil
+	b.snapshotLock.Unlock()
+
+	log.Infof("Validated the blocks up to the utxo snapshot at height %d "+
+		"(%d outputs, utxo set hash %v)", sv.node.height, numUtxos,
+		utxoSetHash)
+	return nil
+}
+
+// claimTrieDigest returns the sha256 digest of the passed ClaimTrie exported at
+// the passed block.
+func claimTrieDigest(ct *claimtrie.ClaimTrie, node *blockNode) ([]byte, error) {
+	hasher := sha256.New()
+	_, err := ct.Export(hasher, claimtrie.Height(node.height), &node.hash)
+	if err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// invalidateUtxoSnapshot records that validating the passed block below a
+// loaded utxo snapshot failed with the passed error.  The main chain, which
+// builds on the snapshot, can't be trusted in that case.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) invalidateUtxoSnapshot(sv *snapshotValidation, node *blockNode, err error) error {
+	log.Criticalf("Block %v at height %d below the utxo snapshot is "+
+		"invalid, so the main chain can't be trusted: %v", node.hash,
+		node.height, err)
+
+	b.snapshotLock.Lock()
+	sv.invalid = true
+	b.snapshotLock.Unlock()
+	sv.claimTrie.Close()
+
+	return b.db.Update(func(dbTx database.Tx) error {
+		err := dbTx.Metadata().DeleteBucket(snapshotUtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		err = dbTx.Metadata().Delete(snapshotUtxoStateKeyName)
+		if err != nil {
+			return err
+		}
+		return dbPutUtxoSnapshotState(dbTx, &sv.node.hash,
+			&sv.utxoSetHash, snapshotInvalid)
+	})
+}
@@ -75,6 +75,24 @@ type thresholdConditionChecker interface {
 	// locked in or activated.
 	EndTime() uint64
 
+	// HeightBased returns whether voting on a rule change starts and ends
+	// at the heights returned by BeginHeight and EndHeight instead of the
+	// times returned by BeginTime and EndTime.
+	HeightBased() bool
+
+	// BeginHeight returns the height at or after which voting on a rule
+	// change starts (at the next window).
+	BeginHeight() int32
+
+	// EndHeight returns the height at or after which an attempted rule
+	// change fails (at the next window) if it has not already been locked
+	// in or activated.
+	EndHeight() int32
+
+	// MinActivationHeight returns the height before which a locked in rule
+	// change does not become active.
+	MinActivationHeight() int32
+
 	// RuleChangeActivationThreshold is the number of blocks for which the
 	// condition must be true in order to lock in a rule change.
 	RuleChangeActivationThreshold() uint32
@@ -121,6 +139,27 @@ func newThresholdCaches(numCaches uint32) []thresholdStateCache {
 	return caches
 }
 
+// thresholdBegun returns whether voting on the rule change of the checker has
+// started for the window after the passed node, which is the last block of a
+// window.
+func thresholdBegun(checker thresholdConditionChecker, prevNode *blockNode) bool {
+	if checker.HeightBased() {
+		return prevNode.height+1 >= checker.BeginHeight()
+	}
+	medianTime := prevNode.CalcPastMedianTime()
+	return uint64(medianTime.Unix()) >= checker.BeginTime()
+}
+
+// thresholdExpired returns whether the rule change of the checker has expired
+// for the window after the passed node, which is the last block of a window.
+func thresholdExpired(checker thresholdConditionChecker, prevNode *blockNode) bool {
+	if checker.HeightBased() {
+		return prevNode.height+1 >= checker.EndHeight()
+	}
+	medianTime := prevNode.CalcPastMedianTime()
+	return uint64(medianTime.Unix()) >= checker.EndTime()
+}
+
 // thresholdState returns the current rule change threshold state for the block
 // AFTER the given node and deployment ID.  The cache is used to ensure the
 // threshold states for previous windows are only calculated once.
@@ -150,13 +189,9 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 			break
 		}
 
-		// The start and expiration times are based on the median block
-		// time, so calculate it now.
-		medianTime := prevNode.CalcPastMedianTime()
-
 		// The state is simply defined if the start time hasn't been
 		// been reached yet.
-		if uint64(medianTime.Unix()) < checker.BeginTime() {
+		if !thresholdBegun(checker, prevNode) {
 			cache.Update(&prevNode.hash, ThresholdDefined)
 			break
 		}
@@ -192,9 +227,7 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 		case ThresholdDefined:
 			// The deployment of the rule change fails if it expires
 			// before it is accepted and locked in.
-			medianTime := prevNode.CalcPastMedianTime()
-			medianTimeUnix := uint64(medianTime.Unix())
-			if medianTimeUnix >= checker.EndTime() {
+			if thresholdExpired(checker, prevNode) {
 				state = ThresholdFailed
 				break
 			}
@@ -202,15 +235,14 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 			// The state for the rule moves to the started state
 			// once its start time has been reached (and it hasn't
 			// already expired per the above).
-			if medianTimeUnix >= checker.BeginTime() {
+			if thresholdBegun(checker, prevNode) {
 				state = ThresholdStarted
 			}
 
 		case ThresholdStarted:
 			// The deployment of the rule change fails if it expires
 			// before it is accepted and locked in.
-			medianTime := prevNode.CalcPastMedianTime()
-			if uint64(medianTime.Unix()) >= checker.EndTime() {
+			if thresholdExpired(checker, prevNode) {
 				state = ThresholdFailed
 				break
 			}
@@ -242,8 +274,11 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 
 		case ThresholdLockedIn:
 			// The new rule becomes active when its previous state
-			// was locked in.
-			state = ThresholdActive
+			// was locked in, unless the minimum activation height
+			// hasn't been reached yet.
+			if prevNode.height+1 >= checker.MinActivationHeight() {
+				state = ThresholdActive
+			}
 
 		// Nothing to do if the previous state is active or failed since
 		// they are both terminal states.
@@ -286,6 +321,124 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 	return state == ThresholdActive, nil
 }
 
+// ThresholdStats describes the signalling for a rule change within the
+// confirmation window of a block, up to and including that block.
+type ThresholdStats struct {
+	// Period is the number of blocks in each confirmation window.
+	Period uint32
+
+	// Threshold is the number of signalling blocks in a window required
+	// to lock in the rule change.
+	Threshold uint32
+
+	// Elapsed is the number of blocks of the window so far.
+	Elapsed uint32
+
+	// Count is the number of signalling blocks of the window so far.
+	Count uint32
+
+	// Possible is whether the threshold can still be reached within the
+	// window.
+	Possible bool
+}
+
+// DeploymentInfo describes the state of a deployment at a block.
+type DeploymentInfo struct {
+	// Height is the height of the block.
+	Height int32
+
+	// State is the threshold state of the deployment for the block.
+	State ThresholdState
+
+	// Since is the height of the first block with the same state.
+	Since int32
+
+	// NextState is the threshold state of the deployment for the block
+	// after the block.
+	NextState ThresholdState
+
+	// Stats describes the signalling within the confirmation window of
+	// the block.  It is only set when the state is started or locked in.
+	Stats *ThresholdStats
+}
+
+// DeploymentInfo returns the state of the given deployment ID at the block
+// with the given hash, which may be in a side chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DeploymentInfo(hash *chainhash.Hash, deploymentID uint32) (*DeploymentInfo, error) {
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
+		return nil, DeploymentError(deploymentID)
+	}
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	deployment := &b.chainParams.Deployments[deploymentID]
+	checker := deploymentChecker{deployment: deployment, chain: b}
+	cache := &b.deploymentCaches[deploymentID]
+	state, err := b.thresholdState(node.parent, checker, cache)
+	if err != nil {
+		return nil, err
+	}
+	nextState, err := b.thresholdState(node, checker, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the first window with the state of the block.  The state of a
+	// window is the one after the last block of the previous window.
+	window := int32(checker.MinerConfirmationWindow())
+	windowStart := node.height - node.height%window
+	since := windowStart
+	for since > 0 {
+		prevState, err := b.thresholdState(node.Ancestor(since-window-1),
+			checker, cache)
+		if err != nil {
+			return nil, err
+		}
+		if prevState != state {
+			break
+		}
+		since -= window
+	}
+
+	info := &DeploymentInfo{
+		Height:    node.height,
+		State:     state,
+		Since:     since,
+		NextState: nextState,
+	}
+	if state != ThresholdStarted && state != ThresholdLockedIn {
+		return info, nil
+	}
+
+	// Count the signalling blocks of the window up to the block.
+	stats := &ThresholdStats{
+		Period:    checker.MinerConfirmationWindow(),
+		Threshold: checker.RuleChangeActivationThreshold(),
+		Elapsed:   uint32(node.height - windowStart + 1),
+	}
+	for n := node; n != nil && n.height >= windowStart; n = n.parent {
+		condition, err := checker.Condition(n)
+		if err != nil {
+			return nil, err
+		}
+		if condition {
+			stats.Count++
+		}
+	}
+	stats.Possible = stats.Count+stats.Period-stats.Elapsed >=
+		stats.Threshold
+	info.Stats = stats
+
+	return info, nil
+}
+
 // deploymentState returns the current rule change threshold for a given
 // deploymentID. The threshold is evaluated from the point of view of the block
 // node passed in as the first argument to this method.
@@ -297,7 +450,7 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) deploymentState(prevNode *blockNode, deploymentID uint32) (ThresholdState, error) {
-	if deploymentID > uint32(len(b.chainParams.Deployments)) {
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
 		return ThresholdFailed, DeploymentError(deploymentID)
 	}
 
@@ -5,8 +5,11 @@
 package blockchain
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
@@ -132,3 +135,179 @@ nextTest:
 		}
 	}
 }
+
+// TestHeightBasedDeployments ensures deployments which start and time out at
+// heights go through the expected threshold states, including the delay until
+// their minimum activation height, and that DeploymentInfo reports them along
+// with the signalling statistics.
+func TestHeightBasedDeployments(t *testing.T) {
+	t.Parallel()
+
+	// Use windows of 10 blocks and two deployments, one of which is
+	// signalled by all blocks of the window at heights 10 through 19
+	// except two, and one which isn't signalled at all.
+	params := chaincfg.RegressionNetParams
+	params.MinerConfirmationWindow = 10
+	params.RuleChangeActivationThreshold = 8
+	params.Deployments = []chaincfg.ConsensusDeployment{{
+		Name:                "signalled",
+		BitNumber:           5,
+		StartHeight:         5,
+		TimeoutHeight:       50,
+		MinActivationHeight: 40,
+	}, {
+		Name:          "unsignalled",
+		BitNumber:     6,
+		StartHeight:   10,
+		TimeoutHeight: 30,
+	}}
+	chain := newFakeChain(&params)
+	node := chain.bestChain.Tip()
+	timestamp := time.Unix(node.timestamp, 0)
+	for height := int32(1); height < 50; height++ {
+		version := int32(vbTopBits)
+		if height >= 10 && height < 20 && height != 11 && height != 12 {
+			version |= 1 << 5
+		}
+		timestamp = timestamp.Add(time.Minute)
+		node = newFakeNode(node, version, 0, timestamp)
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(node)
+
+	tests := []struct {
+		height       int32
+		deploymentID uint32
+		state        ThresholdState
+		since        int32
+		nextState    ThresholdState
+		stats        *ThresholdStats
+	}{
+		{
+			height:    5,
+			state:     ThresholdDefined,
+			since:     0,
+			nextState: ThresholdDefined,
+		},
+		{
+			height:    9,
+			state:     ThresholdDefined,
+			since:     0,
+			nextState: ThresholdStarted,
+		},
+		{
+			height:    15,
+			state:     ThresholdStarted,
+			since:     10,
+			nextState: ThresholdStarted,
+			stats: &ThresholdStats{
+				Period:    10,
+				Threshold: 8,
+				Elapsed:   6,
+				Count:     4,
+				Possible:  true,
+			},
+		},
+		{
+			height:    19,
+			state:     ThresholdStarted,
+			since:     10,
+			nextState: ThresholdLockedIn,
+			stats: &ThresholdStats{
+				Period:    10,
+				Threshold: 8,
+				Elapsed:   10,
+				Count:     8,
+				Possible:  true,
+			},
+		},
+		{
+			height:    35,
+			state:     ThresholdLockedIn,
+			since:     20,
+			nextState: ThresholdLockedIn,
+			stats: &ThresholdStats{
+				Period:    10,
+				Threshold: 8,
+				Elapsed:   6,
+				Count:     0,
+				Possible:  false,
+			},
+		},
+		{
+			height:    39,
+			state:     ThresholdLockedIn,
+			since:     20,
+			nextState: ThresholdActive,
+			stats: &ThresholdStats{
+				Period:    10,
+				Threshold: 8,
+				Elapsed:   10,
+				Count:     0,
+				Possible:  false,
+			},
+		},
+		{
+			height:    49,
+			state:     ThresholdActive,
+			since:     40,
+			nextState: ThresholdActive,
+		},
+		{
+			height:       25,
+			deploymentID: 1,
+			state:        ThresholdStarted,
+			since:        10,
+			nextState:    ThresholdStarted,
+			stats: &ThresholdStats{
+				Period:    10,
+				Threshold: 8,
+				Elapsed:   6,
+				Count:     0,
+				Possible:  false,
+			},
+		},
+		{
+			height:       49,
+			deploymentID: 1,
+			state:        ThresholdFailed,
+			since:        30,
+			nextState:    ThresholdFailed,
+		},
+	}
+
+	for _, test := range tests {
+		node := chain.bestChain.NodeByHeight(test.height)
+		info, err := chain.DeploymentInfo(&node.hash, test.deploymentID)
+		if err != nil {
+			t.Errorf("DeploymentInfo(%d, %d): unexpected error: %v",
+				test.height, test.deploymentID, err)
+			continue
+		}
+		if info.Height != test.height || info.State != test.state ||
+			info.Since != test.since ||
+			info.NextState != test.nextState {
+
+			t.Errorf("DeploymentInfo(%d, %d): got %v since %d then "+
+				"%v, want %v since %d then %v", test.height,
+				test.deploymentID, info.State, info.Since,
+				info.NextState, test.state, test.since,
+				test.nextState)
+		}
+		if !reflect.DeepEqual(info.Stats, test.stats) {
+			t.Errorf("DeploymentInfo(%d, %d): got stats %+v, want "+
+				"%+v", test.height, test.deploymentID,
+				info.Stats, test.stats)
+		}
+	}
+
+	// The state after the best block is the one after block 49.
+	state, err := chain.ThresholdState(0)
+	if err != nil || state != ThresholdActive {
+		t.Errorf("ThresholdState: got %v (%v), want %v", state, err,
+			ThresholdActive)
+	}
+	if _, err := chain.DeploymentInfo(&node.hash, 2); err == nil {
+		t.Error("DeploymentInfo: no error for unknown deployment")
+	}
+}
@@ -0,0 +1,503 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// defaultUtxoCacheMaxSize is the size in bytes the utxo cache is
+	// limited to when no size is specified.
+	defaultUtxoCacheMaxSize = 250 * 1024 * 1024
+
+	// utxoFlushPeriodicInterval is the maximum amount of time modified
+	// entries are held in the utxo cache before they are flushed to the
+	// database by a periodic flush.
+	utxoFlushPeriodicInterval = 5 * time.Minute
+
+	// utxoEntryOverhead is the approximate number of bytes used by a cached
+	// entry in addition to its public key script.  It accounts for the
+	// outpoint key, the entry itself, and the map bucket housing them.
+	utxoEntryOverhead = 128
+)
+
+// flushMode defines the conditions under which the utxo cache is flushed.
+type flushMode uint8
+
+const (
+	// flushRequired always flushes the cache.
+	flushRequired flushMode = iota
+
+	// flushPeriodic flushes the cache when it exceeds its maximum size or
+	// when the periodic flush interval has elapsed since the last flush.
+	flushPeriodic
+
+	// flushIfNeeded only flushes the cache when it exceeds its maximum
+	// size.
+	flushIfNeeded
+)
+
+// memoryUsage returns the approximate number of bytes used by the entry when
+// it is held in the utxo cache.
+func (entry *UtxoEntry) memoryUsage() uint64 {
+	return utxoEntryOverhead + uint64(len(entry.pkScript))
+}
+
+// utxoCache is a write-back cache of the unspent transaction outputs which
+// sits between the utxo views and the utxo set in the database.
+//
+// Views load the entries they need through the cache, which keeps the entries
+// it loads from the database so later lookups are served from memory.  The
+// entries views modify are committed to it once the corresponding block is
+// connected.  The modified and spent entries are written to the database in a
+// single batch when the cache is flushed, along with the hash of the block the
+// utxo set is consistent with.  Spent entries which were created after the last
+// flush are never written at all.  The unmodified entries are kept by a flush
+// unless the cache has grown larger than its maximum size, in which case it is
+// emptied.
+//
+// Since the best chain state is still updated with every block, the utxo set
+// in the database may lag behind it after an unclean shutdown.  In that case,
+// the blocks after the recorded hash are connected again on startup.  See
+// initUtxoCache.
+//
+// The cache is only modified by commits and flushes while holding both the
+// chain lock and the commit lock for writes, so the entries looked up while
+// holding either of them for reads are consistent with the main chain.  The
+// cache has its own mutex since lookups also insert the entries they load.
+type utxoCache struct {
+	mtx     sync.Mutex
+	db      database.DB
+	maxSize uint64
+
+	// bucketName is the name of the db bucket housing the utxo set the
+	// cache sits in front of, and stateKeyName the name of the db key
+	// used to record the hash of the block the utxo set is consistent
+	// with, if any.
+	bucketName   []byte
+	stateKeyName []byte
+
+	// entries houses the cached entries.  Spent entries are kept until
+	// the next flush unless they are fresh, in which case they are
+	// removed as soon as they are spent.
+	entries map[wire.OutPoint]*UtxoEntry
+	size    uint64
+
+	// lastFlushHash is the hash of the block the utxo set in the database
+	// is consistent with.
+	lastFlushHash chainhash.Hash
+	lastFlushTime time.Time
+}
+
+// newUtxoCache returns a new empty utxo cache backed by the utxo set in the
+// passed database bucket which is limited to maxSize bytes.  The default size
+// is used when maxSize is zero.  Each flush records the block the utxo set is
+// consistent with under the passed key unless it is nil.
+func newUtxoCache(db database.DB, bucketName, stateKeyName []byte, maxSize uint64) *utxoCache {
+	if maxSize == 0 {
+		maxSize = defaultUtxoCacheMaxSize
+	}
+	return &utxoCache{
+		db:            db,
+		maxSize:       maxSize,
+		bucketName:    bucketName,
+		stateKeyName:  stateKeyName,
+		entries:       make(map[wire.OutPoint]*UtxoEntry),
+		lastFlushTime: time.Now(),
+	}
+}
+
+// fetchEntries loads the requested outpoints into the passed entries map.  The
+// cached entries are copied, so modifying them has no effect on the cache, and
+// the ones which aren't cached are loaded from the database and added to the
+// cache.  Spent outputs, or those which otherwise don't exist, result in nil
+// entries.
+func (c *utxoCache) fetchEntries(outpoints map[wire.OutPoint]struct{},
+	entries map[wire.OutPoint]*UtxoEntry) error {
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var missing []wire.OutPoint
+	for outpoint := range outpoints {
+		cached, ok := c.entries[outpoint]
+		if !ok {
+			missing = append(missing, outpoint)
+			continue
+		}
+		if cached.IsSpent() {
+			entries[outpoint] = nil
+			continue
+		}
+
+		// The modified flag of the copy tracks the changes made by the
+		// view rather than the ones pending in the cache.
+		entry := cached.Clone()
+		entry.packedFlags &^= tfModified
+		entries[outpoint] = entry
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return c.db.View(func(dbTx database.Tx) error {
+		for _, outpoint := range missing {
+			entry, err := dbFetchUtxoEntry(dbTx, c.bucketName, outpoint)
+			if err != nil {
+				return err
+			}
+
+			entries[outpoint] = entry
+			if entry != nil {
+				c.entries[outpoint] = entry.Clone()
+				c.size += entry.memoryUsage()
+			}
+		}
+
+		return nil
+	})
+}
+
+// fetchEntryByHash attempts to find any available utxo for the given hash by
+// searching the entire set of possible outputs for the given hash.  It checks
+// the cache first and then falls back to the database if needed.  The outputs
+// the cache holds as spent are skipped even though the database may still
+// have them.
+func (c *utxoCache) fetchEntryByHash(hash *chainhash.Hash) (*UtxoEntry, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	spent := make(map[string]struct{})
+	prevOut := wire.OutPoint{Hash: *hash}
+	for idx := uint32(0); idx < MaxOutputsPerBlock; idx++ {
+		prevOut.Index = idx
+		entry, ok := c.entries[prevOut]
+		if !ok {
+			continue
+		}
+		if !entry.IsSpent() {
+			return entry.Clone(), nil
+		}
+		key := outpointKey(prevOut)
+		spent[string(*key)] = struct{}{}
+		recycleOutpointKey(key)
+	}
+
+	var entry *UtxoEntry
+	err := c.db.View(func(dbTx database.Tx) error {
+		// Due to the fact the keys are serialized as <hash><index>,
+		// the outputs of the hash are found next to each other.
+		cursor := dbTx.Metadata().Bucket(c.bucketName).Cursor()
+		key := outpointKey(wire.OutPoint{Hash: *hash, Index: 0})
+		ok := cursor.Seek(*key)
+		recycleOutpointKey(key)
+		for ; ok; ok = cursor.Next() {
+			cursorKey := cursor.Key()
+			if len(cursorKey) < chainhash.HashSize ||
+				!bytes.Equal(hash[:], cursorKey[:chainhash.HashSize]) {
+
+				return nil
+			}
+			if _, ok := spent[string(cursorKey)]; ok {
+				continue
+			}
+
+			var err error
+			entry, err = deserializeUtxoEntry(cursor.Value())
+			return err
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// commit applies the entries modified by the passed view to the cache.  The
+// view must be consistent with the end of the main chain once the block it
+// was used for is connected.
+func (c *utxoCache) commit(view *UtxoViewpoint) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.entries {
+		// Nothing to do for entries the view didn't modify.
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+
+		// An entry is only fresh, meaning it doesn't exist in the
+		// database, when it is not replacing a cached one that does.
+		cached, ok := c.entries[outpoint]
+		fresh := entry.isFresh() && (!ok || cached.isFresh())
+		if ok {
+			c.size -= cached.memoryUsage()
+		}
+
+		// Fresh entries which are spent can be forgotten entirely while
+		// the others must be kept so they get deleted from the
+		// database by the next flush.
+		if entry.IsSpent() {
+			if fresh {
+				delete(c.entries, outpoint)
+				continue
+			}
+			entry = &UtxoEntry{packedFlags: tfSpent | tfModified}
+		} else {
+			entry = entry.Clone()
+			entry.packedFlags |= tfModified
+			entry.packedFlags &^= tfFresh
+			if fresh {
+				entry.packedFlags |= tfFresh
+			}
+		}
+
+		c.entries[outpoint] = entry
+		c.size += entry.memoryUsage()
+	}
+}
+
+// flush writes the modified and spent entries in the cache to the database,
+// provided the conditions for the passed mode are met.  The bestHash is the
+// hash of the block the cache is consistent with, which is recorded in the
+// database along with the entries.  The cache is emptied when it's larger than
+// its maximum size, and only keeps the unspent entries otherwise.
+func (c *utxoCache) flush(mode flushMode, bestHash *chainhash.Hash) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	switch mode {
+	case flushIfNeeded:
+		if c.size <= c.maxSize {
+			return nil
+		}
+	case flushPeriodic:
+		if c.size <= c.maxSize &&
+			time.Since(c.lastFlushTime) < utxoFlushPeriodicInterval {
+			return nil
+		}
+	}
+
+	// Nothing to do when the database is already up to date.
+	if c.size <= c.maxSize && !c.hasModified() &&
+		c.lastFlushHash == *bestHash {
+
+		return nil
+	}
+
+	log.Debugf("Flushing %d utxo cache entries (%d bytes) at block %v",
+		len(c.entries), c.size, bestHash)
+
+	err := c.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(c.bucketName)
+		for outpoint, entry := range c.entries {
+			if !entry.isModified() {
+				continue
+			}
+
+			// Remove the utxo entry if it is spent.
+			if entry.IsSpent() {
+				key := outpointKey(outpoint)
+				err := utxoBucket.Delete(*key)
+				recycleOutpointKey(key)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// Serialize and store the utxo entry.
+			serialized, err := serializeUtxoEntry(entry)
+			if err != nil {
+				return err
+			}
+			key := outpointKey(outpoint)
+			err = utxoBucket.Put(*key, serialized)
+			// NOTE: The key is intentionally not recycled here since
+			// the database interface contract prohibits
+			// modifications.  It will be garbage collected normally
+			// when the database is done with it.
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.stateKeyName == nil {
+			return nil
+		}
+		return dbTx.Metadata().Put(c.stateKeyName, bestHash[:])
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.size > c.maxSize {
+		c.entries = make(map[wire.OutPoint]*UtxoEntry)
+		c.size = 0
+	} else {
+		for outpoint, entry := range c.entries {
+			if entry.IsSpent() {
+				c.size -= entry.memoryUsage()
+				delete(c.entries, outpoint)
+				continue
+			}
+			entry.packedFlags &^= tfModified | tfFresh
+		}
+	}
+	c.lastFlushHash = *bestHash
+	c.lastFlushTime = time.Now()
+	return nil
+}
+
+// viewUtxoSet flushes the utxo cache and invokes fn with a database
+// transaction which sees the utxo set at the end of the main chain, along with
+// the block at the end and the best state.  Blocks may be connected to the main
+// chain while fn runs, since the chain lock is only held until the transaction
+// has been started, but the transaction doesn't see their changes.
+//
+// This function MUST NOT be called with the chain state lock held.
+func (b *BlockChain) viewUtxoSet(fn func(dbTx database.Tx, tip *blockNode, state *BestState) error) error {
+	b.chainLock.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			b.chainLock.Unlock()
+		}
+	}()
+
+	tip := b.bestChain.Tip()
+	state := b.BestSnapshot()
+	b.commitLock.Lock()
+	err := b.utxoCache.flush(flushRequired, &tip.hash)
+	b.commitLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return b.db.View(func(dbTx database.Tx) error {
+		b.chainLock.Unlock()
+		locked = false
+		return fn(dbTx, tip, state)
+	})
+}
+
+// purge empties the cache.  It must only be called right after a flush, and is
+// used before the utxo set in the database is updated without going through
+// the cache.
+func (c *utxoCache) purge() {
+	c.mtx.Lock()
+	c.entries = make(map[wire.OutPoint]*UtxoEntry)
+	c.size = 0
+	c.mtx.Unlock()
+}
+
+// hasModified returns whether any of the entries in the cache has to be
+// written to the database.
+func (c *utxoCache) hasModified() bool {
+	for _, entry := range c.entries {
+		if entry.isModified() {
+			return true
+		}
+	}
+	return false
+}
+
+// initUtxoCache makes the utxo set in the database consistent with the end of
+// the main chain.  The blocks connected after the last flush of the utxo cache,
+// which were lost due to an unclean shutdown, are connected to the utxo set
+// again.  Their validity is not checked since they were validated before.
+func (b *BlockChain) initUtxoCache(interrupt <-chan struct{}) error {
+	tip := b.bestChain.Tip()
+	var consistentHash *chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		consistentHash, err = dbFetchUtxoStateConsistency(dbTx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Databases created before the introduction of the utxo cache update
+	// the utxo set with every block, so they are consistent with the tip.
+	if consistentHash == nil {
+		return b.db.Update(func(dbTx database.Tx) error {
+			b.utxoCache.lastFlushHash = tip.hash
+			return dbPutUtxoStateConsistency(dbTx, &tip.hash)
+		})
+	}
+
+	b.utxoCache.lastFlushHash = *consistentHash
+	if *consistentHash == tip.hash {
+		return nil
+	}
+
+	node := b.index.LookupNode(consistentHash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return AssertError(fmt.Sprintf("utxo set is consistent with block "+
+			"%v which is not in the main chain", consistentHash))
+	}
+
+	log.Infof("Reconnecting the utxo set from height %d to %d...",
+		node.height, tip.height)
+	for n := b.bestChain.Next(node); n != nil; n = b.bestChain.Next(n) {
+		if interruptRequested(interrupt) {
+			// Keep the progress made so far.
+			if err := b.utxoCache.flush(flushRequired, &node.hash); err != nil {
+				return err
+			}
+			return errInterruptRequested
+		}
+
+		var block *btcutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, n)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		view := NewUtxoViewpoint()
+		if err := view.fetchInputUtxos(b.utxoCache, block); err != nil {
+			return err
+		}
+		if err := view.connectTransactions(block, nil); err != nil {
+			return err
+		}
+		b.utxoCache.commit(view)
+		node = n
+
+		if err := b.utxoCache.flush(flushIfNeeded, &n.hash); err != nil {
+			return err
+		}
+	}
+
+	return b.utxoCache.flush(flushRequired, &tip.hash)
+}
+
+// FlushUtxoCache writes all of the modified entries in the utxo cache to the
+// database.  It must be called before the database is closed, or the blocks
+// connected since the last flush will have to be connected to the utxo set
+// again on the next startup.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+	b.commitLock.Lock()
+	defer b.commitLock.Unlock()
+
+	return b.utxoCache.flush(flushRequired, &b.bestChain.Tip().hash)
+}
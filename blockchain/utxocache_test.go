@@ -0,0 +1,286 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// utxoCacheSetup returns a new utxo cache limited to maxSize bytes, which is
+// backed by an empty utxo set in a new database, along with a teardown
+// function.
+func utxoCacheSetup(t *testing.T, maxSize uint64) (*utxoCache, func()) {
+	dbPath, err := ioutil.TempDir("", "utxocache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, wire.SimNet)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("database.Create: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(utxoSetBucketName)
+		return err
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	return newUtxoCache(db, utxoSetBucketName,
+		utxoStateConsistencyKeyName, maxSize), teardown
+}
+
+// testOutPoint returns an outpoint of a transaction identified by the passed
+// byte.
+func testOutPoint(tx byte, index uint32) wire.OutPoint {
+	return wire.OutPoint{Hash: chainhash.Hash{tx}, Index: index}
+}
+
+// newTestEntry returns an unspent entry created by a block, which has been
+// added to a view.
+func newTestEntry(amount int64) *UtxoEntry {
+	return &UtxoEntry{
+		amount:      amount,
+		pkScript:    []byte{0x51},
+		blockHeight: 1,
+		packedFlags: tfModified | tfFresh,
+	}
+}
+
+// fetchEntry returns the entry of the outpoint looked up through the cache.
+func fetchEntry(t *testing.T, c *utxoCache, op wire.OutPoint) *UtxoEntry {
+	entries := make(map[wire.OutPoint]*UtxoEntry)
+	err := c.fetchEntries(map[wire.OutPoint]struct{}{op: {}}, entries)
+	if err != nil {
+		t.Fatalf("fetchEntries: %v", err)
+	}
+	return entries[op]
+}
+
+// dbEntry returns the entry of the outpoint in the database.
+func dbEntry(t *testing.T, c *utxoCache, op wire.OutPoint) *UtxoEntry {
+	var entry *UtxoEntry
+	err := c.db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchUtxoEntry(dbTx, c.bucketName, op)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dbFetchUtxoEntry: %v", err)
+	}
+	return entry
+}
+
+// TestUtxoCacheEntries ensures fresh entries spent before a flush are never
+// written to the database, spent entries which are in the database are
+// deleted from it, and entries loaded from the database are served from the
+// cache afterwards.
+func TestUtxoCacheEntries(t *testing.T) {
+	c, teardown := utxoCacheSetup(t, defaultUtxoCacheMaxSize)
+	defer teardown()
+
+	fresh, stored, other := testOutPoint(1, 0), testOutPoint(2, 0),
+		testOutPoint(2, 1)
+	view := NewUtxoViewpoint()
+	view.entries[fresh] = newTestEntry(1)
+	view.entries[stored] = newTestEntry(2)
+	view.entries[other] = newTestEntry(3)
+	c.commit(view)
+	if e := c.entries[fresh]; e == nil || !e.isFresh() || !e.isModified() {
+		t.Fatalf("committed entry is not fresh and modified: %+v", e)
+	}
+
+	// Spending the fresh entry forgets it.
+	view = NewUtxoViewpoint()
+	entry := fetchEntry(t, c, fresh)
+	if entry == nil || entry.isModified() {
+		t.Fatalf("fetched entry %+v is missing or modified", entry)
+	}
+	entry.Spend()
+	view.entries[fresh] = entry
+	c.commit(view)
+	if _, ok := c.entries[fresh]; ok {
+		t.Fatalf("spent fresh entry is still cached")
+	}
+
+	hash := chainhash.Hash{9}
+	if err := c.flush(flushRequired, &hash); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if dbEntry(t, c, fresh) != nil || dbEntry(t, c, stored) == nil {
+		t.Fatalf("unexpected entries written by the flush")
+	}
+
+	// The flushed entries are kept, but are no longer fresh or modified.
+	e, ok := c.entries[stored]
+	if !ok || e.isFresh() || e.isModified() {
+		t.Fatalf("flushed entry %+v is not kept unmodified", e)
+	}
+
+	// Entries loaded from the database are cached.
+	c.purge()
+	if fetchEntry(t, c, stored) == nil {
+		t.Fatalf("stored entry not found")
+	}
+	e, ok = c.entries[stored]
+	if !ok || e.isFresh() || e.isModified() {
+		t.Fatalf("loaded entry %+v is not cached unmodified", e)
+	}
+	if c.size != e.memoryUsage() {
+		t.Fatalf("cache size %d, want %d", c.size, e.memoryUsage())
+	}
+
+	// Spending an entry which is in the database keeps it as spent until
+	// the next flush, and hides it from lookups by hash.
+	entry = fetchEntry(t, c, stored)
+	entry.Spend()
+	view = NewUtxoViewpoint()
+	view.entries[stored] = entry
+	c.commit(view)
+	if e := c.entries[stored]; e == nil || !e.IsSpent() || !e.isModified() {
+		t.Fatalf("spent entry %+v is not kept as modified", e)
+	}
+	if fetchEntry(t, c, stored) != nil {
+		t.Fatalf("spent entry is still returned")
+	}
+	byHash, err := c.fetchEntryByHash(&stored.Hash)
+	if err != nil {
+		t.Fatalf("fetchEntryByHash: %v", err)
+	}
+	if byHash == nil || byHash.Amount() != 3 {
+		t.Fatalf("fetchEntryByHash returned %+v instead of the "+
+			"unspent output", byHash)
+	}
+
+	// No output is left once the other one is spent as well, even though
+	// the database still has both.
+	c.purge()
+	for _, op := range []wire.OutPoint{stored, other} {
+		entry := fetchEntry(t, c, op)
+		entry.Spend()
+		view = NewUtxoViewpoint()
+		view.entries[op] = entry
+		c.commit(view)
+	}
+	byHash, err = c.fetchEntryByHash(&stored.Hash)
+	if err != nil || byHash != nil {
+		t.Fatalf("fetchEntryByHash returned %+v, %v for spent "+
+			"outputs", byHash, err)
+	}
+
+	if err := c.flush(flushRequired, &hash); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if dbEntry(t, c, stored) != nil || dbEntry(t, c, other) != nil {
+		t.Fatalf("spent entries not deleted by the flush")
+	}
+	if len(c.entries) != 0 || c.size != 0 {
+		t.Fatalf("spent entries still cached after the flush")
+	}
+}
+
+// TestUtxoCacheFlushModes ensures the cache is only flushed under the
+// conditions of each flush mode, and the hash of the block the utxo set is
+// consistent with is recorded.
+func TestUtxoCacheFlushModes(t *testing.T) {
+	entrySize := newTestEntry(0).memoryUsage()
+	c, teardown := utxoCacheSetup(t, 2*entrySize)
+	defer teardown()
+
+	consistentHash := func() *chainhash.Hash {
+		var hash *chainhash.Hash
+		err := c.db.View(func(dbTx database.Tx) error {
+			var err error
+			hash, err = dbFetchUtxoStateConsistency(dbTx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("dbFetchUtxoStateConsistency: %v", err)
+		}
+		return hash
+	}
+	add := func(ops ...wire.OutPoint) {
+		view := NewUtxoViewpoint()
+		for _, op := range ops {
+			view.entries[op] = newTestEntry(1)
+		}
+		c.commit(view)
+	}
+
+	hash1, hash2, hash3 := chainhash.Hash{1}, chainhash.Hash{2},
+		chainhash.Hash{3}
+	add(testOutPoint(1, 0))
+
+	// Neither mode flushes while the cache is small and was just flushed.
+	for _, mode := range []flushMode{flushIfNeeded, flushPeriodic} {
+		if err := c.flush(mode, &hash1); err != nil {
+			t.Fatalf("flush(%d): %v", mode, err)
+		}
+		if consistentHash() != nil {
+			t.Fatalf("flush(%d) wrote the cache", mode)
+		}
+	}
+
+	// A periodic flush happens once the interval has elapsed.  The
+	// entries are kept since the cache isn't full.
+	c.lastFlushTime = time.Now().Add(-utxoFlushPeriodicInterval)
+	if err := c.flush(flushIfNeeded, &hash1); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if consistentHash() != nil {
+		t.Fatalf("flushIfNeeded wrote the cache")
+	}
+	if err := c.flush(flushPeriodic, &hash1); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if h := consistentHash(); h == nil || *h != hash1 {
+		t.Fatalf("utxo set consistent with %v, want %v", h, hash1)
+	}
+	if len(c.entries) != 1 || c.hasModified() {
+		t.Fatalf("flushed cache holds %d entries", len(c.entries))
+	}
+
+	// A required flush records the new hash even when no entries were
+	// modified.
+	if err := c.flush(flushRequired, &hash2); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if h := consistentHash(); h == nil || *h != hash2 {
+		t.Fatalf("utxo set consistent with %v, want %v", h, hash2)
+	}
+
+	// Any mode flushes and empties the cache once it's too large.
+	add(testOutPoint(2, 0), testOutPoint(3, 0))
+	if c.size <= c.maxSize {
+		t.Fatalf("cache size %d not above %d", c.size, c.maxSize)
+	}
+	if err := c.flush(flushIfNeeded, &hash3); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if h := consistentHash(); h == nil || *h != hash3 {
+		t.Fatalf("utxo set consistent with %v, want %v", h, hash3)
+	}
+	if len(c.entries) != 0 || c.size != 0 {
+		t.Fatalf("full cache not emptied by the flush")
+	}
+	for i := byte(1); i <= 3; i++ {
+		if dbEntry(t, c, testOutPoint(i, 0)) == nil {
+			t.Fatalf("entry %d not written by the flush", i)
+		}
+	}
+}
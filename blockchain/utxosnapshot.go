@@ -0,0 +1,556 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// utxoSnapshotVersion is the version of the utxo snapshot format.
+	utxoSnapshotVersion = 1
+
+	// utxoSnapshotBatchSize is the number of outputs of a utxo snapshot
+	// which are written to the database in a single transaction while the
+	// snapshot is being loaded.
+	utxoSnapshotBatchSize = 100000
+)
+
+// The status of a loaded utxo snapshot whose history hasn't been validated.
+const (
+	snapshotPending byte = iota
+	snapshotInvalid
+)
+
+var (
+	// utxoSnapshotMagic identifies a utxo snapshot file.
+	utxoSnapshotMagic = [8]byte{'u', 't', 'x', 'o', 's', 'n', 'a', 'p'}
+
+	// utxoSnapshotKeyName is the name of the db key used to store the state
+	// of a loaded utxo snapshot until its history has been validated.
+	utxoSnapshotKeyName = []byte("utxosnapshot")
+
+	// utxoSnapshotLoadKeyName is the name of the db key used to record that
+	// the outputs of a utxo snapshot are being written to the utxo set.
+	// Such incomplete utxo sets are discarded on startup.
+	utxoSnapshotLoadKeyName = []byte("utxosnapshotload")
+
+	// snapshotUtxoSetBucketName is the name of the db bucket used to house
+	// the utxo set built by the background validation of the history below
+	// a loaded utxo snapshot.
+	snapshotUtxoSetBucketName = []byte("utxosetsnapshot")
+
+	// snapshotUtxoStateKeyName is the name of the db key used to store the
+	// hash of the block the utxo set built by the background validation is
+	// consistent with, which it resumes from after a restart.
+	snapshotUtxoStateKeyName = []byte("utxosetsnapshotstate")
+)
+
+// -----------------------------------------------------------------------------
+// A utxo snapshot consists of the unspent transaction outputs and the ClaimTrie
+// at a block of the main chain, which allows a new node to start at that block
+// rather than at the genesis block.
+//
+// The serialized format is:
+//
+//   <magic><version><network><num outputs><block><outputs><claimtrie>
+//
+//   Field           Type              Size
+//   magic           [8]byte           8 bytes
+//   version         uint32            4 bytes
+//   network         wire.BitcoinNet   4 bytes
+//   num outputs     uint64            8 bytes
+//   block           wire.MsgBlock     variable
+//   outputs         []output          variable
+//   claimtrie       ClaimTrie         variable
+//
+// The block is the one the snapshot was taken at.  The outputs are ordered by
+// their keys in the utxo set, and each one is serialized as:
+//
+//   <hash><index><entry size><entry>
+//
+//   Field           Type              Size
+//   hash            chainhash.Hash    32 bytes
+//   index           uint32            4 bytes
+//   entry size      VarInt            variable
+//   entry           []byte            variable
+//
+// The entry is the utxo entry as it is stored in the utxo set.  See the
+// serialization of utxo entries in chainio.go for details.
+//
+// The hash of the utxo set is the double sha256 of the serialized outputs.  The
+// ClaimTrie is serialized as described by claimtrie.Export.
+// -----------------------------------------------------------------------------
+
+// UtxoSnapshot describes a snapshot of the utxo set at a block of the main
+// chain.
+type UtxoSnapshot struct {
+	Height       int32
+	BlockHash    chainhash.Hash
+	NumUtxos     uint64
+	UtxoSetHash  chainhash.Hash
+	ChainTxCount uint64
+}
+
+// decodeUtxoSetKey returns the outpoint of the passed key of the utxo set.
+func decodeUtxoSetKey(key []byte) (wire.OutPoint, error) {
+	var outpoint wire.OutPoint
+	if len(key) <= chainhash.HashSize {
+		return outpoint, AssertError(fmt.Sprintf("invalid utxo set "+
+			"key %x", key))
+	}
+	index, bytesRead := deserializeVLQ(key[chainhash.HashSize:])
+	if chainhash.HashSize+bytesRead != len(key) {
+		return outpoint, AssertError(fmt.Sprintf("invalid utxo set "+
+			"key %x", key))
+	}
+	copy(outpoint.Hash[:], key[:chainhash.HashSize])
+	outpoint.Index = uint32(index)
+	return outpoint, nil
+}
+
+// serializeUtxoSetOutput returns the serialization of the output of the utxo
+// set with the passed outpoint and serialized entry as it is written to utxo
+// snapshots.
+func serializeUtxoSetOutput(outpoint wire.OutPoint, serializedEntry []byte) []byte {
+	size := chainhash.HashSize + 4 +
+		wire.VarIntSerializeSize(uint64(len(serializedEntry))) +
+		len(serializedEntry)
+	w := bytes.NewBuffer(make([]byte, 0, size))
+	w.Write(outpoint.Hash[:])
+	var index [4]byte
+	byteOrder.PutUint32(index[:], outpoint.Index)
+	w.Write(index[:])
+	wire.WriteVarInt(w, 0, uint64(len(serializedEntry)))
+	w.Write(serializedEntry)
+	return w.Bytes()
+}
+
+// writeUtxoSnapshotOutputs writes the outputs of the utxo set in the passed
+// bucket to w in the order of their keys, and returns their number.
+func writeUtxoSnapshotOutputs(w io.Writer, utxoBucket database.Bucket) (uint64, error) {
+	var numUtxos uint64
+	cursor := utxoBucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		outpoint, err := decodeUtxoSetKey(cursor.Key())
+		if err != nil {
+			return 0, err
+		}
+		_, err = w.Write(serializeUtxoSetOutput(outpoint, cursor.Value()))
+		if err != nil {
+			return 0, err
+		}
+		numUtxos++
+	}
+	return numUtxos, nil
+}
+
+// utxoSetHash returns the hash of the outputs written to the passed hasher,
+// which is the double sha256 of their serialization.
+func utxoSetHash(hasher hash.Hash) chainhash.Hash {
+	return chainhash.HashH(hasher.Sum(nil))
+}
+
+// dbCalcUtxoSetHash uses an existing database transaction to calculate the
+// hash of the utxo set in the bucket with the passed name as it is defined for
+// utxo snapshots.  The number of outputs in the utxo set is returned as well.
+func dbCalcUtxoSetHash(dbTx database.Tx, bucketName []byte) (*chainhash.Hash, uint64, error) {
+	hasher := sha256.New()
+	utxoBucket := dbTx.Metadata().Bucket(bucketName)
+	numUtxos, err := writeUtxoSnapshotOutputs(hasher, utxoBucket)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash := utxoSetHash(hasher)
+	return &hash, numUtxos, nil
+}
+
+// DumpUtxoSnapshot writes a snapshot of the utxo set and the ClaimTrie at the
+// end of the main chain to w.  Blocks may be connected to the main chain while
+// the outputs are written, since they are read from a database transaction
+// which keeps seeing the utxo set at the snapshot block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUtxoSnapshot(w io.Writer) (*UtxoSnapshot, error) {
+	var snapshot *UtxoSnapshot
+	var tip *blockNode
+	bw := bufio.NewWriter(w)
+	err := b.viewUtxoSet(func(dbTx database.Tx, node *blockNode, state *BestState) error {
+		tip = node
+		snapshot = &UtxoSnapshot{
+			Height:       tip.height,
+			BlockHash:    tip.hash,
+			ChainTxCount: state.TotalTxns,
+		}
+		block, err := dbFetchBlockByNode(dbTx, tip)
+		if err != nil {
+			return err
+		}
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		var numUtxos uint64
+		cursor := utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			numUtxos++
+		}
+
+		var hdr [24]byte
+		copy(hdr[:], utxoSnapshotMagic[:])
+		byteOrder.PutUint32(hdr[8:], utxoSnapshotVersion)
+		byteOrder.PutUint32(hdr[12:], uint32(b.chainParams.Net))
+		byteOrder.PutUint64(hdr[16:], numUtxos)
+		if _, err := bw.Write(hdr[:]); err != nil {
+			return err
+		}
+		if err := block.MsgBlock().Serialize(bw); err != nil {
+			return err
+		}
+
+		hasher := sha256.New()
+		snapshot.NumUtxos, err = writeUtxoSnapshotOutputs(
+			io.MultiWriter(bw, hasher), utxoBucket)
+		if err != nil {
+			return err
+		}
+		snapshot.UtxoSetHash = utxoSetHash(hasher)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The ClaimTrie keeps the history of the main chain, so it's exported
+	// at the height of the snapshot block.  Its root no longer matches the
+	// block when the block was disconnected in the meantime.
+	b.chainLock.RLock()
+	hdr, err := b.claimTrie.Export(bw, claimtrie.Height(tip.height), &tip.hash)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.MerkleRoot != tip.claimTrie {
+		return nil, fmt.Errorf("ClaimTrie root %v at height %d does "+
+			"not match block %v, which was disconnected while the "+
+			"snapshot was written", hdr.MerkleRoot, tip.height,
+			tip.hash)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Dumped utxo snapshot at height %d (hash %v, %d outputs, "+
+		"utxo set hash %v)", snapshot.Height, snapshot.BlockHash,
+		snapshot.NumUtxos, snapshot.UtxoSetHash)
+	return snapshot, nil
+}
+
+// assumeUtxo returns the utxo snapshot of the chain parameters taken at the
+// block with the passed hash, or nil when there is none.
+func (b *BlockChain) assumeUtxo(hash *chainhash.Hash) *chaincfg.AssumeUtxo {
+	for i := range b.chainParams.AssumeUtxos {
+		au := &b.chainParams.AssumeUtxos[i]
+		if au.BlockHash.IsEqual(hash) {
+			return au
+		}
+	}
+	return nil
+}
+
+// LoadUtxoSnapshot replaces the chain state with the utxo snapshot read from r,
+// so the main chain continues at the block of the snapshot.  The chain must not
+// have any blocks beyond the genesis block yet, and the header of the snapshot
+// block must be known.
+//
+// The snapshot is refused unless it is one of the snapshots of the chain
+// parameters, and both the hash of its utxo set and the root of its ClaimTrie
+// match.  The blocks below the snapshot are downloaded and validated in the
+// background afterwards, which must result in the same utxo set.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUtxoSnapshot(r io.Reader) (*UtxoSnapshot, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.indexManager != nil {
+		return nil, fmt.Errorf("utxo snapshots can't be loaded while " +
+			"optional indexes are enabled")
+	}
+	if b.bestChain.Height() != 0 || b.snapshot != nil {
+		return nil, fmt.Errorf("utxo snapshots can only be loaded " +
+			"before any blocks have been connected")
+	}
+
+	br := bufio.NewReader(r)
+	var hdr [24]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:8], utxoSnapshotMagic[:]) {
+		return nil, fmt.Errorf("not a utxo snapshot")
+	}
+	if version := byteOrder.Uint32(hdr[8:]); version != utxoSnapshotVersion {
+		return nil, fmt.Errorf("unsupported utxo snapshot version %d",
+			version)
+	}
+	if net := wire.BitcoinNet(byteOrder.Uint32(hdr[12:])); net != b.chainParams.Net {
+		return nil, fmt.Errorf("utxo snapshot is for network %v "+
+			"instead of %v", net, b.chainParams.Net)
+	}
+	numUtxos := byteOrder.Uint64(hdr[16:])
+
+	var msgBlock wire.MsgBlock
+	if err := msgBlock.Deserialize(br); err != nil {
+		return nil, err
+	}
+	block := btcutil.NewBlock(&msgBlock)
+	au := b.assumeUtxo(block.Hash())
+	if au == nil {
+		return nil, fmt.Errorf("block %v of the utxo snapshot is not "+
+			"a known snapshot block", block.Hash())
+	}
+	node := b.index.LookupNode(block.Hash())
+	if node == nil {
+		return nil, fmt.Errorf("header of the utxo snapshot block %v "+
+			"is not known yet", block.Hash())
+	}
+	if node.height != au.Height || b.index.NodeStatus(node).KnownInvalid() {
+		return nil, fmt.Errorf("header of the utxo snapshot block %v "+
+			"is invalid", block.Hash())
+	}
+	if numUtxos != au.NumUtxos {
+		return nil, fmt.Errorf("utxo snapshot has %d outputs instead "+
+			"of %d", numUtxos, au.NumUtxos)
+	}
+	block.SetHeight(node.height)
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		BFNone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the utxo set with the outputs of the snapshot.  They are
+	// discarded on startup in case loading them doesn't complete.
+	b.commitLock.Lock()
+	defer b.commitLock.Unlock()
+	err = b.utxoCache.flush(flushRequired, &b.bestChain.Tip().hash)
+	if err != nil {
+		return nil, err
+	}
+	b.utxoCache.purge()
+	err = b.db.Update(func(dbTx database.Tx) error {
+		err := dbTx.Metadata().Put(utxoSnapshotLoadKeyName, node.hash[:])
+		if err != nil {
+			return err
+		}
+		return dbResetUtxoSet(dbTx, utxoSetBucketName,
+			b.chainParams.GenesisBlock)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Loading utxo snapshot at height %d (hash %v, %d outputs)",
+		node.height, node.hash, numUtxos)
+	hasher := sha256.New()
+	tr := io.TeeReader(br, hasher)
+	for loaded := uint64(0); loaded < numUtxos; {
+		n := numUtxos - loaded
+		if n > utxoSnapshotBatchSize {
+			n = utxoSnapshotBatchSize
+		}
+		err := b.db.Update(func(dbTx database.Tx) error {
+			utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+			return readUtxoSnapshotOutputs(tr, utxoBucket, n,
+				node.height)
+		})
+		if err != nil {
+			return nil, b.discardUtxoSnapshot(err)
+		}
+		loaded += n
+		log.Infof("Loaded %d of %d outputs of the utxo snapshot",
+			loaded, numUtxos)
+	}
+	if hash := utxoSetHash(hasher); hash != *au.UtxoSetHash {
+		err := fmt.Errorf("utxo set hash %v of the snapshot does not "+
+			"match %v", hash, au.UtxoSetHash)
+		return nil, b.discardUtxoSnapshot(err)
+	}
+
+	// Replace the ClaimTrie with the one of the snapshot, which must match
+	// the root in the header of the snapshot block.
+	ctHdr, err := claimtrie.ReadSnapshotHeader(br)
+	if err != nil {
+		return nil, b.discardUtxoSnapshot(err)
+	}
+	if ctHdr.BlockHash != node.hash ||
+		ctHdr.Height != claimtrie.Height(node.height) {
+
+		err := fmt.Errorf("ClaimTrie of the utxo snapshot is for "+
+			"block %v at height %d", ctHdr.BlockHash, ctHdr.Height)
+		return nil, b.discardUtxoSnapshot(err)
+	}
+	if err := b.claimTrie.Import(br, ctHdr, &node.claimTrie); err != nil {
+		return nil, b.discardUtxoSnapshot(err)
+	}
+
+	// Make the snapshot block the end of the main chain.  The hashes of
+	// the blocks below it are added to the main chain index so they can
+	// be looked up by height.
+	state := newBestState(node, uint64(msgBlock.SerializeSize()),
+		uint64(GetBlockWeight(block)), uint64(len(msgBlock.Transactions)),
+		au.ChainTxCount, node.CalcPastMedianTime())
+	err = b.db.Update(func(dbTx database.Tx) error {
+		if err := dbStoreBlock(dbTx, block); err != nil {
+			return err
+		}
+		for n := node; n.parent != nil; n = n.parent {
+			if err := dbPutBlockIndex(dbTx, &n.hash, n.height); err != nil {
+				return err
+			}
+		}
+		if err := dbPutBestState(dbTx, state, node.workSum); err != nil {
+			return err
+		}
+		if err := dbPutUtxoStateConsistency(dbTx, &node.hash); err != nil {
+			return err
+		}
+		err := dbPutUtxoSnapshotState(dbTx, &node.hash, au.UtxoSetHash,
+			snapshotPending)
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(utxoSnapshotLoadKeyName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.utxoCache.lastFlushHash = node.hash
+	b.bestChain.SetTip(node)
+	b.stateLock.Lock()
+	b.stateSnapshot = state
+	b.stateLock.Unlock()
+
+	b.index.SetStatusFlags(node, statusDataStored)
+	for n := node; n != nil; n = n.parent {
+		b.index.SetStatusFlags(n, statusValid)
+	}
+	if err := b.index.flushToDB(); err != nil {
+		return nil, err
+	}
+
+	sv, err := b.newSnapshotValidation(node, au.UtxoSetHash)
+	if err != nil {
+		return nil, err
+	}
+	b.snapshotLock.Lock()
+	b.snapshot = sv
+	b.snapshotLock.Unlock()
+	go b.validateSnapshotHistory(sv)
+
+	log.Infof("Loaded utxo snapshot at height %d (hash %v)", node.height,
+		node.hash)
+	return &UtxoSnapshot{
+		Height:       node.height,
+		BlockHash:    node.hash,
+		NumUtxos:     numUtxos,
+		UtxoSetHash:  *au.UtxoSetHash,
+		ChainTxCount: au.ChainTxCount,
+	}, nil
+}
+
+// readUtxoSnapshotOutputs reads the passed number of outputs of a utxo snapshot
+// taken at the passed height from r, and stores them in the utxo bucket.
+func readUtxoSnapshotOutputs(r io.Reader, utxoBucket database.Bucket, n uint64, height int32) error {
+	var buf [chainhash.HashSize + 4]byte
+	for i := uint64(0); i < n; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return err
+		}
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], buf[:chainhash.HashSize])
+		outpoint.Index = byteOrder.Uint32(buf[chainhash.HashSize:])
+
+		size, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return err
+		}
+		if size == 0 || size > wire.MaxBlockPayload {
+			return fmt.Errorf("invalid size %d of utxo snapshot "+
+				"output %v", size, outpoint)
+		}
+		serialized := make([]byte, size)
+		if _, err := io.ReadFull(r, serialized); err != nil {
+			return err
+		}
+
+		// Only outputs which can be deserialized are accepted, even
+		// though they are stored as is.
+		entry, err := deserializeUtxoEntry(serialized)
+		if err != nil {
+			return fmt.Errorf("invalid utxo snapshot output %v: %v",
+				outpoint, err)
+		}
+		if entry.BlockHeight() > height {
+			return fmt.Errorf("utxo snapshot output %v at height "+
+				"%d is beyond the snapshot", outpoint,
+				entry.BlockHeight())
+		}
+
+		// NOTE: The key is intentionally not recycled here since the
+		// database interface contract prohibits modifications.
+		key := outpointKey(outpoint)
+		if err := utxoBucket.Put(*key, serialized); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbResetUtxoSet uses an existing database transaction to replace the utxo set
+// in the bucket with the passed name with the outputs of the passed genesis
+// block.
+func dbResetUtxoSet(dbTx database.Tx, bucketName []byte, genesis *wire.MsgBlock) error {
+	meta := dbTx.Metadata()
+	if meta.Bucket(bucketName) != nil {
+		if err := meta.DeleteBucket(bucketName); err != nil {
+			return err
+		}
+	}
+	utxoBucket, err := meta.CreateBucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	view := NewUtxoViewpoint()
+	err = view.connectTransactions(btcutil.NewBlock(genesis), nil)
+	if err != nil {
+		return err
+	}
+	for outpoint, entry := range view.entries {
+		if entry == nil || entry.IsSpent() {
+			continue
+		}
+		serialized, err := serializeUtxoEntry(entry)
+		if err != nil {
+			return err
+		}
+		key := outpointKey(outpoint)
+		if err := utxoBucket.Put(*key, serialized); err != nil {
+			return err
+		}
+	}
+	return nil
+}
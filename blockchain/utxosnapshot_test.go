@@ -0,0 +1,297 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestUtxoSnapshot ensures a utxo snapshot dumped from a chain can be loaded
+// into a new chain, which continues at the snapshot block, and that the blocks
+// below it are then validated in the background.
+func TestUtxoSnapshot(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	// Build the source chain from all of the generated blocks.  Whether
+	// they are accepted doesn't matter here.
+	params := *fullblocktests.RegressionNetParams
+	chain, teardown, err := chainSetup(&params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(chain, tests)
+	best := chain.BestSnapshot()
+	var blocks []*btcutil.Block
+	for height := int32(1); height <= best.Height; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): %v", height, err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var buf bytes.Buffer
+	snapshot, err := chain.DumpUtxoSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+	if snapshot.Height != best.Height || snapshot.BlockHash != best.Hash ||
+		snapshot.ChainTxCount != best.TotalTxns {
+
+		t.Fatalf("unexpected snapshot %+v of best chain %+v", snapshot,
+			best)
+	}
+
+	// Create a new chain which knows the snapshot and the headers of the
+	// source chain.
+	params.AssumeUtxos = []chaincfg.AssumeUtxo{{
+		Height:       snapshot.Height,
+		BlockHash:    &snapshot.BlockHash,
+		UtxoSetHash:  &snapshot.UtxoSetHash,
+		NumUtxos:     snapshot.NumUtxos,
+		ChainTxCount: snapshot.ChainTxCount,
+	}}
+	newChain, newTeardown, err := chainSetup(&params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer newTeardown()
+
+	// The snapshot block must be known.
+	if _, err := newChain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded snapshot of unknown block")
+	}
+	for _, block := range blocks {
+		err := newChain.ProcessBlockHeader(&block.MsgBlock().Header,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlockHeader: %v", err)
+		}
+	}
+
+	// A snapshot with a modified output is refused, and leaves the chain
+	// untouched.
+	corrupt := append([]byte(nil), buf.Bytes()...)
+	outputsOffset := 24 + blocks[len(blocks)-1].MsgBlock().SerializeSize()
+	corrupt[outputsOffset] ^= 0x01
+	if _, err := newChain.LoadUtxoSnapshot(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded corrupt snapshot")
+	}
+	if newChain.BestSnapshot().Height != 0 || newChain.SnapshotValidation() != nil {
+		t.Fatal("LoadUtxoSnapshot: corrupt snapshot changed the chain")
+	}
+
+	loaded, err := newChain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: %v", err)
+	}
+	if *loaded != *snapshot {
+		t.Fatalf("loaded snapshot %+v instead of %+v", loaded, snapshot)
+	}
+	newBest := newChain.BestSnapshot()
+	if newBest.Hash != best.Hash || newBest.TotalTxns != best.TotalTxns {
+		t.Fatalf("best chain %+v after loading the snapshot instead "+
+			"of %+v", newBest, best)
+	}
+	if newChain.ClaimTrie().MerkleHash().IsEqual(chain.ClaimTrie().MerkleHash()) == false {
+		t.Fatal("ClaimTrie root does not match after loading the snapshot")
+	}
+	if _, err := newChain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded a second snapshot")
+	}
+
+	// Every output of the source chain is available.
+	for _, block := range blocks {
+		for _, tx := range block.Transactions() {
+			view, err := chain.FetchUtxoView(tx)
+			if err != nil {
+				t.Fatalf("FetchUtxoView: %v", err)
+			}
+			newView, err := newChain.FetchUtxoView(tx)
+			if err != nil {
+				t.Fatalf("FetchUtxoView: %v", err)
+			}
+			for outpoint, entry := range view.Entries() {
+				newEntry := newView.LookupEntry(outpoint)
+				if (entry == nil) != (newEntry == nil) || entry != nil &&
+					(entry.Amount() != newEntry.Amount() ||
+						entry.BlockHeight() != newEntry.BlockHeight()) {
+
+					t.Fatalf("output %v does not match after "+
+						"loading the snapshot", outpoint)
+				}
+			}
+		}
+	}
+
+	// The blocks below the snapshot are validated as they arrive.
+	state := newChain.SnapshotValidation()
+	if state == nil || state.SnapshotHeight != snapshot.Height ||
+		state.ValidatedHeight != 0 || state.Invalid {
+
+		t.Fatalf("unexpected snapshot validation state %+v", state)
+	}
+	for _, block := range blocks[:len(blocks)-1] {
+		block := btcutil.NewBlock(block.MsgBlock())
+		isMainChain, _, err := newChain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil || !isMainChain {
+			t.Fatalf("ProcessBlock(%v): main chain %v, %v",
+				block.Hash(), isMainChain, err)
+		}
+	}
+	deadline := time.Now().Add(time.Minute)
+	for newChain.SnapshotValidation() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("blocks below the snapshot not validated: %+v",
+				newChain.SnapshotValidation())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestUtxoSnapshotResume ensures the background validation of the blocks below
+// a loaded utxo snapshot resumes where it stopped when the chain is restarted.
+func TestUtxoSnapshotResume(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	params := *fullblocktests.RegressionNetParams
+	chain, teardown, err := chainSetup(&params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(chain, tests)
+	var blocks []*btcutil.Block
+	for height := int32(1); height <= chain.BestSnapshot().Height; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): %v", height, err)
+		}
+		blocks = append(blocks, block)
+	}
+	var buf bytes.Buffer
+	snapshot, err := chain.DumpUtxoSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+	params.AssumeUtxos = []chaincfg.AssumeUtxo{{
+		Height:       snapshot.Height,
+		BlockHash:    &snapshot.BlockHash,
+		UtxoSetHash:  &snapshot.UtxoSetHash,
+		NumUtxos:     snapshot.NumUtxos,
+		ChainTxCount: snapshot.ChainTxCount,
+	}}
+
+	// The chain is restarted with the same database and ClaimTrie.  The
+	// tiny utxo cache flushes the utxo set of the validation after every
+	// block.
+	dbPath, err := ioutil.TempDir("", "utxosnapshotresume")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("database.Create: %v", err)
+	}
+	defer db.Close()
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		t.Fatalf("claimtrie.NewMemory: %v", err)
+	}
+	defer ct.Close()
+	newChain := func(interrupt <-chan struct{}) *blockchain.BlockChain {
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:               db,
+			Interrupt:        interrupt,
+			ChainParams:      &params,
+			TimeSource:       blockchain.NewMedianTime(),
+			SigCache:         txscript.NewSigCache(1000),
+			UtxoCacheMaxSize: 1,
+			ClaimTrie:        ct,
+		})
+		if err != nil {
+			t.Fatalf("failed to create chain instance: %v", err)
+		}
+		return chain
+	}
+	waitValidated := func(chain *blockchain.BlockChain, height int32) {
+		deadline := time.Now().Add(time.Minute)
+		for {
+			state := chain.SnapshotValidation()
+			if state == nil && height == snapshot.Height ||
+				state != nil && state.ValidatedHeight == height {
+
+				return
+			}
+			if state != nil && state.Invalid || time.Now().After(deadline) {
+				t.Fatalf("blocks up to height %d not validated: %+v",
+					height, state)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	interrupt := make(chan struct{})
+	firstChain := newChain(interrupt)
+	for _, block := range blocks {
+		err := firstChain.ProcessBlockHeader(&block.MsgBlock().Header,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlockHeader: %v", err)
+		}
+	}
+	_, err = firstChain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: %v", err)
+	}
+	const restartHeight = 60
+	for _, block := range blocks[:restartHeight] {
+		block := btcutil.NewBlock(block.MsgBlock())
+		if _, _, err := firstChain.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlock(%v): %v", block.Hash(), err)
+		}
+	}
+	waitValidated(firstChain, restartHeight)
+
+	// The validation waits for the next block, so interrupting the chain
+	// stops it right away.
+	close(interrupt)
+	restarted := newChain(nil)
+	state := restarted.SnapshotValidation()
+	if state == nil || state.ValidatedHeight != restartHeight {
+		t.Fatalf("validation resumed at %+v instead of height %d", state,
+			restartHeight)
+	}
+	for _, block := range blocks[restartHeight : len(blocks)-1] {
+		block := btcutil.NewBlock(block.MsgBlock())
+		if _, _, err := restarted.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlock(%v): %v", block.Hash(), err)
+		}
+	}
+	waitValidated(restarted, snapshot.Height)
+}
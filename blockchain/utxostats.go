@@ -0,0 +1,239 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// UtxoSetHashType identifies the hash of the utxo set calculated along with its
+// statistics.
+type UtxoSetHashType int
+
+const (
+	// UtxoSetHashNone skips hashing the utxo set.
+	UtxoSetHashNone UtxoSetHashType = iota
+
+	// UtxoSetHashSerialized is the double sha256 of the serialized outputs
+	// of the utxo set, which is the hash of utxo snapshots.
+	UtxoSetHashSerialized
+
+	// UtxoSetHashMuHash is the MuHash of the serialized outputs of the utxo
+	// set, which can be updated as blocks are connected.
+	UtxoSetHashMuHash
+)
+
+// UtxoSetStats describes the utxo set at a block of the main chain.
+type UtxoSetStats struct {
+	Height    int32
+	BlockHash chainhash.Hash
+
+	// NumUtxos is the number of unspent transaction outputs, and
+	// SerializedSize the size of their serialization in utxo snapshots.
+	NumUtxos       uint64
+	SerializedSize uint64
+
+	// TotalAmount is the amount of all unspent outputs, of which
+	// ClaimAmount is held by claims and updates of claims, and
+	// SupportAmount by supports.
+	TotalAmount   int64
+	ClaimAmount   int64
+	SupportAmount int64
+
+	// HashType is the type of Hash, which is not set when it is
+	// UtxoSetHashNone.
+	HashType UtxoSetHashType
+	Hash     chainhash.Hash
+}
+
+// PlainAmount returns the amount of the unspent outputs which are not claims,
+// updates of claims or supports.
+func (s *UtxoSetStats) PlainAmount() int64 {
+	return s.TotalAmount - s.ClaimAmount - s.SupportAmount
+}
+
+// updateOutput adds the passed output of the utxo set, which is serialized as in
+// utxo snapshots, to the statistics, or removes it when add is false.
+func (s *UtxoSetStats) updateOutput(serialized []byte, amount int64, pkScript []byte, add bool) {
+	sign := int64(1)
+	if !add {
+		sign = -1
+	}
+	s.NumUtxos += uint64(sign)
+	s.SerializedSize += uint64(sign * int64(len(serialized)))
+	s.TotalAmount += sign * amount
+
+	if len(pkScript) == 0 {
+		return
+	}
+	cs, err := txscript.DecodeClaimScript(pkScript)
+	if err != nil {
+		return
+	}
+	switch cs.Opcode() {
+	case txscript.OP_CLAIMNAME, txscript.OP_UPDATECLAIM:
+		s.ClaimAmount += sign * amount
+	case txscript.OP_SUPPORTCLAIM:
+		s.SupportAmount += sign * amount
+	}
+}
+
+// CalcUtxoSetStats calculates the statistics of the utxo set at the end of the
+// main chain, along with its hash of the passed type, by reading all of its
+// outputs.  Blocks may be connected to the main chain in the meantime, but the
+// statistics are the ones of the utxo set at the block they report.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcUtxoSetStats(hashType UtxoSetHashType) (*UtxoSetStats, error) {
+	var stats *UtxoSetStats
+	hasher := sha256.New()
+	muHash := NewMuHash()
+	err := b.viewUtxoSet(func(dbTx database.Tx, tip *blockNode, _ *BestState) error {
+		stats = &UtxoSetStats{
+			Height:    tip.height,
+			BlockHash: tip.hash,
+			HashType:  hashType,
+		}
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		cursor := utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			outpoint, err := decodeUtxoSetKey(cursor.Key())
+			if err != nil {
+				return err
+			}
+			entry, err := deserializeUtxoEntry(cursor.Value())
+			if err != nil {
+				return err
+			}
+
+			serialized := serializeUtxoSetOutput(outpoint,
+				cursor.Value())
+			stats.updateOutput(serialized, entry.Amount(),
+				entry.PkScript(), true)
+			switch hashType {
+			case UtxoSetHashSerialized:
+				hasher.Write(serialized)
+			case UtxoSetHashMuHash:
+				muHash.Add(serialized)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch hashType {
+	case UtxoSetHashSerialized:
+		stats.Hash = utxoSetHash(hasher)
+	case UtxoSetHashMuHash:
+		stats.Hash = muHash.Hash()
+	}
+	return stats, nil
+}
+
+// ConnectUtxoSetStats updates the passed statistics and MuHash of the utxo set
+// at the parent of the passed block to the utxo set at the block, whose height
+// must be set.  The spent transaction outputs are the ones of the spend journal
+// of the block, in the order the inputs of its transactions spend them.
+//
+// The hash of the statistics is left untouched, and is the hash of the MuHash
+// once it has been updated.
+func ConnectUtxoSetStats(stats *UtxoSetStats, muHash *MuHash, block *btcutil.Block, stxos []SpentTxOut) error {
+	stxoIdx := 0
+	for i, tx := range block.Transactions() {
+		// Remove the spent outputs.  The outputs spent by the earlier
+		// transactions of the block have been added by then.
+		if i != 0 {
+			for _, txIn := range tx.MsgTx().TxIn {
+				if stxoIdx >= len(stxos) {
+					return AssertError(fmt.Sprintf("spend "+
+						"journal entry of block %v is "+
+						"missing outputs", block.Hash()))
+				}
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+
+				// Legacy entries may lack the height and
+				// coinbase flag of the output, which are part
+				// of its serialization.
+				if stxo.Height == 0 {
+					return AssertError(fmt.Sprintf("spend "+
+						"journal entry of block %v lacks "+
+						"the height of output %v",
+						block.Hash(), txIn.PreviousOutPoint))
+				}
+				entry := &UtxoEntry{
+					amount:      stxo.Amount,
+					pkScript:    stxo.PkScript,
+					blockHeight: stxo.Height,
+				}
+				if stxo.IsCoinBase {
+					entry.packedFlags |= tfCoinBase
+				}
+				err := updateUtxoSetStats(stats, muHash,
+					txIn.PreviousOutPoint, entry, false)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Add the created outputs which are not provably unspendable.
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+
+			prevOut.Index = uint32(txOutIdx)
+			entry := &UtxoEntry{
+				amount:      txOut.Value,
+				pkScript:    txOut.PkScript,
+				blockHeight: block.Height(),
+			}
+			if i == 0 {
+				entry.packedFlags |= tfCoinBase
+			}
+			err := updateUtxoSetStats(stats, muHash, prevOut, entry, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if stxoIdx != len(stxos) {
+		return AssertError(fmt.Sprintf("spend journal entry of block "+
+			"%v has %d outputs instead of %d", block.Hash(),
+			len(stxos), stxoIdx))
+	}
+
+	stats.Height = block.Height()
+	stats.BlockHash = *block.Hash()
+	return nil
+}
+
+// updateUtxoSetStats adds the passed output to the statistics and MuHash of the
+// utxo set, or removes it when add is false.
+func updateUtxoSetStats(stats *UtxoSetStats, muHash *MuHash, outpoint wire.OutPoint, entry *UtxoEntry, add bool) error {
+	serializedEntry, err := serializeUtxoEntry(entry)
+	if err != nil {
+		return err
+	}
+	serialized := serializeUtxoSetOutput(outpoint, serializedEntry)
+	stats.updateOutput(serialized, entry.amount, entry.pkScript, add)
+	if add {
+		muHash.Add(serialized)
+	} else {
+		muHash.Remove(serialized)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/claimtrie"
+)
+
+// TestUtxoSetStats ensures the statistics calculated from the utxo set match
+// the ones of utxo snapshots, and the ones derived by connecting the blocks of
+// the main chain one by one.
+func TestUtxoSetStats(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	params := *fullblocktests.RegressionNetParams
+	chain, teardown, err := chainSetup(&params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(chain, tests)
+	best := chain.BestSnapshot()
+
+	serialized, err := chain.CalcUtxoSetStats(blockchain.UtxoSetHashSerialized)
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: %v", err)
+	}
+	snapshot, err := chain.DumpUtxoSnapshot(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+	if serialized.Height != best.Height || serialized.BlockHash != best.Hash {
+		t.Fatalf("statistics of block %v (%d) instead of %v (%d)",
+			serialized.BlockHash, serialized.Height, best.Hash,
+			best.Height)
+	}
+	if serialized.Hash != snapshot.UtxoSetHash ||
+		serialized.NumUtxos != snapshot.NumUtxos {
+
+		t.Fatalf("statistics %+v do not match snapshot %+v", serialized,
+			snapshot)
+	}
+	if serialized.ClaimAmount == 0 || serialized.SupportAmount == 0 {
+		t.Fatalf("statistics %+v lack claims or supports", serialized)
+	}
+
+	muHashStats, err := chain.CalcUtxoSetStats(blockchain.UtxoSetHashMuHash)
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: %v", err)
+	}
+	if muHashStats.Hash == serialized.Hash {
+		t.Fatal("CalcUtxoSetStats: MuHash equals the serialized hash")
+	}
+
+	// Derive the statistics by connecting every block of the main chain to
+	// the empty utxo set of the genesis block.
+	stats := &blockchain.UtxoSetStats{HashType: blockchain.UtxoSetHashMuHash}
+	muHash := blockchain.NewMuHash()
+	for height := int32(1); height <= best.Height; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): %v", height, err)
+		}
+		stxos, err := chain.FetchSpendJournal(block)
+		if err != nil {
+			t.Fatalf("FetchSpendJournal(%d): %v", height, err)
+		}
+		err = blockchain.ConnectUtxoSetStats(stats, muHash, block, stxos)
+		if err != nil {
+			t.Fatalf("ConnectUtxoSetStats(%d): %v", height, err)
+		}
+	}
+	stats.Hash = muHash.Hash()
+	if *stats != *muHashStats {
+		t.Fatalf("connected statistics %+v instead of %+v", stats,
+			muHashStats)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -28,6 +27,10 @@ const (
 	// tfModified indicates that a txout has been modified since it was
 	// loaded.
 	tfModified
+
+	// tfFresh indicates that a txout was created after the utxo set in the
+	// database was last updated, so it doesn't exist there.
+	tfFresh
 )
 
 // UtxoEntry houses details about an individual transaction output in a utxo
@@ -58,6 +61,12 @@ func (entry *UtxoEntry) isModified() bool {
 	return entry.packedFlags&tfModified == tfModified
 }
 
+// isFresh returns whether or not the output was created after the utxo set in
+// the database was last updated.
+func (entry *UtxoEntry) isFresh() bool {
+	return entry.packedFlags&tfFresh == tfFresh
+}
+
 // IsCoinBase returns whether or not the output was contained in a coinbase
 // transaction.
 func (entry *UtxoEntry) IsCoinBase() bool {
@@ -157,16 +166,19 @@ func (view *UtxoViewpoint) addTxOut(outpoint wire.OutPoint, txOut *wire.TxOut, i
 	// possible (although extremely unlikely) that the existing entry is
 	// being replaced by a different transaction with the same hash.  This
 	// is allowed so long as the previous transaction is fully spent.
+	//
+	// Outputs which are not known to the view don't exist in the utxo set,
+	// so they are marked fresh.
 	entry := view.LookupEntry(outpoint)
 	if entry == nil {
-		entry = new(UtxoEntry)
+		entry = &UtxoEntry{packedFlags: tfFresh}
 		view.entries[outpoint] = entry
 	}
 
 	entry.amount = txOut.Value
 	entry.pkScript = txOut.PkScript
 	entry.blockHeight = blockHeight
-	entry.packedFlags = tfModified
+	entry.packedFlags = tfModified | entry.packedFlags&tfFresh
 	if isCoinBase {
 		entry.packedFlags |= tfCoinBase
 	}
@@ -280,8 +292,8 @@ func (view *UtxoViewpoint) connectTransactions(block *btcutil.Block, stxos *[]Sp
 
 // fetchEntryByHash attempts to find any available utxo for the given hash by
 // searching the entire set of possible outputs for the given hash.  It checks
-// the view first and then falls back to the database if needed.
-func (view *UtxoViewpoint) fetchEntryByHash(db database.DB, hash *chainhash.Hash) (*UtxoEntry, error) {
+// the view first and then falls back to the utxo cache if needed.
+func (view *UtxoViewpoint) fetchEntryByHash(cache *utxoCache, hash *chainhash.Hash) (*UtxoEntry, error) {
 	// First attempt to find a utxo with the provided hash in the view.
 	prevOut := wire.OutPoint{Hash: *hash}
 	for idx := uint32(0); idx < MaxOutputsPerBlock; idx++ {
@@ -292,23 +304,17 @@ func (view *UtxoViewpoint) fetchEntryByHash(db database.DB, hash *chainhash.Hash
 		}
 	}
 
-	// Check the database since it doesn't exist in the view.  This will
+	// Check the utxo cache since it doesn't exist in the view.  This will
 	// often by the case since only specifically referenced utxos are loaded
 	// into the view.
-	var entry *UtxoEntry
-	err := db.View(func(dbTx database.Tx) error {
-		var err error
-		entry, err = dbFetchUtxoEntryByHash(dbTx, hash)
-		return err
-	})
-	return entry, err
+	return cache.fetchEntryByHash(hash)
 }
 
 // disconnectTransactions updates the view by removing all of the transactions
 // created by the passed block, restoring all utxos the transactions spent by
 // using the provided spent txo information, and setting the best hash for the
 // view to the block before the passed block.
-func (view *UtxoViewpoint) disconnectTransactions(db database.DB, block *btcutil.Block, stxos []SpentTxOut) error {
+func (view *UtxoViewpoint) disconnectTransactions(cache *utxoCache, block *btcutil.Block, stxos []SpentTxOut) error {
 	// Sanity check the correct number of stxos are provided.
 	if len(stxos) != countSpentOutputs(block) {
 		return AssertError("disconnectTransactions called with bad " +
@@ -406,7 +412,7 @@ func (view *UtxoViewpoint) disconnectTransactions(db database.DB, block *btcutil
 			// only ever run with the new v2 format, this code path
 			// will never run.
 			if stxo.Height == 0 {
-				utxo, err := view.fetchEntryByHash(db, txHash)
+				utxo, err := view.fetchEntryByHash(cache, txHash)
 				if err != nil {
 					return err
 				}
@@ -451,7 +457,8 @@ func (view *UtxoViewpoint) Entries() map[wire.OutPoint]*UtxoEntry {
 }
 
 // commit prunes all entries marked modified that are now fully spent and marks
-// all entries as unmodified.
+// all entries as unmodified.  The entries are no longer marked fresh either
+// since the utxo cache may write them to the database at any time.
 func (view *UtxoViewpoint) commit() {
 	for outpoint, entry := range view.entries {
 		if entry == nil || (entry.isModified() && entry.IsSpent()) {
@@ -460,6 +467,7 @@ func (view *UtxoViewpoint) commit() {
 		}
 
 		entry.packedFlags ^= tfModified
+		entry.packedFlags &^= tfFresh
 	}
 }
 
@@ -470,7 +478,7 @@ func (view *UtxoViewpoint) commit() {
 // Upon completion of this function, the view will contain an entry for each
 // requested outpoint.  Spent outputs, or those which otherwise don't exist,
 // will result in a nil entry in the view.
-func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.OutPoint]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxosMain(cache *utxoCache, outpoints map[wire.OutPoint]struct{}) error {
 	// Nothing to do if there are no requested outputs.
 	if len(outpoints) == 0 {
 		return nil
@@ -483,24 +491,13 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.Out
 	// will result in nil entries in the view.  This is intentionally done
 	// so other code can use the presence of an entry in the store as a way
 	// to unnecessarily avoid attempting to reload it from the database.
-	return db.View(func(dbTx database.Tx) error {
-		for outpoint := range outpoints {
-			entry, err := dbFetchUtxoEntry(dbTx, outpoint)
-			if err != nil {
-				return err
-			}
-
-			view.entries[outpoint] = entry
-		}
-
-		return nil
-	})
+	return cache.fetchEntries(outpoints, view.entries)
 }
 
 // fetchUtxos loads the unspent transaction outputs for the provided set of
-// outputs into the view from the database as needed unless they already exist
+// outputs into the view from the utxo cache as needed unless they already exist
 // in the view in which case they are ignored.
-func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints map[wire.OutPoint]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxos(cache *utxoCache, outpoints map[wire.OutPoint]struct{}) error {
 	// Nothing to do if there are no requested outputs.
 	if len(outpoints) == 0 {
 		return nil
@@ -517,8 +514,8 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints map[wire.OutPoin
 		neededSet[outpoint] = struct{}{}
 	}
 
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, neededSet)
+	// Request the input utxos from the utxo cache.
+	return view.fetchUtxosMain(cache, neededSet)
 }
 
 // fetchInputUtxos loads the unspent transaction outputs for the inputs
@@ -526,7 +523,7 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints map[wire.OutPoin
 // database as needed.  In particular, referenced entries that are earlier in
 // the block are added to the view and entries that are already in the view are
 // not modified.
-func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *btcutil.Block) error {
+func (view *UtxoViewpoint) fetchInputUtxos(cache *utxoCache, block *btcutil.Block) error {
 	// Build a map of in-flight transactions because some of the inputs in
 	// this block could be referencing other transactions earlier in this
 	// block which are not yet in the chain.
@@ -572,8 +569,8 @@ func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *btcutil.Block)
 		}
 	}
 
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, neededSet)
+	// Request the input utxos from the utxo cache.
+	return view.fetchUtxosMain(cache, neededSet)
 }
 
 // NewUtxoViewpoint returns a new empty unspent transaction output view.
@@ -608,9 +605,9 @@ func (b *BlockChain) FetchUtxoView(tx *btcutil.Tx) (*UtxoViewpoint, error) {
 	// Request the utxos from the point of view of the end of the main
 	// chain.
 	view := NewUtxoViewpoint()
-	b.chainLock.RLock()
-	err := view.fetchUtxosMain(b.db, neededSet)
-	b.chainLock.RUnlock()
+	b.commitLock.RLock()
+	err := view.fetchUtxosMain(b.utxoCache, neededSet)
+	b.commitLock.RUnlock()
 	return view, err
 }
 
@@ -625,18 +622,15 @@ func (b *BlockChain) FetchUtxoView(tx *btcutil.Tx) (*UtxoViewpoint, error) {
 // This function is safe for concurrent access however the returned entry (if
 // any) is NOT.
 func (b *BlockChain) FetchUtxoEntry(outpoint wire.OutPoint) (*UtxoEntry, error) {
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
-
-	var entry *UtxoEntry
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		entry, err = dbFetchUtxoEntry(dbTx, outpoint)
-		return err
-	})
+	b.commitLock.RLock()
+	defer b.commitLock.RUnlock()
+
+	entries := make(map[wire.OutPoint]*UtxoEntry, 1)
+	neededSet := map[wire.OutPoint]struct{}{outpoint: {}}
+	err := b.utxoCache.fetchEntries(neededSet, entries)
 	if err != nil {
 		return nil, err
 	}
 
-	return entry, nil
+	return entries[outpoint], nil
 }
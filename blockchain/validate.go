@@ -13,6 +13,7 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -869,7 +870,7 @@ func (b *BlockChain) checkBlockContext(block *btcutil.Block, prevNode *blockNode
 // http://r6.ca/blog/20120206T005236Z.html.
 //
 // This function MUST be called with the chain state lock held (for reads).
-func (b *BlockChain) checkBIP0030(node *blockNode, block *btcutil.Block, view *UtxoViewpoint) error {
+func checkBIP0030(cache *utxoCache, block *btcutil.Block, view *UtxoViewpoint) error {
 	// Fetch utxos for all of the transaction ouputs in this block.
 	// Typically, there will not be any utxos for any of the outputs.
 	fetchSet := make(map[wire.OutPoint]struct{})
@@ -880,7 +881,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *btcutil.Block, view *U
 			fetchSet[prevOut] = struct{}{}
 		}
 	}
-	err := view.fetchUtxos(b.db, fetchSet)
+	err := view.fetchUtxos(cache, fetchSet)
 	if err != nil {
 		return err
 	}
@@ -1027,6 +1028,23 @@ func CheckTransactionInputs(tx *btcutil.Tx, txHeight int32, utxoView *UtxoViewpo
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut) error {
+	return b.checkConnectBlockTo(b.utxoCache, b.claimTrie, node, block,
+		view, stxos, false)
+}
+
+// checkConnectBlockTo performs the checks of checkConnectBlock against the
+// chain state represented by the passed utxo cache and ClaimTrie rather than
+// the ones of the main chain.  This allows the history of the main chain below
+// a loaded utxo snapshot to be validated in the background.
+//
+// When fullScripts is set, the scripts are run even if the block is covered by
+// a checkpoint or the assumed valid block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkConnectBlockTo(cache *utxoCache, ct *claimtrie.ClaimTrie,
+	node *blockNode, block *btcutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut,
+	fullScripts bool) error {
+
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -1065,7 +1083,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	// BIP0030 check is expensive since it involves a ton of cache misses in
 	// the utxoset.
 	if !isBIP0030Node(node) && (node.height < b.chainParams.BIP0034Height) {
-		err := b.checkBIP0030(node, block, view)
+		err := checkBIP0030(cache, block, view)
 		if err != nil {
 			return err
 		}
@@ -1076,7 +1094,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err := view.fetchInputUtxos(b.db, block)
+	err := view.fetchInputUtxos(cache, block)
 	if err != nil {
 		return err
 	}
@@ -1182,16 +1200,10 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	}
 
 	// Don't run scripts if this node is before the latest known good
-	// checkpoint since the validity is verified via the checkpoints (all
-	// transactions are included in the merkle root hash and any changes
-	// will therefore be detected by the next checkpoint).  This is a huge
-	// optimization because running the scripts is the most time consuming
-	// portion of block handling.
-	checkpoint := b.LatestCheckpoint()
-	runScripts := true
-	if checkpoint != nil && node.height <= checkpoint.Height {
-		runScripts = false
-	}
+	// checkpoint, or is assumed valid.  This is a huge optimization because
+	// running the scripts is the most time consuming portion of block
+	// handling.
+	runScripts := fullScripts || !b.skipScripts(node)
 
 	// Blocks created after the BIP0016 activation time need to have the
 	// pay-to-script-hash checks enabled.
@@ -1272,8 +1284,8 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	}
 
 	// Handle LBRY Claim Scripts
-	if err = b.CheckClaimScripts(block, node, view); err != nil {
-		b.ClaimTrie().Reset(b.ClaimTrie().Height() - 1)
+	if err = checkClaimScripts(ct, block, node, view); err != nil {
+		ct.Reset(claimtrie.Height(node.parent.height))
 		return ruleError(ErrBadClaimTrie, err.Error())
 	}
 
@@ -1321,5 +1333,15 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *btcutil.Block) error {
 	view := NewUtxoViewpoint()
 	view.SetBestHash(&tip.hash)
 	newNode := newBlockNode(&header, tip)
-	return b.checkConnectBlock(newNode, block, view, nil)
+
+	// The claims of the block are applied to a scratch copy of the
+	// ClaimTrie so the one of the main chain is left untouched.
+	ct, err := b.scratchClaimTrie(tip)
+	if err != nil {
+		return err
+	}
+	defer ct.Close()
+
+	return b.checkConnectBlockTo(b.utxoCache, ct, newNode, block, view,
+		nil, false)
 }
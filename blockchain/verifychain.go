@@ -0,0 +1,428 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// MaxVerifyLevel is the most thorough check level of VerifyChain.
+//
+// The checks of each level include the ones of the levels below it:
+//
+//	0 - Look up each block and ensure it can be loaded from the database.
+//	1 - Perform basic context-free sanity checks on each block.
+//	2 - Ensure the spend journal (undo data) of each block can be loaded and
+//	    is consistent with the block.
+//	3 - Disconnect the blocks from the tip of the main chain in a scratch utxo
+//	    view, and reconnect them along with a scratch ClaimTrie.  The outputs
+//	    spent by each block must match its spend journal, the ClaimTrie roots
+//	    must match the block headers, and the resulting view must match the
+//	    utxo set of the main chain.
+//	4 - Additionally perform all of the checks of connecting each block again,
+//	    including running its scripts.
+const MaxVerifyLevel = 4
+
+// VerifyFailure describes a block of the main chain which failed one of the
+// checks of VerifyChain.
+type VerifyFailure struct {
+	Height int32
+	Hash   chainhash.Hash
+
+	// Level is the check level which detected the failure.
+	Level int32
+	Err   error
+}
+
+// VerifyChainReport is the result of VerifyChain.
+type VerifyChainReport struct {
+	// Level is the check level which was used, and Checked is the number
+	// of blocks below the tip of the main chain which were verified.
+	Level   int32
+	Checked int32
+
+	Failures []VerifyFailure
+}
+
+// Valid returns whether all of the verified blocks passed the checks.
+func (r *VerifyChainReport) Valid() bool {
+	return len(r.Failures) == 0
+}
+
+// VerifyChain verifies the last depth blocks of the main chain, or all of them
+// when depth is zero, with the checks of the passed level as described by
+// MaxVerifyLevel.  The verification stops at the first block whose data is not
+// available, at a loaded utxo snapshot until the blocks below it have been
+// validated, and for levels 3 and 4 at the base of the ClaimTrie.
+//
+// All of the failures found are returned in the report.  Since the scratch
+// chain state is unreliable once a block couldn't be disconnected or connected
+// again, the checks of levels 3 and 4 stop at the first such failure.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) VerifyChain(level, depth int32) (*VerifyChainReport, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if level < 0 {
+		level = 0
+	}
+	if level > MaxVerifyLevel {
+		level = MaxVerifyLevel
+	}
+	tip := b.bestChain.Tip()
+	var finishHeight int32
+	if depth > 0 && depth < tip.height {
+		finishHeight = tip.height - depth
+	}
+
+	// The blocks up to a loaded utxo snapshot have no spend journal entries
+	// until their background validation reaches them.
+	b.snapshotLock.RLock()
+	if sv := b.snapshot; sv != nil && sv.node.height > finishHeight {
+		finishHeight = sv.node.height
+	}
+	b.snapshotLock.RUnlock()
+
+	// The claims below the base of the ClaimTrie are not available to
+	// rebuild the scratch ClaimTrie from.
+	if base := int32(b.claimTrie.Base()); level >= 3 && base > finishHeight {
+		finishHeight = base
+	}
+
+	log.Infof("Verifying chain for %d blocks at level %d",
+		tip.height-finishHeight, level)
+
+	report := &VerifyChainReport{Level: level}
+	fail := func(node *blockNode, failedLevel int32, err error) {
+		log.Errorf("Verify failed at level %d for block %v (height %d): "+
+			"%v", failedLevel, node.hash, node.height, err)
+		report.Failures = append(report.Failures, VerifyFailure{
+			Height: node.height,
+			Hash:   node.hash,
+			Level:  failedLevel,
+			Err:    err,
+		})
+	}
+
+	// Walk the main chain backwards, disconnecting each block from the
+	// scratch view for the deeper levels.
+	var view *UtxoViewpoint
+	deep := level >= 3
+	if deep {
+		view = NewUtxoViewpoint()
+		view.SetBestHash(&tip.hash)
+	}
+	node := tip
+	for ; node.height > finishHeight; node = node.parent {
+		if !b.index.NodeStatus(node).HaveData() {
+			log.Infof("Verify stopped at block %v (height %d) "+
+				"without data", node.hash, node.height)
+			break
+		}
+		report.Checked++
+
+		// Level 0 just looks up the block.
+		var block *btcutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			return err
+		})
+		if err != nil {
+			fail(node, 0, err)
+			deep = false
+			continue
+		}
+
+		// Level 1 does basic chain sanity checks.
+		if level < 1 {
+			continue
+		}
+		err = CheckBlockSanity(block, b.chainParams.PowLimit, b.timeSource)
+		if err != nil {
+			fail(node, 1, err)
+			deep = false
+			continue
+		}
+
+		// Level 2 checks the spend journal entry of the block.
+		if level < 2 {
+			continue
+		}
+		stxos, err := b.fetchVerifiedSpendJournal(node, block)
+		if err != nil {
+			fail(node, 2, err)
+			deep = false
+			continue
+		}
+
+		// Level 3 disconnects the block from the scratch view.
+		if !deep {
+			continue
+		}
+		err = view.fetchInputUtxos(b.utxoCache, block)
+		if err == nil {
+			err = view.disconnectTransactions(b.utxoCache, block, stxos)
+		}
+		if err != nil {
+			fail(node, 3, err)
+			deep = false
+		}
+	}
+	if !deep {
+		log.Infof("Chain verify completed with %d failures",
+			len(report.Failures))
+		return report, nil
+	}
+
+	// Rebuild the ClaimTrie at the block the walk stopped at, and connect
+	// the blocks again.
+	ct, err := b.scratchClaimTrie(node)
+	if err != nil {
+		return nil, err
+	}
+	defer ct.Close()
+	for node = b.bestChain.Next(node); node != nil; node = b.bestChain.Next(node) {
+		if err := b.reconnectVerifiedBlock(ct, node, view, level); err != nil {
+			fail(node, level, err)
+			break
+		}
+	}
+
+	// The resulting view must match the utxo set of the main chain.
+	if node == nil {
+		if err := b.compareUtxoView(view); err != nil {
+			fail(tip, 3, err)
+		}
+	}
+	log.Infof("Chain verify completed with %d failures",
+		len(report.Failures))
+
+	return report, nil
+}
+
+// fetchVerifiedSpendJournal loads the spend journal entry of the passed block
+// of the main chain, and ensures it is consistent with the block.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) fetchVerifiedSpendJournal(node *blockNode, block *btcutil.Block) ([]SpentTxOut, error) {
+	var stxos []SpentTxOut
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stxos) != countSpentOutputs(block) {
+		return nil, fmt.Errorf("spend journal has %d entries instead "+
+			"of %d", len(stxos), countSpentOutputs(block))
+	}
+
+	// The outputs created earlier in the block must match exactly, and
+	// the others must have been created below the block, with coinbases
+	// being mature.  Legacy entries may lack the height.
+	coinbaseMaturity := int32(b.chainParams.CoinbaseMaturity)
+	var stxoIdx int
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+
+			prevOut := &txIn.PreviousOutPoint
+			if txOut := blockTxOut(block, prevOut); txOut != nil {
+				if stxo.Height != node.height || stxo.IsCoinBase ||
+					stxo.Amount != txOut.Value ||
+					!bytes.Equal(stxo.PkScript, txOut.PkScript) {
+
+					return nil, fmt.Errorf("spend journal "+
+						"entry of %v does not match the "+
+						"output in the block", prevOut)
+				}
+				continue
+			}
+			if stxo.Height == 0 {
+				continue
+			}
+			if stxo.Height >= node.height {
+				return nil, fmt.Errorf("spend journal entry of %v "+
+					"has height %d", prevOut, stxo.Height)
+			}
+			if stxo.IsCoinBase && node.height-stxo.Height < coinbaseMaturity {
+				return nil, fmt.Errorf("spend journal entry of %v "+
+					"is an immature coinbase of height %d",
+					prevOut, stxo.Height)
+			}
+		}
+	}
+
+	return stxos, nil
+}
+
+// blockTxOut returns the output referenced by the passed outpoint when it is
+// created by one of the transactions of the passed block.
+func blockTxOut(block *btcutil.Block, outpoint *wire.OutPoint) *wire.TxOut {
+	for _, tx := range block.Transactions() {
+		if *tx.Hash() != outpoint.Hash {
+			continue
+		}
+		txOuts := tx.MsgTx().TxOut
+		if outpoint.Index >= uint32(len(txOuts)) {
+			return nil
+		}
+		return txOuts[outpoint.Index]
+	}
+	return nil
+}
+
+// scratchClaimTrie returns a new ClaimTrie in memory, with the claims of the
+// main chain up to the passed block.  It is rebuilt from a snapshot of the
+// ClaimTrie of the main chain, and must match the root in the block header.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) scratchClaimTrie(node *blockNode) (*claimtrie.ClaimTrie, error) {
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		return nil, err
+	}
+
+	// The ClaimTrie is empty at the genesis block, whose root is never
+	// checked against its header.
+	if node.parent == nil {
+		return ct, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := b.claimTrie.Export(pw, claimtrie.Height(node.height),
+			&node.hash)
+		pw.CloseWithError(err)
+	}()
+	hdr, err := claimtrie.ReadSnapshotHeader(pr)
+	if err == nil {
+		err = ct.Import(pr, hdr, &node.claimTrie)
+	}
+
+	// Unblock the export in case the import stopped early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		ct.Close()
+		return nil, fmt.Errorf("unable to rebuild the ClaimTrie at "+
+			"height %d: %v", node.height, err)
+	}
+	return ct, nil
+}
+
+// reconnectVerifiedBlock connects the passed block of the main chain to the
+// scratch view and ClaimTrie, which must represent the chain state up to its
+// parent.  The outputs it spends must match its spend journal entry.  At check
+// level 4, all of the checks of connecting the block are performed, including
+// the ones skipped below the checkpoints and the assumed valid block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reconnectVerifiedBlock(ct *claimtrie.ClaimTrie, node *blockNode, view *UtxoViewpoint, level int32) error {
+	var block *btcutil.Block
+	var journal []SpentTxOut
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByNode(dbTx, node)
+		if err != nil {
+			return err
+		}
+		journal, err = dbFetchSpendJournalEntry(dbTx, block)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+	if level >= 4 {
+		err = b.checkConnectBlockTo(b.utxoCache, ct, node, block, view,
+			&stxos, true)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = view.fetchInputUtxos(b.utxoCache, block)
+		if err != nil {
+			return err
+		}
+		err = view.connectTransactions(block, &stxos)
+		if err != nil {
+			return err
+		}
+		if err := checkClaimScripts(ct, block, node, view); err != nil {
+			return ruleError(ErrBadClaimTrie, err.Error())
+		}
+	}
+
+	if len(stxos) != len(journal) {
+		return fmt.Errorf("connecting the block spends %d outputs, "+
+			"the spend journal has %d", len(stxos), len(journal))
+	}
+	for i := range stxos {
+		stxo, entry := &stxos[i], &journal[i]
+		if stxo.Amount != entry.Amount ||
+			!bytes.Equal(stxo.PkScript, entry.PkScript) ||
+			entry.Height != 0 && (stxo.Height != entry.Height ||
+				stxo.IsCoinBase != entry.IsCoinBase) {
+
+			return fmt.Errorf("spent output %d does not match the "+
+				"spend journal", i)
+		}
+	}
+	return nil
+}
+
+// compareUtxoView ensures the outputs of the passed view, which has been
+// disconnected and connected again up to the tip of the main chain, match the
+// ones of the utxo set.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) compareUtxoView(view *UtxoViewpoint) error {
+	outpoints := make(map[wire.OutPoint]struct{}, len(view.entries))
+	for outpoint := range view.entries {
+		outpoints[outpoint] = struct{}{}
+	}
+	entries := make(map[wire.OutPoint]*UtxoEntry, len(outpoints))
+	if err := b.utxoCache.fetchEntries(outpoints, entries); err != nil {
+		return err
+	}
+
+	for outpoint, entry := range view.entries {
+		utxo := entries[outpoint]
+		if entry == nil || entry.IsSpent() {
+			if utxo != nil {
+				return fmt.Errorf("output %v is missing after "+
+					"reconnecting the blocks", outpoint)
+			}
+			continue
+		}
+		if utxo == nil {
+			return fmt.Errorf("output %v is not in the utxo set",
+				outpoint)
+		}
+		if entry.Amount() != utxo.Amount() ||
+			!bytes.Equal(entry.PkScript(), utxo.PkScript()) ||
+			entry.BlockHeight() != utxo.BlockHeight() ||
+			entry.IsCoinBase() != utxo.IsCoinBase() {
+
+			return fmt.Errorf("output %v does not match the utxo "+
+				"set", outpoint)
+		}
+	}
+	return nil
+}
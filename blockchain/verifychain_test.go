@@ -0,0 +1,90 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestVerifyChain ensures the main chain passes all of the check levels of
+// VerifyChain, and that a missing spend journal entry is reported for the
+// levels which check it.
+func TestVerifyChain(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, db, teardown, err := chainSetupDB(fullblocktests.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	processGeneratedBlocks(chain, tests)
+	best := chain.BestSnapshot()
+
+	for level := int32(0); level <= blockchain.MaxVerifyLevel; level++ {
+		report, err := chain.VerifyChain(level, 0)
+		if err != nil {
+			t.Fatalf("VerifyChain(%d): %v", level, err)
+		}
+		if !report.Valid() || report.Level != level ||
+			report.Checked != best.Height {
+
+			t.Fatalf("VerifyChain(%d): unexpected report %+v", level,
+				report)
+		}
+	}
+
+	// Find the last block of the main chain which spends any outputs, and
+	// remove its spend journal entry.
+	var block *btcutil.Block
+	for height := best.Height; height > 0 && block == nil; height-- {
+		b, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): %v", height, err)
+		}
+		if len(b.Transactions()) > 1 {
+			block = b
+		}
+	}
+	if block == nil {
+		t.Fatal("no block spending any outputs in the main chain")
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket([]byte("spendjournal"))
+		return bucket.Delete(block.Hash()[:])
+	})
+	if err != nil {
+		t.Fatalf("failed to remove spend journal entry: %v", err)
+	}
+
+	depth := best.Height - block.Height() + 1
+	report, err := chain.VerifyChain(1, depth)
+	if err != nil || !report.Valid() || report.Checked != depth {
+		t.Fatalf("VerifyChain(1): unexpected report %+v, %v", report, err)
+	}
+	for level := int32(2); level <= blockchain.MaxVerifyLevel; level++ {
+		report, err := chain.VerifyChain(level, 0)
+		if err != nil {
+			t.Fatalf("VerifyChain(%d): %v", level, err)
+		}
+		if len(report.Failures) != 1 || report.Failures[0].Level != 2 ||
+			report.Failures[0].Hash != *block.Hash() ||
+			report.Failures[0].Height != block.Height() ||
+			report.Checked != best.Height {
+
+			t.Fatalf("VerifyChain(%d): unexpected report %+v", level,
+				report)
+		}
+	}
+}
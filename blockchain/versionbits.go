@@ -74,6 +74,50 @@ func (c bitConditionChecker) EndTime() uint64 {
 	return math.MaxUint64
 }
 
+// HeightBased returns whether voting on a rule change starts and ends at
+// heights instead of times.
+//
+// Since this implementation checks for unknown rules, it returns false so the
+// times above are used.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) HeightBased() bool {
+	return false
+}
+
+// BeginHeight returns the height at or after which voting on a rule change
+// starts (at the next window).
+//
+// Since this implementation checks for unknown rules, it returns 0 so the rule
+// is always treated as active.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) BeginHeight() int32 {
+	return 0
+}
+
+// EndHeight returns the height at or after which an attempted rule change
+// fails if it has not already been locked in or activated.
+//
+// Since this implementation checks for unknown rules, it returns the maximum
+// possible height so the rule is always treated as active.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) EndHeight() int32 {
+	return math.MaxInt32
+}
+
+// MinActivationHeight returns the height before which a locked in rule change
+// does not become active.
+//
+// Since this implementation checks for unknown rules, it returns 0 so the rule
+// becomes active as soon as possible.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) MinActivationHeight() int32 {
+	return 0
+}
+
 // RuleChangeActivationThreshold is the number of blocks for which the condition
 // must be true in order to lock in a rule change.
 //
@@ -155,6 +199,50 @@ func (c deploymentChecker) EndTime() uint64 {
 	return c.deployment.ExpireTime
 }
 
+// HeightBased returns whether voting on a rule change starts and ends at
+// heights instead of times.
+//
+// This implementation returns whether the specific deployment the checker is
+// associated with defines a timeout height.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) HeightBased() bool {
+	return c.deployment.HeightBased()
+}
+
+// BeginHeight returns the height at or after which voting on a rule change
+// starts (at the next window).
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) BeginHeight() int32 {
+	return c.deployment.StartHeight
+}
+
+// EndHeight returns the height at or after which an attempted rule change
+// fails if it has not already been locked in or activated.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) EndHeight() int32 {
+	return c.deployment.TimeoutHeight
+}
+
+// MinActivationHeight returns the height before which a locked in rule change
+// does not become active.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) MinActivationHeight() int32 {
+	return c.deployment.MinActivationHeight
+}
+
 // RuleChangeActivationThreshold is the number of blocks for which the condition
 // must be true in order to lock in a rule change.
 //
@@ -143,6 +143,22 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropStatsIndex {
+		if err := indexers.DropStatsIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropCoinStatsIndex {
+		if err := indexers.DropCoinStatsIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 
 	// Create server and start it.
 	server, err := newServer(cfg.Listeners, cfg.AgentBlacklist,
@@ -158,6 +174,9 @@ func btcdMain(serverChan chan<- *server) error {
 		server.Stop()
 		server.WaitForShutdown()
 		srvrLog.Infof("Server shutdown complete")
+		if err := server.chain.FlushUtxoCache(); err != nil {
+			btcdLog.Errorf("Unable to flush the utxo cache: %v", err)
+		}
 		server.chain.ClaimTrie().Close()
 	}()
 	server.Start()
@@ -100,6 +100,55 @@ func NewDecodeScriptCmd(hexScript string) *DecodeScriptCmd {
 	}
 }
 
+// DumpTxOutSetCmd defines the dumptxoutset JSON-RPC command.
+type DumpTxOutSetCmd struct {
+	Path string
+}
+
+// NewDumpTxOutSetCmd returns a new instance which can be used to issue a
+// dumptxoutset JSON-RPC command.
+func NewDumpTxOutSetCmd(path string) *DumpTxOutSetCmd {
+	return &DumpTxOutSetCmd{
+		Path: path,
+	}
+}
+
+// GenerateBlockCmd defines the generateblock JSON-RPC command.
+type GenerateBlockCmd struct {
+	Output       string
+	Transactions []string
+}
+
+// NewGenerateBlockCmd returns a new instance which can be used to issue a
+// generateblock JSON-RPC command.  The transactions are given as hashes of
+// transactions in the memory pool or as hex-encoded raw transactions.
+func NewGenerateBlockCmd(output string, transactions []string) *GenerateBlockCmd {
+	return &GenerateBlockCmd{
+		Output:       output,
+		Transactions: transactions,
+	}
+}
+
+// GenerateToAddressCmd defines the generatetoaddress JSON-RPC command.
+type GenerateToAddressCmd struct {
+	NumBlocks uint32
+	Address   string
+	MaxTries  *int64 `jsonrpcdefault:"1000000"`
+}
+
+// NewGenerateToAddressCmd returns a new instance which can be used to issue a
+// generatetoaddress JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGenerateToAddressCmd(numBlocks uint32, address string, maxTries *int64) *GenerateToAddressCmd {
+	return &GenerateToAddressCmd{
+		NumBlocks: numBlocks,
+		Address:   address,
+		MaxTries:  maxTries,
+	}
+}
+
 // GetAddedNodeInfoCmd defines the getaddednodeinfo JSON-RPC command.
 type GetAddedNodeInfoCmd struct {
 	DNS  bool
@@ -193,6 +242,59 @@ func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	}
 }
 
+// HashOrHeight is a block hash or height, which is a string or a number in
+// JSON, as accepted by commands which can refer to a block either way.
+type HashOrHeight struct {
+	Value interface{}
+}
+
+// MarshalJSON provides a custom Marshal method for HashOrHeight.
+func (h HashOrHeight) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Value)
+}
+
+// UnmarshalJSON provides a custom Unmarshal method for HashOrHeight.  This is
+// necessary because the value can only be a string or an integer.
+func (h *HashOrHeight) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch val := value.(type) {
+	case string:
+		h.Value = val
+		return nil
+	case float64:
+		if val == float64(int32(val)) {
+			h.Value = int32(val)
+			return nil
+		}
+	}
+
+	str := "the block must be specified as a hash string or a height"
+	return makeError(ErrInvalidType, str)
+}
+
+// GetBlockStatsCmd defines the getblockstats JSON-RPC command.
+type GetBlockStatsCmd struct {
+	HashOrHeight HashOrHeight
+	Stats        *[]string
+}
+
+// NewGetBlockStatsCmd returns a new instance which can be used to issue a
+// getblockstats JSON-RPC command.  The block is either a hash string or an
+// int32 height.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockStatsCmd(hashOrHeight interface{}, stats *[]string) *GetBlockStatsCmd {
+	return &GetBlockStatsCmd{
+		HashOrHeight: HashOrHeight{Value: hashOrHeight},
+		Stats:        stats,
+	}
+}
+
 // TemplateRequest is a request object as defined in BIP22
 // (https://en.bitcoin.it/wiki/BIP_0022), it is optionally provided as an
 // pointer argument to GetBlockTemplateCmd.
@@ -330,6 +432,22 @@ func NewGetConnectionCountCmd() *GetConnectionCountCmd {
 	return &GetConnectionCountCmd{}
 }
 
+// GetDeploymentInfoCmd defines the getdeploymentinfo JSON-RPC command.
+type GetDeploymentInfoCmd struct {
+	BlockHash *string
+}
+
+// NewGetDeploymentInfoCmd returns a new instance which can be used to issue a
+// getdeploymentinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetDeploymentInfoCmd(blockHash *string) *GetDeploymentInfoCmd {
+	return &GetDeploymentInfoCmd{
+		BlockHash: blockHash,
+	}
+}
+
 // GetDifficultyCmd defines the getdifficulty JSON-RPC command.
 type GetDifficultyCmd struct{}
 
@@ -518,12 +636,28 @@ func NewGetTxOutProofCmd(txIDs []string, blockHash *string) *GetTxOutProofCmd {
 }
 
 // GetTxOutSetInfoCmd defines the gettxoutsetinfo JSON-RPC command.
-type GetTxOutSetInfoCmd struct{}
+type GetTxOutSetInfoCmd struct {
+	HashType     *string `jsonrpcdefault:"\"hash_serialized\""`
+	HashOrHeight *HashOrHeight
+	UseIndex     *bool `jsonrpcdefault:"true"`
+}
 
 // NewGetTxOutSetInfoCmd returns a new instance which can be used to issue a
-// gettxoutsetinfo JSON-RPC command.
-func NewGetTxOutSetInfoCmd() *GetTxOutSetInfoCmd {
-	return &GetTxOutSetInfoCmd{}
+// gettxoutsetinfo JSON-RPC command.  The block is either a hash string or an
+// int32 height.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetTxOutSetInfoCmd(hashType *string, hashOrHeight interface{}, useIndex *bool) *GetTxOutSetInfoCmd {
+	var block *HashOrHeight
+	if hashOrHeight != nil {
+		block = &HashOrHeight{Value: hashOrHeight}
+	}
+	return &GetTxOutSetInfoCmd{
+		HashType:     hashType,
+		HashOrHeight: block,
+		UseIndex:     useIndex,
+	}
 }
 
 // GetWorkCmd defines the getwork JSON-RPC command.
@@ -571,6 +705,19 @@ func NewInvalidateBlockCmd(blockHash string) *InvalidateBlockCmd {
 	}
 }
 
+// LoadTxOutSetCmd defines the loadtxoutset JSON-RPC command.
+type LoadTxOutSetCmd struct {
+	Path string
+}
+
+// NewLoadTxOutSetCmd returns a new instance which can be used to issue a
+// loadtxoutset JSON-RPC command.
+func NewLoadTxOutSetCmd(path string) *LoadTxOutSetCmd {
+	return &LoadTxOutSetCmd{
+		Path: path,
+	}
+}
+
 // PingCmd defines the ping JSON-RPC command.
 type PingCmd struct{}
 
@@ -593,6 +740,24 @@ func NewPreciousBlockCmd(blockHash string) *PreciousBlockCmd {
 	}
 }
 
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+// The dummy parameter takes the place of the priority delta, which is no
+// longer supported, and must be zero.
+type PrioritiseTransactionCmd struct {
+	TxID     string
+	Dummy    float64
+	FeeDelta int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to issue
+// a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txID string, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		TxID:     txID,
+		FeeDelta: feeDelta,
+	}
+}
+
 // ReconsiderBlockCmd defines the reconsiderblock JSON-RPC command.
 type ReconsiderBlockCmd struct {
 	BlockHash string
@@ -741,6 +906,7 @@ func NewValidateAddressCmd(address string) *ValidateAddressCmd {
 type VerifyChainCmd struct {
 	CheckLevel *int32 `jsonrpcdefault:"3"`
 	CheckDepth *int32 `jsonrpcdefault:"288"` // 0 = all
+	Verbose    *bool  `jsonrpcdefault:"false"`
 }
 
 // NewVerifyChainCmd returns a new instance which can be used to issue a
@@ -748,10 +914,11 @@ type VerifyChainCmd struct {
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
-func NewVerifyChainCmd(checkLevel, checkDepth *int32) *VerifyChainCmd {
+func NewVerifyChainCmd(checkLevel, checkDepth *int32, verbose *bool) *VerifyChainCmd {
 	return &VerifyChainCmd{
 		CheckLevel: checkLevel,
 		CheckDepth: checkDepth,
+		Verbose:    verbose,
 	}
 }
 
@@ -793,6 +960,9 @@ func init() {
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
+	MustRegisterCmd("dumptxoutset", (*DumpTxOutSetCmd)(nil), flags)
+	MustRegisterCmd("generateblock", (*GenerateBlockCmd)(nil), flags)
+	MustRegisterCmd("generatetoaddress", (*GenerateToAddressCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
@@ -800,11 +970,13 @@ func init() {
 	MustRegisterCmd("getblockcount", (*GetBlockCountCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
+	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
 	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
 	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
+	MustRegisterCmd("getdeploymentinfo", (*GetDeploymentInfoCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
@@ -824,8 +996,10 @@ func init() {
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
+	MustRegisterCmd("loadtxoutset", (*LoadTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
@@ -103,6 +103,50 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &btcjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "generateblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generateblock", "1Address", []string{"123"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateBlockCmd("1Address", []string{"123"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generateblock","params":["1Address",["123"]],"id":1}`,
+			unmarshalled: &btcjson.GenerateBlockCmd{
+				Output:       "1Address",
+				Transactions: []string{"123"},
+			},
+		},
+		{
+			name: "generatetoaddress",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetoaddress", 1, "1Address")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateToAddressCmd(1, "1Address", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetoaddress","params":[1,"1Address"],"id":1}`,
+			unmarshalled: &btcjson.GenerateToAddressCmd{
+				NumBlocks: 1,
+				Address:   "1Address",
+				MaxTries:  btcjson.Int64(1000000),
+			},
+		},
+		{
+			name: "generatetoaddress optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetoaddress", 1, "1Address", 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateToAddressCmd(1, "1Address", btcjson.Int64(10))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetoaddress","params":[1,"1Address",10],"id":1}`,
+			unmarshalled: &btcjson.GenerateToAddressCmd{
+				NumBlocks: 1,
+				Address:   "1Address",
+				MaxTries:  btcjson.Int64(10),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -646,10 +690,28 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("gettxoutsetinfo")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewGetTxOutSetInfoCmd()
+				return btcjson.NewGetTxOutSetInfoCmd(nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutSetInfoCmd{
+				HashType: btcjson.String("hash_serialized"),
+				UseIndex: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "gettxoutsetinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxoutsetinfo", "muhash", btcjson.HashOrHeight{Value: int32(100)}, false)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetTxOutSetInfoCmd(btcjson.String("muhash"), int32(100), btcjson.Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":["muhash",100,false],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutSetInfoCmd{
+				HashType:     btcjson.String("muhash"),
+				HashOrHeight: &btcjson.HashOrHeight{Value: int32(100)},
+				UseIndex:     btcjson.Bool(false),
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
-			unmarshalled: &btcjson.GetTxOutSetInfoCmd{},
 		},
 		{
 			name: "getwork",
@@ -740,6 +802,21 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "123", 0.0, 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("123", 1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",0,1000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				TxID:     "123",
+				Dummy:    0,
+				FeeDelta: 1000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -1022,12 +1099,13 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("verifychain")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewVerifyChainCmd(nil, nil)
+				return btcjson.NewVerifyChainCmd(nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"verifychain","params":[],"id":1}`,
 			unmarshalled: &btcjson.VerifyChainCmd{
 				CheckLevel: btcjson.Int32(3),
 				CheckDepth: btcjson.Int32(288),
+				Verbose:    btcjson.Bool(false),
 			},
 		},
 		{
@@ -1036,12 +1114,13 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("verifychain", 2)
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewVerifyChainCmd(btcjson.Int32(2), nil)
+				return btcjson.NewVerifyChainCmd(btcjson.Int32(2), nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"verifychain","params":[2],"id":1}`,
 			unmarshalled: &btcjson.VerifyChainCmd{
 				CheckLevel: btcjson.Int32(2),
 				CheckDepth: btcjson.Int32(288),
+				Verbose:    btcjson.Bool(false),
 			},
 		},
 		{
@@ -1050,12 +1129,28 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("verifychain", 2, 500)
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewVerifyChainCmd(btcjson.Int32(2), btcjson.Int32(500))
+				return btcjson.NewVerifyChainCmd(btcjson.Int32(2), btcjson.Int32(500), nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"verifychain","params":[2,500],"id":1}`,
 			unmarshalled: &btcjson.VerifyChainCmd{
 				CheckLevel: btcjson.Int32(2),
 				CheckDepth: btcjson.Int32(500),
+				Verbose:    btcjson.Bool(false),
+			},
+		},
+		{
+			name: "verifychain optional3",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("verifychain", 4, 10, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewVerifyChainCmd(btcjson.Int32(4), btcjson.Int32(10), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"verifychain","params":[4,10,true],"id":1}`,
+			unmarshalled: &btcjson.VerifyChainCmd{
+				CheckLevel: btcjson.Int32(4),
+				CheckDepth: btcjson.Int32(10),
+				Verbose:    btcjson.Bool(true),
 			},
 		},
 		{
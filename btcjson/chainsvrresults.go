@@ -65,6 +65,11 @@ type DecodeScriptResult struct {
 	P2sh      string   `json:"p2sh,omitempty"`
 }
 
+// GenerateBlockResult models the data returned from the generateblock command.
+type GenerateBlockResult struct {
+	Hash string `json:"hash"`
+}
+
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
 // getaddednodeinfo command.
 type GetAddedNodeInfoResultAddr struct {
@@ -145,10 +150,99 @@ type GetBlockChainInfoResult struct {
 	Pruned               bool    `json:"pruned"`
 	PruneHeight          int32   `json:"pruneheight,omitempty"`
 	ChainWork            string  `json:"chainwork,omitempty"`
+	AssumeValid          string  `json:"assumevalid,omitempty"`
+	AssumeValidActive    bool    `json:"assumevalidactive"`
 	*SoftForks
 	*UnifiedSoftForks
 }
 
+// GetBlockStatsResult models the data returned from the getblockstats command.
+// Amounts are in satoshi, and fee rates in satoshi per virtual byte.
+type GetBlockStatsResult struct {
+	AvgFee             int64   `json:"avgfee"`
+	AvgFeeRate         int64   `json:"avgfeerate"`
+	AvgTxSize          int64   `json:"avgtxsize"`
+	BlockHash          string  `json:"blockhash"`
+	FeeRatePercentiles []int64 `json:"feerate_percentiles"`
+	Height             int64   `json:"height"`
+	Ins                int64   `json:"ins"`
+	MaxFee             int64   `json:"maxfee"`
+	MaxFeeRate         int64   `json:"maxfeerate"`
+	MaxTxSize          int64   `json:"maxtxsize"`
+	MedianFee          int64   `json:"medianfee"`
+	MedianTime         int64   `json:"mediantime"`
+	MinFee             int64   `json:"minfee"`
+	MinFeeRate         int64   `json:"minfeerate"`
+	MinTxSize          int64   `json:"mintxsize"`
+	Outs               int64   `json:"outs"`
+	Subsidy            int64   `json:"subsidy"`
+	SegWitTotalSize    int64   `json:"swtotal_size"`
+	SegWitTotalWeight  int64   `json:"swtotal_weight"`
+	SegWitTxs          int64   `json:"swtxs"`
+	Time               int64   `json:"time"`
+	TotalOut           int64   `json:"total_out"`
+	TotalSize          int64   `json:"total_size"`
+	TotalWeight        int64   `json:"total_weight"`
+	TotalFee           int64   `json:"totalfee"`
+	Txs                int64   `json:"txs"`
+	UtxoIncrease       int64   `json:"utxo_increase"`
+	UtxoSizeIncrease   int64   `json:"utxo_size_inc"`
+	Claims             int64   `json:"claims"`
+	Supports           int64   `json:"supports"`
+	Updates            int64   `json:"updates"`
+	Staked             int64   `json:"staked"`
+}
+
+// GetChainTipsResult models the data returned from the getchaintips command.
+type GetChainTipsResult struct {
+	Height    int32  `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int32  `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
+// Bip9Statistics models the signalling statistics of a BIP0009 deployment
+// within the current window.
+type Bip9Statistics struct {
+	Period    uint32 `json:"period"`
+	Threshold uint32 `json:"threshold"`
+	Elapsed   uint32 `json:"elapsed"`
+	Count     uint32 `json:"count"`
+	Possible  bool   `json:"possible"`
+}
+
+// Bip9DeploymentInfo models the BIP0009 details of a deployment returned from
+// the getdeploymentinfo command.
+type Bip9DeploymentInfo struct {
+	Bit                 uint8           `json:"bit"`
+	StartTime           int64           `json:"start_time,omitempty"`
+	Timeout             int64           `json:"timeout,omitempty"`
+	StartHeight         int32           `json:"start_height,omitempty"`
+	TimeoutHeight       int32           `json:"timeout_height,omitempty"`
+	MinActivationHeight int32           `json:"min_activation_height"`
+	Status              string          `json:"status"`
+	Since               int32           `json:"since"`
+	StatusNext          string          `json:"status_next"`
+	Statistics          *Bip9Statistics `json:"statistics,omitempty"`
+}
+
+// DeploymentInfo models a deployment returned from the getdeploymentinfo
+// command.
+type DeploymentInfo struct {
+	Type   string              `json:"type"`
+	Height int32               `json:"height,omitempty"`
+	Active bool                `json:"active"`
+	Bip9   *Bip9DeploymentInfo `json:"bip9,omitempty"`
+}
+
+// GetDeploymentInfoResult models the data returned from the getdeploymentinfo
+// command.
+type GetDeploymentInfoResult struct {
+	Hash        string                     `json:"hash"`
+	Height      int32                      `json:"height"`
+	Deployments map[string]*DeploymentInfo `json:"deployments"`
+}
+
 // GetBlockTemplateResultTx models the transactions field of the
 // getblocktemplate command.
 type GetBlockTemplateResultTx struct {
@@ -302,6 +396,7 @@ type GetRawMempoolVerboseResult struct {
 	Vsize            int32    `json:"vsize"`
 	Weight           int32    `json:"weight"`
 	Fee              float64  `json:"fee"`
+	ModifiedFee      float64  `json:"modifiedfee"`
 	Time             int64    `json:"time"`
 	Height           int64    `json:"height"`
 	StartingPriority float64  `json:"startingpriority"`
@@ -319,6 +414,20 @@ type ScriptPubKeyResult struct {
 	Addresses []string `json:"addresses,omitempty"`
 }
 
+// GetTxOutSetInfoResult models the data from the gettxoutsetinfo command.
+type GetTxOutSetInfoResult struct {
+	Height         int32   `json:"height"`
+	BestBlock      string  `json:"bestblock"`
+	TxOuts         uint64  `json:"txouts"`
+	SerializedSize uint64  `json:"serialized_size"`
+	HashSerialized string  `json:"hash_serialized,omitempty"`
+	MuHash         string  `json:"muhash,omitempty"`
+	TotalAmount    float64 `json:"total_amount"`
+	ClaimAmount    float64 `json:"claim_amount"`
+	SupportAmount  float64 `json:"support_amount"`
+	PlainAmount    float64 `json:"plain_amount"`
+}
+
 // GetTxOutResult models the data from the gettxout command.
 type GetTxOutResult struct {
 	BestBlock     string             `json:"bestblock"`
@@ -328,6 +437,35 @@ type GetTxOutResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// TxOutSetSnapshotResult models the data from the dumptxoutset and
+// loadtxoutset commands.
+type TxOutSetSnapshotResult struct {
+	Path         string `json:"path"`
+	Height       int32  `json:"height"`
+	BlockHash    string `json:"blockhash"`
+	NumUtxos     uint64 `json:"numutxos"`
+	UtxoSetHash  string `json:"utxosethash"`
+	ChainTxCount uint64 `json:"chaintxcount"`
+}
+
+// VerifyChainFailure models a block which failed the checks of the verifychain
+// command.
+type VerifyChainFailure struct {
+	Height int32  `json:"height"`
+	Hash   string `json:"hash"`
+	Level  int32  `json:"level"`
+	Error  string `json:"error"`
+}
+
+// VerifyChainResult models the data from the verifychain command when the
+// verbose flag is set.
+type VerifyChainResult struct {
+	Valid         bool                 `json:"valid"`
+	CheckLevel    int32                `json:"checklevel"`
+	CheckedBlocks int32                `json:"checkedblocks"`
+	Failures      []VerifyChainFailure `json:"failures"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
 	TotalBytesRecv uint64 `json:"totalbytesrecv"`
@@ -41,6 +41,24 @@ func NewStopNotifyBlocksCmd() *StopNotifyBlocksCmd {
 	return &StopNotifyBlocksCmd{}
 }
 
+// NotifyReorgsCmd defines the notifyreorgs JSON-RPC command.
+type NotifyReorgsCmd struct{}
+
+// NewNotifyReorgsCmd returns a new instance which can be used to issue a
+// notifyreorgs JSON-RPC command.
+func NewNotifyReorgsCmd() *NotifyReorgsCmd {
+	return &NotifyReorgsCmd{}
+}
+
+// StopNotifyReorgsCmd defines the stopnotifyreorgs JSON-RPC command.
+type StopNotifyReorgsCmd struct{}
+
+// NewStopNotifyReorgsCmd returns a new instance which can be used to issue a
+// stopnotifyreorgs JSON-RPC command.
+func NewStopNotifyReorgsCmd() *StopNotifyReorgsCmd {
+	return &StopNotifyReorgsCmd{}
+}
+
 // NotifyNewTransactionsCmd defines the notifynewtransactions JSON-RPC command.
 type NotifyNewTransactionsCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -230,10 +248,12 @@ func init() {
 	MustRegisterCmd("notifyblocks", (*NotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
+	MustRegisterCmd("notifyreorgs", (*NotifyReorgsCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyreorgs", (*StopNotifyReorgsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
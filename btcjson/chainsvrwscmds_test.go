@@ -63,6 +63,28 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyblocks","params":[],"id":1}`,
 			unmarshalled: &btcjson.StopNotifyBlocksCmd{},
 		},
+		{
+			name: "notifyreorgs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyreorgs")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyReorgsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifyreorgs","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyReorgsCmd{},
+		},
+		{
+			name: "stopnotifyreorgs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyreorgs")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyReorgsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyreorgs","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyReorgsCmd{},
+		},
 		{
 			name: "notifynewtransactions",
 			newCmd: func() (interface{}, error) {
@@ -31,6 +31,10 @@ const (
 	// disconnected.
 	FilteredBlockDisconnectedNtfnMethod = "filteredblockdisconnected"
 
+	// ChainReorganizedNtfnMethod is the method used for notifications from
+	// the chain server that the main chain has been reorganized.
+	ChainReorganizedNtfnMethod = "chainreorganized"
+
 	// RecvTxNtfnMethod is the legacy, deprecated method used for
 	// notifications from the chain server that a transaction which pays to
 	// a registered address has been processed.
@@ -153,6 +157,27 @@ func NewFilteredBlockDisconnectedNtfn(height int32, header string) *FilteredBloc
 	}
 }
 
+// ChainReorganizedNtfn defines the chainreorganized JSON-RPC notification.  The
+// disconnected block hashes are ordered from the old tip down to the fork
+// point, and the connected ones from the fork point up to the new tip.
+type ChainReorganizedNtfn struct {
+	ForkHash     string
+	ForkHeight   int32
+	Disconnected []string
+	Connected    []string
+}
+
+// NewChainReorganizedNtfn returns a new instance which can be used to issue a
+// chainreorganized JSON-RPC notification.
+func NewChainReorganizedNtfn(forkHash string, forkHeight int32, disconnected, connected []string) *ChainReorganizedNtfn {
+	return &ChainReorganizedNtfn{
+		ForkHash:     forkHash,
+		ForkHeight:   forkHeight,
+		Disconnected: disconnected,
+		Connected:    connected,
+	}
+}
+
 // BlockDetails describes details of a tx in a block.
 type BlockDetails struct {
 	Height int32  `json:"height"`
@@ -294,6 +319,7 @@ func init() {
 	MustRegisterCmd(BlockDisconnectedNtfnMethod, (*BlockDisconnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockConnectedNtfnMethod, (*FilteredBlockConnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockDisconnectedNtfnMethod, (*FilteredBlockDisconnectedNtfn)(nil), flags)
+	MustRegisterCmd(ChainReorganizedNtfnMethod, (*ChainReorganizedNtfn)(nil), flags)
 	MustRegisterCmd(RecvTxNtfnMethod, (*RecvTxNtfn)(nil), flags)
 	MustRegisterCmd(RedeemingTxNtfnMethod, (*RedeemingTxNtfn)(nil), flags)
 	MustRegisterCmd(RescanFinishedNtfnMethod, (*RescanFinishedNtfn)(nil), flags)
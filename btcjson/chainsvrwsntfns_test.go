@@ -59,6 +59,22 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Time:   123456789,
 			},
 		},
+		{
+			name: "chainreorganized",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("chainreorganized", "123", 100000, []string{"456", "789"}, []string{"abc"})
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewChainReorganizedNtfn("123", 100000, []string{"456", "789"}, []string{"abc"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"chainreorganized","params":["123",100000,["456","789"],["abc"]],"id":null}`,
+			unmarshalled: &btcjson.ChainReorganizedNtfn{
+				ForkHash:     "123",
+				ForkHeight:   100000,
+				Disconnected: []string{"456", "789"},
+				Connected:    []string{"abc"},
+			},
+		},
 		{
 			name: "filteredblockconnected",
 			newNtfn: func() (interface{}, error) {
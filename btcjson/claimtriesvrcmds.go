@@ -7,11 +7,22 @@
 package btcjson
 
 // GetClaimsInTrieCmd defines the getclaimsintrie JSON-RPC command.
-type GetClaimsInTrieCmd struct{}
+type GetClaimsInTrieCmd struct {
+	Prefix     *string `jsonrpcdefault:"\"\""`
+	StartAfter *string `jsonrpcdefault:"\"\""`
+	Limit      *int32  `jsonrpcdefault:"0"` // 0 = all
+}
 
 // NewGetClaimsInTrieCmd returns a new instance which can be used to issue a getclaimsintrie JSON-RPC command.
-func NewGetClaimsInTrieCmd() *GetClaimsInTrieCmd {
-	return &GetClaimsInTrieCmd{}
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetClaimsInTrieCmd(prefix, startAfter *string, limit *int32) *GetClaimsInTrieCmd {
+	return &GetClaimsInTrieCmd{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Limit:      limit,
+	}
 }
 
 // GetClaimTrieCmd defines the getclaimtrie JSON-RPC command.
@@ -98,6 +109,52 @@ func NewGetClaimByIDCmd() *GetClaimByIDCmd {
 	return &GetClaimByIDCmd{}
 }
 
+// GetClaimScheduleCmd defines the getclaimschedule JSON-RPC command.
+type GetClaimScheduleCmd struct {
+	FromHeight *int32
+	ToHeight   *int32
+}
+
+// NewGetClaimScheduleCmd returns a new instance which can be used to issue a getclaimschedule JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetClaimScheduleCmd(fromHeight, toHeight *int32) *GetClaimScheduleCmd {
+	return &GetClaimScheduleCmd{
+		FromHeight: fromHeight,
+		ToHeight:   toHeight,
+	}
+}
+
+// ExportClaimTrieCmd defines the exportclaimtrie JSON-RPC command.
+type ExportClaimTrieCmd struct {
+	Path   string
+	Height *int32
+}
+
+// NewExportClaimTrieCmd returns a new instance which can be used to issue an exportclaimtrie JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewExportClaimTrieCmd(path string, height *int32) *ExportClaimTrieCmd {
+	return &ExportClaimTrieCmd{
+		Path:   path,
+		Height: height,
+	}
+}
+
+// ImportClaimTrieCmd defines the importclaimtrie JSON-RPC command.
+type ImportClaimTrieCmd struct {
+	Path string
+}
+
+// NewImportClaimTrieCmd returns a new instance which can be used to issue an importclaimtrie JSON-RPC command.
+func NewImportClaimTrieCmd(path string) *ImportClaimTrieCmd {
+	return &ImportClaimTrieCmd{
+		Path: path,
+	}
+}
+
 func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
@@ -112,4 +169,7 @@ func init() {
 	MustRegisterCmd("getclaimsfortx", (*GetClaimsForTxCmd)(nil), flags)
 	MustRegisterCmd("getnameproof", (*GetNameProofCmd)(nil), flags)
 	MustRegisterCmd("getclaimbyid", (*GetClaimByIDCmd)(nil), flags)
+	MustRegisterCmd("getclaimschedule", (*GetClaimScheduleCmd)(nil), flags)
+	MustRegisterCmd("exportclaimtrie", (*ExportClaimTrieCmd)(nil), flags)
+	MustRegisterCmd("importclaimtrie", (*ImportClaimTrieCmd)(nil), flags)
 }
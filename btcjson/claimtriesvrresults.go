@@ -71,6 +71,8 @@ type ClaimForName struct {
 	Amount          claimtrie.Amount `json:"nAmount"`
 	EffectiveAmount claimtrie.Amount `json:"nEffectiveAmount"`
 	Supports        []SupportOfClaim `json:"supports"`
+	ExpiresAt       claimtrie.Height `json:"expires_at"`
+	BlocksToExpiry  claimtrie.Height `json:"blocks_to_expiry"`
 }
 
 // SupportOfClaim models the data of support from the GetClaimsForName command.
@@ -123,16 +125,18 @@ type ClaimsForTxEntry struct {
 
 // GetClaimByIDResult models the data from the GetClaimByID command.
 type GetClaimByIDResult struct {
-	Name        string             `json:"name"`
-	Value       string             `json:"value"`
-	ClaimID     string             `json:"claimId"`
-	TxID        string             `json:"txid"`
-	N           uint32             `json:"n"`
-	Amount      claimtrie.Amount   `json:"amount"`
-	EffAmount   claimtrie.Amount   `json:"effective amount"`
-	Supports    []ClaimByIDSupport `json:"supports"`
-	Height      claimtrie.Height   `json:"height"`
-	ValidHeight claimtrie.Height   `json:"valid at height"`
+	Name           string             `json:"name"`
+	Value          string             `json:"value"`
+	ClaimID        string             `json:"claimId"`
+	TxID           string             `json:"txid"`
+	N              uint32             `json:"n"`
+	Amount         claimtrie.Amount   `json:"amount"`
+	EffAmount      claimtrie.Amount   `json:"effective amount"`
+	Supports       []ClaimByIDSupport `json:"supports"`
+	Height         claimtrie.Height   `json:"height"`
+	ValidHeight    claimtrie.Height   `json:"valid at height"`
+	ExpiresAt      claimtrie.Height   `json:"expires_at"`
+	BlocksToExpiry claimtrie.Height   `json:"blocks_to_expiry"`
 }
 
 // ClaimByIDSupport models the data of support from the GetClaimByID command.
@@ -143,3 +147,30 @@ type ClaimByIDSupport struct {
 	ValidHeight claimtrie.Height `json:"valid at height"`
 	Amount      claimtrie.Amount `json:"amount"`
 }
+
+// GetClaimScheduleResult models the data from the GetClaimSchedule command.
+type GetClaimScheduleResult struct {
+	FromHeight claimtrie.Height     `json:"fromheight"`
+	ToHeight   claimtrie.Height     `json:"toheight"`
+	Updates    []ClaimScheduleEntry `json:"updates"`
+}
+
+// ClaimScheduleEntry models a scheduled update from the GetClaimSchedule command.
+type ClaimScheduleEntry struct {
+	Height  claimtrie.Height `json:"height"`
+	Event   string           `json:"event"`
+	Name    string           `json:"name"`
+	Type    string           `json:"type"`
+	ClaimID string           `json:"claimId"`
+	TxID    string           `json:"txid"`
+	N       uint32           `json:"n"`
+	Amount  claimtrie.Amount `json:"amount"`
+}
+
+// ClaimTrieSnapshotResult models the data from the ExportClaimTrie and ImportClaimTrie commands.
+type ClaimTrieSnapshotResult struct {
+	Path      string           `json:"path"`
+	Height    claimtrie.Height `json:"height"`
+	BlockHash string           `json:"blockhash"`
+	ClaimTrie string           `json:"claimtrie"`
+}
@@ -52,6 +52,25 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// AssumeUtxo identifies a snapshot of the unspent transaction output set at a
+// known good block of the main chain.  Such a snapshot can be loaded to bring
+// up a new node without validating the history of the block chain first.  The
+// history is still validated in the background, and the resulting utxo set
+// must hash to UtxoSetHash.
+type AssumeUtxo struct {
+	Height    int32
+	BlockHash *chainhash.Hash
+
+	// UtxoSetHash is the hash of the serialized outputs of the snapshot,
+	// and NumUtxos their number.
+	UtxoSetHash *chainhash.Hash
+	NumUtxos    uint64
+
+	// ChainTxCount is the number of transactions in the main chain up to
+	// and including the block of the snapshot.
+	ChainTxCount uint64
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -65,6 +84,9 @@ type DNSSeed struct {
 // ConsensusDeployment defines details related to a specific consensus rule
 // change that is voted in.  This is part of BIP0009.
 type ConsensusDeployment struct {
+	// Name is the human-readable name of the deployment.
+	Name string
+
 	// BitNumber defines the specific bit number within the block version
 	// this particular soft-fork deployment refers to.
 	BitNumber uint8
@@ -76,6 +98,24 @@ type ConsensusDeployment struct {
 	// ExpireTime is the median block time after which the attempted
 	// deployment expires.
 	ExpireTime uint64
+
+	// StartHeight and TimeoutHeight replace StartTime and ExpireTime when
+	// TimeoutHeight is not zero.  Voting on the deployment then starts
+	// with the first window which begins at or after StartHeight, and the
+	// attempted deployment expires with the first window which begins at
+	// or after TimeoutHeight.
+	StartHeight   int32
+	TimeoutHeight int32
+
+	// MinActivationHeight is the height before which the deployment does
+	// not become active even when it has been locked in.
+	MinActivationHeight int32
+}
+
+// HeightBased returns whether voting on the deployment starts and expires at
+// heights rather than at median block times.
+func (d *ConsensusDeployment) HeightBased() bool {
+	return d.TimeoutHeight != 0
 }
 
 // Constants that define the deployment offset in the deployments field of the
@@ -181,6 +221,22 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeValid is the hash of a block whose scripts, along with the
+	// ones of its ancestors, are assumed to be valid, so they aren't
+	// checked during the initial block download.  All of the other rules
+	// are still enforced.  It is nil when no block is assumed valid.
+	AssumeValid *chainhash.Hash
+
+	// MinimumChainWork is the total work the best header chain must have
+	// before the blocks in it are assumed valid.  It ensures a chain which
+	// merely contains the assume-valid block, but is weaker than the
+	// known main chain, isn't trusted.  It is nil when no minimum applies.
+	MinimumChainWork *big.Int
+
+	// AssumeUtxos are the utxo set snapshots which can be loaded, ordered
+	// from oldest to newest.
+	AssumeUtxos []AssumeUtxo
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -193,10 +249,11 @@ type Params struct {
 	// state retarget window.
 	//
 	// Deployments define the specific consensus rule changes to be voted
-	// on.
+	// on.  The first DefinedDeployments of them are indexed by the
+	// deployment IDs defined above, and test networks may append more.
 	RuleChangeActivationThreshold uint32
 	MinerConfirmationWindow       uint32
-	Deployments                   [DefinedDeployments]ConsensusDeployment
+	Deployments                   []ConsensusDeployment
 
 	// Mempool parameters
 	RelayNonStdTxs bool
@@ -254,24 +311,36 @@ var MainNetParams = Params{
 		// {4000, newHashFromStr("a6bbb48f5343eb9b0287c22f3ea8b29f36cf10794a37f8a925a894d6f4519913")},
 	},
 
+	// The scripts of all blocks are checked until a block, along with the
+	// work of the chain containing it, has been reviewed to be assumed
+	// valid.
+	AssumeValid:      nil,
+	MinimumChainWork: nil,
+
+	// No utxo set snapshots have been reviewed to be loadable yet.
+	AssumeUtxos: nil,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
 	//   target proof of work timespan / target proof of work spacing
 	RuleChangeActivationThreshold: 1916, // 95% of MinerConfirmationWindow
 	MinerConfirmationWindow:       2016, //
-	Deployments: [DefinedDeployments]ConsensusDeployment{
+	Deployments: []ConsensusDeployment{
 		DeploymentTestDummy: {
+			Name:       "dummy",
 			BitNumber:  28,
 			StartTime:  1199145601, // January 1, 2008 UTC
 			ExpireTime: 1230767999, // December 31, 2008 UTC
 		},
 		DeploymentCSV: {
+			Name:       "csv",
 			BitNumber:  0,
 			StartTime:  1462060800, // May 1st, 2016
 			ExpireTime: 1493596800, // May 1st, 2017
 		},
 		DeploymentSegwit: {
+			Name:       "segwit",
 			BitNumber:  1,
 			StartTime:  math.MaxInt64, // Not in the roadmap
 			ExpireTime: math.MaxInt64, // Not in the roadmap
@@ -328,7 +397,10 @@ var RegressionNetParams = Params{
 	GenerateSupported:        true,
 
 	// Checkpoints ordered from oldest to newest.
-	Checkpoints: nil,
+	Checkpoints:      nil,
+	AssumeValid:      nil,
+	MinimumChainWork: nil,
+	AssumeUtxos:      nil,
 
 	// Consensus rule change deployments.
 	//
@@ -336,18 +408,21 @@ var RegressionNetParams = Params{
 	//   target proof of work timespan / target proof of work spacing
 	RuleChangeActivationThreshold: 108, // 75%  of MinerConfirmationWindow
 	MinerConfirmationWindow:       144,
-	Deployments: [DefinedDeployments]ConsensusDeployment{
+	Deployments: []ConsensusDeployment{
 		DeploymentTestDummy: {
+			Name:       "dummy",
 			BitNumber:  28,
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
 		DeploymentCSV: {
+			Name:       "csv",
 			BitNumber:  0,
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
 		DeploymentSegwit: {
+			Name:       "segwit",
 			BitNumber:  1,
 			StartTime:  math.MaxInt64, // Not in the roadmap
 			ExpireTime: math.MaxInt64, // Not in the roadmap
@@ -409,24 +484,36 @@ var TestNet3Params = Params{
 		{0, newHashFromStr("9c89283ba0f3227f6c03b70216b9f665f0118d5e0fa729cedf4fb34d6a34f463")},
 	},
 
+	// The scripts of all blocks are checked until a block, along with the
+	// work of the chain containing it, has been reviewed to be assumed
+	// valid.
+	AssumeValid:      nil,
+	MinimumChainWork: nil,
+
+	// No utxo set snapshots have been reviewed to be loadable yet.
+	AssumeUtxos: nil,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
 	//   target proof of work timespan / target proof of work spacing
 	RuleChangeActivationThreshold: 1512, // 75% of MinerConfirmationWindow
 	MinerConfirmationWindow:       2016,
-	Deployments: [DefinedDeployments]ConsensusDeployment{
+	Deployments: []ConsensusDeployment{
 		DeploymentTestDummy: {
+			Name:       "dummy",
 			BitNumber:  28,
 			StartTime:  1199145601, // January 1, 2008 UTC
 			ExpireTime: 1230767999, // December 31, 2008 UTC
 		},
 		DeploymentCSV: {
+			Name:       "csv",
 			BitNumber:  0,
 			StartTime:  1456790400, // March 1st, 2016
 			ExpireTime: 1493596800, // May 1st, 2017
 		},
 		DeploymentSegwit: {
+			Name:       "segwit",
 			BitNumber:  1,
 			StartTime:  math.MaxInt64, // Not in the roadmap
 			ExpireTime: math.MaxInt64, // Not in the roadmap
@@ -487,7 +574,10 @@ var SimNetParams = Params{
 	GenerateSupported:        true,
 
 	// Checkpoints ordered from oldest to newest.
-	Checkpoints: nil,
+	Checkpoints:      nil,
+	AssumeValid:      nil,
+	MinimumChainWork: nil,
+	AssumeUtxos:      nil,
 
 	// Consensus rule change deployments.
 	//
@@ -495,18 +585,21 @@ var SimNetParams = Params{
 	//   target proof of work timespan / target proof of work spacing
 	RuleChangeActivationThreshold: 75, // 75% of MinerConfirmationWindow
 	MinerConfirmationWindow:       100,
-	Deployments: [DefinedDeployments]ConsensusDeployment{
+	Deployments: []ConsensusDeployment{
 		DeploymentTestDummy: {
+			Name:       "dummy",
 			BitNumber:  28,
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
 		DeploymentCSV: {
+			Name:       "csv",
 			BitNumber:  0,
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
 		DeploymentSegwit: {
+			Name:       "segwit",
 			BitNumber:  1,
 			StartTime:  math.MaxInt64, // Not in the roadmap
 			ExpireTime: math.MaxInt64, // Not in the roadmap
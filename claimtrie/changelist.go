@@ -82,6 +82,10 @@ const (
 	cmdUpdateClaim
 	cmdAddSupport
 	cmdSpendSupport
+
+	// cmdRestore replaces the node with the state held in the value.  It
+	// is the first change of the nodes imported from a snapshot.
+	cmdRestore
 )
 
 // change represent a record of changes to the node of Name at Height.
@@ -95,6 +99,38 @@ type change struct {
 	value  []byte
 }
 
+// changeGob is the serialized form of a change.
+// The fields of change are unexported, and thus invisible to gob.
+type changeGob struct {
+	Height Height
+	Cmd    command
+	Name   string
+	OP     wire.OutPoint
+	Amount Amount
+	ID     ClaimID
+	Value  []byte
+}
+
+// GobEncode implements the gob.GobEncoder interface.
+func (c *change) GobEncode() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	cg := changeGob{c.height, c.cmd, c.name, c.op, c.amount, c.id, c.value}
+	if err := gob.NewEncoder(buf).Encode(&cg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements the gob.GobDecoder interface.
+func (c *change) GobDecode(b []byte) error {
+	var cg changeGob
+	if err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&cg); err != nil {
+		return err
+	}
+	*c = change{cg.Height, cg.Cmd, cg.Name, cg.OP, cg.Amount, cg.ID, cg.Value}
+	return nil
+}
+
 func newChange(cmd command) *change {
 	return &change{cmd: cmd}
 }
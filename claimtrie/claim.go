@@ -35,7 +35,8 @@ func (c *Claim) setAccepted(ht Height) *Claim        { c.Accepted = ht; return c
 func (c *Claim) setActiveAt(ht Height) *Claim        { c.ActiveAt = ht; return c }
 func (c *Claim) setValue(val []byte) *Claim          { c.Value = val; return c }
 
-func (c *Claim) expireAt() Height {
+// ExpireAt returns the height at which the Claim (or Support) expires.
+func (c *Claim) ExpireAt() Height {
 	if c.Accepted+paramOriginalClaimExpirationTime > paramExtendedClaimExpirationForkHeight {
 		return c.Accepted + paramExtendedClaimExpirationTime
 	}
@@ -43,7 +44,7 @@ func (c *Claim) expireAt() Height {
 }
 
 func IsActiveAt(c *Claim, ht Height) bool {
-	return c != nil && c.ActiveAt <= ht && c.expireAt() > ht
+	return c != nil && c.ActiveAt <= ht && c.ExpireAt() > ht
 }
 
 func equal(a, b *Claim) bool {
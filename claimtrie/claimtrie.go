@@ -1,7 +1,6 @@
 package claimtrie
 
 import (
-	"fmt"
 	"path/filepath"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -9,6 +8,7 @@ import (
 	"github.com/btcsuite/btcutil"
 	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 )
 
 // ClaimTrie implements a Merkle Trie supporting linear history of commits.
@@ -47,19 +47,43 @@ func New() (*ClaimTrie, error) {
 		return nil, errors.Wrapf(err, "can't open %s", path)
 	}
 
+	ct, err := newClaimTrie(dbTrie, dbNodeMgr, dbCommit)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("%d of commits loaded. Head: %d", len(ct.cm.commits), ct.cm.head.Height)
+	log.Infof("%d of nodes loaded.", ct.nm.size())
+	log.Infof("ClaimTrie Root: %s.", ct.trie.MerkleHash())
+	return ct, nil
+}
+
+// NewMemory returns an empty ClaimTrie, which is kept in memory only.
+// It is intended for tools and tests, which need to calculate ClaimTrie roots
+// without touching the database of the node.
+func NewMemory() (*ClaimTrie, error) {
+	var dbs [3]*leveldb.DB
+	for i := range dbs {
+		db, err := leveldb.Open(storage.NewMemStorage(), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't open memory storage")
+		}
+		dbs[i] = db
+	}
+	return newClaimTrie(dbs[0], dbs[1], dbs[2])
+}
+
+// newClaimTrie returns a ClaimTrie loaded from the specified databases.
+func newClaimTrie(dbTrie, dbNodeMgr, dbCommit *leveldb.DB) (*ClaimTrie, error) {
 	cm := newCommitMgr(dbCommit)
 	if err := cm.load(); err != nil {
 		return nil, errors.Wrapf(err, "cm.Load()")
 	}
-	fmt.Printf("%d of commits loaded. Head: %d\n", len(cm.commits), cm.head.Height)
 
 	nm := newNodeMgr(dbNodeMgr)
 	nm.Load(cm.head.Height)
-	fmt.Printf("%d of nodes loaded.\n", nm.size())
 
 	tr := newMerkleTrie(nm, dbTrie)
 	tr.SetRoot(cm.head.MerkleRoot)
-	fmt.Printf("ClaimTrie Root: %s.\n", tr.MerkleHash())
 
 	ct := &ClaimTrie{
 		cm:   cm,
@@ -98,6 +122,13 @@ func (ct *ClaimTrie) Height() Height {
 	return ct.cm.head.Height
 }
 
+// Base returns the height of the snapshot the ClaimTrie was imported from.
+// It is zero if the ClaimTrie has been built from the genesis block.
+// The ClaimTrie doesn't hold any state for the heights below it.
+func (ct *ClaimTrie) Base() Height {
+	return ct.cm.base
+}
+
 // AddClaim adds a Claim to the ClaimTrie.
 func (ct *ClaimTrie) AddClaim(name string, op wire.OutPoint, amt Amount, val []byte) error {
 	c := newChange(cmdAddClaim).setOP(op).setAmt(amt).setValue(val)
@@ -148,7 +179,7 @@ func (ct *ClaimTrie) Commit(ht Height) {
 
 // Reset resets the tip commit to a previous height specified.
 func (ct *ClaimTrie) Reset(ht Height) error {
-	if ht > ct.Height() {
+	if ht > ct.Height() || ht < ct.Base() {
 		return errInvalidHeight
 	}
 	ct.cm.reset(ht)
@@ -157,9 +188,13 @@ func (ct *ClaimTrie) Reset(ht Height) error {
 	return nil
 }
 
-// Node returns the node adjusted to specified height.
+// Node returns a copy of the node adjusted to the current height.  An empty
+// node is returned if the name has never been claimed.
 func (ct *ClaimTrie) Node(name string) *Node {
-	return ct.nm.nodeAt(name, ct.Height())
+	if n := ct.nm.peek(name); n != nil {
+		return n
+	}
+	return NewNode(name)
 }
 
 // Size returns the number of nodes loaded into the cache.
@@ -173,6 +208,13 @@ func (ct *ClaimTrie) Visit(v visitFunc) {
 	ct.nm.visit(v)
 }
 
+// VisitRange visits the nodes in the cache, whose names have the specified
+// prefix and sort after startAfter, in lexicographical order of names.
+// If the VisitFunc returns true, the iteration ends immediately.
+func (ct *ClaimTrie) VisitRange(prefix, startAfter string, v visitFunc) {
+	ct.nm.visitRange(prefix, startAfter, v)
+}
+
 func (ct *ClaimTrie) modify(name string, c *change) error {
 	c.setHeight(ct.Height() + 1).setName(name)
 	if err := ct.nm.modifyNode(name, c); err != nil {
@@ -25,6 +25,10 @@ type commitMgr struct {
 	db      *leveldb.DB
 	commits []*commit
 	head    *commit
+
+	// base is the height of the imported snapshot, if any.
+	// No commits exist below it.
+	base Height
 }
 
 func newCommitMgr(db *leveldb.DB) *commitMgr {
@@ -65,9 +69,11 @@ func (cm *commitMgr) save() error {
 	exported := struct {
 		Commits []*commit
 		Head    *commit
+		Base    Height
 	}{
 		Commits: cm.commits,
 		Head:    cm.head,
+		Base:    cm.base,
 	}
 
 	buf := bytes.NewBuffer(nil)
@@ -84,6 +90,7 @@ func (cm *commitMgr) load() error {
 	exported := struct {
 		Commits []*commit
 		Head    *commit
+		Base    Height
 	}{}
 
 	data, err := cm.db.Get([]byte("CommitMgr"), nil)
@@ -98,5 +105,20 @@ func (cm *commitMgr) load() error {
 	}
 	cm.commits = exported.Commits
 	cm.head = exported.Head
+	cm.base = exported.Base
 	return nil
 }
+
+// rootAt returns the Merkle root committed at height ht.
+func (cm *commitMgr) rootAt(ht Height) (*chainhash.Hash, error) {
+	for i := len(cm.commits) - 1; i >= 0; i-- {
+		c := cm.commits[i]
+		if c.Height == ht {
+			return c.MerkleRoot, nil
+		}
+		if c.Height < ht {
+			break
+		}
+	}
+	return nil, errors.Wrapf(errInvalidHeight, "no commit at height %d", ht)
+}
@@ -15,6 +15,9 @@ var (
 	// errDuplicate is returned when the Claim or Support already exists in the node.
 	errDuplicate = fmt.Errorf("duplicate")
 
+	// errInvalidSnapshot is returned when the snapshot is malformed or doesn't match.
+	errInvalidSnapshot = fmt.Errorf("invalid snapshot")
+
 	// errInvalidID is returned when the ID does not conform to the format.
 	errInvalidID = errors.New("ID must be a 20-character hexadecimal string")
 )
@@ -2,7 +2,9 @@ package claimtrie
 
 import (
 	"bytes"
+	"container/heap"
 	"encoding/gob"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -66,6 +68,26 @@ func (nm *nodeMgr) Get(key []byte) value {
 // reset resets all nodes to specified height.
 func (nm *nodeMgr) reset(ht Height) {
 	nm.height = ht
+
+	// Drop the changes recorded above the height.  Every modified node is
+	// also scheduled for an update at the height of the change.
+	truncated := map[string]bool{}
+	for next, names := range nm.nextUpdates {
+		if next <= ht {
+			continue
+		}
+		for name := range names {
+			if truncated[name] {
+				continue
+			}
+			truncated[name] = true
+			cl := newChangeList(nm.db, name).load()
+			if n := len(cl.changes); n > 0 && cl.changes[n-1].height > ht {
+				cl.truncate(ht).save()
+			}
+		}
+	}
+
 	for name, n := range nm.cache {
 		if n.Height >= ht {
 			nm.cache[name] = nm.load(name, ht)
@@ -98,6 +120,19 @@ func (nm *nodeMgr) nodeAt(name string, ht Height) *Node {
 	return n.adjustTo(ht)
 }
 
+// peek returns a copy of the node adjusted to the current height, or nil if
+// the node doesn't exist.  Unlike nodeAt, it leaves the cache untouched.
+func (nm *nodeMgr) peek(name string) *Node {
+	n, ok := nm.cache[name]
+	if !ok {
+		return nil
+	}
+	if n.Height > nm.height {
+		return nm.load(name, nm.height)
+	}
+	return n.clone().adjustTo(nm.height)
+}
+
 // modifyNode returns the node adjusted to specified height.
 func (nm *nodeMgr) modifyNode(name string, chg *change) error {
 	ht := nm.height
@@ -135,19 +170,74 @@ func (nm *nodeMgr) visit(v visitFunc) {
 	}
 }
 
+// visitRange visits the nodes in the cache, whose names have the specified
+// prefix and sort after startAfter, in lexicographical order of names.
+// Only the names are collected up front, so the nodes are not copied, and they
+// are ordered lazily, so visiting the first few doesn't sort all of them.
+func (nm *nodeMgr) visitRange(prefix, startAfter string, v visitFunc) {
+	var names nameHeap
+	for name := range nm.cache {
+		if strings.HasPrefix(name, prefix) && name > startAfter {
+			names = append(names, name)
+		}
+	}
+	heap.Init(&names)
+	for names.Len() > 0 {
+		name := heap.Pop(&names).(string)
+		n, ok := nm.cache[name]
+		if !ok {
+			continue
+		}
+		if v(n) {
+			return
+		}
+	}
+}
+
+// nameHeap is a min-heap of names, which implements heap.Interface.
+type nameHeap []string
+
+func (h nameHeap) Len() int            { return len(h) }
+func (h nameHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h nameHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nameHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *nameHeap) Pop() interface{} {
+	old := *h
+	name := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return name
+}
+
 func replay(name string, chgs []*change) *Node {
+	n, err := replayChanges(name, chgs)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// replayChanges returns the node rebuilt from the changes, or an error if any
+// of the changes can't be applied.
+func replayChanges(name string, chgs []*change) (*Node, error) {
 	n := NewNode(name)
 	for _, chg := range chgs {
+		if chg.cmd == cmdRestore {
+			var err error
+			if n, err = decodeNode(chg.value); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		if n.Height < chg.height-1 {
 			n.adjustTo(chg.height - 1)
 		}
 		if n.Height == chg.height-1 {
 			if err := execute(n, chg); err != nil {
-				panic(err)
+				return nil, err
 			}
 		}
 	}
-	return n
+	return n, nil
 }
 
 func execute(n *Node, c *change) error {
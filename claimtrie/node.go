@@ -138,7 +138,7 @@ func (n *Node) nextUpdate() Height {
 	next := Height(math.MaxInt32)
 	min := func(l claimList) Height {
 		for _, v := range l {
-			exp := v.expireAt()
+			exp := v.ExpireAt()
 			if n.Height >= exp {
 				continue
 			}
@@ -159,6 +159,26 @@ func (n *Node) nextUpdate() Height {
 	return next
 }
 
+// clone returns a deep copy of the Node.
+func (n *Node) clone() *Node {
+	c := *n
+	dup := func(l claimList) claimList {
+		var d claimList
+		for _, v := range l {
+			cpy := *v
+			d = append(d, &cpy)
+			if v == n.BestClaim {
+				c.BestClaim = &cpy
+			}
+		}
+		return d
+	}
+	c.Claims = dup(n.Claims)
+	c.Supports = dup(n.Supports)
+	c.removed = dup(n.removed)
+	return &c
+}
+
 // Hash calculates the Hash value based on the OutPoint and when it tookover.
 func (n *Node) Hash() *chainhash.Hash {
 	if n.BestClaim == nil {
@@ -169,7 +189,7 @@ func (n *Node) Hash() *chainhash.Hash {
 
 func (n *Node) bid() {
 	for {
-		if n.BestClaim == nil || n.Height >= n.BestClaim.expireAt() {
+		if n.BestClaim == nil || n.Height >= n.BestClaim.ExpireAt() {
 			n.BestClaim, n.Tookover = nil, n.Height
 			updateActiveHeights(n, n.Claims, n.Supports)
 		}
@@ -19,3 +19,46 @@ var (
 	paramExtendedClaimExpirationTime       = DefaultExtendedClaimExpirationTime
 	paramExtendedClaimExpirationForkHeight = DefaultExtendedClaimExpirationForkHeight
 )
+
+// Params defines the consensus parameters of the ClaimTrie.
+type Params struct {
+	MaxActiveDelay    Height
+	ActiveDelayFactor Height
+
+	OriginalClaimExpirationTime       Height
+	ExtendedClaimExpirationTime       Height
+	ExtendedClaimExpirationForkHeight Height
+}
+
+// DefaultParams are the consensus parameters of the LBRY networks.
+var DefaultParams = Params{
+	MaxActiveDelay:    DefaultMaxActiveDelay,
+	ActiveDelayFactor: DefaultActiveDelayFactor,
+
+	OriginalClaimExpirationTime:       DefaultOriginalClaimExpirationTime,
+	ExtendedClaimExpirationTime:       DefaultExtendedClaimExpirationTime,
+	ExtendedClaimExpirationForkHeight: DefaultExtendedClaimExpirationForkHeight,
+}
+
+// SetParams replaces the consensus parameters of all the ClaimTries, and
+// returns the ones previously in effect.  It is intended for tests, which
+// need shorter activation delays and expiration times than the networks.
+//
+// This function is NOT safe for concurrent access, and MUST NOT be called while
+// any ClaimTrie is in use.
+func SetParams(p Params) Params {
+	prev := Params{
+		MaxActiveDelay:    paramMaxActiveDelay,
+		ActiveDelayFactor: paramActiveDelayFactor,
+
+		OriginalClaimExpirationTime:       paramOriginalClaimExpirationTime,
+		ExtendedClaimExpirationTime:       paramExtendedClaimExpirationTime,
+		ExtendedClaimExpirationForkHeight: paramExtendedClaimExpirationForkHeight,
+	}
+	paramMaxActiveDelay = p.MaxActiveDelay
+	paramActiveDelayFactor = p.ActiveDelayFactor
+	paramOriginalClaimExpirationTime = p.OriginalClaimExpirationTime
+	paramExtendedClaimExpirationTime = p.ExtendedClaimExpirationTime
+	paramExtendedClaimExpirationForkHeight = p.ExtendedClaimExpirationForkHeight
+	return prev
+}
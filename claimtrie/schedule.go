@@ -0,0 +1,143 @@
+package claimtrie
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// UpdateKind defines the type of a scheduled update.
+type UpdateKind int
+
+const (
+	// UpdateActivation indicates a Claim or Support becomes active.
+	UpdateActivation UpdateKind = iota
+
+	// UpdateExpiration indicates a Claim or Support expires.
+	UpdateExpiration
+
+	// UpdateTakeover indicates a Claim becomes the BestClaim of the Node.
+	UpdateTakeover
+)
+
+var updateKindStrings = map[UpdateKind]string{
+	UpdateActivation: "activation",
+	UpdateExpiration: "expiration",
+	UpdateTakeover:   "takeover",
+}
+
+func (k UpdateKind) String() string {
+	if s, ok := updateKindStrings[k]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// ScheduledUpdate describes a pending change of a Node at a future height.
+type ScheduledUpdate struct {
+	Name      string     // Name of the Node to be updated.
+	Height    Height     // Height at which the update happens.
+	Kind      UpdateKind // Kind of the update.
+	Claim     *Claim     // Claim (or Support) involved in the update.
+	IsSupport bool       // IsSupport is true if Claim refers to a Support.
+}
+
+// Schedule returns the updates that will happen between heights from and to,
+// inclusive, due to activation delays and expirations of the current Claims
+// and Supports. Takeovers are predicted assuming no further changes are made
+// to the ClaimTrie. The updates are ordered by height and name.
+// An error is returned unless from is above the current height and not above
+// to.
+func (ct *ClaimTrie) Schedule(from, to Height) ([]ScheduledUpdate, error) {
+	if from <= ct.Height() {
+		return nil, errors.Wrapf(errInvalidHeight, "fromheight %d "+
+			"is not above the current height %d", from, ct.Height())
+	}
+	if to < from {
+		return nil, errors.Wrapf(errInvalidHeight, "toheight %d is "+
+			"lower than fromheight %d", to, from)
+	}
+	return ct.nm.schedule(from, to), nil
+}
+
+// schedule returns the updates of nodes scheduled in the range [from, to].
+// It doesn't modify the nodes in the cache, so it can run concurrently with
+// other readers of the ClaimTrie.
+func (nm *nodeMgr) schedule(from, to Height) []ScheduledUpdate {
+
+	// nextUpdates holds the earliest pending update of each node, so only
+	// the nodes listed at or before the upper bound can be affected.
+	names := map[string]bool{}
+	for ht, m := range nm.nextUpdates {
+		if ht <= nm.height || ht > to {
+			continue
+		}
+		for name := range m {
+			names[name] = true
+		}
+	}
+
+	var updates []ScheduledUpdate
+	for name := range names {
+		n := nm.peek(name)
+		if n == nil {
+			continue
+		}
+		updates = append(updates, n.schedule(from, to)...)
+	}
+
+	sort.Slice(updates, func(i, j int) bool {
+		if updates[i].Height != updates[j].Height {
+			return updates[i].Height < updates[j].Height
+		}
+		if updates[i].Name != updates[j].Name {
+			return updates[i].Name < updates[j].Name
+		}
+		return updates[i].Kind < updates[j].Kind
+	})
+	return updates
+}
+
+// schedule advances the node through its pending updates up to height to, and
+// returns the ones happening at or after height from.
+func (n *Node) schedule(from, to Height) []ScheduledUpdate {
+	var updates []ScheduledUpdate
+	add := func(k UpdateKind, c *Claim, isSupport bool) {
+		u := ScheduledUpdate{Name: n.Name, Height: n.Height, Kind: k, Claim: c, IsSupport: isSupport}
+		updates = append(updates, u)
+	}
+	for {
+		next := n.nextUpdate()
+		if next == n.Height || next > to {
+			break
+		}
+		var prev ClaimID
+		if n.BestClaim != nil {
+			prev = n.BestClaim.ID
+		}
+		n.adjustTo(next)
+		if next < from {
+			continue
+		}
+		for _, c := range n.Claims {
+			if c.ActiveAt == next {
+				add(UpdateActivation, c, false)
+			}
+			if c.ExpireAt() == next {
+				add(UpdateExpiration, c, false)
+			}
+		}
+		for _, s := range n.Supports {
+			if s.ActiveAt == next {
+				add(UpdateActivation, s, true)
+			}
+			if s.ExpireAt() == next {
+				add(UpdateExpiration, s, true)
+			}
+		}
+		if n.BestClaim != nil && n.BestClaim.ID != prev {
+			add(UpdateTakeover, n.BestClaim, false)
+		}
+	}
+	return updates
+}
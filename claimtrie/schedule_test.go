@@ -0,0 +1,129 @@
+package claimtrie
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testOutPoint returns a distinct outpoint for the passed index.
+func testOutPoint(i byte) wire.OutPoint {
+	return wire.OutPoint{Hash: chainhash.Hash{i}, Index: uint32(i)}
+}
+
+// commitTo commits empty blocks to the ClaimTrie up to the passed height.
+func commitTo(ct *ClaimTrie, ht Height) {
+	for h := ct.Height() + 1; h <= ht; h++ {
+		ct.Commit(h)
+	}
+}
+
+// TestSchedule ensures the scheduled activations, takeovers and expirations
+// are reported in order, and that invalid ranges are rejected.
+func TestSchedule(t *testing.T) {
+	prev := SetParams(Params{
+		MaxActiveDelay:                    DefaultMaxActiveDelay,
+		ActiveDelayFactor:                 DefaultActiveDelayFactor,
+		OriginalClaimExpirationTime:       500,
+		ExtendedClaimExpirationTime:       1000,
+		ExtendedClaimExpirationForkHeight: 10000,
+	})
+	defer SetParams(prev)
+
+	ct, err := NewMemory()
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	defer ct.Close()
+
+	// The first claim of a name takes over at once.  The second one, which
+	// is made 100 blocks later, is delayed by 100 / 32 = 3 blocks.
+	op1, op2 := testOutPoint(1), testOutPoint(2)
+	if err := ct.AddClaim("a", op1, 10, nil); err != nil {
+		t.Fatalf("AddClaim: %v", err)
+	}
+	commitTo(ct, 100)
+	if err := ct.AddClaim("a", op2, 20, nil); err != nil {
+		t.Fatalf("AddClaim: %v", err)
+	}
+	commitTo(ct, 101)
+
+	tests := []struct {
+		name     string
+		from, to Height
+		want     []ScheduledUpdate
+		wantErr  bool
+	}{
+		{
+			name: "activation and takeover",
+			from: 102,
+			to:   200,
+			want: []ScheduledUpdate{
+				{Name: "a", Height: 104, Kind: UpdateActivation},
+				{Name: "a", Height: 104, Kind: UpdateTakeover},
+			},
+		},
+		{
+			name: "expirations",
+			from: 105,
+			to:   700,
+			want: []ScheduledUpdate{
+				{Name: "a", Height: 501, Kind: UpdateExpiration},
+				{Name: "a", Height: 601, Kind: UpdateExpiration},
+			},
+		},
+		{
+			name: "empty range",
+			from: 105,
+			to:   500,
+		},
+		{
+			name:    "from at the current height",
+			from:    101,
+			to:      200,
+			wantErr: true,
+		},
+		{
+			name:    "to below from",
+			from:    200,
+			to:      199,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		updates, err := ct.Schedule(test.from, test.to)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(updates) != len(test.want) {
+			t.Errorf("%s: got %d updates, want %d", test.name,
+				len(updates), len(test.want))
+			continue
+		}
+		for i, u := range updates {
+			w := test.want[i]
+			if u.Name != w.Name || u.Height != w.Height ||
+				u.Kind != w.Kind {
+				t.Errorf("%s: update #%d is %s of %q at %d, "+
+					"want %s of %q at %d", test.name, i,
+					u.Kind, u.Name, u.Height, w.Kind,
+					w.Name, w.Height)
+			}
+		}
+	}
+
+	// Predicting the schedule must not advance the cached node.
+	if n := ct.nm.cache["a"]; n.Height > ct.Height() {
+		t.Errorf("cached node advanced to height %d, ClaimTrie is "+
+			"at %d", n.Height, ct.Height())
+	}
+}
@@ -0,0 +1,301 @@
+package claimtrie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// snapshotMagic identifies a ClaimTrie snapshot file.
+var snapshotMagic = [8]byte{'c', 'l', 'm', 't', 'r', 'i', 'e', 0}
+
+// snapshotVersion is the version of the snapshot format.
+const snapshotVersion uint32 = 2
+
+// SnapshotHeader is the header of a ClaimTrie snapshot, which has the
+// following form:
+//
+//	magic(8B) version(4B) height(4B) blockhash(32B) merkleroot(32B)
+type SnapshotHeader struct {
+	Height     Height         // Height of the block the snapshot was taken at.
+	BlockHash  chainhash.Hash // BlockHash is the hash of that block.
+	MerkleRoot chainhash.Hash // MerkleRoot is the ClaimTrie root at that block.
+}
+
+// snapshotNode is a node in a snapshot.  It holds the state of the node at the
+// height of the snapshot, and the height of its next pending update.
+type snapshotNode struct {
+	Name       string
+	State      []byte
+	NextUpdate Height
+}
+
+// nodeState is the serialized form of a node.  The fields of Node can't be
+// encoded directly, since BestClaim points into Claims.
+type nodeState struct {
+	Name      string
+	Height    Height
+	Tookover  Height
+	Claims    []*Claim
+	Supports  []*Claim
+	BestClaim int // Index of the BestClaim in Claims, or -1 if none.
+}
+
+// encodeNode returns the serialized state of the node.
+func encodeNode(n *Node) ([]byte, error) {
+	ns := nodeState{
+		Name:      n.Name,
+		Height:    n.Height,
+		Tookover:  n.Tookover,
+		Claims:    n.Claims,
+		Supports:  n.Supports,
+		BestClaim: -1,
+	}
+	for i, c := range n.Claims {
+		if c == n.BestClaim {
+			ns.BestClaim = i
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(&ns); err != nil {
+		return nil, errors.Wrapf(err, "gob.Encode(%s)", n.Name)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeNode returns the node rebuilt from its serialized state.
+func decodeNode(b []byte) (*Node, error) {
+	var ns nodeState
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&ns); err != nil {
+		return nil, errors.Wrapf(err, "gob.Decode()")
+	}
+	if ns.BestClaim < -1 || ns.BestClaim >= len(ns.Claims) {
+		return nil, errors.Wrapf(errInvalidSnapshot, "best claim of "+
+			"%s out of range", ns.Name)
+	}
+	n := &Node{
+		Name:     ns.Name,
+		Height:   ns.Height,
+		Tookover: ns.Tookover,
+		Claims:   ns.Claims,
+		Supports: ns.Supports,
+	}
+	if ns.BestClaim >= 0 {
+		n.BestClaim = n.Claims[ns.BestClaim]
+	}
+	return n, nil
+}
+
+// WriteSnapshotHeader writes the header of a snapshot to w.
+func WriteSnapshotHeader(w io.Writer, hdr *SnapshotHeader) error {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(snapshotMagic[:])                             // nolint : errchk
+	binary.Write(buf, binary.LittleEndian, snapshotVersion) // nolint : errchk
+	binary.Write(buf, binary.LittleEndian, hdr.Height)      // nolint : errchk
+	buf.Write(hdr.BlockHash[:])                             // nolint : errchk
+	buf.Write(hdr.MerkleRoot[:])                            // nolint : errchk
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadSnapshotHeader reads the header of a snapshot from r.
+func ReadSnapshotHeader(r io.Reader) (*SnapshotHeader, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, errors.Wrapf(err, "read magic")
+	}
+	if magic != snapshotMagic {
+		return nil, errInvalidSnapshot
+	}
+	var ver uint32
+	if err := binary.Read(r, binary.LittleEndian, &ver); err != nil {
+		return nil, errors.Wrapf(err, "read version")
+	}
+	if ver != snapshotVersion {
+		return nil, errors.Wrapf(errInvalidSnapshot, "unsupported version %d", ver)
+	}
+	hdr := &SnapshotHeader{}
+	if err := binary.Read(r, binary.LittleEndian, &hdr.Height); err != nil {
+		return nil, errors.Wrapf(err, "read height")
+	}
+	if _, err := io.ReadFull(r, hdr.BlockHash[:]); err != nil {
+		return nil, errors.Wrapf(err, "read block hash")
+	}
+	if _, err := io.ReadFull(r, hdr.MerkleRoot[:]); err != nil {
+		return nil, errors.Wrapf(err, "read merkle root")
+	}
+	return hdr, nil
+}
+
+// Export writes a snapshot of the ClaimTrie at height ht, which must be
+// between Base and Height, to w.  The blockHash is the hash of the block at
+// height ht and is recorded in the header.
+func (ct *ClaimTrie) Export(w io.Writer, ht Height, blockHash *chainhash.Hash) (*SnapshotHeader, error) {
+	if ht > ct.Height() || ht < ct.Base() {
+		return nil, errInvalidHeight
+	}
+	root, err := ct.cm.rootAt(ht)
+	if err != nil {
+		return nil, err
+	}
+	hdr := &SnapshotHeader{Height: ht, BlockHash: *blockHash, MerkleRoot: *root}
+	if err := WriteSnapshotHeader(w, hdr); err != nil {
+		return nil, errors.Wrapf(err, "WriteSnapshotHeader()")
+	}
+
+	// Only the names are collected up front.  Each node is rebuilt at the
+	// height of the snapshot and written one at a time.
+	var names []string
+	for name := range ct.nm.cache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enc := gob.NewEncoder(w)
+	for _, name := range names {
+		n := ct.nm.load(name, ht)
+		if len(n.Claims) == 0 && len(n.Supports) == 0 {
+			continue
+		}
+		state, err := encodeNode(n)
+		if err != nil {
+			return nil, err
+		}
+		sn := snapshotNode{
+			Name:       name,
+			State:      state,
+			NextUpdate: n.nextUpdate(),
+		}
+		if err := enc.Encode(&sn); err != nil {
+			return nil, errors.Wrapf(err, "gob.Encode(%s)", name)
+		}
+	}
+	// An empty name terminates the nodes.
+	if err := enc.Encode(&snapshotNode{}); err != nil {
+		return nil, errors.Wrapf(err, "gob.Encode()")
+	}
+	return hdr, nil
+}
+
+// Import replaces the state of the ClaimTrie with the snapshot read from r.
+// The header of the snapshot must have been read from r by ReadSnapshotHeader.
+// The snapshot is rebuilt in memory first, and is only loaded if the rebuilt
+// Merkle root matches both the one in the header and the expected one.
+// Otherwise, the ClaimTrie is left untouched.
+func (ct *ClaimTrie) Import(r io.Reader, hdr *SnapshotHeader, expected *chainhash.Hash) error {
+	ht := hdr.Height
+	nodes := map[string]*Node{}
+	states := map[string][]byte{}
+	next := todos{}
+
+	dec := gob.NewDecoder(r)
+	for {
+		var sn snapshotNode
+		if err := dec.Decode(&sn); err != nil {
+			return errors.Wrapf(err, "gob.Decode()")
+		}
+		if sn.Name == "" {
+			break
+		}
+		if _, ok := nodes[sn.Name]; ok {
+			return errors.Wrapf(errInvalidSnapshot, "duplicate node %s", sn.Name)
+		}
+		n, err := decodeNode(sn.State)
+		if err != nil {
+			return errors.Wrapf(errInvalidSnapshot, "decode %s: %s", sn.Name, err)
+		}
+		if err := checkSnapshotNode(n, sn.Name, ht); err != nil {
+			return err
+		}
+		if n.nextUpdate() != sn.NextUpdate {
+			return errors.Wrapf(errInvalidSnapshot, "mismatched schedule of %s", sn.Name)
+		}
+		if sn.NextUpdate > ht {
+			next.set(sn.Name, sn.NextUpdate)
+		}
+		nodes[sn.Name] = n
+		states[sn.Name] = sn.State
+	}
+
+	// Calculate the Merkle root with a standalone trie.  It shares the trie
+	// database, which is content addressed, with the ClaimTrie.
+	nm := &nodeMgr{height: ht, cache: nodes, nextUpdates: next}
+	tr := newMerkleTrie(nm, ct.trie.db)
+	for name := range nodes {
+		tr.Update([]byte(name))
+	}
+	root := tr.MerkleHash()
+	if *root != hdr.MerkleRoot || *root != *expected {
+		return errors.Wrapf(errInvalidSnapshot, "merkle root %s, header: %s, expected: %s",
+			root, hdr.MerkleRoot, expected)
+	}
+
+	// Replace the changes of all nodes in a single batch.
+	batch := &leveldb.Batch{}
+	iter := ct.nm.db.NewIterator(nil, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return errors.Wrapf(err, "iter.Next()")
+	}
+	for name, state := range states {
+		c := []*change{newChange(cmdRestore).setName(name).setHeight(ht).setValue(state)}
+		buf := bytes.NewBuffer(nil)
+		if err := gob.NewEncoder(buf).Encode(&c); err != nil {
+			return errors.Wrapf(err, "gob.Encode(%s)", name)
+		}
+		batch.Put([]byte(name), buf.Bytes())
+	}
+	if err := ct.nm.db.Write(batch, nil); err != nil {
+		return errors.Wrapf(err, "db.Write()")
+	}
+
+	ct.nm.height = ht
+	ct.nm.cache = nodes
+	ct.nm.nextUpdates = next
+	if err := ct.nm.save(); err != nil {
+		return errors.Wrapf(err, "nm.save()")
+	}
+
+	head := newCommit(nil, ht, root)
+	ct.cm.commits = []*commit{head}
+	ct.cm.head = head
+	ct.cm.base = ht
+	if err := ct.cm.save(); err != nil {
+		return errors.Wrapf(err, "cm.save()")
+	}
+
+	ct.trie.SetRoot(root)
+	return nil
+}
+
+// checkSnapshotNode returns an error unless the node read from a snapshot taken
+// at height ht has the expected name and height, and its bids are settled.
+func checkSnapshotNode(n *Node, name string, ht Height) error {
+	if n.Name != name || n.Height != ht {
+		return errors.Wrapf(errInvalidSnapshot, "node %s at height %d "+
+			"in place of %s at %d", n.Name, n.Height, name, ht)
+	}
+	for _, c := range append(append(claimList{}, n.Claims...), n.Supports...) {
+		if c.Accepted > ht {
+			return errors.Wrapf(errInvalidSnapshot, "invalid claim %s "+
+				"of %s", c.OutPoint, name)
+		}
+	}
+
+	// Bidding again at the same height must not change the best claim.
+	dup := n.clone()
+	dup.bid()
+	if !equal(dup.BestClaim, n.BestClaim) || dup.Tookover != n.Tookover {
+		return errors.Wrapf(errInvalidSnapshot, "unsettled bids of %s", name)
+	}
+	return nil
+}
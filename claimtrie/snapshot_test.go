@@ -0,0 +1,180 @@
+package claimtrie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// newSnapshotTestTrie returns a ClaimTrie at height 50, which has a pending
+// activation and takeover of name "a", a supported claim of name "b", and a
+// spent claim of name "c".
+func newSnapshotTestTrie(t *testing.T) *ClaimTrie {
+	ct, err := NewMemory()
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	must := func(err error) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	must(ct.AddClaim("a", testOutPoint(1), 10, []byte("a1")))
+	must(ct.AddClaim("b", testOutPoint(2), 10, []byte("b2")))
+	must(ct.AddClaim("c", testOutPoint(3), 10, []byte("c3")))
+	commitTo(ct, 1)
+	must(ct.AddSupport("b", testOutPoint(4), 5, NewID(testOutPoint(2))))
+	commitTo(ct, 10)
+	must(ct.SpendClaim("c", testOutPoint(3)))
+	commitTo(ct, 49)
+	must(ct.AddClaim("a", testOutPoint(5), 20, []byte("a5")))
+	commitTo(ct, 50)
+	return ct
+}
+
+// exportTrie returns the snapshot of the ClaimTrie at height ht.
+func exportTrie(t *testing.T, ct *ClaimTrie, ht Height) ([]byte, *SnapshotHeader) {
+	var buf bytes.Buffer
+	hdr, err := ct.Export(&buf, ht, &chainhash.Hash{byte(ht)})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	return buf.Bytes(), hdr
+}
+
+// importTrie reads the snapshot into ct.
+func importTrie(ct *ClaimTrie, snapshot []byte, expected *chainhash.Hash) error {
+	r := bytes.NewReader(snapshot)
+	hdr, err := ReadSnapshotHeader(r)
+	if err != nil {
+		return err
+	}
+	return ct.Import(r, hdr, expected)
+}
+
+// TestSnapshotRoundTrip ensures a ClaimTrie imported from a snapshot has the
+// same root as the original one, and keeps evolving like it, including the
+// updates which were pending when the snapshot was taken.
+func TestSnapshotRoundTrip(t *testing.T) {
+	ct := newSnapshotTestTrie(t)
+	defer ct.Close()
+
+	for _, ht := range []Height{50, 30} {
+		snapshot, hdr := exportTrie(t, ct, ht)
+		if hdr.Height != ht || hdr.BlockHash != (chainhash.Hash{byte(ht)}) {
+			t.Fatalf("unexpected header %+v", hdr)
+		}
+
+		imported, err := NewMemory()
+		if err != nil {
+			t.Fatalf("NewMemory: %v", err)
+		}
+		defer imported.Close()
+		if err := importTrie(imported, snapshot, &hdr.MerkleRoot); err != nil {
+			t.Fatalf("Import at height %d: %v", ht, err)
+		}
+		if imported.Height() != ht || imported.Base() != ht {
+			t.Fatalf("imported ClaimTrie at height %d, base %d, "+
+				"want %d", imported.Height(), imported.Base(), ht)
+		}
+		if *imported.MerkleHash() != hdr.MerkleRoot {
+			t.Fatalf("imported root %v, want %v",
+				imported.MerkleHash(), hdr.MerkleRoot)
+		}
+		if n := imported.Node("c"); len(n.Claims) != 0 {
+			t.Fatalf("spent claim of c was imported")
+		}
+	}
+
+	// Both tries advance past the pending activation of a5 at height 51.
+	snapshot, hdr := exportTrie(t, ct, 50)
+	imported, err := NewMemory()
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	defer imported.Close()
+	if err := importTrie(imported, snapshot, &hdr.MerkleRoot); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	for ht := Height(51); ht <= 60; ht++ {
+		if ht == 55 {
+			for _, tr := range []*ClaimTrie{ct, imported} {
+				err := tr.AddClaim("d", testOutPoint(6), 1, nil)
+				if err != nil {
+					t.Fatalf("AddClaim: %v", err)
+				}
+			}
+		}
+		ct.Commit(ht)
+		imported.Commit(ht)
+		if *ct.MerkleHash() != *imported.MerkleHash() {
+			t.Fatalf("height %d: imported root %v, want %v", ht,
+				imported.MerkleHash(), ct.MerkleHash())
+		}
+	}
+	best := imported.Node("a").BestClaim
+	if best == nil || best.OutPoint != testOutPoint(5) {
+		t.Fatalf("best claim of a is %v, want %v", best, testOutPoint(5))
+	}
+
+	// The imported ClaimTrie can be reset down to the snapshot, but not
+	// below it.
+	if err := imported.Reset(50); err != nil {
+		t.Fatalf("Reset to the snapshot height: %v", err)
+	}
+	if *imported.MerkleHash() != hdr.MerkleRoot {
+		t.Fatalf("root after reset %v, want %v", imported.MerkleHash(),
+			hdr.MerkleRoot)
+	}
+	if err := imported.Reset(49); err == nil {
+		t.Fatalf("Reset below the snapshot height succeeded")
+	}
+}
+
+// TestSnapshotInvalid ensures truncated snapshots and snapshots which don't
+// match the expected root are refused, and leave the ClaimTrie untouched.
+func TestSnapshotInvalid(t *testing.T) {
+	ct := newSnapshotTestTrie(t)
+	defer ct.Close()
+	snapshot, hdr := exportTrie(t, ct, 50)
+
+	target, err := NewMemory()
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	defer target.Close()
+	if err := target.AddClaim("x", testOutPoint(9), 1, nil); err != nil {
+		t.Fatalf("AddClaim: %v", err)
+	}
+	commitTo(target, 3)
+	root := *target.MerkleHash()
+
+	tests := []struct {
+		name     string
+		snapshot []byte
+		expected chainhash.Hash
+	}{
+		{"empty", nil, hdr.MerkleRoot},
+		{"truncated header", snapshot[:40], hdr.MerkleRoot},
+		{"truncated nodes", snapshot[:len(snapshot)/2], hdr.MerkleRoot},
+		{"missing terminator", snapshot[:len(snapshot)-4], hdr.MerkleRoot},
+		{"root mismatch", snapshot, chainhash.Hash{1}},
+	}
+	for _, test := range tests {
+		if err := importTrie(target, test.snapshot, &test.expected); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if target.Height() != 3 || target.Base() != 0 ||
+			*target.MerkleHash() != root {
+			t.Fatalf("%s: ClaimTrie modified by a failed import",
+				test.name)
+		}
+		if n := target.Node("x"); len(n.Claims) != 1 {
+			t.Fatalf("%s: claims modified by a failed import",
+				test.name)
+		}
+	}
+}
@@ -287,6 +287,13 @@ func (bi *blockImporter) Import() chan *importResults {
 	// the status handler when done.
 	go func() {
 		bi.wg.Wait()
+
+		// Write the utxos cached by the chain to the database before
+		// reporting the import is done.
+		if err := bi.chain.FlushUtxoCache(); err != nil {
+			bi.errChan <- err
+			return
+		}
 		bi.doneChan <- true
 	}()
 
@@ -27,6 +27,7 @@ import (
 	"github.com/btcsuite/btcd/database"
 	_ "github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/go-socks/socks"
@@ -58,9 +59,14 @@ const (
 	blockMaxWeightMin            = 4000
 	blockMaxWeightMax            = blockchain.MaxBlockWeight - 4000
 	defaultGenerate              = false
+	defaultStratumPort           = "3334"
+	defaultStratumDifficulty     = 1.0
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = 100000
 	defaultSigCacheMaxSize       = 100000
+	defaultUtxoCacheMaxSizeMiB   = 250
+	minPruneTargetMiB            = 550
+	defaultReorgWarnDepth        = 6
 	sampleConfigFilename         = "sample-btcd.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
@@ -135,7 +141,10 @@ type config struct {
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
+	AddAssumeUtxos       []string      `long:"addassumeutxo" description:"Add a utxo snapshot which may be loaded with loadtxoutset, as reported by dumptxoutset.  No network has built-in snapshots yet, so loadtxoutset refuses all others.  Format: '<height>:<block hash>:<utxo set hash>:<num outputs>:<chain tx count>'"`
+	Deployments          []string      `long:"deployment" description:"Override or add a version bits deployment on the regression and simulation test networks.  Format: '<name>:<bit>:<start height>:<timeout height>[:<min activation height>]'"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
+	AssumeValid          string        `long:"assumevalid" description:"Skip the script checks of the specified block and its ancestors once it is buried deep enough in the best header chain (0 checks all scripts, which is also the default since no network has a built-in block yet)"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
@@ -147,7 +156,12 @@ type config struct {
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
-	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
+	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate or stratumlisten options are set"`
+	StratumListeners     []string      `long:"stratumlisten" description:"Add an interface/port to listen for Stratum connections of miners (default port: 3334)"`
+	StratumDifficulty    float64       `long:"stratumdiff" description:"Initial and minimum difficulty of the shares of Stratum miners"`
+	CoinbaseTag          string        `long:"coinbasetag" description:"Text to add to the coinbase script of generated blocks"`
+	CoinbasePayouts      []string      `long:"coinbasepayout" description:"Pay the specified percentage of the value of generated blocks to an address given as <address>:<percent>, while the rest is paid to a mining address"`
+	WitnessCommitment    bool          `long:"witnesscommitment" description:"Add a witness commitment to the coinbase of generated blocks once segwit is active, even when they have no transactions with witness data"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
@@ -158,11 +172,18 @@ type config struct {
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
+	UtxoCacheMaxSizeMiB  uint          `long:"utxocachemaxsize" description:"The maximum size in MiB of the UTXO cache"`
+	Prune                uint64        `long:"prune" description:"Delete old blocks to keep the stored blocks below the specified size in MiB (minimum 550, 0 disables pruning) -- Incompatible with --txindex, --addrindex, --statsindex and --coinstatsindex"`
+	ReorgWarnDepth       uint32        `long:"reorgwarndepth" description:"Log reorganizations of the main chain which disconnect more than the specified number of blocks as warnings"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	StatsIndex           bool          `long:"statsindex" description:"Maintain an index of block statistics which makes the getblockstats RPC answer without loading blocks"`
+	DropStatsIndex       bool          `long:"dropstatsindex" description:"Deletes the block statistics index from the database on start up and then exits."`
+	CoinStatsIndex       bool          `long:"coinstatsindex" description:"Maintain an index of the utxo set statistics at each block which makes the gettxoutsetinfo RPC answer for any block without reading the utxo set"`
+	DropCoinStatsIndex   bool          `long:"dropcoinstatsindex" description:"Deletes the utxo set statistics index from the database on start up and then exits."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
@@ -170,7 +191,9 @@ type config struct {
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
 	miningAddrs          []btcutil.Address
+	coinbasePayouts      []mining.CoinbasePayout
 	minRelayTxFee        btcutil.Amount
 	whitelists           []*net.IPNet
 }
@@ -372,6 +395,169 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// newAssumeUtxoFromStr parses utxo snapshots in the
+// '<height>:<block hash>:<utxo set hash>:<num outputs>:<chain tx count>' format.
+func newAssumeUtxoFromStr(assumeUtxo string) (chaincfg.AssumeUtxo, error) {
+	parts := strings.Split(assumeUtxo, ":")
+	if len(parts) != 5 {
+		return chaincfg.AssumeUtxo{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q -- use the syntax <height>:"+
+			"<block hash>:<utxo set hash>:<num outputs>:"+
+			"<chain tx count>", assumeUtxo)
+	}
+
+	height, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || height <= 0 {
+		return chaincfg.AssumeUtxo{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed height", assumeUtxo)
+	}
+	blockHash, err := chainhash.NewHashFromStr(parts[1])
+	if err != nil || len(parts[1]) == 0 {
+		return chaincfg.AssumeUtxo{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed block hash",
+			assumeUtxo)
+	}
+	utxoSetHash, err := chainhash.NewHashFromStr(parts[2])
+	if err != nil || len(parts[2]) == 0 {
+		return chaincfg.AssumeUtxo{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed utxo set hash",
+			assumeUtxo)
+	}
+	numUtxos, err := strconv.ParseUint(parts[3], 10, 64)
+	if err != nil {
+		return chaincfg.AssumeUtxo{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed number of outputs",
+			assumeUtxo)
+	}
+	chainTxCount, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		return chaincfg.AssumeUtxo{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed chain tx count",
+			assumeUtxo)
+	}
+
+	return chaincfg.AssumeUtxo{
+		Height:       int32(height),
+		BlockHash:    blockHash,
+		UtxoSetHash:  utxoSetHash,
+		NumUtxos:     numUtxos,
+		ChainTxCount: chainTxCount,
+	}, nil
+}
+
+// parseAssumeUtxos checks the utxo snapshot strings for valid syntax and
+// returns the utxo snapshots of the passed network parameters along with the
+// parsed ones, ordered from oldest to newest.  The network parameters are left
+// untouched.
+func parseAssumeUtxos(params *chaincfg.Params, assumeUtxoStrings []string) ([]chaincfg.AssumeUtxo, error) {
+	assumeUtxos := make([]chaincfg.AssumeUtxo, len(params.AssumeUtxos),
+		len(params.AssumeUtxos)+len(assumeUtxoStrings))
+	copy(assumeUtxos, params.AssumeUtxos)
+	for _, auString := range assumeUtxoStrings {
+		assumeUtxo, err := newAssumeUtxoFromStr(auString)
+		if err != nil {
+			return nil, err
+		}
+		assumeUtxos = append(assumeUtxos, assumeUtxo)
+	}
+	sort.SliceStable(assumeUtxos, func(i, j int) bool {
+		return assumeUtxos[i].Height < assumeUtxos[j].Height
+	})
+	return assumeUtxos, nil
+}
+
+// newDeploymentFromStr parses deployments in the
+// '<name>:<bit>:<start height>:<timeout height>[:<min activation height>]'
+// format.
+func newDeploymentFromStr(deployment string) (chaincfg.ConsensusDeployment, error) {
+	parts := strings.Split(deployment, ":")
+	if len(parts) != 4 && len(parts) != 5 {
+		return chaincfg.ConsensusDeployment{}, fmt.Errorf("unable to "+
+			"parse deployment %q -- use the syntax "+
+			"<name>:<bit>:<start height>:<timeout height>"+
+			"[:<min activation height>]", deployment)
+	}
+	if len(parts[0]) == 0 {
+		return chaincfg.ConsensusDeployment{}, fmt.Errorf("unable to "+
+			"parse deployment %q due to missing name", deployment)
+	}
+
+	// Version bits leave the top three bits of the block version to
+	// signal their use.
+	bit, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || bit >= 29 {
+		return chaincfg.ConsensusDeployment{}, fmt.Errorf("unable to "+
+			"parse deployment %q due to malformed bit", deployment)
+	}
+
+	var heights [3]int32
+	for i, part := range parts[2:] {
+		height, err := strconv.ParseInt(part, 10, 32)
+		if err != nil || height < 0 {
+			return chaincfg.ConsensusDeployment{}, fmt.Errorf(
+				"unable to parse deployment %q due to "+
+					"malformed height", deployment)
+		}
+		heights[i] = int32(height)
+	}
+	if heights[1] == 0 || heights[1] < heights[0] {
+		return chaincfg.ConsensusDeployment{}, fmt.Errorf("unable to "+
+			"parse deployment %q since it times out before it "+
+			"starts", deployment)
+	}
+
+	return chaincfg.ConsensusDeployment{
+		Name:                parts[0],
+		BitNumber:           uint8(bit),
+		StartHeight:         heights[0],
+		TimeoutHeight:       heights[1],
+		MinActivationHeight: heights[2],
+	}, nil
+}
+
+// parseDeployments checks the deployment strings for valid syntax and returns
+// the deployments of the passed network parameters with the parsed ones
+// replacing those with the same name and the others appended.  Deployments
+// which end up sharing a bit are rejected.
+func parseDeployments(params *chaincfg.Params, deploymentStrings []string) ([]chaincfg.ConsensusDeployment, error) {
+	deployments := make([]chaincfg.ConsensusDeployment,
+		len(params.Deployments), len(params.Deployments)+
+			len(deploymentStrings))
+	copy(deployments, params.Deployments)
+	for _, dString := range deploymentStrings {
+		deployment, err := newDeploymentFromStr(dString)
+		if err != nil {
+			return nil, err
+		}
+
+		replaced := false
+		for i := range deployments {
+			if deployments[i].Name == deployment.Name {
+				deployments[i] = deployment
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			deployments = append(deployments, deployment)
+		}
+	}
+
+	// Blocks can only signal each deployment apart from the others when
+	// they all use their own bit.
+	for i := range deployments {
+		for j := i + 1; j < len(deployments); j++ {
+			if deployments[i].BitNumber == deployments[j].BitNumber {
+				return nil, fmt.Errorf("deployments %q and %q "+
+					"both use bit %d", deployments[i].Name,
+					deployments[j].Name,
+					deployments[i].BitNumber)
+			}
+		}
+	}
+	return deployments, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -426,9 +612,12 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxSize:         defaultBlockMaxSize,
 		BlockMinWeight:       defaultBlockMinWeight,
 		BlockMaxWeight:       defaultBlockMaxWeight,
+		StratumDifficulty:    defaultStratumDifficulty,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		UtxoCacheMaxSizeMiB:  defaultUtxoCacheMaxSizeMiB,
+		ReorgWarnDepth:       defaultReorgWarnDepth,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
@@ -791,6 +980,15 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The utxo cache can't be disabled.
+	if cfg.UtxoCacheMaxSizeMiB == 0 {
+		str := "%s: The utxocachemaxsize option may not be 0"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max orphan count to a sane vlue.
 	if cfg.MaxOrphanTxs < 0 {
 		str := "%s: The maxorphantx option may not be less than 0 " +
@@ -867,6 +1065,80 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --statsindex and --dropstatsindex do not mix.
+	if cfg.StatsIndex && cfg.DropStatsIndex {
+		err := fmt.Errorf("%s: the --statsindex and --dropstatsindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --coinstatsindex and --dropcoinstatsindex do not mix.
+	if cfg.CoinStatsIndex && cfg.DropCoinStatsIndex {
+		err := fmt.Errorf("%s: the --coinstatsindex and "+
+			"--dropcoinstatsindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Pruning keeps at least the most recent block file, so don't allow
+	// targets which are smaller than a block file.
+	if cfg.Prune != 0 && cfg.Prune < minPruneTargetMiB {
+		err := fmt.Errorf("%s: the --prune option must be at least "+
+			"%d MiB -- parsed [%d]", funcName, minPruneTargetMiB,
+			cfg.Prune)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --txindex do not mix.
+	if cfg.Prune != 0 && cfg.TxIndex {
+		err := fmt.Errorf("%s: the --prune and --txindex options may "+
+			"not be activated at the same time because the "+
+			"transaction index requires all blocks to be stored",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --addrindex do not mix.
+	if cfg.Prune != 0 && cfg.AddrIndex {
+		err := fmt.Errorf("%s: the --prune and --addrindex options may "+
+			"not be activated at the same time because the address "+
+			"index requires all blocks to be stored", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --statsindex do not mix.
+	if cfg.Prune != 0 && cfg.StatsIndex {
+		err := fmt.Errorf("%s: the --prune and --statsindex options may "+
+			"not be activated at the same time because the block "+
+			"statistics index requires all blocks to be stored",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --coinstatsindex do not mix.
+	if cfg.Prune != 0 && cfg.CoinStatsIndex {
+		err := fmt.Errorf("%s: the --prune and --coinstatsindex options "+
+			"may not be activated at the same time because the utxo "+
+			"set statistics index requires all blocks to be stored",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]btcutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -899,6 +1171,93 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure there is at least one mining address when the Stratum server
+	// is enabled, and that its difficulty is valid.
+	if len(cfg.StratumListeners) > 0 && len(cfg.MiningAddrs) == 0 {
+		str := "%s: the stratumlisten option is set, but there are no " +
+			"mining addresses specified "
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.StratumDifficulty <= 0 {
+		str := "%s: the stratumdiff option must be positive -- " +
+			"parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StratumDifficulty)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the coinbase tag fits into the coinbase script.
+	if len(cfg.CoinbaseTag) > mining.MaxCoinbaseTagLen {
+		str := "%s: the coinbasetag option must not be longer than %d " +
+			"bytes -- parsed [%s]"
+		err := fmt.Errorf(str, funcName, mining.MaxCoinbaseTagLen,
+			cfg.CoinbaseTag)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Check the coinbase payouts are valid and leave a share for the
+	// mining addresses, and save parsed versions.
+	cfg.coinbasePayouts = make([]mining.CoinbasePayout, 0,
+		len(cfg.CoinbasePayouts))
+	totalShares := uint32(0)
+	for _, payout := range cfg.CoinbasePayouts {
+		sep := strings.LastIndex(payout, ":")
+		if sep < 0 {
+			str := "%s: coinbase payout '%s' is not of the form " +
+				"<address>:<percent>"
+			err := fmt.Errorf(str, funcName, payout)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		strAddr, strPercent := payout[:sep], payout[sep+1:]
+		addr, err := btcutil.DecodeAddress(strAddr, activeNetParams.Params)
+		if err != nil {
+			str := "%s: coinbase payout address '%s' failed to " +
+				"decode: %v"
+			err := fmt.Errorf(str, funcName, strAddr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if !addr.IsForNet(activeNetParams.Params) {
+			str := "%s: coinbase payout address '%s' is on the " +
+				"wrong network"
+			err := fmt.Errorf(str, funcName, strAddr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		percent, err := strconv.ParseFloat(strPercent, 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			str := "%s: coinbase payout percentage '%s' is not " +
+				"between 0 and 100"
+			err := fmt.Errorf(str, funcName, strPercent)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		share := uint32(percent*mining.CoinbaseShares/100 + 0.5)
+		totalShares += share
+		if share == 0 || totalShares >= mining.CoinbaseShares {
+			str := "%s: the coinbase payouts must each be at " +
+				"least %v%% and add up to less than 100%%"
+			err := fmt.Errorf(str, funcName,
+				100.0/mining.CoinbaseShares)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.coinbasePayouts = append(cfg.coinbasePayouts,
+			mining.CoinbasePayout{Address: addr, Share: share})
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
@@ -909,6 +1268,11 @@ func loadConfig() (*config, []string, error) {
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
 		activeNetParams.rpcPort)
 
+	// Add default port to all Stratum listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.StratumListeners = normalizeAddresses(cfg.StratumListeners,
+		defaultStratumPort)
+
 	// Only allow TLS to be disabled if the RPC is bound to localhost
 	// addresses.
 	if !cfg.DisableRPC && cfg.DisableTLS {
@@ -965,6 +1329,74 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Override or add the deployments of the test networks.  The active
+	// network parameters are copied so the ones of the chaincfg package
+	// are left untouched.
+	if len(cfg.Deployments) > 0 {
+		if !(cfg.RegressionTest || cfg.SimNet) {
+			str := "%s: The deployment option can only be used " +
+				"with the regression and simulation test networks"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		deployments, err := parseDeployments(activeNetParams.Params,
+			cfg.Deployments)
+		if err != nil {
+			str := "%s: Error parsing deployments: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		netParams := *activeNetParams.Params
+		netParams.Deployments = deployments
+		activeNetParams = &params{
+			Params:  &netParams,
+			rpcPort: activeNetParams.rpcPort,
+		}
+	}
+
+	// Add the utxo snapshots which may be loaded.  The active network
+	// parameters are copied as for the deployments.
+	if len(cfg.AddAssumeUtxos) > 0 {
+		assumeUtxos, err := parseAssumeUtxos(activeNetParams.Params,
+			cfg.AddAssumeUtxos)
+		if err != nil {
+			str := "%s: Error parsing utxo snapshots: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		netParams := *activeNetParams.Params
+		netParams.AssumeUtxos = assumeUtxos
+		activeNetParams = &params{
+			Params:  &netParams,
+			rpcPort: activeNetParams.rpcPort,
+		}
+	}
+
+	// Parse the assume-valid block hash.  The built-in block of the active
+	// network is used unless one is specified, and 0 disables it.  None of
+	// the networks have a built-in block yet, so all scripts are checked by
+	// default.
+	switch cfg.AssumeValid {
+	case "":
+		cfg.assumeValid = activeNetParams.AssumeValid
+	case "0":
+	default:
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"runtime"
 	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 var (
@@ -70,3 +72,120 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestParseDeployments ensures deployments given on the command line override
+// those of the network with the same name, are appended otherwise, and are
+// rejected when malformed.
+func TestParseDeployments(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	deployments, err := parseDeployments(params, []string{
+		"csv:0:144:432", "claimrules:12:0:1000:500",
+	})
+	if err != nil {
+		t.Fatalf("parseDeployments: unexpected error: %v", err)
+	}
+	if len(deployments) != len(params.Deployments)+1 {
+		t.Fatalf("parseDeployments: got %d deployments, want %d",
+			len(deployments), len(params.Deployments)+1)
+	}
+	csv := deployments[chaincfg.DeploymentCSV]
+	if csv.Name != "csv" || !csv.HeightBased() || csv.StartHeight != 144 ||
+		csv.TimeoutHeight != 432 {
+
+		t.Errorf("parseDeployments: unexpected csv deployment %+v", csv)
+	}
+	if params.Deployments[chaincfg.DeploymentCSV].HeightBased() {
+		t.Error("parseDeployments: changed the network parameters")
+	}
+	added := deployments[len(deployments)-1]
+	if added.Name != "claimrules" || added.BitNumber != 12 ||
+		added.TimeoutHeight != 1000 || added.MinActivationHeight != 500 {
+
+		t.Errorf("parseDeployments: unexpected added deployment %+v",
+			added)
+	}
+
+	for _, malformed := range []string{
+		"csv", "csv:0:144", "csv:0:144:432:500:1", ":0:144:432",
+		"csv:29:144:432", "csv:x:144:432", "csv:0:-1:432",
+		"csv:0:144:0", "csv:0:432:144",
+	} {
+		_, err := parseDeployments(params, []string{malformed})
+		if err == nil {
+			t.Errorf("parseDeployments(%q): no error", malformed)
+		}
+	}
+
+	// Each deployment must use its own bit.
+	for _, conflicting := range [][]string{
+		{"claimrules:0:0:1000"},
+		{"claimrules:1:0:1000"},
+		{"claimrules:28:0:1000"},
+		{"csv:1:144:432"},
+		{"claimrules:12:0:1000", "other:12:0:1000"},
+	} {
+		_, err := parseDeployments(params, conflicting)
+		if err == nil {
+			t.Errorf("parseDeployments(%q): no error", conflicting)
+		}
+	}
+
+	// A deployment may move to another bit, which frees its old one.
+	_, err = parseDeployments(params, []string{
+		"csv:2:144:432", "claimrules:0:0:1000",
+	})
+	if err != nil {
+		t.Errorf("parseDeployments: unexpected error: %v", err)
+	}
+}
+
+// TestParseAssumeUtxos ensures utxo snapshots given on the command line are
+// added to those of the network in the order of their heights, and are
+// rejected when malformed.
+func TestParseAssumeUtxos(t *testing.T) {
+	const (
+		blockHash   = "4c1bfc4f2a4ef2fd1b2f71ac72ff35e2d2d3a4ab0e8b2e1e7c5f9b4e6a3b2c1d"
+		utxoSetHash = "9a0e8f3d5c2b1a4e7f6d8c9b0a1e2f3d4c5b6a7e8f9d0c1b2a3e4f5d6c7b8a9e"
+	)
+	params := chaincfg.RegressionNetParams
+	params.AssumeUtxos = []chaincfg.AssumeUtxo{{Height: 200}}
+	assumeUtxos, err := parseAssumeUtxos(&params, []string{
+		"300:" + blockHash + ":" + utxoSetHash + ":1000:2000",
+		"100:" + blockHash + ":" + utxoSetHash + ":10:20",
+	})
+	if err != nil {
+		t.Fatalf("parseAssumeUtxos: unexpected error: %v", err)
+	}
+	if len(assumeUtxos) != 3 || assumeUtxos[0].Height != 100 ||
+		assumeUtxos[1].Height != 200 || assumeUtxos[2].Height != 300 {
+
+		t.Fatalf("parseAssumeUtxos: unexpected utxo snapshots %+v",
+			assumeUtxos)
+	}
+	added := assumeUtxos[2]
+	if added.BlockHash.String() != blockHash ||
+		added.UtxoSetHash.String() != utxoSetHash ||
+		added.NumUtxos != 1000 || added.ChainTxCount != 2000 {
+
+		t.Errorf("parseAssumeUtxos: unexpected added utxo snapshot %+v",
+			added)
+	}
+	if len(params.AssumeUtxos) != 1 {
+		t.Error("parseAssumeUtxos: changed the network parameters")
+	}
+
+	for _, malformed := range []string{
+		"300", "300:" + blockHash + ":" + utxoSetHash + ":1000",
+		"x:" + blockHash + ":" + utxoSetHash + ":1000:2000",
+		"0:" + blockHash + ":" + utxoSetHash + ":1000:2000",
+		"300::" + utxoSetHash + ":1000:2000",
+		"300:" + blockHash + ":xyz:1000:2000",
+		"300:" + blockHash + ":" + utxoSetHash + ":-1:2000",
+		"300:" + blockHash + ":" + utxoSetHash + ":1000:x",
+	} {
+		_, err := parseAssumeUtxos(&params, []string{malformed})
+		if err == nil {
+			t.Errorf("parseAssumeUtxos(%q): no error", malformed)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// exportClaimTrieCmd defines the configuration options for the exportclaimtrie
+// command.
+type exportClaimTrieCmd struct {
+	Height int32 `long:"height" description:"Height of the block to export the claimtrie at (default: the best block)"`
+}
+
+// importClaimTrieCmd defines the configuration options for the importclaimtrie
+// command.
+type importClaimTrieCmd struct{}
+
+var (
+	// exportClaimTrieCfg defines the configuration options for the command.
+	exportClaimTrieCfg = exportClaimTrieCmd{
+		Height: -1,
+	}
+
+	// importClaimTrieCfg defines the configuration options for the command.
+	importClaimTrieCfg = importClaimTrieCmd{}
+)
+
+// loadBlockChain opens the block database and loads the chain state, including
+// the claimtrie, from it.  The returned function must be called to save the
+// utxo cache and the claimtrie and close the database.
+func loadBlockChain() (*blockchain.BlockChain, func(), error) {
+	db, err := loadBlockDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: activeNetParams,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if chain.ClaimTrie() == nil {
+		db.Close()
+		return nil, nil, errors.New("unable to open the claimtrie")
+	}
+
+	cleanup := func() {
+		if err := chain.FlushUtxoCache(); err != nil {
+			log.Errorf("Unable to flush the utxo cache: %v", err)
+		}
+		if err := chain.ClaimTrie().Close(); err != nil {
+			log.Errorf("Unable to save the claimtrie: %v", err)
+		}
+		db.Close()
+	}
+	return chain, cleanup, nil
+}
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *exportClaimTrieCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("required snapshot file parameter not specified")
+	}
+
+	chain, cleanup, err := loadBlockChain()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	height := cmd.Height
+	if height < 0 {
+		height = chain.BestSnapshot().Height
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	log.Infof("Exporting claimtrie at height %d to %s", height, args[0])
+	startTime := time.Now()
+	hdr, err := chain.ExportClaimTrie(w, height)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(args[0])
+		return err
+	}
+	log.Infof("Exported claimtrie in %v (block %v, root %v)",
+		time.Since(startTime), hdr.BlockHash, hdr.MerkleRoot)
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *exportClaimTrieCmd) Usage() string {
+	return "<snapshot-file>"
+}
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *importClaimTrieCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("required snapshot file parameter not specified")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chain, cleanup, err := loadBlockChain()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	log.Infof("Importing claimtrie from %s", args[0])
+	startTime := time.Now()
+	hdr, err := chain.ImportClaimTrie(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	log.Infof("Imported claimtrie at height %d in %v (block %v, root %v)",
+		hdr.Height, time.Since(startTime), hdr.BlockHash, hdr.MerkleRoot)
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *importClaimTrieCmd) Usage() string {
+	return "<snapshot-file>"
+}
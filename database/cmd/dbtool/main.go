@@ -89,6 +89,16 @@ func realMain() error {
 	parser.AddCommand("fetchblockregion",
 		"Fetch the specified block region from the database", "",
 		&blockRegionCfg)
+	parser.AddCommand("exportclaimtrie",
+		"Export a snapshot of the claimtrie to a file",
+		"Export a snapshot of the claimtrie at a block of the main "+
+			"chain to a file.", &exportClaimTrieCfg)
+	parser.AddCommand("importclaimtrie",
+		"Replace the claimtrie with a snapshot read from a file",
+		"Replace the claimtrie with a snapshot read from a file.  The "+
+			"snapshot is refused unless its block is in the main "+
+			"chain and the rebuilt claimtrie root matches the header "+
+			"of that block.", &importClaimTrieCfg)
 
 	// Parse command line and invoke the Execute function for the specified
 	// command.
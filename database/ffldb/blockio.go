@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
@@ -307,6 +308,29 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// closeFile closes the block file for the passed flat file number when it is
+// open for reads.  It waits for any readers of the file to finish first.
+func (s *blockStore) closeFile(fileNum uint32) {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+
+	blockFile, ok := s.openBlockFiles[fileNum]
+	if !ok {
+		return
+	}
+
+	s.lruMutex.Lock()
+	s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+	delete(s.fileNumToLRUElem, fileNum)
+	s.lruMutex.Unlock()
+
+	blockFile.Lock()
+	_ = blockFile.file.Close()
+	blockFile.Unlock()
+
+	delete(s.openBlockFiles, fileNum)
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -712,6 +736,30 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// firstBlockFile returns the number of the oldest flat block file in the
+// database directory.  It is only non-zero when the oldest files have been
+// deleted by pruning.
+func firstBlockFile(dbPath string) uint32 {
+	paths, err := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	if err != nil {
+		return 0
+	}
+
+	first := uint32(math.MaxUint32)
+	for _, path := range paths {
+		var fileNum uint32
+		_, err := fmt.Sscanf(filepath.Base(path), blockFilenameTemplate,
+			&fileNum)
+		if err == nil && fileNum < first {
+			first = fileNum
+		}
+	}
+	if first == math.MaxUint32 {
+		return 0
+	}
+	return first
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
 // find the end of the most recent file.  This position is considered the
 // current write cursor which is also stored in the metadata.  Thus, it is used
@@ -720,7 +768,7 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 func scanBlockFiles(dbPath string) (int, uint32) {
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	for i := int(firstBlockFile(dbPath)); ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
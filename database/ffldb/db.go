@@ -74,6 +74,10 @@ var (
 	// writeLocKeyName is the key used to store the current write file
 	// location.
 	writeLocKeyName = []byte("ffldb-writeloc")
+
+	// prunedKeyName is the key used to flag that block files have been
+	// deleted by pruning.
+	prunedKeyName = []byte("ffldb-pruned")
 )
 
 // Common error strings.
@@ -1898,6 +1902,124 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// PruneBlocks deletes the oldest flat block files until the total size of the
+// block files is no larger than the target size in bytes.  Since blocks are
+// deleted a whole file at a time, pruning stops at the first file which houses
+// a block the keep function returns true for.  The file currently being
+// written to is never deleted.  The hashes of the deleted blocks are returned.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) PruneBlocks(targetSize uint64, keep func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error) {
+	store := db.store
+	var pruned []chainhash.Hash
+	var deleted []uint32
+	err := db.Update(func(dbTx database.Tx) error {
+		tx := dbTx.(*transaction)
+
+		// No blocks can be written while the write transaction is
+		// held, so the current write file can't change.
+		wc := store.writeCursor
+		wc.RLock()
+		curFileNum := wc.curFileNum
+		wc.RUnlock()
+
+		// Determine the total size of the block files.
+		first := firstBlockFile(store.basePath)
+		fileSizes := make(map[uint32]uint64)
+		var totalSize uint64
+		for fileNum := first; fileNum <= curFileNum; fileNum++ {
+			st, err := os.Stat(blockFilePath(store.basePath, fileNum))
+			if err != nil {
+				continue
+			}
+			fileSizes[fileNum] = uint64(st.Size())
+			totalSize += uint64(st.Size())
+		}
+		if totalSize <= targetSize {
+			return nil
+		}
+
+		// Group the blocks by the file they are stored in.
+		blocksByFile := make(map[uint32][]chainhash.Hash)
+		cursor := tx.blockIdxBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			loc := deserializeBlockLoc(cursor.Value())
+			if loc.blockFileNum >= curFileNum {
+				continue
+			}
+
+			var hash chainhash.Hash
+			copy(hash[:], cursor.Key())
+			blocksByFile[loc.blockFileNum] = append(
+				blocksByFile[loc.blockFileNum], hash)
+		}
+
+		// Remove the blocks of the oldest files from the block index
+		// until enough space is freed.
+	prune:
+		for fileNum := first; fileNum < curFileNum; fileNum++ {
+			if totalSize <= targetSize {
+				break
+			}
+
+			hashes := blocksByFile[fileNum]
+			for i := range hashes {
+				if keep(&hashes[i]) {
+					break prune
+				}
+			}
+			for i := range hashes {
+				err := tx.blockIdxBucket.Delete(hashes[i][:])
+				if err != nil {
+					return err
+				}
+			}
+
+			pruned = append(pruned, hashes...)
+			deleted = append(deleted, fileNum)
+			totalSize -= fileSizes[fileNum]
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		return tx.metaBucket.Put(prunedKeyName, []byte{1})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete the files once the blocks they house are no longer referenced
+	// by the block index.  A failure here only leaves unused files behind
+	// which are deleted by the next prune.
+	for _, fileNum := range deleted {
+		store.closeFile(fileNum)
+		if err := store.deleteFileFunc(fileNum); err != nil {
+			log.Warnf("Failed to delete pruned block file %d: %v",
+				fileNum, err)
+		}
+	}
+	if len(deleted) > 0 {
+		log.Debugf("Pruned block files %d through %d (%d blocks)",
+			deleted[0], deleted[len(deleted)-1], len(pruned))
+	}
+
+	return pruned, nil
+}
+
+// BeenPruned returns whether any block files have ever been deleted by
+// PruneBlocks.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) BeenPruned() (bool, error) {
+	var pruned bool
+	err := db.View(func(tx database.Tx) error {
+		pruned = tx.Metadata().Get(prunedKeyName) != nil
+		return nil
+	})
+	return pruned, err
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
@@ -0,0 +1,171 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// storeTestBlocks stores the distinct blocks identified by the nonces from
+// first up to, but not including, end in the database, one per flat file, and
+// returns them.
+func storeTestBlocks(t *testing.T, pdb database.DB, first, end int) []*btcutil.Block {
+	var blocks []*btcutil.Block
+	for i := first; i < end; i++ {
+		msgBlock := &wire.MsgBlock{Header: wire.BlockHeader{Nonce: uint32(i)}}
+		blocks = append(blocks, btcutil.NewBlock(msgBlock))
+	}
+
+	// Every block takes 12 bytes in addition to its serialized size.
+	rawBlock, err := blocks[0].Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	pdb.(*db).store.maxBlockFileSize = uint32(len(rawBlock) + 12)
+
+	for _, block := range blocks {
+		err := pdb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: %v", err)
+		}
+	}
+	return blocks
+}
+
+// hasBlock returns whether the block is stored in the database, and checks it
+// can be fetched if so.
+func hasBlock(t *testing.T, pdb database.DB, block *btcutil.Block) bool {
+	var has bool
+	err := pdb.View(func(tx database.Tx) error {
+		var err error
+		if has, err = tx.HasBlock(block.Hash()); err != nil {
+			return err
+		}
+		_, err = tx.FetchBlock(block.Hash())
+		if has && err != nil {
+			t.Errorf("FetchBlock(%v): %v", block.Hash(), err)
+		}
+		if dbErr, ok := err.(database.Error); !has &&
+			(!ok || dbErr.ErrorCode != database.ErrBlockNotFound) {
+
+			t.Errorf("FetchBlock(%v) of pruned block: unexpected "+
+				"error %v", block.Hash(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	return has
+}
+
+// TestPruneBlocks ensures the oldest block files are deleted until the target
+// size is met, the files housing blocks which must be kept and the current
+// write file are never deleted, and the state survives reopening the database.
+func TestPruneBlocks(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "ffldb-prune")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	pdb, err := database.Create(dbType, dbPath, wire.SimNet)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer func() { pdb.Close() }()
+
+	blocks := storeTestBlocks(t, pdb, 0, 5)
+	fileSize := uint64(pdb.(*db).store.maxBlockFileSize)
+	if pruned, err := pdb.BeenPruned(); err != nil || pruned {
+		t.Fatalf("BeenPruned: got %v, %v before pruning", pruned, err)
+	}
+
+	// Nothing is pruned while the files fit in the target.
+	pruned, err := pdb.PruneBlocks(5*fileSize, func(*chainhash.Hash) bool {
+		return false
+	})
+	if err != nil || len(pruned) != 0 {
+		t.Fatalf("PruneBlocks: pruned %v, %v below the target", pruned,
+			err)
+	}
+
+	// Pruning stops at the file of the block which must be kept.
+	keep := func(hash *chainhash.Hash) bool {
+		return *hash == *blocks[2].Hash()
+	}
+	pruned, err = pdb.PruneBlocks(0, keep)
+	if err != nil {
+		t.Fatalf("PruneBlocks: %v", err)
+	}
+	if len(pruned) != 2 || pruned[0] != *blocks[0].Hash() ||
+		pruned[1] != *blocks[1].Hash() {
+
+		t.Fatalf("PruneBlocks: pruned %v instead of the first two "+
+			"blocks", pruned)
+	}
+	for fileNum := uint32(0); fileNum < 5; fileNum++ {
+		_, err := os.Stat(blockFilePath(dbPath, fileNum))
+		if exists := err == nil; exists != (fileNum >= 2) {
+			t.Fatalf("block file %d exists: %v", fileNum, exists)
+		}
+	}
+	if first := firstBlockFile(dbPath); first != 2 {
+		t.Fatalf("firstBlockFile: got %d, want 2", first)
+	}
+	if pruned, err := pdb.BeenPruned(); err != nil || !pruned {
+		t.Fatalf("BeenPruned: got %v, %v after pruning", pruned, err)
+	}
+	for i, block := range blocks {
+		if has := hasBlock(t, pdb, block); has != (i >= 2) {
+			t.Fatalf("block %d stored: %v", i, has)
+		}
+	}
+
+	// The current write file is never deleted.
+	pruned, err = pdb.PruneBlocks(0, func(*chainhash.Hash) bool {
+		return false
+	})
+	if err != nil || len(pruned) != 2 {
+		t.Fatalf("PruneBlocks: pruned %v, %v", pruned, err)
+	}
+	if first := firstBlockFile(dbPath); first != 4 {
+		t.Fatalf("firstBlockFile: got %d, want 4", first)
+	}
+	if !hasBlock(t, pdb, blocks[4]) {
+		t.Fatalf("block of the current write file was pruned")
+	}
+
+	// The database is reopened with the remaining files, and new blocks
+	// are written after them.
+	if err := pdb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	pdb, err = database.Open(dbType, dbPath, wire.SimNet)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if pruned, err := pdb.BeenPruned(); err != nil || !pruned {
+		t.Fatalf("BeenPruned: got %v, %v after reopening", pruned, err)
+	}
+	more := storeTestBlocks(t, pdb, 5, 7)
+	for _, block := range append(more, blocks[4]) {
+		if !hasBlock(t, pdb, block) {
+			t.Fatalf("block %v not stored after reopening",
+				block.Hash())
+		}
+	}
+	if _, err := os.Stat(blockFilePath(dbPath, 6)); err != nil {
+		t.Fatalf("block file 6 not written: %v", err)
+	}
+}
@@ -459,6 +459,20 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// PruneBlocks deletes the stored blocks, oldest first, until the total
+	// size of the stored blocks is no larger than the target size in
+	// bytes.  Implementations may delete blocks in groups, such as whole
+	// files, and must stop before deleting any block the keep function
+	// returns true for.  The hashes of the deleted blocks are returned.
+	//
+	// Deleted blocks are treated as if they were never stored, so
+	// attempting to fetch one will return ErrBlockNotFound.
+	PruneBlocks(targetSize uint64, keep func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error)
+
+	// BeenPruned returns whether any blocks have ever been deleted by
+	// PruneBlocks.
+	BeenPruned() (bool, error)
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
@@ -77,8 +77,22 @@ Application Options:
       --regtest             Use the regression test network
       --simnet              Use the simulation test network
       --addcheckpoint=      Add a custom checkpoint.  Format: '<height>:<hash>'
+      --addassumeutxo=      Add a utxo snapshot which may be loaded with
+                            loadtxoutset, as reported by dumptxoutset.  No
+                            network has built-in snapshots yet, so loadtxoutset
+                            refuses all others.  Format: '<height>:<block hash>:
+                            <utxo set hash>:<num outputs>:<chain tx count>'
+      --deployment=         Override or add a version bits deployment on the
+                            regression and simulation test networks.  Format:
+                            '<name>:<bit>:<start height>:<timeout height>
+                            [:<min activation height>]'
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
+      --assumevalid=        Skip the script checks of the specified block and its
+                            ancestors once it is buried deep enough in the best
+                            header chain (0 checks all scripts, which is also
+                            the default since no network has a built-in block
+                            yet)
       --uacomment=          Comment to add to the user agent --
                             See BIP 14 for more information.
       --dbtype=             Database backend to use for the Block Chain (ffldb)
@@ -103,8 +117,21 @@ Application Options:
       --generate            Generate (mine) bitcoins using the CPU
       --miningaddr=         Add the specified payment address to the list of
                             addresses to use for generated blocks -- At least
-                            one address is required if the generate option is
-                            set
+                            one address is required if the generate or
+                            stratumlisten options are set
+      --stratumlisten=      Add an interface/port to listen for Stratum
+                            connections of miners (default port: 3334)
+      --stratumdiff=        Initial and minimum difficulty of the shares of
+                            Stratum miners (1)
+      --coinbasetag=        Text to add to the coinbase script of generated
+                            blocks
+      --coinbasepayout=     Pay the specified percentage of the value of
+                            generated blocks to an address given as
+                            <address>:<percent>, while the rest is paid to a
+                            mining address
+      --witnesscommitment   Add a witness commitment to the coinbase of
+                            generated blocks once segwit is active, even when
+                            they have no transactions with witness data
       --blockminsize=       Mininum block size in bytes to be used when creating
                             a block
       --blockmaxsize=       Maximum block size in bytes to be used when creating
@@ -115,6 +142,14 @@ Application Options:
       --nocfilters          Disable committed filtering (CF) support.
       --sigcachemaxsize=    The maximum number of entries in the signature
                             verification cache.
+      --utxocachemaxsize=   The maximum size in MiB of the UTXO cache (250)
+      --prune=              Delete old blocks to keep the stored blocks below the
+                            specified size in MiB (minimum 550, 0 disables
+                            pruning) -- Incompatible with --txindex,
+                            --addrindex, --statsindex and --coinstatsindex
+      --reorgwarndepth=     Log reorganizations of the main chain which
+                            disconnect more than the specified number of blocks
+                            as warnings (6)
       --blocksonly          Do not accept transactions from remote peers.
       --relaynonstd         Relay non-standard transactions regardless of the
                             default settings for the active network.
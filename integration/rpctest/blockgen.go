@@ -19,10 +19,10 @@ import (
 	"github.com/btcsuite/btcutil"
 )
 
-// solveBlock attempts to find a nonce which makes the passed block header hash
-// to a value less than the target difficulty. When a successful solution is
-// found true is returned and the nonce field of the passed header is updated
-// with the solution. False is returned if no solution exists.
+// solveBlock attempts to find a nonce which makes the LBRY proof of work hash of
+// the passed block header less than the target difficulty. When a successful
+// solution is found true is returned and the nonce field of the passed header
+// is updated with the solution. False is returned if no solution exists.
 func solveBlock(header *wire.BlockHeader, targetDifficulty *big.Int) bool {
 	// sbResult is used by the solver goroutines to send results.
 	type sbResult struct {
@@ -43,7 +43,7 @@ func solveBlock(header *wire.BlockHeader, targetDifficulty *big.Int) bool {
 				return
 			default:
 				hdr.Nonce = i
-				hash := hdr.BlockHash()
+				hash := hdr.BlockPoWHash()
 				if blockchain.HashToBig(&hash).Cmp(targetDifficulty) <= 0 {
 					select {
 					case results <- sbResult{true, i}:
@@ -132,6 +132,10 @@ func createCoinbaseTx(coinbaseScript []byte, nextBlockHeight int32,
 // initialized), then the timestamp of the previous block will be used plus 1
 // second is used. Passing nil for the previous block results in a block that
 // builds off of the genesis block for the specified chain.
+//
+// The block commits to the ClaimTrie root of the previous block, so the
+// included transactions must not create or spend claims, and no claims may
+// change at its height.
 func CreateBlock(prevBlock *btcutil.Block, inclusionTxs []*btcutil.Tx,
 	blockVersion int32, blockTime time.Time, miningAddr btcutil.Address,
 	mineTo []wire.TxOut, net *chaincfg.Params) (*btcutil.Block, error) {
@@ -140,6 +144,7 @@ func CreateBlock(prevBlock *btcutil.Block, inclusionTxs []*btcutil.Tx,
 		prevHash      *chainhash.Hash
 		blockHeight   int32
 		prevBlockTime time.Time
+		claimTrieRoot chainhash.Hash
 	)
 
 	// If the previous block isn't specified, then we'll construct a block
@@ -148,10 +153,12 @@ func CreateBlock(prevBlock *btcutil.Block, inclusionTxs []*btcutil.Tx,
 		prevHash = net.GenesisHash
 		blockHeight = 1
 		prevBlockTime = net.GenesisBlock.Header.Timestamp.Add(time.Minute)
+		claimTrieRoot = net.GenesisBlock.Header.ClaimTrie
 	} else {
 		prevHash = prevBlock.Hash()
 		blockHeight = prevBlock.Height() + 1
 		prevBlockTime = prevBlock.MsgBlock().Header.Timestamp
+		claimTrieRoot = prevBlock.MsgBlock().Header.ClaimTrie
 	}
 
 	// If a target block time was specified, then use that as the header's
@@ -187,6 +194,7 @@ func CreateBlock(prevBlock *btcutil.Block, inclusionTxs []*btcutil.Tx,
 		Version:    blockVersion,
 		PrevBlock:  *prevHash,
 		MerkleRoot: *merkles[len(merkles)-1],
+		ClaimTrie:  claimTrieRoot,
 		Timestamp:  ts,
 		Bits:       net.PowLimitBits,
 	}
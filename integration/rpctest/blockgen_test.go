@@ -0,0 +1,84 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestCreateBlock ensures the blocks created by CreateBlock satisfy the LBRY
+// proof of work and are accepted by a chain.
+func TestCreateBlock(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	dbPath, err := ioutil.TempDir("", "rpctestblockgen")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		t.Fatalf("unable to create claimtrie: %v", err)
+	}
+	defer ct.Close()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+		ClaimTrie:   ct,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+
+	// The regression test target accepts about half of all hashes, so
+	// blocks solved against any other hash are rejected quickly.
+	const numBlocks = 20
+	var prevBlock *btcutil.Block
+	for height := int32(1); height <= numBlocks; height++ {
+		block, err := CreateBlock(prevBlock, nil, BlockVersion,
+			time.Time{}, addr, nil, &params)
+		if err != nil {
+			t.Fatalf("CreateBlock(%d): %v", height, err)
+		}
+		err = blockchain.CheckProofOfWork(block, params.PowLimit)
+		if err != nil {
+			t.Fatalf("block at height %d: %v", height, err)
+		}
+		_, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock(%d): %v", height, err)
+		}
+		if isOrphan {
+			t.Fatalf("ProcessBlock(%d): block is an orphan", height)
+		}
+		prevBlock = block
+	}
+	if best := chain.BestSnapshot(); best.Height != numBlocks {
+		t.Fatalf("best chain height %d instead of %d", best.Height,
+			numBlocks)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// feeDeltasSaveVersion is the version of the serialized fee deltas.
+const feeDeltasSaveVersion = 1
+
+var (
+	// FeeDeltasDatabaseKey is the key the fee deltas of the transactions
+	// prioritised via PrioritiseTransaction are stored with in the
+	// database.
+	FeeDeltasDatabaseKey = []byte("feedeltas")
+)
+
+// PrioritiseTransaction adds the passed fee delta in Satoshi to the fee delta of
+// the transaction with the passed hash, which doesn't have to be in the pool.
+// A positive delta makes the transaction more likely to be selected for a block
+// template and a negative one less likely, while it also counts towards the fee
+// when the transaction is replaced or replaces others.  The fee delta remains
+// until the transaction is included in a block.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(hash *chainhash.Hash, feeDelta int64) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.feeDeltas[*hash] += feeDelta
+	if mp.feeDeltas[*hash] == 0 {
+		delete(mp.feeDeltas, *hash)
+	}
+	log.Debugf("Fee delta of transaction %v changed by %d to %d", hash,
+		feeDelta, mp.feeDeltas[*hash])
+
+	// Update the fee totals of the transaction along with its ancestors
+	// and descendants when it is in the pool.
+	txD, ok := mp.pool[*hash]
+	if !ok || feeDelta == 0 {
+		return
+	}
+	txD.FeeDelta += feeDelta
+	txD.AncestorFee += feeDelta
+	txD.DescendantFee += feeDelta
+	for ancestorHash := range mp.txAncestors(txD.Tx, nil) {
+		mp.pool[ancestorHash].DescendantFee += feeDelta
+	}
+	for descendantHash := range mp.txDescendants(txD.Tx, nil) {
+		mp.pool[descendantHash].AncestorFee += feeDelta
+	}
+	mp.setLastUpdated()
+}
+
+// ClearPrioritisation removes the fee delta of the transaction with the passed
+// hash.  It is called once the transaction was included in a block, and it
+// must not be in the pool anymore.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ClearPrioritisation(hash *chainhash.Hash) {
+	mp.mtx.Lock()
+	delete(mp.feeDeltas, *hash)
+	mp.mtx.Unlock()
+}
+
+// FeeDelta returns the fee delta of the transaction with the passed hash.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FeeDelta(hash *chainhash.Hash) int64 {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	return mp.feeDeltas[*hash]
+}
+
+// SaveFeeDeltas returns the serialized fee deltas of the pool, which can be
+// restored with RestoreFeeDeltas.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) SaveFeeDeltas() []byte {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	w := bytes.NewBuffer(make([]byte, 0, 8+len(mp.feeDeltas)*
+		(chainhash.HashSize+8)))
+	binary.Write(w, binary.BigEndian, uint32(feeDeltasSaveVersion))
+	binary.Write(w, binary.BigEndian, uint32(len(mp.feeDeltas)))
+	for hash, feeDelta := range mp.feeDeltas {
+		w.Write(hash[:])
+		binary.Write(w, binary.BigEndian, feeDelta)
+	}
+	return w.Bytes()
+}
+
+// RestoreFeeDeltas adds the fee deltas serialized by SaveFeeDeltas to the ones
+// of the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RestoreFeeDeltas(data []byte) error {
+	r := bytes.NewReader(data)
+	var version, count uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return err
+	}
+	if version != feeDeltasSaveVersion {
+		return fmt.Errorf("unknown fee deltas version %d", version)
+	}
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if uint64(count)*(chainhash.HashSize+8) != uint64(r.Len()) {
+		return fmt.Errorf("fee deltas of %d bytes don't match the "+
+			"count of %d", r.Len(), count)
+	}
+
+	feeDeltas := make(map[chainhash.Hash]int64, count)
+	for i := uint32(0); i < count; i++ {
+		var hash chainhash.Hash
+		var feeDelta int64
+		r.Read(hash[:])
+		binary.Read(r, binary.BigEndian, &feeDelta)
+		feeDeltas[hash] += feeDelta
+	}
+
+	for hash, feeDelta := range feeDeltas {
+		mp.PrioritiseTransaction(&hash, feeDelta)
+	}
+	return nil
+}
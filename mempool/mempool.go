@@ -174,7 +174,7 @@ type orphanTx struct {
 // peers.
 type TxPool struct {
 	// The following variables must only be used atomically.
-	lastUpdated int64 // last time pool was updated
+	lastUpdated int64 // last time pool was updated in nanoseconds
 
 	mtx           sync.RWMutex
 	cfg           Config
@@ -185,6 +185,10 @@ type TxPool struct {
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 
+	// feeDeltas holds the fee deltas set via PrioritiseTransaction by the
+	// hash of the transactions, which don't have to be in the pool.
+	feeDeltas map[chainhash.Hash]int64
+
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
 	// the scan will only run when an orphan is added to the pool as opposed
@@ -486,12 +490,84 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
 
-		// Mark the referenced outpoints as unspent by the pool.
+		// Mark the referenced outpoints as unspent by the pool, and
+		// update the totals of the related transactions.
+		ancestors := mp.txAncestors(tx, nil)
+		descendants := mp.txDescendants(tx, nil)
 		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
-		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+		mp.unlinkTransaction(txDesc, ancestors, descendants)
+		mp.setLastUpdated()
+	}
+}
+
+// linkStats adds the fee and size of the passed ancestor to the ancestor totals
+// of the passed descendant, and the ones of the descendant to the descendant
+// totals of the ancestor.  A negative sign removes them instead.
+func linkStats(ancestor, descendant *TxDesc, sign int64) {
+	descendant.AncestorFee += sign * ancestor.ModifiedFee()
+	descendant.AncestorSize += sign * GetTxVirtualSize(ancestor.Tx)
+	descendant.AncestorCount += int(sign)
+	ancestor.DescendantFee += sign * descendant.ModifiedFee()
+	ancestor.DescendantSize += sign * GetTxVirtualSize(descendant.Tx)
+	ancestor.DescendantCount += int(sign)
+}
+
+// linkTransaction updates the ancestor and descendant totals of the pool for
+// the passed transaction which was just added to it.  The ancestors and
+// descendants are the ones of the transaction, and oldAncestors the ancestors
+// of each descendant before the transaction was added.  Since a descendant
+// might already have depended on some of the ancestors through other
+// transactions, only the ancestors which are new to it are added.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) linkTransaction(txD *TxDesc, ancestors,
+	descendants map[chainhash.Hash]*btcutil.Tx,
+	oldAncestors map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx) {
+
+	for hash := range ancestors {
+		linkStats(mp.pool[hash], txD, 1)
+	}
+	for hash, descendant := range descendants {
+		descendantDesc := mp.pool[hash]
+		linkStats(txD, descendantDesc, 1)
+		known := oldAncestors[*descendant.Hash()]
+		for ancestorHash := range ancestors {
+			if _, ok := known[ancestorHash]; !ok {
+				linkStats(mp.pool[ancestorHash], descendantDesc, 1)
+			}
+		}
+	}
+}
+
+// unlinkTransaction updates the ancestor and descendant totals of the pool for
+// the passed transaction which was just removed from it, along with its
+// ancestors and descendants at that time.  The ancestors of the transaction
+// remain ancestors of its descendants only when they still depend on them
+// through other transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) unlinkTransaction(txD *TxDesc, ancestors,
+	descendants map[chainhash.Hash]*btcutil.Tx) {
+
+	for hash := range ancestors {
+		linkStats(mp.pool[hash], txD, -1)
+	}
+	cache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	for hash, descendant := range descendants {
+		descendantDesc := mp.pool[hash]
+		linkStats(txD, descendantDesc, -1)
+		if len(ancestors) == 0 {
+			continue
+		}
+		remaining := mp.txAncestors(descendant, cache)
+		for ancestorHash := range ancestors {
+			if _, ok := remaining[ancestorHash]; !ok {
+				linkStats(mp.pool[ancestorHash], descendantDesc, -1)
+			}
+		}
 	}
 }
 
@@ -536,22 +612,46 @@ func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height int32, fee int64) *TxDesc {
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
+	txSize := GetTxVirtualSize(tx)
+	feeDelta := mp.feeDeltas[*tx.Hash()]
 	txD := &TxDesc{
 		TxDesc: mining.TxDesc{
-			Tx:       tx,
-			Added:    time.Now(),
-			Height:   height,
-			Fee:      fee,
-			FeePerKB: fee * 1000 / GetTxVirtualSize(tx),
+			Tx:              tx,
+			Added:           time.Now(),
+			Height:          height,
+			Fee:             fee,
+			FeePerKB:        fee * 1000 / txSize,
+			FeeDelta:        feeDelta,
+			AncestorFee:     fee + feeDelta,
+			AncestorSize:    txSize,
+			AncestorCount:   1,
+			DescendantFee:   fee + feeDelta,
+			DescendantSize:  txSize,
+			DescendantCount: 1,
 		},
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
 	}
 
+	// Transactions spending the outputs of this one are usually orphans
+	// until it is added, but they are already in the pool when it is added
+	// back after the block containing it was disconnected.
+	ancestors := mp.txAncestors(tx, nil)
+	descendants := mp.txDescendants(tx, nil)
+	var oldAncestors map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx
+	if len(ancestors) > 0 && len(descendants) > 0 {
+		oldAncestors = make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+		for _, descendant := range descendants {
+			oldAncestors[*descendant.Hash()] = mp.txAncestors(
+				descendant, oldAncestors)
+		}
+	}
+
 	mp.pool[*tx.Hash()] = txD
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
-	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+	mp.linkTransaction(txD, ancestors, descendants, oldAncestors)
+	mp.setLastUpdated()
 
 	// Add unconfirmed address index entries associated with the transaction
 	// if enabled.
@@ -858,7 +958,8 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 
 	// The replacement should have a higher fee rate than each of the
 	// conflicting transactions and a higher absolute fee than the fee sum
-	// of all the conflicting transactions.
+	// of all the conflicting transactions.  The fees include the fee
+	// deltas of the transactions.
 	//
 	// We usually don't want to accept replacements with lower fee rates
 	// than what they replaced as that would lower the fee rate of the next
@@ -866,20 +967,23 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 	// easy-to-reason about way to prevent DoS attacks via replacements.
 	var (
 		txSize           = GetTxVirtualSize(tx)
-		txFeeRate        = txFee * 1000 / txSize
+		modifiedFee      = txFee + mp.feeDeltas[*tx.Hash()]
+		txFeeRate        = modifiedFee * 1000 / txSize
 		conflictsFee     int64
 		conflictsParents = make(map[chainhash.Hash]struct{})
 	)
 	for hash, conflict := range conflicts {
-		if txFeeRate <= mp.pool[hash].FeePerKB {
+		conflictDesc := mp.pool[hash]
+		conflictFeeRate := conflictDesc.ModifiedFee() * 1000 /
+			GetTxVirtualSize(conflict)
+		if txFeeRate <= conflictFeeRate {
 			str := fmt.Sprintf("replacement transaction %v has an "+
 				"insufficient fee rate: needs more than %v, "+
-				"has %v", tx.Hash(), mp.pool[hash].FeePerKB,
-				txFeeRate)
+				"has %v", tx.Hash(), conflictFeeRate, txFeeRate)
 			return nil, txRuleError(wire.RejectInsufficientFee, str)
 		}
 
-		conflictsFee += mp.pool[hash].Fee
+		conflictsFee += conflictDesc.ModifiedFee()
 
 		// We'll track each conflict's parents to ensure the replacement
 		// isn't spending any new unconfirmed inputs.
@@ -892,10 +996,10 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 	// transactions it intends to replace and pay for its own bandwidth,
 	// which is determined by our minimum relay fee.
 	minFee := calcMinRequiredTxRelayFee(txSize, mp.cfg.Policy.MinRelayTxFee)
-	if txFee < conflictsFee+minFee {
+	if modifiedFee < conflictsFee+minFee {
 		str := fmt.Sprintf("replacement transaction %v has an "+
 			"insufficient absolute fee: needs %v, has %v",
-			tx.Hash(), conflictsFee+minFee, txFee)
+			tx.Hash(), conflictsFee+minFee, modifiedFee)
 		return nil, txRuleError(wire.RejectInsufficientFee, str)
 	}
 
@@ -1482,7 +1586,10 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	descs := make([]*mining.TxDesc, len(mp.pool))
 	i := 0
 	for _, desc := range mp.pool {
-		descs[i] = &desc.TxDesc
+		// The ancestor and descendant totals change as transactions
+		// are added and removed, so the descriptors are copied.
+		miningDesc := desc.TxDesc
+		descs[i] = &miningDesc
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1503,48 +1610,89 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 	bestHeight := mp.cfg.BestHeight()
 
 	for _, desc := range mp.pool {
-		// Calculate the current priority based on the inputs to
-		// the transaction.  Use zero if one or more of the
-		// input transactions can't be found for some reason.
-		tx := desc.Tx
-		var currentPriority float64
-		utxos, err := mp.fetchInputUtxos(tx)
-		if err == nil {
-			currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
-				bestHeight+1)
-		}
+		result[desc.Tx.Hash().String()] = mp.rawMempoolVerbose(desc,
+			bestHeight)
+	}
 
-		mpd := &btcjson.GetRawMempoolVerboseResult{
-			Size:             int32(tx.MsgTx().SerializeSize()),
-			Vsize:            int32(GetTxVirtualSize(tx)),
-			Weight:           int32(blockchain.GetTransactionWeight(tx)),
-			Fee:              btcutil.Amount(desc.Fee).ToBTC(),
-			Time:             desc.Added.Unix(),
-			Height:           int64(desc.Height),
-			StartingPriority: desc.StartingPriority,
-			CurrentPriority:  currentPriority,
-			Depends:          make([]string, 0),
-		}
-		for _, txIn := range tx.MsgTx().TxIn {
-			hash := &txIn.PreviousOutPoint.Hash
-			if mp.haveTransaction(hash) {
-				mpd.Depends = append(mpd.Depends,
-					hash.String())
-			}
-		}
+	return result
+}
 
-		result[tx.Hash().String()] = mpd
+// RawMempoolVerboseTx returns the verbose information of the transaction with
+// the passed hash in the memory pool.  The boolean is false when the
+// transaction is not in the main pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RawMempoolVerboseTx(hash *chainhash.Hash) (*btcjson.GetRawMempoolVerboseResult, bool) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*hash]
+	if !exists {
+		return nil, false
 	}
+	return mp.rawMempoolVerbose(desc, mp.cfg.BestHeight()), true
+}
 
-	return result
+// rawMempoolVerbose returns the verbose information of a transaction in the
+// memory pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) rawMempoolVerbose(desc *TxDesc, bestHeight int32) *btcjson.GetRawMempoolVerboseResult {
+	// Calculate the current priority based on the inputs to
+	// the transaction.  Use zero if one or more of the
+	// input transactions can't be found for some reason.
+	tx := desc.Tx
+	var currentPriority float64
+	utxos, err := mp.fetchInputUtxos(tx)
+	if err == nil {
+		currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
+			bestHeight+1)
+	}
+
+	mpd := &btcjson.GetRawMempoolVerboseResult{
+		Size:             int32(tx.MsgTx().SerializeSize()),
+		Vsize:            int32(GetTxVirtualSize(tx)),
+		Weight:           int32(blockchain.GetTransactionWeight(tx)),
+		Fee:              btcutil.Amount(desc.Fee).ToBTC(),
+		ModifiedFee:      btcutil.Amount(desc.ModifiedFee()).ToBTC(),
+		Time:             desc.Added.Unix(),
+		Height:           int64(desc.Height),
+		StartingPriority: desc.StartingPriority,
+		CurrentPriority:  currentPriority,
+		Depends:          make([]string, 0),
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		hash := &txIn.PreviousOutPoint.Hash
+		if mp.haveTransaction(hash) {
+			mpd.Depends = append(mpd.Depends,
+				hash.String())
+		}
+	}
+
+	return mpd
+}
+
+// setLastUpdated records the current time as the last time the main pool was
+// updated.  The time is kept strictly increasing, so every update results in a
+// different time even when the clock doesn't advance in between.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) setLastUpdated() {
+	now := time.Now().UnixNano()
+	if last := atomic.LoadInt64(&mp.lastUpdated); now <= last {
+		now = last + 1
+	}
+	atomic.StoreInt64(&mp.lastUpdated, now)
 }
 
 // LastUpdated returns the last time a transaction was added to or removed from
-// the main pool.  It does not include the orphan pool.
+// the main pool, or the fee delta of one of its transactions changed.  It does
+// not include the orphan pool.  Each update of the pool results in a different
+// time.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) LastUpdated() time.Time {
-	return time.Unix(atomic.LoadInt64(&mp.lastUpdated), 0)
+	return time.Unix(0, atomic.LoadInt64(&mp.lastUpdated))
 }
 
 // New returns a new memory pool for validating and storing standalone
@@ -1557,5 +1705,6 @@ func New(cfg *Config) *TxPool {
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
 		outpoints:      make(map[wire.OutPoint]*btcutil.Tx),
+		feeDeltas:      make(map[chainhash.Hash]int64),
 	}
 }
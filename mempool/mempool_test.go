@@ -1452,6 +1452,226 @@ func TestAncestorsDescendants(t *testing.T) {
 	}
 }
 
+// testAncestorStats ensures the ancestor and descendant totals of all
+// transactions in the pool match the ones of their ancestors and descendants.
+func testAncestorStats(ctx *testContext) {
+	ctx.t.Helper()
+
+	txPool := ctx.harness.txPool
+	for hash, desc := range txPool.pool {
+		wantFee, wantSize := desc.ModifiedFee(), GetTxVirtualSize(desc.Tx)
+		ancestors := txPool.txAncestors(desc.Tx, nil)
+		for _, ancestor := range ancestors {
+			wantFee += txPool.pool[*ancestor.Hash()].ModifiedFee()
+			wantSize += GetTxVirtualSize(ancestor)
+		}
+		if desc.AncestorFee != wantFee || desc.AncestorSize != wantSize ||
+			desc.AncestorCount != len(ancestors)+1 {
+
+			ctx.t.Fatalf("ancestor totals of %v: got fee %d, size %d, "+
+				"count %d, want fee %d, size %d, count %d", hash,
+				desc.AncestorFee, desc.AncestorSize,
+				desc.AncestorCount, wantFee, wantSize,
+				len(ancestors)+1)
+		}
+
+		wantFee, wantSize = desc.ModifiedFee(), GetTxVirtualSize(desc.Tx)
+		descendants := txPool.txDescendants(desc.Tx, nil)
+		for _, descendant := range descendants {
+			wantFee += txPool.pool[*descendant.Hash()].ModifiedFee()
+			wantSize += GetTxVirtualSize(descendant)
+		}
+		if desc.DescendantFee != wantFee ||
+			desc.DescendantSize != wantSize ||
+			desc.DescendantCount != len(descendants)+1 {
+
+			ctx.t.Fatalf("descendant totals of %v: got fee %d, size "+
+				"%d, count %d, want fee %d, size %d, count %d",
+				hash, desc.DescendantFee, desc.DescendantSize,
+				desc.DescendantCount, wantFee, wantSize,
+				len(descendants)+1)
+		}
+	}
+}
+
+// TestAncestorStats ensures the ancestor and descendant totals of the
+// transactions in the pool are kept up to date as transactions are added and
+// removed, including when a transaction is added back while the transactions
+// spending it are still in the pool.
+func TestAncestorStats(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// We'll be creating the following chain of unconfirmed transactions,
+	// each paying a different fee:
+	//
+	//       B ----
+	//     /        \
+	//   A            E
+	//     \        /
+	//       C -- D
+	a := ctx.addSignedTx(outputs[:1], 2, 1000, false, false)
+	b := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 0)}, 1, 2000, false,
+		false,
+	)
+	c := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 1)}, 1, 3000, false,
+		false,
+	)
+	d := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(c, 0)}, 1, 4000, false,
+		false,
+	)
+	e := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(b, 0), txOutToSpendableOut(d, 0),
+	}, 1, 5000, false, false)
+	testAncestorStats(ctx)
+
+	eDesc := harness.txPool.pool[*e.Hash()]
+	if eDesc.AncestorFee != 15000 || eDesc.AncestorCount != 5 {
+		t.Fatalf("unexpected ancestor totals of E: fee %d, count %d",
+			eDesc.AncestorFee, eDesc.AncestorCount)
+	}
+
+	// Removing C without its descendants leaves D without ancestors, while
+	// E still depends on A through B.
+	harness.txPool.RemoveTransaction(c, false)
+	testAncestorStats(ctx)
+	if count := harness.txPool.pool[*d.Hash()].AncestorCount; count != 1 {
+		t.Fatalf("D has %d ancestors after removing C", count-1)
+	}
+
+	// Adding C back links D to both C and A again, which is how a
+	// transaction of a disconnected block returns to the pool.
+	_, _, err = harness.txPool.MaybeAcceptTransaction(c, false, false)
+	if err != nil {
+		t.Fatalf("unable to add C back: %v", err)
+	}
+	testAncestorStats(ctx)
+
+	// Removing A along with its descendants empties the pool.
+	harness.txPool.RemoveTransaction(a, true)
+	testAncestorStats(ctx)
+	if count := harness.txPool.Count(); count != 0 {
+		t.Fatalf("pool has %d transactions left", count)
+	}
+}
+
+// TestPrioritiseTransaction ensures the fee deltas of transactions are kept
+// whether or not they are in the pool, are included in the totals of their
+// ancestors and descendants, count towards replacements, and survive being
+// saved and restored.
+func TestPrioritiseTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	// The fee delta of B is set before it is added to the pool, and the
+	// one of A after it, which both end up in the totals.
+	//
+	//   A -- B
+	a, err := harness.CreateSignedTx(outputs[:1], 2, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	b, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 0)}, 1, 2000, false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	txPool.PrioritiseTransaction(b.Hash(), 500)
+	txPool.PrioritiseTransaction(b.Hash(), -200)
+	for _, tx := range []*btcutil.Tx{a, b} {
+		_, err := txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to process transaction: %v", err)
+		}
+	}
+	txPool.PrioritiseTransaction(a.Hash(), 4000)
+	testAncestorStats(ctx)
+
+	bDesc := txPool.pool[*b.Hash()]
+	if bDesc.FeeDelta != 300 || bDesc.AncestorFee != 7300 {
+		t.Fatalf("unexpected fee delta %d and ancestor fee %d of B",
+			bDesc.FeeDelta, bDesc.AncestorFee)
+	}
+	result, ok := txPool.RawMempoolVerboseTx(a.Hash())
+	if !ok {
+		t.Fatal("A is not in the pool")
+	}
+	wantModifiedFee := btcutil.Amount(5000).ToBTC()
+	if result.ModifiedFee != wantModifiedFee {
+		t.Fatalf("modified fee of A is %v instead of %v",
+			result.ModifiedFee, wantModifiedFee)
+	}
+
+	// A transaction paying the same fee as the one it conflicts with can
+	// only replace it with a fee delta.
+	replaced := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 1)}, 1, 1000, true,
+		false,
+	)
+	replacement, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 1)}, 2, 1000, true,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(replacement, false, false, 0)
+	if err == nil {
+		t.Fatal("replacement without fee delta accepted")
+	}
+	txPool.PrioritiseTransaction(replacement.Hash(), 100000)
+	_, err = txPool.ProcessTransaction(replacement, false, false, 0)
+	if err != nil {
+		t.Fatalf("replacement with fee delta rejected: %v", err)
+	}
+	testPoolMembership(ctx, replaced, false, false)
+	testAncestorStats(ctx)
+
+	// The fee deltas are restored into a new pool, where they apply to the
+	// transactions added later, and are removed once cleared.
+	saved := txPool.SaveFeeDeltas()
+	txPool.ClearPrioritisation(b.Hash())
+	if feeDelta := txPool.FeeDelta(b.Hash()); feeDelta != 0 {
+		t.Fatalf("fee delta of B is %d after clearing it", feeDelta)
+	}
+	restored := New(&txPool.cfg)
+	if err := restored.RestoreFeeDeltas(saved); err != nil {
+		t.Fatalf("unable to restore fee deltas: %v", err)
+	}
+	for _, test := range []struct {
+		tx       *btcutil.Tx
+		feeDelta int64
+	}{
+		{a, 4000},
+		{b, 300},
+		{replacement, 100000},
+		{replaced, 0},
+	} {
+		feeDelta := restored.FeeDelta(test.tx.Hash())
+		if feeDelta != test.feeDelta {
+			t.Fatalf("restored fee delta of %v is %d instead of %d",
+				test.tx.Hash(), feeDelta, test.feeDelta)
+		}
+	}
+	if err := restored.RestoreFeeDeltas(saved[:len(saved)-1]); err == nil {
+		t.Fatal("truncated fee deltas restored")
+	}
+}
+
 // TestRBF tests the different cases required for a transaction to properly
 // replace its conflicts given that they all signal replacement.
 func TestRBF(t *testing.T) {
@@ -0,0 +1,562 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testHarness houses a regression test chain along with a memory pool and a
+// block template generator using it.  All coinbases pay to the key of the
+// harness.
+type testHarness struct {
+	tb        testing.TB
+	params    *chaincfg.Params
+	chain     *blockchain.BlockChain
+	txPool    *mempool.TxPool
+	policy    *mining.Policy
+	generator *mining.BlkTmplGenerator
+	key       *btcec.PrivateKey
+	addr      btcutil.Address
+	pkScript  []byte
+	teardown  func()
+}
+
+// newTestHarness returns a harness on a new regression test chain with the
+// passed number of blocks.
+func newTestHarness(tb testing.TB, numBlocks int) *testHarness {
+	params := chaincfg.RegressionNetParams
+	dbPath, err := ioutil.TempDir("", "miningtest")
+	if err != nil {
+		tb.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		tb.Fatalf("unable to create db: %v", err)
+	}
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbPath)
+		tb.Fatalf("unable to create claimtrie: %v", err)
+	}
+	teardown := func() {
+		ct.Close()
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	timeSource := blockchain.NewMedianTime()
+	sigCache := txscript.NewSigCache(1000)
+	hashCache := txscript.NewHashCache(1000)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+		SigCache:    sigCache,
+		ClaimTrie:   ct,
+	})
+	if err != nil {
+		teardown()
+		tb.Fatalf("unable to create chain: %v", err)
+	}
+	txPool := mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			DisableRelayPriority: true,
+			MaxOrphanTxs:         5,
+			MaxOrphanTxSize:      1000,
+			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxFee:        mempool.DefaultMinRelayTxFee,
+			MaxTxVersion:         2,
+		},
+		ChainParams:   &params,
+		FetchUtxoView: chain.FetchUtxoView,
+		BestHeight:    func() int32 { return chain.BestSnapshot().Height },
+		MedianTimePast: func() time.Time {
+			return chain.BestSnapshot().MedianTime
+		},
+		CalcSequenceLock: func(tx *btcutil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+			return chain.CalcSequenceLock(tx, view, true)
+		},
+		IsDeploymentActive: chain.IsDeploymentActive,
+		SigCache:           sigCache,
+		HashCache:          hashCache,
+	})
+	policy := &mining.Policy{
+		BlockMaxWeight: blockchain.MaxBlockWeight - 4000,
+		BlockMaxSize:   blockchain.MaxBlockBaseSize - 1000,
+		TxMinFreeFee:   mempool.DefaultMinRelayTxFee,
+	}
+	generator := mining.NewBlkTmplGenerator(policy, &params, txPool, chain,
+		timeSource, sigCache, hashCache)
+
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		teardown()
+		tb.Fatalf("unable to create key: %v", err)
+	}
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()), &params)
+	if err != nil {
+		teardown()
+		tb.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		teardown()
+		tb.Fatalf("unable to create script: %v", err)
+	}
+
+	h := &testHarness{
+		tb:        tb,
+		params:    &params,
+		chain:     chain,
+		txPool:    txPool,
+		policy:    policy,
+		generator: generator,
+		key:       key,
+		addr:      addr,
+		pkScript:  pkScript,
+		teardown:  teardown,
+	}
+	for i := 0; i < numBlocks; i++ {
+		h.mineBlock()
+	}
+	return h
+}
+
+// mineBlock solves a block template and connects it to the chain.  The
+// transactions of the block are removed from the memory pool.
+func (h *testHarness) mineBlock() *btcutil.Block {
+	template, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		h.tb.Fatalf("unable to create block template: %v", err)
+	}
+	header := &template.Block.Header
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		hash := header.BlockPoWHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		header.Nonce++
+	}
+
+	block := btcutil.NewBlock(template.Block)
+	_, isOrphan, err := h.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil || isOrphan {
+		h.tb.Fatalf("block rejected (orphan %v): %v", isOrphan, err)
+	}
+	for _, tx := range block.Transactions()[1:] {
+		h.txPool.RemoveTransaction(tx, false)
+	}
+	return block
+}
+
+// coinbaseOutput returns the output of the coinbase of the block at the passed
+// height.
+func (h *testHarness) coinbaseOutput(height int32) (wire.OutPoint, int64) {
+	block, err := h.chain.BlockByHeight(height)
+	if err != nil {
+		h.tb.Fatalf("unable to fetch block %d: %v", height, err)
+	}
+	coinbase := block.Transactions()[0]
+	return wire.OutPoint{Hash: *coinbase.Hash()},
+		coinbase.MsgTx().TxOut[0].Value
+}
+
+// createTx returns a transaction spending the passed output of the passed
+// amount into the passed number of equal outputs, which pays a fee of the
+// passed rate in Satoshi per byte.
+func (h *testHarness) createTx(prevOut wire.OutPoint, amount int64, numOutputs int, feeRate int64) *btcutil.Tx {
+	// The size of the signature varies slightly, so the size of a first
+	// version of the transaction is used with some slack.
+	var tx *wire.MsgTx
+	fee := int64(0)
+	for i := 0; i < 2; i++ {
+		tx = wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		value := (amount - fee) / int64(numOutputs)
+		for j := 0; j < numOutputs; j++ {
+			tx.AddTxOut(wire.NewTxOut(value, h.pkScript))
+		}
+		sigScript, err := txscript.SignatureScript(tx, 0, h.pkScript,
+			txscript.SigHashAll, h.key, true)
+		if err != nil {
+			h.tb.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		fee = feeRate * int64(tx.SerializeSize()+2)
+	}
+	return btcutil.NewTx(tx)
+}
+
+// addTx adds the passed transaction to the memory pool.
+func (h *testHarness) addTx(tx *btcutil.Tx) {
+	_, err := h.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		h.tb.Fatalf("transaction %v rejected: %v", tx.Hash(), err)
+	}
+}
+
+// templateFees returns the total fees of the passed block template.
+func templateFees(template *mining.BlockTemplate) int64 {
+	return -template.Fees[0]
+}
+
+// noAncestorsSource is a transaction source which doesn't track the ancestors
+// of its transactions, so the block template generator calculates them.
+type noAncestorsSource struct {
+	*mempool.TxPool
+}
+
+// MiningDescs returns the descriptors of the memory pool without the totals of
+// the ancestors.  This is part of the mining.TxSource interface.
+func (s noAncestorsSource) MiningDescs() []*mining.TxDesc {
+	descs := s.TxPool.MiningDescs()
+	for _, desc := range descs {
+		desc.AncestorFee = 0
+		desc.AncestorSize = 0
+		desc.AncestorCount = 0
+	}
+	return descs
+}
+
+// TestCPFP ensures transactions paying a high fee pull their ancestors paying a
+// low fee into block templates when that yields higher fees.
+func TestCPFP(t *testing.T) {
+	h := newTestHarness(t, int(chaincfg.RegressionNetParams.CoinbaseMaturity)+5)
+	defer h.teardown()
+
+	// Create a chain of two transactions paying the minimum fee, spent by a
+	// transaction paying a high fee, along with four independent ones
+	// paying a medium fee:
+	//
+	//   P1 -- P2 -- C      I1  I2  I3  I4
+	prevOut, amount := h.coinbaseOutput(1)
+	p1 := h.createTx(prevOut, amount, 1, 1)
+	p1Out := p1.MsgTx().TxOut[0]
+	p2 := h.createTx(wire.OutPoint{Hash: *p1.Hash()}, p1Out.Value, 1, 1)
+	p2Out := p2.MsgTx().TxOut[0]
+	c := h.createTx(wire.OutPoint{Hash: *p2.Hash()}, p2Out.Value, 1, 100)
+	independent := make([]*btcutil.Tx, 4)
+	for i := range independent {
+		prevOut, amount := h.coinbaseOutput(int32(i + 2))
+		independent[i] = h.createTx(prevOut, amount, 1, 10)
+	}
+	for _, tx := range append([]*btcutil.Tx{p1, p2, c}, independent...) {
+		h.addTx(tx)
+	}
+
+	// Limit the block to the coinbase and three of the transactions, which
+	// are all about the same size.  The count of the transactions is
+	// accounted for with its maximum size.
+	template, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	coinbaseOnly := wire.MsgBlock{
+		Header:       template.Block.Header,
+		Transactions: template.Block.Transactions[:1],
+	}
+	txWeight := uint32(blockchain.GetTransactionWeight(independent[0]))
+	h.policy.BlockMaxWeight = uint32(blockchain.GetBlockWeight(
+		btcutil.NewBlock(&coinbaseOnly))) +
+		(wire.MaxVarIntPayload-1)*blockchain.WitnessScaleFactor +
+		3*txWeight + txWeight/2
+
+	// The generator caches its templates, so one honoring the new limit is
+	// needed for mining blocks.
+	h.generator = mining.NewBlkTmplGenerator(h.policy, h.params, h.txPool,
+		h.chain, blockchain.NewMedianTime(), txscript.NewSigCache(1000),
+		txscript.NewHashCache(1000))
+
+	// Without the package of P1, P2 and C, the best template would hold
+	// three of the independent transactions.
+	fee := func(tx *btcutil.Tx) int64 {
+		view, err := h.chain.FetchUtxoView(tx)
+		if err != nil {
+			t.Fatalf("unable to fetch utxos: %v", err)
+		}
+		in := int64(0)
+		for _, txIn := range tx.MsgTx().TxIn {
+			entry := view.LookupEntry(txIn.PreviousOutPoint)
+			if entry == nil {
+				t.Fatalf("missing input of %v", tx.Hash())
+			}
+			in += entry.Amount()
+		}
+		out := int64(0)
+		for _, txOut := range tx.MsgTx().TxOut {
+			out += txOut.Value
+		}
+		return in - out
+	}
+	// The package spends the coinbase of block 1 down to the output of C.
+	wantFees := amount - c.MsgTx().TxOut[0].Value
+	parentFirstFees := 3 * fee(independent[0])
+
+	sources := []struct {
+		name   string
+		source mining.TxSource
+	}{
+		{"memory pool", h.txPool},
+		{"no ancestors", noAncestorsSource{h.txPool}},
+	}
+	for _, test := range sources {
+		generator := mining.NewBlkTmplGenerator(h.policy, h.params,
+			test.source, h.chain, blockchain.NewMedianTime(),
+			txscript.NewSigCache(1000), txscript.NewHashCache(1000))
+		template, err := generator.NewBlockTemplate(h.addr)
+		if err != nil {
+			t.Fatalf("%s: unable to create block template: %v",
+				test.name, err)
+		}
+
+		txns := template.Block.Transactions
+		if len(txns) != 4 {
+			t.Fatalf("%s: template has %d transactions instead of 4",
+				test.name, len(txns))
+		}
+		wantTxns := []*btcutil.Tx{p1, p2, c}
+		for i, tx := range wantTxns {
+			if txns[i+1].TxHash() != *tx.Hash() {
+				t.Fatalf("%s: transaction %d of the template is "+
+					"%v instead of %v", test.name, i+1,
+					txns[i+1].TxHash(), tx.Hash())
+			}
+		}
+		if fees := templateFees(template); fees != wantFees {
+			t.Fatalf("%s: template has %d in fees instead of %d",
+				test.name, fees, wantFees)
+		}
+		if wantFees <= parentFirstFees {
+			t.Fatalf("%s: the package pays %d, not more than the %d "+
+				"of the independent transactions", test.name,
+				wantFees, parentFirstFees)
+		}
+	}
+
+	// Once the package is mined, the independent transactions follow.
+	block := h.mineBlock()
+	if len(block.Transactions()) != 4 {
+		t.Fatalf("block has %d transactions instead of 4",
+			len(block.Transactions()))
+	}
+	block = h.mineBlock()
+	if len(block.Transactions()) != 4 {
+		t.Fatalf("block has %d transactions instead of 4",
+			len(block.Transactions()))
+	}
+	if count := h.txPool.Count(); count != 1 {
+		t.Fatalf("memory pool has %d transactions left instead of 1",
+			count)
+	}
+}
+
+// TestFeeDelta ensures the fee deltas of prioritised transactions are honored
+// when selecting the transactions of block templates, while the templates only
+// collect the fees which are actually paid.
+func TestFeeDelta(t *testing.T) {
+	h := newTestHarness(t, int(chaincfg.RegressionNetParams.CoinbaseMaturity)+3)
+	defer h.teardown()
+
+	// Create a transaction paying the minimum fee spent by another one
+	// paying the minimum fee, along with two independent ones paying a
+	// high fee:
+	//
+	//   P -- C      I1  I2
+	prevOut, amount := h.coinbaseOutput(1)
+	p := h.createTx(prevOut, amount, 1, 1)
+	pOut := p.MsgTx().TxOut[0]
+	c := h.createTx(wire.OutPoint{Hash: *p.Hash()}, pOut.Value, 1, 1)
+	independent := make([]*btcutil.Tx, 2)
+	for i := range independent {
+		prevOut, amount := h.coinbaseOutput(int32(i + 2))
+		independent[i] = h.createTx(prevOut, amount, 1, 100)
+	}
+	for _, tx := range append([]*btcutil.Tx{p, c}, independent...) {
+		h.addTx(tx)
+	}
+
+	// Limit the block to the coinbase and two of the transactions, and
+	// prioritise C over the independent transactions.
+	template, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	coinbaseOnly := wire.MsgBlock{
+		Header:       template.Block.Header,
+		Transactions: template.Block.Transactions[:1],
+	}
+	txWeight := uint32(blockchain.GetTransactionWeight(independent[0]))
+	h.policy.BlockMaxWeight = uint32(blockchain.GetBlockWeight(
+		btcutil.NewBlock(&coinbaseOnly))) +
+		(wire.MaxVarIntPayload-1)*blockchain.WitnessScaleFactor +
+		2*txWeight + txWeight/2
+	h.txPool.PrioritiseTransaction(c.Hash(), btcutil.SatoshiPerBitcoin)
+
+	wantFees := amount - c.MsgTx().TxOut[0].Value
+	sources := []struct {
+		name   string
+		source mining.TxSource
+	}{
+		{"memory pool", h.txPool},
+		{"no ancestors", noAncestorsSource{h.txPool}},
+	}
+	for _, test := range sources {
+		generator := mining.NewBlkTmplGenerator(h.policy, h.params,
+			test.source, h.chain, blockchain.NewMedianTime(),
+			txscript.NewSigCache(1000), txscript.NewHashCache(1000))
+		template, err := generator.NewBlockTemplate(h.addr)
+		if err != nil {
+			t.Fatalf("%s: unable to create block template: %v",
+				test.name, err)
+		}
+
+		txns := template.Block.Transactions
+		if len(txns) != 3 {
+			t.Fatalf("%s: template has %d transactions instead of 3",
+				test.name, len(txns))
+		}
+		for i, tx := range []*btcutil.Tx{p, c} {
+			if txns[i+1].TxHash() != *tx.Hash() {
+				t.Fatalf("%s: transaction %d of the template is "+
+					"%v instead of %v", test.name, i+1,
+					txns[i+1].TxHash(), tx.Hash())
+			}
+		}
+		if fees := templateFees(template); fees != wantFees {
+			t.Fatalf("%s: template has %d in fees instead of %d",
+				test.name, fees, wantFees)
+		}
+		if template.Fees[2] != pOut.Value-c.MsgTx().TxOut[0].Value {
+			t.Fatalf("%s: template has fee %d for C instead of "+
+				"the one paid", test.name, template.Fees[2])
+		}
+	}
+
+	// Without the fee delta, the independent transactions are selected.
+	h.txPool.PrioritiseTransaction(c.Hash(), -btcutil.SatoshiPerBitcoin)
+	generator := mining.NewBlkTmplGenerator(h.policy, h.params, h.txPool,
+		h.chain, blockchain.NewMedianTime(), txscript.NewSigCache(1000),
+		txscript.NewHashCache(1000))
+	template, err = generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	for _, tx := range independent {
+		if !templateHasTx(template, tx.Hash()) {
+			t.Fatalf("template doesn't include transaction %v",
+				tx.Hash())
+		}
+	}
+}
+
+// newCPFPBenchHarness returns a test harness with a memory pool where most
+// transactions paying a high fee spend ones paying the minimum fee, and the
+// block only has room for half of the transactions.  The returned transaction
+// spends an output left unspent by the memory pool.
+func newCPFPBenchHarness(b *testing.B) (*testHarness, *btcutil.Tx) {
+	const numPairs = 100
+	h := newTestHarness(b, int(chaincfg.RegressionNetParams.CoinbaseMaturity)+1)
+
+	// Split a coinbase into the outputs spent by the transactions.
+	prevOut, amount := h.coinbaseOutput(1)
+	split := h.createTx(prevOut, amount, 3*numPairs, 1)
+	h.addTx(split)
+	h.mineBlock()
+
+	// Each pair is a parent paying the minimum fee and a child paying a
+	// fee which increases with the pairs, and there is an independent
+	// transaction paying a medium fee for each.  The third output of each
+	// is left unspent.
+	splitOutputs := split.MsgTx().TxOut
+	var txWeight uint32
+	for i := 0; i < numPairs; i++ {
+		parent := h.createTx(wire.OutPoint{Hash: *split.Hash(),
+			Index: uint32(3 * i)}, splitOutputs[3*i].Value, 1, 1)
+		child := h.createTx(wire.OutPoint{Hash: *parent.Hash()},
+			parent.MsgTx().TxOut[0].Value, 1, int64(2+i))
+		single := h.createTx(wire.OutPoint{Hash: *split.Hash(),
+			Index: uint32(3*i + 1)}, splitOutputs[3*i+1].Value, 1,
+			numPairs/4)
+		h.addTx(parent)
+		h.addTx(child)
+		h.addTx(single)
+		txWeight = uint32(blockchain.GetTransactionWeight(single))
+	}
+	h.policy.BlockMaxWeight = 4000 + 3*numPairs*txWeight/2
+
+	extra := h.createTx(wire.OutPoint{Hash: *split.Hash(), Index: 2},
+		splitOutputs[2].Value, 1, numPairs)
+	return h, extra
+}
+
+// BenchmarkNewBlockTemplateCPFP benchmarks creating block templates from
+// scratch from a memory pool where most transactions paying a high fee spend
+// ones paying the minimum fee, and the block only has room for half of the
+// transactions.  The fees of the template are reported as well.
+func BenchmarkNewBlockTemplateCPFP(b *testing.B) {
+	h, _ := newCPFPBenchHarness(b)
+	defer h.teardown()
+
+	b.ResetTimer()
+	var fees int64
+	for i := 0; i < b.N; i++ {
+		generator := mining.NewBlkTmplGenerator(h.policy, h.params,
+			h.txPool, h.chain, blockchain.NewMedianTime(),
+			txscript.NewSigCache(1000), txscript.NewHashCache(1000))
+		template, err := generator.NewBlockTemplate(h.addr)
+		if err != nil {
+			b.Fatalf("unable to create block template: %v", err)
+		}
+		fees = templateFees(template)
+	}
+	b.ReportMetric(float64(fees), "fees/template")
+}
+
+// BenchmarkNewBlockTemplateUpdate benchmarks updating the cached block template
+// of the memory pool of BenchmarkNewBlockTemplateCPFP after a transaction was
+// added to or removed from it.
+func BenchmarkNewBlockTemplateUpdate(b *testing.B) {
+	h, extra := newCPFPBenchHarness(b)
+	defer h.teardown()
+	if _, err := h.generator.NewBlockTemplate(h.addr); err != nil {
+		b.Fatalf("unable to create block template: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if i%2 == 0 {
+			h.addTx(extra)
+		} else {
+			h.txPool.RemoveTransaction(extra, false)
+		}
+		b.StartTimer()
+
+		_, err := h.generator.NewBlockTemplate(h.addr)
+		if err != nil {
+			b.Fatalf("unable to create block template: %v", err)
+		}
+	}
+}
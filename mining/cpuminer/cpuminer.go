@@ -7,9 +7,12 @@ package cpuminer
 import (
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"math/rand"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
@@ -195,17 +198,63 @@ func (m *CPUMiner) submitBlock(block *btcutil.Block) bool {
 	return true
 }
 
+// solveHeader searches the nonces of the passed header, starting at startNonce
+// and advancing by stride, for one which makes the LBRY proof of work hash of
+// the header less than the target difficulty.  Every hash computed is counted
+// in hashes.  When tries is not nil, every hash is also deducted from it and
+// searching stops once it is used up.  The nonce of a solution is sent to
+// found, and searching stops early when stop is closed.
+//
+// It must be run as a goroutine.
+func solveHeader(header wire.BlockHeader, targetDifficulty *big.Int,
+	startNonce, stride uint32, hashes *uint64, tries *int64,
+	found chan<- uint32, stop <-chan struct{}, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	// The header is a copy, so its nonce can be modified freely.
+	for nonce := uint64(startNonce); nonce <= uint64(maxNonce); nonce += uint64(stride) {
+		select {
+		case <-stop:
+			return
+		default:
+			// Non-blocking select to fall through
+		}
+
+		if tries != nil && atomic.AddInt64(tries, -1) < 0 {
+			return
+		}
+		header.Nonce = uint32(nonce)
+		hash := header.BlockPoWHash()
+		atomic.AddUint64(hashes, 1)
+
+		// The block is solved when the proof of work hash is less than
+		// the target difficulty.  Yay!
+		if blockchain.HashToBig(&hash).Cmp(targetDifficulty) <= 0 {
+			select {
+			case found <- header.Nonce:
+			case <-stop:
+			}
+			return
+		}
+	}
+}
+
 // solveBlock attempts to find some combination of a nonce, extra nonce, and
 // current timestamp which makes the passed block hash to a value less than the
-// target difficulty.  The timestamp is updated periodically and the passed
-// block is modified with all tweaks during this process.  This means that
-// when the function returns true, the block is ready for submission.
+// target difficulty.  The hash is the LBRY proof of work hash of the header,
+// which the nonce range is split across numThreads goroutines to search.  The
+// timestamp is updated periodically and the passed block is modified with all
+// tweaks during this process.  This means that when the function returns true,
+// the block is ready for submission.
 //
 // This function will return early with false when conditions that trigger a
 // stale block such as a new block showing up or periodically when there are
-// new transactions and enough time has elapsed without finding a solution.
+// new transactions and enough time has elapsed without finding a solution.  It
+// also returns false once the passed number of tries, if not nil, is used up.
 func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int32,
-	ticker *time.Ticker, quit chan struct{}) bool {
+	numThreads uint32, tries *int64, ticker *time.Ticker,
+	quit chan struct{}) bool {
 
 	// Choose a random extra nonce offset for this block template and
 	// worker.
@@ -219,11 +268,14 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int32,
 	// Create some convenience variables.
 	header := &msgBlock.Header
 	targetDifficulty := blockchain.CompactToBig(header.Bits)
+	if numThreads == 0 {
+		numThreads = 1
+	}
 
 	// Initial state.
 	lastGenerated := time.Now()
 	lastTxUpdate := m.g.TxSource().LastUpdated()
-	hashesCompleted := uint64(0)
+	var hashesCompleted uint64
 
 	// Note that the entire extra nonce range is iterated and the offset is
 	// added relying on the fact that overflow will wrap around 0 as
@@ -236,15 +288,52 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int32,
 
 		// Search through the entire nonce range for a solution while
 		// periodically checking for early quit and stale block
-		// conditions along with updates to the speed monitor.
-		for i := uint32(0); i <= maxNonce; i++ {
+		// conditions along with updates to the speed monitor.  The
+		// search starts over whenever the timestamp is updated since
+		// that changes the hash of every nonce.
+	search:
+		for {
+			found := make(chan uint32)
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(int(numThreads))
+			for i := uint32(0); i < numThreads; i++ {
+				go solveHeader(*header, targetDifficulty, i,
+					numThreads, &hashesCompleted, tries, found,
+					stop, &wg)
+			}
+			exhausted := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(exhausted)
+			}()
+			stopThreads := func() {
+				close(stop)
+				wg.Wait()
+			}
+
 			select {
+			case nonce := <-found:
+				stopThreads()
+				header.Nonce = nonce
+				m.updateHashes <- atomic.SwapUint64(&hashesCompleted, 0)
+				return true
+
+			case <-exhausted:
+				if tries != nil && atomic.LoadInt64(tries) <= 0 {
+					m.updateHashes <- atomic.SwapUint64(
+						&hashesCompleted, 0)
+					return false
+				}
+				break search
+
 			case <-quit:
+				stopThreads()
 				return false
 
 			case <-ticker.C:
-				m.updateHashes <- hashesCompleted
-				hashesCompleted = 0
+				stopThreads()
+				m.updateHashes <- atomic.SwapUint64(&hashesCompleted, 0)
 
 				// The current block is stale if the best block
 				// has changed.
@@ -264,24 +353,6 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int32,
 				}
 
 				m.g.UpdateBlockTime(msgBlock)
-
-			default:
-				// Non-blocking select to fall through
-			}
-
-			// Update the nonce and hash the block header.  Each
-			// hash is actually a double sha256 (two hashes), so
-			// increment the number of hashes completed for each
-			// attempt accordingly.
-			header.Nonce = i
-			hash := header.BlockHash()
-			hashesCompleted += 2
-
-			// The block is solved when the new block hash is less
-			// than the target difficulty.  Yay!
-			if blockchain.HashToBig(&hash).Cmp(targetDifficulty) <= 0 {
-				m.updateHashes <- hashesCompleted
-				return true
 			}
 		}
 	}
@@ -350,11 +421,12 @@ out:
 			continue
 		}
 
-		// Attempt to solve the block.  The function will exit early
+		// Attempt to solve the block with a single thread since every
+		// worker solves its own block.  The function will exit early
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, quit) {
+		if m.solveBlock(template.Block, curHeight+1, 1, nil, ticker, quit) {
 			block := btcutil.NewBlock(template.Block)
 			m.submitBlock(block)
 		}
@@ -539,18 +611,16 @@ func (m *CPUMiner) NumWorkers() int32 {
 	return int32(m.numWorkers)
 }
 
-// GenerateNBlocks generates the requested number of blocks. It is self
-// contained in that it creates block templates and attempts to solve them while
-// detecting when it is performing stale work and reacting accordingly by
-// generating a new block template.  When a block is solved, it is submitted.
-// The function returns a list of the hashes of generated blocks.
-func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
+// startDiscreteMining marks the miner as generating a discrete number of blocks
+// and starts the speed monitor.  It returns the number of threads to solve each
+// block with, or an error when the miner is already mining.
+func (m *CPUMiner) startDiscreteMining() (uint32, error) {
 	m.Lock()
+	defer m.Unlock()
 
 	// Respond with an error if server is already mining.
 	if m.started || m.discreteMining {
-		m.Unlock()
-		return nil, errors.New("Server is already CPU mining. Please call " +
+		return 0, errors.New("Server is already CPU mining. Please call " +
 			"`setgenerate 0` before calling discrete `generate` commands.")
 	}
 
@@ -561,10 +631,60 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 	m.wg.Add(1)
 	go m.speedMonitor()
 
+	return m.numWorkers, nil
+}
+
+// stopDiscreteMining stops the speed monitor started by startDiscreteMining and
+// allows the miner to be started again.
+func (m *CPUMiner) stopDiscreteMining() {
+	m.Lock()
+	close(m.speedMonitorQuit)
+	m.wg.Wait()
+	m.started = false
+	m.discreteMining = false
 	m.Unlock()
+}
+
+// GenerateNBlocks generates the requested number of blocks. It is self
+// contained in that it creates block templates and attempts to solve them while
+// detecting when it is performing stale work and reacting accordingly by
+// generating a new block template.  When a block is solved, it is submitted.
+// Each block is solved by as many threads as the number of workers.  The
+// function returns a list of the hashes of generated blocks.
+func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(n, nil, 0)
+}
+
+// GenerateNBlocksToAddress generates the requested number of blocks like
+// GenerateNBlocks, but pays them to the passed address instead of one of the
+// configured mining addresses.  When maxTries is not zero, at most that many
+// nonces are tried for all of the blocks combined, and the hashes of the blocks
+// generated until then are returned.
+func (m *CPUMiner) GenerateNBlocksToAddress(n uint32, payToAddr btcutil.Address, maxTries uint64) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(n, payToAddr, maxTries)
+}
+
+// generateNBlocks generates the requested number of blocks paying to the passed
+// address, or to one of the configured mining addresses when it is nil, with
+// at most the passed number of tries unless it is zero.
+func (m *CPUMiner) generateNBlocks(n uint32, payToAddr btcutil.Address, maxTries uint64) ([]*chainhash.Hash, error) {
+	numThreads, err := m.startDiscreteMining()
+	if err != nil {
+		return nil, err
+	}
+	defer m.stopDiscreteMining()
 
 	log.Tracef("Generating %d blocks", n)
 
+	var tries *int64
+	if maxTries != 0 {
+		tries = new(int64)
+		*tries = int64(maxTries)
+		if *tries < 0 {
+			*tries = math.MaxInt64
+		}
+	}
+
 	i := uint32(0)
 	blockHashes := make([]*chainhash.Hash, n)
 
@@ -575,8 +695,8 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 
 	for {
 		// Read updateNumWorkers in case someone tries a `setgenerate` while
-		// we're generating. We can ignore it as the `generate` RPC call only
-		// uses 1 worker.
+		// we're generating. We can ignore it as the `generate` RPC call keeps
+		// the number of threads it started with.
 		select {
 		case <-m.updateNumWorkers:
 		default:
@@ -588,14 +708,17 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		m.submitBlockLock.Lock()
 		curHeight := m.g.BestSnapshot().Height
 
-		// Choose a payment address at random.
-		rand.Seed(time.Now().UnixNano())
-		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		// Choose a payment address at random unless one was passed.
+		addr := payToAddr
+		if addr == nil {
+			rand.Seed(time.Now().UnixNano())
+			addr = m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		}
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
 		// include in the block.
-		template, err := m.g.NewBlockTemplate(payToAddr)
+		template, err := m.g.NewBlockTemplate(addr)
 		m.submitBlockLock.Unlock()
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to create new block "+
@@ -608,25 +731,52 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, nil) {
+		if m.solveBlock(template.Block, curHeight+1, numThreads, tries,
+			ticker, nil) {
+
 			block := btcutil.NewBlock(template.Block)
 			m.submitBlock(block)
 			blockHashes[i] = block.Hash()
 			i++
 			if i == n {
 				log.Tracef("Generated %d blocks", i)
-				m.Lock()
-				close(m.speedMonitorQuit)
-				m.wg.Wait()
-				m.started = false
-				m.discreteMining = false
-				m.Unlock()
 				return blockHashes, nil
 			}
+		} else if tries != nil && atomic.LoadInt64(tries) <= 0 {
+			log.Tracef("Generated %d blocks before running out "+
+				"of tries", i)
+			return blockHashes[:i], nil
 		}
 	}
 }
 
+// GenerateBlock solves the passed block template, such as one created by
+// NewBlockTemplateWithTxs of the block template generator, and submits the
+// block.  It returns the hash of the block, or an error when the template
+// became stale or the block was rejected.
+func (m *CPUMiner) GenerateBlock(template *mining.BlockTemplate) (*chainhash.Hash, error) {
+	numThreads, err := m.startDiscreteMining()
+	if err != nil {
+		return nil, err
+	}
+	defer m.stopDiscreteMining()
+
+	ticker := time.NewTicker(time.Second * hashUpdateSecs)
+	defer ticker.Stop()
+
+	if !m.solveBlock(template.Block, template.Height, numThreads, nil,
+		ticker, nil) {
+
+		return nil, errors.New("block template became stale before " +
+			"it was solved")
+	}
+	block := btcutil.NewBlock(template.Block)
+	if !m.submitBlock(block) {
+		return nil, fmt.Errorf("block %v was rejected", block.Hash())
+	}
+	return block.Hash(), nil
+}
+
 // New returns a new instance of a CPU miner for the provided configuration.
 // Use Start to begin the mining process.  See the documentation for CPUMiner
 // type for more details.
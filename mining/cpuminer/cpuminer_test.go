@@ -0,0 +1,220 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cpuminer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// emptyTxSource is a mining.TxSource without any transactions.
+type emptyTxSource struct{}
+
+// LastUpdated returns the zero time since the source never changes.  This is
+// part of the mining.TxSource interface.
+func (emptyTxSource) LastUpdated() time.Time { return time.Time{} }
+
+// MiningDescs returns no transactions.  This is part of the mining.TxSource
+// interface.
+func (emptyTxSource) MiningDescs() []*mining.TxDesc { return nil }
+
+// HaveTransaction returns false since the source has no transactions.  This is
+// part of the mining.TxSource interface.
+func (emptyTxSource) HaveTransaction(*chainhash.Hash) bool { return false }
+
+// newTestMiner returns a CPU miner which mines on a new chain with the passed
+// parameters, along with the chain and a teardown function.
+func newTestMiner(t *testing.T, params *chaincfg.Params) (*CPUMiner, *blockchain.BlockChain, func()) {
+	dbPath, err := ioutil.TempDir("", "cpuminertest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create db: %v", err)
+	}
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create claimtrie: %v", err)
+	}
+	teardown := func() {
+		ct.Close()
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	timeSource := blockchain.NewMedianTime()
+	sigCache := txscript.NewSigCache(1000)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  timeSource,
+		SigCache:    sigCache,
+		ClaimTrie:   ct,
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	policy := mining.Policy{
+		BlockMaxWeight: blockchain.MaxBlockWeight - 4000,
+		BlockMaxSize:   blockchain.MaxBlockBaseSize - 1000,
+	}
+	generator := mining.NewBlkTmplGenerator(&policy, params,
+		emptyTxSource{}, chain, timeSource, sigCache,
+		txscript.NewHashCache(0))
+
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create address: %v", err)
+	}
+	miner := New(&Config{
+		ChainParams:            params,
+		BlockTemplateGenerator: generator,
+		MiningAddrs:            []btcutil.Address{addr},
+		ProcessBlock: func(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
+			_, isOrphan, err := chain.ProcessBlock(block, flags)
+			return isOrphan, err
+		},
+		ConnectedCount: func() int32 { return 1 },
+		IsCurrent:      func() bool { return true },
+	})
+	return miner, chain, teardown
+}
+
+// TestGenerateNBlocks ensures the blocks mined by the CPU miner with several
+// threads satisfy the LBRY proof of work and are accepted by the chain.
+func TestGenerateNBlocks(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	miner, chain, teardown := newTestMiner(t, &params)
+	defer teardown()
+
+	// The regression test target accepts about half of all hashes, so
+	// blocks solved against any other hash are rejected quickly.
+	const numBlocks = 20
+	miner.SetNumWorkers(4)
+	hashes, err := miner.GenerateNBlocks(numBlocks)
+	if err != nil {
+		t.Fatalf("GenerateNBlocks: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Height != numBlocks {
+		t.Fatalf("best chain height %d instead of %d", best.Height,
+			numBlocks)
+	}
+	for i, hash := range hashes {
+		block, err := chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("BlockByHash(%v): %v", hash, err)
+		}
+		if block.Height() != int32(i+1) {
+			t.Fatalf("block %v at height %d instead of %d", hash,
+				block.Height(), i+1)
+		}
+		err = blockchain.CheckProofOfWork(block, params.PowLimit)
+		if err != nil {
+			t.Fatalf("block %v: %v", hash, err)
+		}
+	}
+	if miner.IsMining() {
+		t.Fatal("miner still running after GenerateNBlocks")
+	}
+}
+
+// TestGenerateNBlocksToAddress ensures the blocks generated for an address pay
+// to it, and that generating stops once the tries are used up.
+func TestGenerateNBlocksToAddress(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	miner, chain, teardown := newTestMiner(t, &params)
+	defer teardown()
+
+	addr, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{1}, 20),
+		&params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	hashes, err := miner.GenerateNBlocksToAddress(3, addr, 0)
+	if err != nil {
+		t.Fatalf("GenerateNBlocksToAddress: %v", err)
+	}
+	if len(hashes) != 3 {
+		t.Fatalf("generated %d blocks instead of 3", len(hashes))
+	}
+	for _, hash := range hashes {
+		block, err := chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("BlockByHash(%v): %v", hash, err)
+		}
+		txOut := block.MsgBlock().Transactions[0].TxOut[0]
+		if !bytes.Equal(txOut.PkScript, pkScript) {
+			t.Fatalf("block %v pays to %x instead of %x", hash,
+				txOut.PkScript, pkScript)
+		}
+	}
+
+	// About half of all hashes solve a block, so far fewer blocks than
+	// requested are generated with as many tries.
+	const numBlocks = 200
+	hashes, err = miner.GenerateNBlocksToAddress(numBlocks, addr, numBlocks)
+	if err != nil {
+		t.Fatalf("GenerateNBlocksToAddress: %v", err)
+	}
+	if len(hashes) == numBlocks {
+		t.Fatalf("generated all %d blocks with as many tries", numBlocks)
+	}
+	if best := chain.BestSnapshot(); best.Height != int32(3+len(hashes)) {
+		t.Fatalf("best chain height %d instead of %d", best.Height,
+			3+len(hashes))
+	}
+	if miner.IsMining() {
+		t.Fatal("miner still running after GenerateNBlocksToAddress")
+	}
+}
+
+// TestGenerateBlock ensures a block template created by the generator is solved
+// and connected to the chain.
+func TestGenerateBlock(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	miner, chain, teardown := newTestMiner(t, &params)
+	defer teardown()
+
+	template, err := miner.g.NewBlockTemplateWithTxs(miner.cfg.MiningAddrs[0],
+		nil)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	hash, err := miner.GenerateBlock(template)
+	if err != nil {
+		t.Fatalf("GenerateBlock: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Hash != *hash || best.Height != 1 {
+		t.Fatalf("best block %v at height %d instead of %v", best.Hash,
+			best.Height, hash)
+	}
+	if miner.IsMining() {
+		t.Fatal("miner still running after GenerateBlock")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"container/heap"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
@@ -31,6 +33,19 @@ const (
 	// and is used to monitor BIP16 support as well as blocks that are
 	// generated via btcd.
 	CoinbaseFlags = "/P2SH/btcd/"
+
+	// MaxCoinbaseTagLen is the maximum length of the coinbase tag of the
+	// mining policy.  The coinbase script holds the height in up to 5
+	// bytes, the extra nonce in up to 9 bytes, and the coinbase flags
+	// along with the tag in a push of up to 2 bytes more than their
+	// length.
+	MaxCoinbaseTagLen = blockchain.MaxCoinbaseScriptLen - 5 - 9 - 2 -
+		len(CoinbaseFlags)
+
+	// CoinbaseShares is the number of shares the coinbase value is split
+	// into for the coinbase payouts of the mining policy, so one share is
+	// a hundredth of a percent.
+	CoinbaseShares = 10000
 )
 
 // TxDesc is a descriptor about a transaction in a transaction source along with
@@ -51,6 +66,32 @@ type TxDesc struct {
 
 	// FeePerKB is the fee the transaction pays in Satoshi per 1000 bytes.
 	FeePerKB int64
+
+	// FeeDelta is added to the fee the transaction pays when selecting the
+	// transactions of a block, which allows prioritizing or penalizing it.
+	// Neither Fee nor FeePerKB include it.
+	FeeDelta int64
+
+	// AncestorFee, AncestorSize and AncestorCount are the total fee, virtual
+	// size and number of the transaction and all of its ancestors in the
+	// source pool.  Sources which don't track ancestors leave them zero, in
+	// which case they are calculated from the transactions themselves.  The
+	// fee totals include the fee deltas.
+	AncestorFee   int64
+	AncestorSize  int64
+	AncestorCount int
+
+	// DescendantFee, DescendantSize and DescendantCount are the total fee,
+	// virtual size and number of the transaction and all of its descendants
+	// in the source pool.
+	DescendantFee   int64
+	DescendantSize  int64
+	DescendantCount int
+}
+
+// ModifiedFee returns the fee the transaction pays along with its fee delta.
+func (txD *TxDesc) ModifiedFee() int64 {
+	return txD.Fee + txD.FeeDelta
 }
 
 // TxSource represents a source of transactions to consider for inclusion in
@@ -81,11 +122,35 @@ type txPrioItem struct {
 	priority float64
 	feePerKB int64
 
+	// modifiedFee is the fee the transaction is prioritized by, which
+	// includes the fee delta of the source pool.  The fee per kilobyte
+	// is based on it.
+	modifiedFee int64
+
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
 	// transactions in the source pool and hence must come after them in
 	// a block.
 	dependsOn map[chainhash.Hash]struct{}
+
+	// desc is the descriptor of the transaction in the source pool, and
+	// size its virtual size.
+	desc *TxDesc
+	size int64
+
+	// ancestors holds all of the transactions in the source pool this one
+	// depends on, directly or not, and descendants the ones depending on
+	// it.  The ancestor fee and size are the totals of the transaction
+	// and its ancestors which are not in the block yet.
+	ancestors    map[chainhash.Hash]*txPrioItem
+	descendants  []*txPrioItem
+	ancestorFee  int64
+	ancestorSize int64
+
+	// included is set once the transaction is added to the block, and
+	// failed when it can't be, which also rules out its descendants.
+	included bool
+	failed   bool
 }
 
 // txPriorityQueueLessFunc describes a function that can be used as a compare
@@ -183,10 +248,149 @@ func newTxPriorityQueue(reserve int, sortByFee bool) *txPriorityQueue {
 	return pq
 }
 
+// txPackageEntry is an entry of a txPackageQueue, which is a transaction along
+// with the fee and size of its package at the time it was queued.
+type txPackageEntry struct {
+	item    *txPrioItem
+	fee     int64
+	size    int64
+	feeRate float64
+	hash    *chainhash.Hash
+}
+
+// newTxPackageEntry returns an entry for the passed transaction and its current
+// package.
+func newTxPackageEntry(item *txPrioItem) *txPackageEntry {
+	return &txPackageEntry{
+		item:    item,
+		fee:     item.ancestorFee,
+		size:    item.ancestorSize,
+		feeRate: float64(item.ancestorFee) / float64(item.ancestorSize),
+		hash:    item.tx.Hash(),
+	}
+}
+
+// txPackageQueue implements a priority queue of packages, which are the
+// transactions along with their ancestors not in the block yet, sorted by the
+// fee per kilobyte of the packages and then their hash.
+type txPackageQueue []*txPackageEntry
+
+// Len returns the number of entries in the queue.  It is part of the
+// heap.Interface implementation.
+func (pq txPackageQueue) Len() int {
+	return len(pq)
+}
+
+// Less returns whether the package with index i pays a higher fee per kilobyte
+// than the one with index j.  It is part of the heap.Interface implementation.
+func (pq txPackageQueue) Less(i, j int) bool {
+	if pq[i].feeRate == pq[j].feeRate {
+		return bytes.Compare(pq[i].hash[:], pq[j].hash[:]) < 0
+	}
+	return pq[i].feeRate > pq[j].feeRate
+}
+
+// Swap swaps the entries at the passed indices in the queue.  It is part of the
+// heap.Interface implementation.
+func (pq txPackageQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+// Push pushes the passed entry onto the queue.  It is part of the
+// heap.Interface implementation.
+func (pq *txPackageQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(*txPackageEntry))
+}
+
+// Pop removes the entry of the package with the highest fee per kilobyte from
+// the queue and returns it.  It is part of the heap.Interface implementation.
+func (pq *txPackageQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*pq = old[0 : n-1]
+	return entry
+}
+
+// setAncestors determines the ancestors of the passed transaction among the
+// passed candidates for inclusion, along with its package fee and size.  The
+// transaction is marked as failed when it depends on a transaction which isn't
+// a candidate.
+func setAncestors(item *txPrioItem, items map[chainhash.Hash]*txPrioItem) {
+	if item.ancestors != nil || item.failed {
+		return
+	}
+
+	ancestors := make(map[chainhash.Hash]*txPrioItem)
+	for hash := range item.dependsOn {
+		parent, ok := items[hash]
+		if ok {
+			setAncestors(parent, items)
+		}
+		if !ok || parent.failed {
+			log.Tracef("Skipping tx %s since it depends on %s",
+				item.tx.Hash(), hash)
+			item.failed = true
+			return
+		}
+		ancestors[hash] = parent
+		for ancestorHash, ancestor := range parent.ancestors {
+			ancestors[ancestorHash] = ancestor
+		}
+	}
+	item.ancestors = ancestors
+
+	// Prefer the totals tracked by the source pool, which are the same
+	// since all of the ancestors in the pool are candidates.
+	if item.desc.AncestorCount > 0 {
+		item.ancestorFee = item.desc.AncestorFee
+		item.ancestorSize = item.desc.AncestorSize
+	} else {
+		item.ancestorFee = item.modifiedFee
+		item.ancestorSize = item.size
+		for _, ancestor := range ancestors {
+			item.ancestorFee += ancestor.modifiedFee
+			item.ancestorSize += ancestor.size
+		}
+	}
+	for _, ancestor := range ancestors {
+		ancestor.descendants = append(ancestor.descendants, item)
+	}
+}
+
+// witnessCommitmentWeight returns the weight the witness commitment adds to the
+// passed coinbase transaction.
+func witnessCommitmentWeight(coinbaseTx *btcutil.Tx) uint32 {
+	// Account for the additional weight with a model coinbase transaction
+	// with a witness commitment.
+	coinbaseCopy := btcutil.NewTx(coinbaseTx.MsgTx().Copy())
+	coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
+		bytes.Repeat([]byte("a"), blockchain.CoinbaseWitnessDataLen),
+	}
+	coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
+		PkScript: bytes.Repeat([]byte("a"),
+			blockchain.CoinbaseWitnessPkScriptLength),
+	})
+
+	// In order to accurately account for the weight addition due to this
+	// coinbase transaction, the difference of the transaction before and
+	// after the addition of the commitment is added to the block weight.
+	weightDiff := blockchain.GetTransactionWeight(coinbaseCopy) -
+		blockchain.GetTransactionWeight(coinbaseTx)
+	return uint32(weightDiff)
+}
+
 // BlockTemplate houses a block that has yet to be solved along with additional
 // details about the fees and the number of signature operations for each
 // transaction in the block.
 type BlockTemplate struct {
+	// ID identifies the set of transactions selected for the template.  It
+	// is of the form "<previous block hash>-<sequence number>" and changes
+	// whenever the generator creates a new template, but not when a cached
+	// template is handed out again.
+	ID string
+
 	// Block is a block that is ready to be solved by miners.  Thus, it is
 	// completely valid with the exception of satisfying the proof-of-work
 	// requirement.
@@ -219,17 +423,18 @@ type BlockTemplate struct {
 	WitnessCommitment []byte
 }
 
-// mergeUtxoView adds all of the entries in viewB to viewA.  The result is that
-// viewA will contain all of its original entries plus all of the entries
-// in viewB.  It will replace any entries in viewB which also exist in viewA
-// if the entry in viewA is spent.
+// mergeUtxoView adds copies of all of the entries in viewB to viewA.  The
+// result is that viewA will contain all of its original entries plus all of the
+// entries in viewB.  It will replace any entries in viewB which also exist in
+// viewA if the entry in viewA is spent.  The entries are copied so spending
+// them in viewA leaves viewB untouched.
 func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpoint) {
 	viewAEntries := viewA.Entries()
 	for outpoint, entryB := range viewB.Entries() {
 		if entryA, exists := viewAEntries[outpoint]; !exists ||
 			entryA == nil || entryA.IsSpent() {
 
-			viewAEntries[outpoint] = entryB
+			viewAEntries[outpoint] = entryB.Clone()
 		}
 	}
 }
@@ -237,37 +442,26 @@ func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpo
 // standardCoinbaseScript returns a standard script suitable for use as the
 // signature script of the coinbase transaction of a new block.  In particular,
 // it starts with the block height that is required by version 2 blocks and adds
-// the extra nonce as well as additional coinbase flags.
-func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64) ([]byte, error) {
+// the extra nonce as well as additional coinbase flags followed by the passed
+// coinbase tag.
+func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64, tag string) ([]byte, error) {
 	return txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
-		AddInt64(int64(extraNonce)).AddData([]byte(CoinbaseFlags)).
+		AddInt64(int64(extraNonce)).AddData([]byte(CoinbaseFlags + tag)).
 		Script()
 }
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate subsidy
-// based on the passed block height to the provided address.  When the address
-// is nil, the coinbase transaction will instead be redeemable by anyone.
+// based on the passed block height to the provided address along with the
+// passed payouts.  When the address is nil, the coinbase transaction will
+// instead be redeemable by anyone.
 //
 // See the comment for NewBlockTemplate for more information about why the nil
 // address handling is useful.
-func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockHeight int32, addr btcutil.Address) (*btcutil.Tx, error) {
-	// Create the script to pay to the provided payment address if one was
-	// specified.  Otherwise create a script that allows the coinbase to be
-	// redeemable by anyone.
-	var pkScript []byte
-	if addr != nil {
-		var err error
-		pkScript, err = txscript.PayToAddrScript(addr)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		var err error
-		scriptBuilder := txscript.NewScriptBuilder()
-		pkScript, err = scriptBuilder.AddOp(txscript.OP_TRUE).Script()
-		if err != nil {
-			return nil, err
-		}
+func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockHeight int32, addr btcutil.Address, payouts []CoinbasePayout) (*btcutil.Tx, error) {
+	txOuts, err := coinbaseOutputs(blockchain.CalcBlockSubsidy(
+		nextBlockHeight, params), addr, payouts)
+	if err != nil {
+		return nil, err
 	}
 
 	tx := wire.NewMsgTx(wire.TxVersion)
@@ -279,13 +473,77 @@ func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockH
 		SignatureScript: coinbaseScript,
 		Sequence:        wire.MaxTxInSequenceNum,
 	})
-	tx.AddTxOut(&wire.TxOut{
-		Value:    blockchain.CalcBlockSubsidy(nextBlockHeight, params),
-		PkScript: pkScript,
-	})
+	tx.TxOut = txOuts
 	return btcutil.NewTx(tx), nil
 }
 
+// coinbaseOutputs returns the outputs of a coinbase transaction paying the
+// passed value.  Each of the passed payouts receives its share of the value,
+// and the first output pays the rest to the passed address.  When the address
+// is nil, the whole value is instead paid to a single output which is
+// redeemable by anyone, since the coinbase transaction is replaced by the
+// caller anyway.
+func coinbaseOutputs(value int64, addr btcutil.Address, payouts []CoinbasePayout) ([]*wire.TxOut, error) {
+	pkScript, err := coinbasePkScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	txOuts := []*wire.TxOut{{Value: value, PkScript: pkScript}}
+	if addr == nil {
+		return txOuts, nil
+	}
+
+	for _, payout := range payouts {
+		pkScript, err := txscript.PayToAddrScript(payout.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		// Avoid overflows by splitting the value at the share count.
+		share := int64(payout.Share)
+		payoutValue := value/CoinbaseShares*share +
+			value%CoinbaseShares*share/CoinbaseShares
+		txOuts[0].Value -= payoutValue
+		txOuts = append(txOuts, &wire.TxOut{
+			Value:    payoutValue,
+			PkScript: pkScript,
+		})
+	}
+	return txOuts, nil
+}
+
+// coinbasePkScript returns the script to pay to the provided payment address if
+// one was specified.  Otherwise it returns a script that allows the coinbase to
+// be redeemable by anyone.
+func coinbasePkScript(addr btcutil.Address) ([]byte, error) {
+	if addr != nil {
+		return txscript.PayToAddrScript(addr)
+	}
+	return txscript.NewScriptBuilder().AddOp(txscript.OP_TRUE).Script()
+}
+
+// copyTemplate returns a copy of the passed block template with a coinbase that
+// pays to the passed address along with the coinbase payouts of the policy, or
+// is redeemable by anyone if the address is nil.  The copy can be modified, such
+// as by solving it, without affecting the passed template.  Only the header and
+// the coinbase transaction are copied since the other transactions of the block
+// are never modified.
+func (g *BlkTmplGenerator) copyTemplate(template *BlockTemplate, payToAddress btcutil.Address) (*BlockTemplate, error) {
+	msgBlock := *template.Block
+	msgBlock.Transactions = make([]*wire.MsgTx, len(template.Block.Transactions))
+	copy(msgBlock.Transactions, template.Block.Transactions)
+	msgBlock.Transactions[0] = template.Block.Transactions[0].Copy()
+
+	templateCopy := *template
+	templateCopy.Block = &msgBlock
+	templateCopy.Fees = append([]int64(nil), template.Fees...)
+	templateCopy.SigOpCosts = append([]int64(nil), template.SigOpCosts...)
+	if err := g.UpdateCoinbasePayouts(&templateCopy, payToAddress); err != nil {
+		return nil, err
+	}
+	return &templateCopy, nil
+}
+
 // spendTransaction updates the passed view by marking the inputs to the passed
 // transaction as spent.  It also adds all outputs in the passed transaction
 // which are not provably unspendable as available unspent transaction outputs.
@@ -353,6 +611,20 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+
+	// The following fields cache the most recently generated template and
+	// the utxos referenced by the transactions of the source pool as of
+	// the block the template builds on, so the template is only rebuilt
+	// when the source pool or the best chain changed, and then only the
+	// utxos of new transactions have to be fetched.  The templateChanged
+	// channel is closed and replaced whenever a new template is generated.
+	cacheMtx        sync.Mutex
+	template        *BlockTemplate
+	templateTxTime  time.Time
+	templateSeq     uint64
+	templateChanged chan struct{}
+	utxoCacheTip    chainhash.Hash
+	utxoCache       map[chainhash.Hash]*blockchain.UtxoViewpoint
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -368,13 +640,14 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 	hashCache *txscript.HashCache) *BlkTmplGenerator {
 
 	return &BlkTmplGenerator{
-		policy:      policy,
-		chainParams: params,
-		txSource:    txSource,
-		chain:       chain,
-		timeSource:  timeSource,
-		sigCache:    sigCache,
-		hashCache:   hashCache,
+		policy:          policy,
+		chainParams:     params,
+		txSource:        txSource,
+		chain:           chain,
+		timeSource:      timeSource,
+		sigCache:        sigCache,
+		hashCache:       hashCache,
+		templateChanged: make(chan struct{}),
 	}
 }
 
@@ -387,6 +660,14 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // coinbase which will replace the one generated for the block template.  Thus
 // the need to have configured address can be avoided.
 //
+// The most recently generated template is cached, and a copy of it is returned
+// with an updated timestamp as long as the best chain and the transactions of
+// the source pool did not change.  Otherwise a new template is generated, which
+// only needs to look up the utxos spent by the transactions added to the source
+// pool since the previous one unless the best chain changed.  Each new template
+// gets a new ID, and the channels returned by TemplateChanged are closed.  The
+// returned template is always a copy the caller is free to modify.
+//
 // The transactions selected and included are prioritized according to several
 // factors.  First, each transaction has a priority calculated based on its
 // value, age of inputs, and size.  Transactions which consist of larger
@@ -395,24 +676,28 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // higher fee per kilobyte are preferred.  Finally, the block generation related
 // policy settings are all taken into account.
 //
-// Transactions which only spend outputs from other transactions already in the
-// block chain are immediately added to a priority queue which either
-// prioritizes based on the priority (then fee per kilobyte) or the fee per
-// kilobyte (then priority) depending on whether or not the BlockPrioritySize
-// policy setting allots space for high-priority transactions.  Transactions
+// When the BlockPrioritySize policy setting allots space for high-priority
+// transactions, transactions which only spend outputs from other transactions
+// already in the block chain are immediately added to a priority queue which
+// prioritizes based on the priority (then fee per kilobyte).  Transactions
 // which spend outputs from other transactions in the source pool are added to a
 // dependency map so they can be added to the priority queue once the
 // transactions they depend on have been included.
 //
 // Once the high-priority area (if configured) has been filled with
 // transactions, or the priority falls below what is considered high-priority,
-// the priority queue is updated to prioritize by fees per kilobyte (then
-// priority).
+// the remaining transactions are selected by the fee per kilobyte of their
+// package, which is the transaction along with all of its ancestors in the
+// source pool that are not in the block yet.  The package with the highest fee
+// per kilobyte is added as a whole, so a transaction paying a high fee pulls in
+// the ancestors it depends on even when they pay a low fee (child pays for
+// parent).  The packages of the transactions depending on the added ones are
+// then reevaluated without the added transactions.
 //
-// When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
-// transaction will be skipped unless the BlockMinSize policy setting is
-// nonzero, in which case the block will be filled with the low-fee/free
-// transactions until the block size reaches that minimum size.
+// When the fees per kilobyte of a package drop below the TxMinFreeFee policy
+// setting, the package will be skipped unless the BlockMinSize policy setting
+// is nonzero, in which case the block will be filled with the low-fee/free
+// packages until the block size reaches that minimum size.
 //
 // Any transactions which would cause the block to exceed the BlockMaxSize
 // policy setting, exceed the maximum allowed signature operations per block, or
@@ -430,7 +715,7 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //  |                                   |   |
 //  |                                   |   |
 //  |                                   |   |--- policy.BlockMaxSize
-//  |  Transactions prioritized by fee  |   |
+//  |  Packages prioritized by fee      |   |
 //  |  until <= policy.TxMinFreeFee     |   |
 //  |                                   |   |
 //  |                                   |   |
@@ -441,12 +726,194 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //  |  <= policy.BlockMinSize)          |   |
 //   -----------------------------------  --
 func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*BlockTemplate, error) {
-	// Extend the most recently known best block.
+	g.cacheMtx.Lock()
+	defer g.cacheMtx.Unlock()
+
+	// Hand out the cached template when it still extends the most recently
+	// known best block and the source pool wasn't updated since it was
+	// generated.  The time the source pool was updated is queried before
+	// the transactions, so an update while generating the template causes
+	// it to be generated again next time.
+	best := g.chain.BestSnapshot()
+	txTime := g.txSource.LastUpdated()
+	if g.template != nil && g.template.Block.Header.PrevBlock == best.Hash &&
+		g.templateTxTime.Equal(txTime) {
+
+		template, err := g.copyTemplate(g.template, payToAddress)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.UpdateBlockTime(template.Block); err != nil {
+			return nil, err
+		}
+		log.Tracef("Reusing block template %s", template.ID)
+		return template, nil
+	}
+
+	template, err := g.newBlockTemplate(best, payToAddress)
+	if err != nil {
+		return nil, err
+	}
+	g.templateSeq++
+	template.ID = fmt.Sprintf("%s-%d", best.Hash, g.templateSeq)
+	g.template = template
+	g.templateTxTime = txTime
+	close(g.templateChanged)
+	g.templateChanged = make(chan struct{})
+
+	return g.copyTemplate(template, payToAddress)
+}
+
+// TemplateChanged returns a channel which is closed once a block template with
+// an ID other than the passed one has been generated.  The returned channel is
+// already closed when the most recently generated template has another ID.
+// This allows callers, such as long polling clients of getblocktemplate, to
+// wait for their template to be replaced.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) TemplateChanged(id string) <-chan struct{} {
+	g.cacheMtx.Lock()
+	defer g.cacheMtx.Unlock()
+
+	if g.template != nil && g.template.ID != id {
+		c := make(chan struct{})
+		close(c)
+		return c
+	}
+	return g.templateChanged
+}
+
+// NewBlockTemplateWithTxs returns a new block template like NewBlockTemplate,
+// which holds exactly the passed transactions in the passed order instead of
+// transactions selected from the source pool.  Transactions may only spend the
+// outputs of the ones before them, and an error is returned when any of them
+// can't be included in the block.  The template is not cached and doesn't
+// affect the templates returned by NewBlockTemplate.
+//
+// This is useful for tests which need blocks with particular transactions, such
+// as the generateblock RPC.
+func (g *BlkTmplGenerator) NewBlockTemplateWithTxs(payToAddress btcutil.Address, txns []*btcutil.Tx) (*BlockTemplate, error) {
 	best := g.chain.BestSnapshot()
 	nextBlockHeight := best.Height + 1
 
 	// Create a standard coinbase transaction paying to the provided
-	// address.  NOTE: The coinbase value will be updated to include the
+	// address along with the payouts of the policy.  Its value is updated
+	// once the fees of the transactions are known.
+	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, 0,
+		g.policy.CoinbaseTag)
+	if err != nil {
+		return nil, err
+	}
+	coinbaseTx, err := createCoinbaseTx(g.chainParams, coinbaseScript,
+		nextBlockHeight, payToAddress, g.policy.CoinbasePayouts)
+	if err != nil {
+		return nil, err
+	}
+
+	segwitState, err := g.chain.ThresholdState(chaincfg.DeploymentSegwit)
+	if err != nil {
+		return nil, err
+	}
+	segwitActive := segwitState == blockchain.ThresholdActive
+	witnessIncluded := segwitActive && g.policy.AlwaysWitnessCommitment
+
+	blockTxns := make([]*btcutil.Tx, 0, len(txns)+1)
+	blockTxns = append(blockTxns, coinbaseTx)
+	txFees := make([]int64, 0, len(txns)+1)
+	txSigOpCosts := make([]int64, 0, len(txns)+1)
+	txFees = append(txFees, -1) // Updated once known
+	txSigOpCosts = append(txSigOpCosts,
+		int64(blockchain.CountSigOps(coinbaseTx))*blockchain.WitnessScaleFactor)
+	totalFees := int64(0)
+
+	// Check each transaction against a view of the outputs of the chain
+	// and of the transactions before it.  The block as a whole is checked
+	// against the consensus rules once it is complete.
+	blockUtxos := blockchain.NewUtxoViewpoint()
+	included := make(map[chainhash.Hash]struct{}, len(txns))
+	for _, tx := range txns {
+		if _, ok := included[*tx.Hash()]; ok {
+			return nil, fmt.Errorf("transaction %v is included twice",
+				tx.Hash())
+		}
+		if blockchain.IsCoinBase(tx) {
+			return nil, fmt.Errorf("transaction %v is a coinbase",
+				tx.Hash())
+		}
+		if tx.HasWitness() {
+			if !segwitActive {
+				return nil, fmt.Errorf("transaction %v has "+
+					"witness data before segwit is active",
+					tx.Hash())
+			}
+			witnessIncluded = true
+		}
+
+		utxos, err := g.chain.FetchUtxoView(tx)
+		if err != nil {
+			return nil, err
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			if blockUtxos.LookupEntry(txIn.PreviousOutPoint) != nil {
+				continue
+			}
+			entry := utxos.LookupEntry(txIn.PreviousOutPoint)
+			if entry != nil {
+				blockUtxos.Entries()[txIn.PreviousOutPoint] =
+					entry.Clone()
+			}
+		}
+
+		fee, err := blockchain.CheckTransactionInputs(tx,
+			nextBlockHeight, blockUtxos, g.chainParams)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %v can't be "+
+				"included in the block: %v", tx.Hash(), err)
+		}
+		sigOpCost, err := blockchain.GetSigOpCost(tx, false,
+			blockUtxos, true, segwitActive)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %v can't be "+
+				"included in the block: %v", tx.Hash(), err)
+		}
+		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
+			txscript.StandardVerifyFlags, g.sigCache, g.hashCache)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %v can't be "+
+				"included in the block: %v", tx.Hash(), err)
+		}
+		spendTransaction(blockUtxos, tx, nextBlockHeight)
+
+		blockTxns = append(blockTxns, tx)
+		txFees = append(txFees, fee)
+		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
+		totalFees += fee
+		included[*tx.Hash()] = struct{}{}
+	}
+
+	return g.completeBlockTemplate(best, payToAddress, blockTxns, txFees,
+		txSigOpCosts, totalFees, witnessIncluded)
+}
+
+// newBlockTemplate generates a new block template extending the passed best
+// block as described by NewBlockTemplate.  The utxos referenced by the
+// transactions of the source pool are cached for the next template extending
+// the same block.
+//
+// This function MUST be called with the cache lock held.
+func (g *BlkTmplGenerator) newBlockTemplate(best *blockchain.BestState, payToAddress btcutil.Address) (*BlockTemplate, error) {
+	// Extend the most recently known best block.
+	nextBlockHeight := best.Height + 1
+
+	// The cached utxos are only valid for the block they were fetched
+	// for, so start over once the best chain changed.
+	if g.utxoCacheTip != best.Hash {
+		g.utxoCache = nil
+	}
+	utxoCache := make(map[chainhash.Hash]*blockchain.UtxoViewpoint)
+
+	// Create a standard coinbase transaction paying to the provided
+	// address along with the payouts of the policy.  NOTE: The coinbase value will be updated to include the
 	// fees from the selected transactions later after they have actually
 	// been selected.  It is created here to detect any errors early
 	// before potentially doing a lot of work below.  The extra nonce helps
@@ -454,12 +921,13 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	// same value to the same public key address would otherwise be an
 	// identical transaction for block version 1).
 	extraNonce := uint64(0)
-	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce,
+		g.policy.CoinbaseTag)
 	if err != nil {
 		return nil, err
 	}
 	coinbaseTx, err := createCoinbaseTx(g.chainParams, coinbaseScript,
-		nextBlockHeight, payToAddress)
+		nextBlockHeight, payToAddress, g.policy.CoinbasePayouts)
 	if err != nil {
 		return nil, err
 	}
@@ -504,6 +972,10 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	log.Debugf("Considering %d transactions for inclusion to new block",
 		len(sourceTxns))
 
+	// items houses all of the transactions which are candidates for
+	// inclusion, keyed by their hash.
+	items := make(map[chainhash.Hash]*txPrioItem, len(sourceTxns))
+
 mempoolLoop:
 	for _, txDesc := range sourceTxns {
 		// A block can't have more than one coinbase or contain
@@ -520,22 +992,28 @@ mempoolLoop:
 			continue
 		}
 
-		// Fetch all of the utxos referenced by the this transaction.
+		// Fetch all of the utxos referenced by the this transaction
+		// unless they were already fetched for a previous template.
 		// NOTE: This intentionally does not fetch inputs from the
 		// mempool since a transaction which depends on other
 		// transactions in the mempool must come after those
 		// dependencies in the final generated block.
-		utxos, err := g.chain.FetchUtxoView(tx)
-		if err != nil {
-			log.Warnf("Unable to fetch utxo view for tx %s: %v",
-				tx.Hash(), err)
-			continue
+		utxos, ok := g.utxoCache[*tx.Hash()]
+		if !ok {
+			var err error
+			utxos, err = g.chain.FetchUtxoView(tx)
+			if err != nil {
+				log.Warnf("Unable to fetch utxo view for tx "+
+					"%s: %v", tx.Hash(), err)
+				continue
+			}
 		}
+		utxoCache[*tx.Hash()] = utxos
 
 		// Setup dependencies for any transactions which reference
 		// other transactions in the mempool so they can be properly
 		// ordered below.
-		prioItem := &txPrioItem{tx: tx}
+		prioItem := &txPrioItem{tx: tx, desc: txDesc}
 		for _, txIn := range tx.MsgTx().TxIn {
 			originHash := &txIn.PreviousOutPoint.Hash
 			entry := utxos.LookupEntry(txIn.PreviousOutPoint)
@@ -575,9 +1053,19 @@ mempoolLoop:
 		prioItem.priority = CalcPriority(tx.MsgTx(), utxos,
 			nextBlockHeight)
 
-		// Calculate the fee in Satoshi/kB.
+		// Calculate the fee in Satoshi/kB, which is based on the fee
+		// along with the fee delta when there is one.
+		weight := blockchain.GetTransactionWeight(tx)
+		prioItem.size = (weight + blockchain.WitnessScaleFactor - 1) /
+			blockchain.WitnessScaleFactor
 		prioItem.feePerKB = txDesc.FeePerKB
 		prioItem.fee = txDesc.Fee
+		prioItem.modifiedFee = txDesc.ModifiedFee()
+		if txDesc.FeeDelta != 0 {
+			prioItem.feePerKB = prioItem.modifiedFee * 1000 /
+				prioItem.size
+		}
+		items[*tx.Hash()] = prioItem
 
 		// Add the transaction to the priority queue to mark it ready
 		// for inclusion in the block unless it has dependencies.
@@ -590,6 +1078,14 @@ mempoolLoop:
 		// code below to avoid a second lookup.
 		mergeUtxoView(blockUtxos, utxos)
 	}
+	g.utxoCache = utxoCache
+	g.utxoCacheTip = best.Hash
+
+	// Determine the ancestors of each candidate transaction, which have to
+	// be included along with it, and the fee and size of them combined.
+	for _, item := range items {
+		setAncestors(item, items)
+	}
 
 	log.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
@@ -612,12 +1108,40 @@ mempoolLoop:
 	}
 	segwitActive := segwitState == blockchain.ThresholdActive
 
+	// The policy may require the witness commitment regardless of the
+	// transactions, in which case its weight is accounted for up front.
 	witnessIncluded := false
+	if segwitActive && g.policy.AlwaysWitnessCommitment {
+		blockWeight += witnessCommitmentWeight(coinbaseTx)
+		witnessIncluded = true
+	}
+
+	// addTx adds the passed transaction to the block, increments the
+	// counters, and saves the fees and signature operation counts to the
+	// block template.  The transactions depending on it no longer need to
+	// pay for it.
+	addTx := func(prioItem *txPrioItem, txWeight uint32, sigOpCost int64) {
+		blockTxns = append(blockTxns, prioItem.tx)
+		blockWeight += txWeight
+		blockSigOpCost += sigOpCost
+		totalFees += prioItem.fee
+		txFees = append(txFees, prioItem.fee)
+		txSigOpCosts = append(txSigOpCosts, sigOpCost)
+
+		prioItem.included = true
+		for _, item := range prioItem.descendants {
+			item.ancestorFee -= prioItem.modifiedFee
+			item.ancestorSize -= prioItem.size
+		}
 
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
+		log.Tracef("Adding tx %s (priority %.2f, feePerKB %d)",
+			prioItem.tx.Hash(), prioItem.priority, prioItem.feePerKB)
+	}
+
+	// Fill the high-priority area, if any, with the transactions of the
+	// highest priority.
+	for !sortedByFee && priorityQueue.Len() > 0 {
+		// Grab the highest priority transaction.
 		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
 		tx := prioItem.tx
 
@@ -625,6 +1149,7 @@ mempoolLoop:
 		// If segregated witness has not been activated yet, then we
 		// shouldn't include any witness transactions in the block.
 		case !segwitActive && tx.HasWitness():
+			prioItem.failed = true
 			continue
 
 		// Otherwise, Keep track of if we've included a transaction
@@ -636,26 +1161,8 @@ mempoolLoop:
 			// witness data, then we'll also need to include a
 			// witness commitment in the coinbase transaction.
 			// Therefore, we account for the additional weight
-			// within the block with a model coinbase tx with a
-			// witness commitment.
-			coinbaseCopy := btcutil.NewTx(coinbaseTx.MsgTx().Copy())
-			coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
-				bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessDataLen),
-			}
-			coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
-				PkScript: bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessPkScriptLength),
-			})
-
-			// In order to accurately account for the weight
-			// addition due to this coinbase transaction, we'll add
-			// the difference of the transaction before and after
-			// the addition of the commitment to the block weight.
-			weightDiff := blockchain.GetTransactionWeight(coinbaseCopy) -
-				blockchain.GetTransactionWeight(coinbaseTx)
-
-			blockWeight += uint32(weightDiff)
+			// within the block.
+			blockWeight += witnessCommitmentWeight(coinbaseTx)
 
 			witnessIncluded = true
 		}
@@ -672,6 +1179,7 @@ mempoolLoop:
 			log.Tracef("Skipping tx %s because it would exceed "+
 				"the max block weight", tx.Hash())
 			logSkippedDeps(tx, deps)
+			prioItem.failed = true
 			continue
 		}
 
@@ -683,6 +1191,7 @@ mempoolLoop:
 			log.Tracef("Skipping tx %s due to error in "+
 				"GetSigOpCost: %v", tx.Hash(), err)
 			logSkippedDeps(tx, deps)
+			prioItem.failed = true
 			continue
 		}
 		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
@@ -690,29 +1199,16 @@ mempoolLoop:
 			log.Tracef("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block", tx.Hash())
 			logSkippedDeps(tx, deps)
+			prioItem.failed = true
 			continue
 		}
 
-		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
-			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
-			blockPlusTxWeight >= g.policy.BlockMinWeight {
-
-			log.Tracef("Skipping tx %s with feePerKB %d "+
-				"< TxMinFreeFee %d and block weight %d >= "+
-				"minBlockWeight %d", tx.Hash(), prioItem.feePerKB,
-				g.policy.TxMinFreeFee, blockPlusTxWeight,
-				g.policy.BlockMinWeight)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Prioritize by fee per kilobyte once the block is larger than
-		// the priority size or there are no more high-priority
+		// Prioritize by the fee per kilobyte of the transactions along
+		// with their ancestors once the block is larger than the
+		// priority size or there are no more high-priority
 		// transactions.
-		if !sortedByFee && (blockPlusTxWeight >= g.policy.BlockPrioritySize ||
-			prioItem.priority <= MinHighPriority) {
+		if blockPlusTxWeight >= g.policy.BlockPrioritySize ||
+			prioItem.priority <= MinHighPriority {
 
 			log.Tracef("Switching to sort by fees per "+
 				"kilobyte blockSize %d >= BlockPrioritySize "+
@@ -721,19 +1217,17 @@ mempoolLoop:
 				prioItem.priority, MinHighPriority)
 
 			sortedByFee = true
-			priorityQueue.SetLessFunc(txPQByFee)
-
-			// Put the transaction back into the priority queue and
-			// skip it so it is re-priortized by fees if it won't
-			// fit into the high-priority section or the priority
-			// is too low.  Otherwise this transaction will be the
-			// final one in the high-priority section, so just fall
-			// though to the code below so it is added now.
+
+			// Leave the transaction to be selected by its fees if
+			// it won't fit into the high-priority section or the
+			// priority is too low.  Otherwise this transaction will
+			// be the final one in the high-priority section, so
+			// just fall though to the code below so it is added
+			// now.
 			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
 				prioItem.priority < MinHighPriority {
 
-				heap.Push(priorityQueue, prioItem)
-				continue
+				break
 			}
 		}
 
@@ -745,6 +1239,7 @@ mempoolLoop:
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionInputs: %v", tx.Hash(), err)
 			logSkippedDeps(tx, deps)
+			prioItem.failed = true
 			continue
 		}
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
@@ -754,6 +1249,7 @@ mempoolLoop:
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
 			logSkippedDeps(tx, deps)
+			prioItem.failed = true
 			continue
 		}
 
@@ -762,19 +1258,7 @@ mempoolLoop:
 		// this one have it available as an input and can ensure they
 		// aren't double spending.
 		spendTransaction(blockUtxos, tx, nextBlockHeight)
-
-		// Add the transaction to the block, increment counters, and
-		// save the fees and signature operation counts to the block
-		// template.
-		blockTxns = append(blockTxns, tx)
-		blockWeight += txWeight
-		blockSigOpCost += int64(sigOpCost)
-		totalFees += prioItem.fee
-		txFees = append(txFees, prioItem.fee)
-		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
-
-		log.Tracef("Adding tx %s (priority %.2f, feePerKB %.2f)",
-			prioItem.tx.Hash(), prioItem.priority, prioItem.feePerKB)
+		addTx(prioItem, txWeight, int64(sigOpCost))
 
 		// Add transactions which depend on this one (and also do not
 		// have any other unsatisified dependencies) to the priority
@@ -789,18 +1273,224 @@ mempoolLoop:
 		}
 	}
 
+	// Fill the rest of the block with packages of transactions along with
+	// their ancestors which are not in the block yet, choosing the highest
+	// fee per kilobyte of the packages first.  This allows a transaction
+	// paying a high fee to pull in its ancestors paying a low one.  Each
+	// transaction is queued again whenever one of its ancestors is added,
+	// and the entries whose package changed since are ignored.
+	packageQueue := &txPackageQueue{}
+	for _, item := range items {
+		if !item.included && !item.failed {
+			heap.Push(packageQueue, newTxPackageEntry(item))
+		}
+	}
+
+packageLoop:
+	for packageQueue.Len() > 0 {
+		entry := heap.Pop(packageQueue).(*txPackageEntry)
+		prioItem := entry.item
+		if prioItem.included || prioItem.failed ||
+			entry.fee != prioItem.ancestorFee ||
+			entry.size != prioItem.ancestorSize {
+
+			continue
+		}
+		tx := prioItem.tx
+
+		// Gather the package in an order where all ancestors of a
+		// transaction come before it.
+		pkg := make([]*txPrioItem, 0, len(prioItem.ancestors)+1)
+		for _, item := range prioItem.ancestors {
+			if item.failed {
+				log.Tracef("Skipping tx %s since it depends "+
+					"on %s", tx.Hash(), item.tx.Hash())
+				prioItem.failed = true
+				continue packageLoop
+			}
+			if !item.included {
+				pkg = append(pkg, item)
+			}
+		}
+		pkg = append(pkg, prioItem)
+		sort.Slice(pkg, func(i, j int) bool {
+			if len(pkg[i].ancestors) == len(pkg[j].ancestors) {
+				return bytes.Compare(pkg[i].tx.Hash()[:],
+					pkg[j].tx.Hash()[:]) < 0
+			}
+			return len(pkg[i].ancestors) < len(pkg[j].ancestors)
+		})
+
+		// Witness transactions can't be included before segregated
+		// witness is active, and the first one requires the witness
+		// commitment in the coinbase transaction.
+		pkgWeight := uint32(0)
+		pkgHasWitness := false
+		for _, item := range pkg {
+			if item.tx.HasWitness() {
+				if !segwitActive {
+					item.failed = true
+					continue packageLoop
+				}
+				pkgHasWitness = true
+			}
+			pkgWeight += uint32(blockchain.GetTransactionWeight(item.tx))
+		}
+		var commitmentWeight uint32
+		if pkgHasWitness && !witnessIncluded {
+			commitmentWeight = witnessCommitmentWeight(coinbaseTx)
+			pkgWeight += commitmentWeight
+		}
+
+		// Enforce maximum block size.  Also check for overflow.
+		blockPlusPkgWeight := blockWeight + pkgWeight
+		if blockPlusPkgWeight < blockWeight ||
+			blockPlusPkgWeight >= g.policy.BlockMaxWeight {
+
+			log.Tracef("Skipping tx %s because its package of %d "+
+				"transactions would exceed the max block weight",
+				tx.Hash(), len(pkg))
+			continue
+		}
+
+		// Skip free packages once the block is larger than the minimum
+		// block size.
+		pkgFeePerKB := prioItem.ancestorFee * 1000 / prioItem.ancestorSize
+		if pkgFeePerKB < int64(g.policy.TxMinFreeFee) &&
+			blockPlusPkgWeight >= g.policy.BlockMinWeight {
+
+			log.Tracef("Skipping tx %s with package feePerKB %d "+
+				"< TxMinFreeFee %d and block weight %d >= "+
+				"minBlockWeight %d", tx.Hash(), pkgFeePerKB,
+				g.policy.TxMinFreeFee, blockPlusPkgWeight,
+				g.policy.BlockMinWeight)
+			continue
+		}
+
+		// Ensure all transactions of the package are valid before
+		// adding any of them.  They are checked against a separate
+		// view holding the outputs they spend, so the block utxo view
+		// is left untouched when one of them turns out to be invalid.
+		pkgUtxos := blockchain.NewUtxoViewpoint()
+		for _, item := range pkg {
+			for _, txIn := range item.tx.MsgTx().TxIn {
+				entry := blockUtxos.LookupEntry(txIn.PreviousOutPoint)
+				if entry != nil {
+					pkgUtxos.Entries()[txIn.PreviousOutPoint] =
+						entry.Clone()
+				}
+			}
+		}
+		sigOpCosts := make([]int64, len(pkg))
+		pkgSigOpCost := int64(0)
+		for i, item := range pkg {
+			sigOpCost, err := blockchain.GetSigOpCost(item.tx, false,
+				pkgUtxos, true, segwitActive)
+			if err != nil {
+				log.Tracef("Skipping tx %s due to error in "+
+					"GetSigOpCost: %v", item.tx.Hash(), err)
+				item.failed = true
+				continue packageLoop
+			}
+			sigOpCosts[i] = int64(sigOpCost)
+			pkgSigOpCost += int64(sigOpCost)
+			if blockSigOpCost+pkgSigOpCost < blockSigOpCost ||
+				blockSigOpCost+pkgSigOpCost > blockchain.MaxBlockSigOpsCost {
+				log.Tracef("Skipping tx %s because its package "+
+					"would exceed the maximum sigops per "+
+					"block", tx.Hash())
+				continue packageLoop
+			}
+
+			_, err = blockchain.CheckTransactionInputs(item.tx,
+				nextBlockHeight, pkgUtxos, g.chainParams)
+			if err != nil {
+				log.Tracef("Skipping tx %s due to error in "+
+					"CheckTransactionInputs: %v",
+					item.tx.Hash(), err)
+				item.failed = true
+				continue packageLoop
+			}
+			err = blockchain.ValidateTransactionScripts(item.tx,
+				pkgUtxos, txscript.StandardVerifyFlags,
+				g.sigCache, g.hashCache)
+			if err != nil {
+				log.Tracef("Skipping tx %s due to error in "+
+					"ValidateTransactionScripts: %v",
+					item.tx.Hash(), err)
+				item.failed = true
+				continue packageLoop
+			}
+			spendTransaction(pkgUtxos, item.tx, nextBlockHeight)
+		}
+
+		// Add the package to the block and queue the transactions which
+		// depend on any of its transactions with their reduced package.
+		if pkgHasWitness && !witnessIncluded {
+			blockWeight += commitmentWeight
+			witnessIncluded = true
+		}
+		for i, item := range pkg {
+			spendTransaction(blockUtxos, item.tx, nextBlockHeight)
+			addTx(item, uint32(blockchain.GetTransactionWeight(item.tx)),
+				sigOpCosts[i])
+		}
+		for _, item := range pkg {
+			for _, descendant := range item.descendants {
+				if !descendant.included && !descendant.failed {
+					heap.Push(packageQueue,
+						newTxPackageEntry(descendant))
+				}
+			}
+		}
+	}
+
 	// Now that the actual transactions have been selected, update the
-	// block weight for the real transaction count and coinbase value with
-	// the total fees accordingly.
+	// block weight for the real transaction count and complete the block.
 	blockWeight -= wire.MaxVarIntPayload -
 		(uint32(wire.VarIntSerializeSize(uint64(len(blockTxns)))) *
 			blockchain.WitnessScaleFactor)
-	coinbaseTx.MsgTx().TxOut[0].Value += totalFees
+	template, err := g.completeBlockTemplate(best, payToAddress, blockTxns,
+		txFees, txSigOpCosts, totalFees, witnessIncluded)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Created new block template (%d transactions, %d in "+
+		"fees, %d signature operations cost, %d weight, target difficulty "+
+		"%064x)", len(template.Block.Transactions), totalFees,
+		blockSigOpCost, blockWeight,
+		blockchain.CompactToBig(template.Block.Header.Bits))
+
+	return template, nil
+}
+
+// completeBlockTemplate returns a block template extending the passed best
+// block, which holds the passed transactions after the coinbase.  The coinbase
+// value is split with the total fees among its outputs, the witness commitment
+// is added to it when requested, and the header commits to the transactions and
+// to the ClaimTrie root after the claims of the block.  The block is checked to
+// properly connect to the end of the main chain.
+func (g *BlkTmplGenerator) completeBlockTemplate(best *blockchain.BestState,
+	payToAddress btcutil.Address, blockTxns []*btcutil.Tx, txFees,
+	txSigOpCosts []int64, totalFees int64,
+	witnessIncluded bool) (*BlockTemplate, error) {
+
+	nextBlockHeight := best.Height + 1
+	coinbaseTx := blockTxns[0]
+	var err error
+	coinbaseTx.MsgTx().TxOut, err = coinbaseOutputs(
+		blockchain.CalcBlockSubsidy(nextBlockHeight, g.chainParams)+
+			totalFees, payToAddress, g.policy.CoinbasePayouts)
+	if err != nil {
+		return nil, err
+	}
 	txFees[0] = -totalFees
 
 	// If segwit is active and we included transactions with witness data,
-	// then we'll need to include a commitment to the witness data in an
-	// OP_RETURN output within the coinbase transaction.
+	// or the policy always requires it, then we'll need to include a
+	// commitment to the witness data in an OP_RETURN output within the
+	// coinbase transaction.
 	var witnessCommitment []byte
 	if witnessIncluded {
 		// The witness of the coinbase transaction MUST be exactly 32-bytes
@@ -871,20 +1561,23 @@ mempoolLoop:
 		}
 	}
 
+	// The header commits to the ClaimTrie root after the claims of the
+	// block have been applied.
+	block := btcutil.NewBlock(&msgBlock)
+	block.SetHeight(nextBlockHeight)
+	claimTrieRoot, err := g.chain.CalcTemplateClaimTrieRoot(block)
+	if err != nil {
+		return nil, err
+	}
+	msgBlock.Header.ClaimTrie = *claimTrieRoot
+
 	// Finally, perform a full check on the created block against the chain
 	// consensus rules to ensure it properly connects to the current best
 	// chain with no issues.
-	block := btcutil.NewBlock(&msgBlock)
-	block.SetHeight(nextBlockHeight)
 	if err := g.chain.CheckConnectBlockTemplate(block); err != nil {
 		return nil, err
 	}
 
-	log.Debugf("Created new block template (%d transactions, %d in "+
-		"fees, %d signature operations cost, %d weight, target difficulty "+
-		"%064x)", len(msgBlock.Transactions), totalFees, blockSigOpCost,
-		blockWeight, blockchain.CompactToBig(msgBlock.Header.Bits))
-
 	return &BlockTemplate{
 		Block:             &msgBlock,
 		Fees:              txFees,
@@ -925,7 +1618,8 @@ func (g *BlkTmplGenerator) UpdateBlockTime(msgBlock *wire.MsgBlock) error {
 // height.  It also recalculates and updates the new merkle root that results
 // from changing the coinbase script.
 func (g *BlkTmplGenerator) UpdateExtraNonce(msgBlock *wire.MsgBlock, blockHeight int32, extraNonce uint64) error {
-	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce,
+		g.policy.CoinbaseTag)
 	if err != nil {
 		return err
 	}
@@ -948,6 +1642,61 @@ func (g *BlkTmplGenerator) UpdateExtraNonce(msgBlock *wire.MsgBlock, blockHeight
 	return nil
 }
 
+// UpdateCoinbasePayouts updates the outputs of the coinbase transaction of the
+// passed block template to pay the coinbase value to the passed address along
+// with the coinbase payouts of the policy, or to make it redeemable by anyone
+// if the address is nil.  The witness commitment, if any, is kept.  It also
+// recalculates and updates the merkle root when the coinbase transaction
+// changed.
+func (g *BlkTmplGenerator) UpdateCoinbasePayouts(template *BlockTemplate, payToAddress btcutil.Address) error {
+	coinbaseTx := template.Block.Transactions[0]
+	payouts := coinbaseTx.TxOut
+	if template.WitnessCommitment != nil {
+		payouts = payouts[:len(payouts)-1]
+	}
+	value := int64(0)
+	for _, txOut := range payouts {
+		value += txOut.Value
+	}
+	txOuts, err := coinbaseOutputs(value, payToAddress,
+		g.policy.CoinbasePayouts)
+	if err != nil {
+		return err
+	}
+	template.ValidPayAddress = payToAddress != nil
+
+	// Nothing to do when the coinbase already pays the same outputs.
+	if len(txOuts) == len(payouts) {
+		same := true
+		for i, txOut := range txOuts {
+			if txOut.Value != payouts[i].Value ||
+				!bytes.Equal(txOut.PkScript, payouts[i].PkScript) {
+
+				same = false
+				break
+			}
+		}
+		if same {
+			return nil
+		}
+	}
+
+	// Keep the witness commitment as the last output and update the merkle
+	// root for the new coinbase.
+	coinbaseTx.TxOut = append(txOuts, coinbaseTx.TxOut[len(payouts):]...)
+	block := btcutil.NewBlock(template.Block)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	template.Block.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return nil
+}
+
+// CoinbaseFlags returns the coinbase flags along with the coinbase tag of the
+// policy, which are added to the signature script of the coinbase transaction
+// of the generated block templates.
+func (g *BlkTmplGenerator) CoinbaseFlags() string {
+	return CoinbaseFlags + g.policy.CoinbaseTag
+}
+
 // BestSnapshot returns information about the current best chain block and
 // related state as of the current point in time using the chain instance
 // associated with the block template generator.  The returned state must be
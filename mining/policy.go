@@ -45,6 +45,34 @@ type Policy struct {
 	// required for a transaction to be treated as free for mining purposes
 	// (block template generation).
 	TxMinFreeFee btcutil.Amount
+
+	// CoinbaseTag is added to the coinbase flags in the signature script
+	// of the coinbase transaction.  It must not be longer than
+	// MaxCoinbaseTagLen.
+	CoinbaseTag string
+
+	// CoinbasePayouts are the payouts which receive their share of the
+	// coinbase value in additional outputs of the coinbase transaction,
+	// while the rest is paid to the payment address of the block template.
+	// The shares must add up to less than CoinbaseShares.
+	CoinbasePayouts []CoinbasePayout
+
+	// AlwaysWitnessCommitment indicates whether the coinbase transaction
+	// commits to the witness data once segregated witness is active, even
+	// when the block template doesn't include transactions with witness
+	// data.
+	AlwaysWitnessCommitment bool
+}
+
+// CoinbasePayout is an address receiving a share of the coinbase value of block
+// templates.
+type CoinbasePayout struct {
+	// Address is the address the payout is paid to.
+	Address btcutil.Address
+
+	// Share is the share of the coinbase value paid to the address out of
+	// CoinbaseShares.
+	Share uint32
 }
 
 // minInt is a helper function to return the minimum of two ints.  This avoids
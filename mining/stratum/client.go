@@ -0,0 +1,424 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+const (
+	// maxMessageSize is the maximum size of a message from a miner.
+	maxMessageSize = 16 * 1024
+
+	// idleTimeout is how long a miner may stay silent before it is
+	// disconnected.
+	idleTimeout = 10 * time.Minute
+
+	// writeTimeout is how long a message to a miner may take to be sent.
+	writeTimeout = 30 * time.Second
+
+	// targetShareInterval is the average time between the shares of a miner
+	// its difficulty is adjusted for.
+	targetShareInterval = 10 * time.Second
+
+	// retargetInterval is how often the difficulty of a miner is adjusted,
+	// unless it submits retargetShares shares sooner.
+	retargetInterval = 90 * time.Second
+	retargetShares   = 30
+
+	// maxRetargetFactor is the most the difficulty of a miner changes by at
+	// once.
+	maxRetargetFactor = 4
+)
+
+// The error codes of Stratum responses.
+const (
+	errOther          = 20
+	errJobNotFound    = 21
+	errDuplicateShare = 22
+	errLowDifficulty  = 23
+	errUnauthorized   = 24
+	errNotSubscribed  = 25
+)
+
+// diff1Target is the target of shares of difficulty 1, which is the highest
+// target allowed by the Bitcoin main network.
+var diff1Target = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+
+// request is a message from a miner.
+type request struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response is a reply to a request of a miner.
+type response struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  *stratumErr `json:"error"`
+}
+
+// notification is a message to a miner which is not a reply.
+type notification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumErr is the error of a response, which is sent as an array of the
+// error code, the message and a traceback which is always null.
+type stratumErr struct {
+	Code    int
+	Message string
+}
+
+// MarshalJSON returns the error in the format of Stratum.
+func (e *stratumErr) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Code, e.Message, nil})
+}
+
+// Error satisfies the error interface.
+func (e *stratumErr) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// newErr returns a Stratum error with the passed code and message.
+func newErr(code int, format string, args ...interface{}) *stratumErr {
+	return &stratumErr{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// client is a connection of a miner to the server.
+type client struct {
+	server      *Server
+	conn        net.Conn
+	extraNonce1 []byte
+	writeMtx    sync.Mutex
+
+	// The following fields are protected by mtx.
+	//
+	// Shares must meet the lower of difficulty and prevDifficulty, since
+	// miners keep working on their current job at the previous difficulty
+	// until they are sent a new one.  The shares counted for adjusting the
+	// difficulty are the ones since windowStart.
+	mtx            sync.Mutex
+	subscribed     bool
+	authorized     bool
+	worker         string
+	difficulty     float64
+	prevDifficulty float64
+	sentDifficulty bool
+	shares         int
+	windowStart    time.Time
+}
+
+// newClient returns a client for the passed connection which is assigned the
+// passed extra nonce.
+func newClient(s *Server, conn net.Conn, extraNonce1 []byte) *client {
+	return &client{
+		server:         s,
+		conn:           conn,
+		extraNonce1:    extraNonce1,
+		difficulty:     s.cfg.MinDifficulty,
+		prevDifficulty: s.cfg.MinDifficulty,
+		windowStart:    time.Now(),
+	}
+}
+
+// send writes the passed message to the miner.  The connection is closed when
+// it fails.
+func (c *client) send(msg interface{}) error {
+	serialized, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	serialized = append(serialized, '\n')
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(serialized); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// inHandler reads and handles the requests of the miner until the connection is
+// closed.
+//
+// It must be run as a goroutine.
+func (c *client) inHandler() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 1024), maxMessageSize)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			log.Debugf("Malformed message from Stratum client %s: %v",
+				c.conn.RemoteAddr(), err)
+			break
+		}
+		result, postReply, stratumErr := c.handleRequest(&req)
+		if err := c.send(&response{req.ID, result, stratumErr}); err != nil {
+			break
+		}
+		if postReply != nil {
+			postReply()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Debugf("Stratum client %s: %v", c.conn.RemoteAddr(), err)
+	}
+
+	c.conn.Close()
+	c.server.removeClient(c)
+	log.Debugf("Stratum client %s disconnected", c.conn.RemoteAddr())
+	c.server.wg.Done()
+}
+
+// handleRequest handles the passed request and returns its result or error,
+// and optionally a function to run once the response has been sent.
+func (c *client) handleRequest(req *request) (interface{}, func(), *stratumErr) {
+	switch req.Method {
+	case "mining.subscribe":
+		return c.handleSubscribe(req)
+	case "mining.authorize":
+		return c.handleAuthorize(req)
+	case "mining.submit":
+		result, err := c.handleSubmit(req)
+		return result, nil, err
+	case "mining.extranonce.subscribe":
+		// The extra nonce of a connection never changes.
+		return true, nil, nil
+	}
+	return nil, nil, newErr(errOther, "unsupported method %q", req.Method)
+}
+
+// handleSubscribe handles mining.subscribe requests, which are answered with
+// the extra nonce of the connection and the size of the extra nonce the miner
+// chooses.
+func (c *client) handleSubscribe(req *request) (interface{}, func(), *stratumErr) {
+	c.mtx.Lock()
+	c.subscribed = true
+	c.mtx.Unlock()
+
+	subscriptionID := hex.EncodeToString(c.extraNonce1)
+	subscriptions := [][]string{
+		{"mining.set_difficulty", subscriptionID},
+		{"mining.notify", subscriptionID},
+	}
+	return []interface{}{subscriptions, subscriptionID, extraNonce2Size},
+		nil, nil
+}
+
+// handleAuthorize handles mining.authorize requests.  Any worker is authorized
+// since the blocks pay to the mining addresses of the server.  Once the reply is
+// sent, the miner is sent its difficulty and the current job.
+func (c *client) handleAuthorize(req *request) (interface{}, func(), *stratumErr) {
+	var worker string
+	if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &worker) != nil {
+		return nil, nil, newErr(errOther, "invalid worker name")
+	}
+
+	c.mtx.Lock()
+	if !c.subscribed {
+		c.mtx.Unlock()
+		return nil, nil, newErr(errNotSubscribed, "not subscribed")
+	}
+	c.authorized = true
+	c.worker = worker
+	c.mtx.Unlock()
+
+	log.Infof("Stratum worker %q authorized from %s", worker,
+		c.conn.RemoteAddr())
+	postReply := func() {
+		if j := c.server.currentJob(); j != nil {
+			c.notify(j, true)
+		}
+	}
+	return true, postReply, nil
+}
+
+// handleSubmit handles mining.submit requests, whose parameters are the worker
+// name, the job id, the extra nonce chosen by the miner, the time and the nonce.
+// Shares which solve a block are submitted to the chain.
+func (c *client) handleSubmit(req *request) (interface{}, *stratumErr) {
+	c.mtx.Lock()
+	subscribed, authorized := c.subscribed, c.authorized
+	difficulty := math.Min(c.difficulty, c.prevDifficulty)
+	c.mtx.Unlock()
+	if !subscribed {
+		return nil, newErr(errNotSubscribed, "not subscribed")
+	}
+	if !authorized {
+		return nil, newErr(errUnauthorized, "unauthorized worker")
+	}
+
+	var params [5]string
+	if len(req.Params) != len(params) {
+		return nil, newErr(errOther, "expected %d parameters",
+			len(params))
+	}
+	for i := range params {
+		if err := json.Unmarshal(req.Params[i], &params[i]); err != nil {
+			return nil, newErr(errOther, "invalid parameter %d", i+1)
+		}
+	}
+	extraNonce2, err := hex.DecodeString(params[2])
+	if err != nil || len(extraNonce2) != extraNonce2Size {
+		return nil, newErr(errOther, "invalid extranonce2")
+	}
+	timestamp, err := parseUint32Hex(params[3])
+	if err != nil {
+		return nil, newErr(errOther, "invalid ntime: %v", err)
+	}
+	nonce, err := parseUint32Hex(params[4])
+	if err != nil {
+		return nil, newErr(errOther, "invalid nonce: %v", err)
+	}
+
+	j := c.server.job(params[1])
+	if j == nil {
+		return nil, newErr(errJobNotFound, "job not found")
+	}
+	minTime := j.template.Block.Header.Timestamp.Unix()
+	maxTime := time.Now().Add(maxFutureTime).Unix()
+	if int64(timestamp) < minTime || int64(timestamp) > maxTime {
+		return nil, newErr(errOther, "ntime out of range")
+	}
+
+	header := j.header(c.extraNonce1, extraNonce2, timestamp, nonce)
+	powHash := header.BlockPoWHash()
+	hashNum := blockchain.HashToBig(&powHash)
+	solvesBlock := hashNum.Cmp(j.target) <= 0
+	if !solvesBlock && hashNum.Cmp(difficultyTarget(difficulty)) > 0 {
+		return nil, newErr(errLowDifficulty, "low difficulty share")
+	}
+	if !j.addShare(c.extraNonce1, extraNonce2, timestamp, nonce) {
+		return nil, newErr(errDuplicateShare, "duplicate share")
+	}
+	log.Tracef("Stratum worker %q submitted share %v for job %s",
+		params[0], powHash, j.id)
+
+	c.mtx.Lock()
+	c.shares++
+	retarget := c.shares >= retargetShares
+	c.mtx.Unlock()
+	if retarget {
+		c.retarget(j, true)
+	}
+
+	if solvesBlock {
+		block := j.block(&header, c.extraNonce1, extraNonce2)
+		if err := c.server.submitBlock(block, params[0]); err != nil {
+			return nil, newErr(errOther, "block rejected: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// notify sends the passed job to the miner, preceded by its difficulty if it
+// changed.
+func (c *client) notify(j *job, cleanJobs bool) {
+	c.mtx.Lock()
+	authorized := c.authorized
+	c.prevDifficulty = c.difficulty
+	c.mtx.Unlock()
+	if !authorized {
+		return
+	}
+
+	c.retarget(j, false)
+	if err := c.send(&notification{nil, "mining.notify", j.notifyParams(cleanJobs)}); err != nil {
+		log.Debugf("Unable to send job to Stratum client %s: %v",
+			c.conn.RemoteAddr(), err)
+	}
+}
+
+// retarget adjusts the difficulty of the miner to the rate of its shares once
+// enough shares were submitted or enough time has passed, or when force is set,
+// and sends the new difficulty to the miner if it changed.  The difficulty
+// stays between the minimum difficulty and the difficulty of the passed job.
+func (c *client) retarget(j *job, force bool) {
+	c.mtx.Lock()
+	now := time.Now()
+	elapsed := now.Sub(c.windowStart)
+	difficulty := c.difficulty
+	if force || elapsed >= retargetInterval {
+		difficulty = retargetDifficulty(difficulty, c.shares, elapsed)
+		c.shares = 0
+		c.windowStart = now
+	}
+	difficulty = math.Max(difficulty, c.server.cfg.MinDifficulty)
+	difficulty = math.Min(difficulty, targetDifficulty(j.target))
+
+	changed := difficulty != c.difficulty || !c.sentDifficulty
+	if changed {
+		c.prevDifficulty = c.difficulty
+		c.difficulty = difficulty
+		c.sentDifficulty = true
+	}
+	worker := c.worker
+	c.mtx.Unlock()
+	if !changed {
+		return
+	}
+
+	log.Debugf("Stratum worker %q difficulty set to %g", worker, difficulty)
+	err := c.send(&notification{nil, "mining.set_difficulty",
+		[]interface{}{difficulty}})
+	if err != nil {
+		log.Debugf("Unable to send difficulty to Stratum client %s: %v",
+			c.conn.RemoteAddr(), err)
+	}
+}
+
+// retargetDifficulty returns the difficulty for a miner which submitted the
+// passed number of shares at the passed difficulty over the passed time, so it
+// submits a share every targetShareInterval on average.
+func retargetDifficulty(difficulty float64, shares int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return difficulty
+	}
+	expected := elapsed.Seconds() / targetShareInterval.Seconds()
+	factor := float64(shares) / expected
+	factor = math.Max(factor, 1.0/maxRetargetFactor)
+	factor = math.Min(factor, maxRetargetFactor)
+	return difficulty * factor
+}
+
+// difficultyTarget returns the target of shares of the passed difficulty.
+func difficultyTarget(difficulty float64) *big.Int {
+	target := new(big.Float).SetInt(diff1Target)
+	target.Quo(target, big.NewFloat(difficulty))
+	t, _ := target.Int(nil)
+	return t
+}
+
+// targetDifficulty returns the difficulty of shares with the passed target.
+func targetDifficulty(target *big.Int) float64 {
+	difficulty := new(big.Float).SetInt(diff1Target)
+	difficulty.Quo(difficulty, new(big.Float).SetInt(target))
+	d, _ := difficulty.Float64()
+	return d
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// extraNonce1Size is the size in bytes of the extra nonce the server
+	// assigns to each connection.
+	extraNonce1Size = 4
+
+	// extraNonce2Size is the size in bytes of the extra nonce the miners
+	// choose for every share.
+	extraNonce2Size = 4
+
+	// maxFutureTime is how far the time of a share may be ahead of the
+	// current time.
+	maxFutureTime = 2 * time.Hour
+)
+
+// job is a unit of work handed out to the miners, which is a block template
+// whose coinbase transaction is split around the extra nonces.
+type job struct {
+	id       string
+	template *mining.BlockTemplate
+	target   *big.Int
+
+	// coinbase1 and coinbase2 are the serialization of the coinbase
+	// transaction without its witness before and after the extra nonces.
+	// The script prefix and suffix are the parts of the signature script
+	// of the coinbase transaction around them.
+	coinbase1    []byte
+	coinbase2    []byte
+	scriptPrefix []byte
+	scriptSuffix []byte
+
+	// merkleBranch is the list of hashes which are combined with the hash
+	// of the coinbase transaction to calculate the merkle root.
+	merkleBranch []chainhash.Hash
+
+	// shares houses the shares submitted for the job to detect duplicates.
+	sharesMtx sync.Mutex
+	shares    map[string]struct{}
+}
+
+// newJob returns a job with the passed id for the passed block template, whose
+// coinbase transaction has the passed coinbase flags.
+func newJob(id string, template *mining.BlockTemplate, coinbaseFlags string) (*job, error) {
+	msgBlock := template.Block
+	if len(msgBlock.Transactions) == 0 {
+		return nil, errors.New("block template has no coinbase transaction")
+	}
+
+	// The signature script of the coinbase transaction starts with the
+	// height as required by BIP0034, followed by a push of the extra
+	// nonces and the coinbase flags.
+	scriptPrefix, err := txscript.NewScriptBuilder().
+		AddInt64(int64(template.Height)).Script()
+	if err != nil {
+		return nil, err
+	}
+	scriptPrefix = append(scriptPrefix, txscript.OP_DATA_1-1+
+		extraNonce1Size+extraNonce2Size)
+	scriptSuffix, err := txscript.NewScriptBuilder().
+		AddData([]byte(coinbaseFlags)).Script()
+	if err != nil {
+		return nil, err
+	}
+	j := &job{
+		id:           id,
+		template:     template,
+		target:       blockchain.CompactToBig(msgBlock.Header.Bits),
+		scriptPrefix: scriptPrefix,
+		scriptSuffix: scriptSuffix,
+		merkleBranch: merkleBranch(msgBlock.Transactions),
+		shares:       make(map[string]struct{}),
+	}
+
+	// Split the serialized coinbase transaction at the extra nonces, which
+	// are zero in the serialization.
+	var extraNonces [extraNonce1Size + extraNonce2Size]byte
+	coinbase := j.coinbase(extraNonces[:extraNonce1Size],
+		extraNonces[extraNonce1Size:])
+	var buf bytes.Buffer
+	if err := coinbase.SerializeNoWitness(&buf); err != nil {
+		return nil, err
+	}
+	serialized := buf.Bytes()
+	offset := 4 + wire.VarIntSerializeSize(1) + 36 +
+		wire.VarIntSerializeSize(uint64(len(coinbase.TxIn[0].SignatureScript))) +
+		len(scriptPrefix)
+	j.coinbase1 = serialized[:offset]
+	j.coinbase2 = serialized[offset+len(extraNonces):]
+	return j, nil
+}
+
+// coinbase returns the coinbase transaction of the job with the passed extra
+// nonces.
+func (j *job) coinbase(extraNonce1, extraNonce2 []byte) *wire.MsgTx {
+	coinbase := j.template.Block.Transactions[0].Copy()
+	script := make([]byte, 0, len(j.scriptPrefix)+len(extraNonce1)+
+		len(extraNonce2)+len(j.scriptSuffix))
+	script = append(script, j.scriptPrefix...)
+	script = append(script, extraNonce1...)
+	script = append(script, extraNonce2...)
+	script = append(script, j.scriptSuffix...)
+	coinbase.TxIn[0].SignatureScript = script
+	return coinbase
+}
+
+// header returns the block header of the job for the passed extra nonces, time
+// and nonce.  The ClaimTrie root is the one of the block template, which does
+// not depend on the coinbase transaction.
+func (j *job) header(extraNonce1, extraNonce2 []byte, timestamp, nonce uint32) wire.BlockHeader {
+	serialized := make([]byte, 0, len(j.coinbase1)+len(extraNonce1)+
+		len(extraNonce2)+len(j.coinbase2))
+	serialized = append(serialized, j.coinbase1...)
+	serialized = append(serialized, extraNonce1...)
+	serialized = append(serialized, extraNonce2...)
+	serialized = append(serialized, j.coinbase2...)
+	merkleRoot := chainhash.DoubleHashH(serialized)
+	for i := range j.merkleBranch {
+		merkleRoot = *blockchain.HashMerkleBranches(&merkleRoot,
+			&j.merkleBranch[i])
+	}
+
+	header := j.template.Block.Header
+	header.MerkleRoot = merkleRoot
+	header.Timestamp = time.Unix(int64(timestamp), 0)
+	header.Nonce = nonce
+	return header
+}
+
+// block returns the block of the job with the passed header and extra nonces.
+func (j *job) block(header *wire.BlockHeader, extraNonce1, extraNonce2 []byte) *btcutil.Block {
+	msgBlock := wire.MsgBlock{
+		Header:       *header,
+		Transactions: make([]*wire.MsgTx, len(j.template.Block.Transactions)),
+	}
+	copy(msgBlock.Transactions, j.template.Block.Transactions)
+	msgBlock.Transactions[0] = j.coinbase(extraNonce1, extraNonce2)
+	block := btcutil.NewBlock(&msgBlock)
+	block.SetHeight(j.template.Height)
+	return block
+}
+
+// addShare records the share with the passed extra nonces, time and nonce, and
+// returns false if it was submitted before.
+func (j *job) addShare(extraNonce1, extraNonce2 []byte, timestamp, nonce uint32) bool {
+	key := string(extraNonce1) + string(extraNonce2) +
+		strconv.FormatUint(uint64(timestamp), 16) + ":" +
+		strconv.FormatUint(uint64(nonce), 16)
+
+	j.sharesMtx.Lock()
+	defer j.sharesMtx.Unlock()
+	if _, ok := j.shares[key]; ok {
+		return false
+	}
+	j.shares[key] = struct{}{}
+	return true
+}
+
+// notifyParams returns the parameters of the mining.notify message for the job.
+// Following the convention of LBRY pools, the ClaimTrie root of the header is
+// sent after the previous block hash, and both are sent with the bytes of each
+// 32-bit word swapped.
+func (j *job) notifyParams(cleanJobs bool) []interface{} {
+	header := &j.template.Block.Header
+	branch := make([]string, len(j.merkleBranch))
+	for i := range j.merkleBranch {
+		branch[i] = hex.EncodeToString(j.merkleBranch[i][:])
+	}
+	return []interface{}{
+		j.id,
+		hex.EncodeToString(swapWords(header.PrevBlock[:])),
+		hex.EncodeToString(swapWords(header.ClaimTrie[:])),
+		hex.EncodeToString(j.coinbase1),
+		hex.EncodeToString(j.coinbase2),
+		branch,
+		uint32Hex(uint32(header.Version)),
+		uint32Hex(header.Bits),
+		uint32Hex(uint32(header.Timestamp.Unix())),
+		cleanJobs,
+	}
+}
+
+// merkleBranch returns the hashes which are combined with the hash of the first
+// of the passed transactions, the coinbase, to calculate their merkle root.
+func merkleBranch(txns []*wire.MsgTx) []chainhash.Hash {
+	// Each level of the tree starts with the node the coinbase is part of,
+	// which isn't known, followed by the other nodes of the level.
+	level := make([]chainhash.Hash, len(txns))
+	for i := 1; i < len(txns); i++ {
+		level[i] = txns[i].TxHash()
+	}
+
+	var branch []chainhash.Hash
+	for len(level) > 1 {
+		branch = append(branch, level[1])
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]chainhash.Hash, 1, len(level)/2)
+		for i := 2; i < len(level); i += 2 {
+			next = append(next, *blockchain.HashMerkleBranches(
+				&level[i], &level[i+1]))
+		}
+		level = next
+	}
+	return branch
+}
+
+// swapWords returns the passed bytes with the bytes of each 32-bit word
+// swapped, which is how Stratum sends hashes of the header.
+func swapWords(b []byte) []byte {
+	swapped := make([]byte, len(b))
+	for i := 0; i+4 <= len(b); i += 4 {
+		binary.LittleEndian.PutUint32(swapped[i:],
+			binary.BigEndian.Uint32(b[i:]))
+	}
+	return swapped
+}
+
+// uint32Hex returns the passed number as 8 hex digits in big-endian order.
+func uint32Hex(n uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	return hex.EncodeToString(b[:])
+}
+
+// parseUint32Hex parses a number encoded by uint32Hex.
+func parseUint32Hex(s string) (uint32, error) {
+	if len(s) != 8 {
+		return 0, errors.New("expected 8 hex digits")
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// jobPollInterval is how often the server checks whether the current
+	// job must be replaced.
+	jobPollInterval = time.Second
+
+	// jobUpdateInterval is the minimum time between jobs for updates of
+	// the memory pool, and jobRefreshInterval the maximum time between
+	// jobs, so their time stays current.
+	jobUpdateInterval  = 10 * time.Second
+	jobRefreshInterval = time.Minute
+)
+
+// Config is a descriptor containing the Stratum server configuration.
+type Config struct {
+	// ChainParams identifies which chain parameters the server is
+	// associated with.
+	ChainParams *chaincfg.Params
+
+	// BlockTemplateGenerator identifies the instance to use in order to
+	// generate the block templates handed out to the miners.
+	BlockTemplateGenerator *mining.BlkTmplGenerator
+
+	// MiningAddrs is a list of payment addresses to use for the generated
+	// blocks.  Each block template randomly chooses one of them.
+	MiningAddrs []btcutil.Address
+
+	// ProcessBlock defines the function to call with any solved blocks.
+	// It typically must run the provided block through the same set of
+	// rules and handling as any other block coming from the network.
+	ProcessBlock func(*btcutil.Block, blockchain.BehaviorFlags) (bool, error)
+
+	// IsCurrent defines the function to use to obtain whether or not the
+	// block chain is current.  No jobs are handed out while it isn't, since
+	// any solved blocks would end up orphaned.  It may be nil.
+	IsCurrent func() bool
+
+	// Listeners defines a slice of listeners for which the server will
+	// accept connections from miners.
+	Listeners []net.Listener
+
+	// MinDifficulty is the initial and minimum difficulty of the shares
+	// submitted by the miners.  The difficulty of each miner is adjusted to
+	// the rate of its shares, but never exceeds the difficulty of the
+	// network.
+	MinDifficulty float64
+}
+
+// Server provides a Stratum v1 server which hands out jobs created from block
+// templates to miners, validates their shares against the LBRY proof of work,
+// and submits the shares which solve a block.
+type Server struct {
+	started  int32
+	shutdown int32
+	cfg      Config
+	wg       sync.WaitGroup
+	quit     chan struct{}
+
+	// newTip is signalled when a block was found, so the jobs are
+	// replaced without waiting for the next poll.
+	newTip chan struct{}
+
+	// The following fields are protected by mtx.  The jobs are the ones
+	// building on the current tip of the main chain.
+	mtx             sync.Mutex
+	clients         map[*client]struct{}
+	jobs            map[string]*job
+	curJob          *job
+	nextJobID       uint64
+	nextExtraNonce1 uint32
+	lastJobTime     time.Time
+	lastTxUpdate    time.Time
+}
+
+// New returns a new Stratum server for the provided configuration.  Use Start
+// to begin accepting connections from miners.
+func New(cfg *Config) (*Server, error) {
+	if len(cfg.MiningAddrs) == 0 {
+		return nil, errors.New("the Stratum server requires at least " +
+			"one mining address")
+	}
+	if cfg.MinDifficulty <= 0 {
+		return nil, errors.New("the minimum Stratum difficulty must be " +
+			"positive")
+	}
+	extraNonce1, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		cfg:             *cfg,
+		quit:            make(chan struct{}),
+		newTip:          make(chan struct{}, 1),
+		clients:         make(map[*client]struct{}),
+		jobs:            make(map[string]*job),
+		nextExtraNonce1: uint32(extraNonce1),
+	}, nil
+}
+
+// Start begins accepting connections from miners and handing out jobs.
+// Calling this function when the server has already been started will have no
+// effect.
+func (s *Server) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	for _, listener := range s.cfg.Listeners {
+		s.wg.Add(1)
+		go s.listenHandler(listener)
+	}
+	s.wg.Add(1)
+	go s.jobHandler()
+	log.Infof("Stratum server started")
+}
+
+// Stop disconnects all miners and stops the server.  Calling this function
+// when the server has already been stopped will have no effect.
+func (s *Server) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		return
+	}
+
+	close(s.quit)
+	for _, listener := range s.cfg.Listeners {
+		listener.Close()
+	}
+	s.mtx.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+	log.Infof("Stratum server stopped")
+}
+
+// listenHandler accepts the connections of miners on the passed listener until
+// it is closed.
+//
+// It must be run as a goroutine.
+func (s *Server) listenHandler(listener net.Listener) {
+	log.Infof("Stratum server listening on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Only log the error if not forcibly shutting down.
+			if atomic.LoadInt32(&s.shutdown) == 0 {
+				log.Errorf("Can't accept connection: %v", err)
+			}
+			break
+		}
+
+		// Clients connecting while the server is stopped would never
+		// be disconnected.
+		s.mtx.Lock()
+		if atomic.LoadInt32(&s.shutdown) != 0 {
+			s.mtx.Unlock()
+			conn.Close()
+			break
+		}
+		var extraNonce1 [extraNonce1Size]byte
+		binary.BigEndian.PutUint32(extraNonce1[:], s.nextExtraNonce1)
+		s.nextExtraNonce1++
+		c := newClient(s, conn, extraNonce1[:])
+		s.clients[c] = struct{}{}
+		s.wg.Add(1)
+		s.mtx.Unlock()
+
+		log.Debugf("New Stratum client %s", conn.RemoteAddr())
+		go c.inHandler()
+	}
+	s.wg.Done()
+}
+
+// removeClient forgets the passed client once it disconnected.
+func (s *Server) removeClient(c *client) {
+	s.mtx.Lock()
+	delete(s.clients, c)
+	s.mtx.Unlock()
+}
+
+// job returns the job with the passed id, or nil if it doesn't exist or no
+// longer builds on the tip of the main chain.
+func (s *Server) job(id string) *job {
+	s.mtx.Lock()
+	j := s.jobs[id]
+	s.mtx.Unlock()
+	if j == nil {
+		return nil
+	}
+	best := s.cfg.BlockTemplateGenerator.BestSnapshot()
+	if j.template.Block.Header.PrevBlock != best.Hash {
+		return nil
+	}
+	return j
+}
+
+// currentJob returns the most recent job, or nil if there is none.
+func (s *Server) currentJob() *job {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.curJob
+}
+
+// jobHandler periodically replaces the current job when it became stale.
+//
+// It must be run as a goroutine.
+func (s *Server) jobHandler() {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	s.updateJob()
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.updateJob()
+
+		case <-s.newTip:
+			s.updateJob()
+
+		case <-s.quit:
+			break out
+		}
+	}
+	s.wg.Done()
+}
+
+// updateJob creates a new job and sends it to all miners when the tip of the
+// main chain changed, or when the memory pool was updated or the current job is
+// getting old.  The jobs building on a previous tip are invalidated, and the
+// miners are told to abandon them.
+func (s *Server) updateJob() {
+	g := s.cfg.BlockTemplateGenerator
+	best := g.BestSnapshot()
+	if s.cfg.IsCurrent != nil && best.Height != 0 && !s.cfg.IsCurrent() {
+		return
+	}
+
+	s.mtx.Lock()
+	curJob, lastJobTime := s.curJob, s.lastJobTime
+	lastTxUpdate := s.lastTxUpdate
+	s.mtx.Unlock()
+	txUpdate := g.TxSource().LastUpdated()
+	newTip := curJob == nil ||
+		curJob.template.Block.Header.PrevBlock != best.Hash
+	if !newTip {
+		sinceJob := time.Since(lastJobTime)
+		if sinceJob < jobRefreshInterval && (txUpdate == lastTxUpdate ||
+			sinceJob < jobUpdateInterval) {
+
+			return
+		}
+	}
+
+	// Choose a payment address at random.
+	payToAddr := s.cfg.MiningAddrs[rand.Intn(len(s.cfg.MiningAddrs))]
+	template, err := g.NewBlockTemplate(payToAddr)
+	if err != nil {
+		log.Errorf("Failed to create new block template: %v", err)
+		return
+	}
+	newTip = curJob == nil || curJob.template.Block.Header.PrevBlock !=
+		template.Block.Header.PrevBlock
+
+	s.mtx.Lock()
+	j, err := newJob(strconv.FormatUint(s.nextJobID, 16), template,
+		g.CoinbaseFlags())
+	if err != nil {
+		s.mtx.Unlock()
+		log.Errorf("Failed to create Stratum job: %v", err)
+		return
+	}
+	s.nextJobID++
+	if newTip {
+		s.jobs = make(map[string]*job)
+	}
+	s.jobs[j.id] = j
+	s.curJob = j
+	s.lastJobTime = time.Now()
+	s.lastTxUpdate = txUpdate
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mtx.Unlock()
+
+	log.Debugf("New Stratum job %s for block at height %d", j.id,
+		template.Height)
+	for _, c := range clients {
+		c.notify(j, newTip)
+	}
+}
+
+// submitBlock processes the passed block solved by the passed worker, and
+// replaces the jobs once it was accepted.
+func (s *Server) submitBlock(block *btcutil.Block, worker string) error {
+	isOrphan, err := s.cfg.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		log.Infof("Block submitted via Stratum by worker %q rejected: "+
+			"%v", worker, err)
+		return err
+	}
+	if isOrphan {
+		log.Infof("Block submitted via Stratum by worker %q is an "+
+			"orphan", worker)
+		return errors.New("orphan block")
+	}
+
+	coinbaseTx := block.MsgBlock().Transactions[0].TxOut[0]
+	log.Infof("Block submitted via Stratum by worker %q accepted (hash "+
+		"%s, amount %v)", worker, block.Hash(),
+		btcutil.Amount(coinbaseTx.Value))
+
+	select {
+	case s.newTip <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,504 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// emptyTxSource is a mining.TxSource without any transactions.
+type emptyTxSource struct{}
+
+// LastUpdated returns the zero time since the source never changes.  This is
+// part of the mining.TxSource interface.
+func (emptyTxSource) LastUpdated() time.Time { return time.Time{} }
+
+// MiningDescs returns no transactions.  This is part of the mining.TxSource
+// interface.
+func (emptyTxSource) MiningDescs() []*mining.TxDesc { return nil }
+
+// HaveTransaction returns false since the source has no transactions.  This is
+// part of the mining.TxSource interface.
+func (emptyTxSource) HaveTransaction(*chainhash.Hash) bool { return false }
+
+// newTestServer returns a started Stratum server with the passed minimum
+// difficulty which mines on a new regression test chain, along with the chain
+// and a teardown function.
+func newTestServer(t *testing.T, minDifficulty float64) (*Server, *blockchain.BlockChain, func()) {
+	params := chaincfg.RegressionNetParams
+	dbPath, err := ioutil.TempDir("", "stratumtest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create db: %v", err)
+	}
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create claimtrie: %v", err)
+	}
+	closeAll := func() {
+		ct.Close()
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	timeSource := blockchain.NewMedianTime()
+	sigCache := txscript.NewSigCache(1000)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+		SigCache:    sigCache,
+		ClaimTrie:   ct,
+	})
+	if err != nil {
+		closeAll()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	policy := mining.Policy{
+		BlockMaxWeight: blockchain.MaxBlockWeight - 4000,
+		BlockMaxSize:   blockchain.MaxBlockBaseSize - 1000,
+	}
+	generator := mining.NewBlkTmplGenerator(&policy, &params,
+		emptyTxSource{}, chain, timeSource, sigCache,
+		txscript.NewHashCache(0))
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &params)
+	if err != nil {
+		closeAll()
+		t.Fatalf("unable to create address: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		closeAll()
+		t.Fatalf("unable to listen: %v", err)
+	}
+	server, err := New(&Config{
+		ChainParams:            &params,
+		BlockTemplateGenerator: generator,
+		MiningAddrs:            []btcutil.Address{addr},
+		ProcessBlock: func(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
+			_, isOrphan, err := chain.ProcessBlock(block, flags)
+			return isOrphan, err
+		},
+		Listeners:     []net.Listener{listener},
+		MinDifficulty: minDifficulty,
+	})
+	if err != nil {
+		listener.Close()
+		closeAll()
+		t.Fatalf("unable to create server: %v", err)
+	}
+	server.Start()
+	teardown := func() {
+		server.Stop()
+		closeAll()
+	}
+	return server, chain, teardown
+}
+
+// testMiner is a simulated Stratum miner.
+type testMiner struct {
+	t           *testing.T
+	conn        net.Conn
+	reader      *bufio.Reader
+	nextID      int
+	extraNonce1 []byte
+	difficulty  float64
+	job         *testJob
+}
+
+// testJob is a job received by a testMiner.
+type testJob struct {
+	id        string
+	header    wire.BlockHeader
+	coinbase1 []byte
+	coinbase2 []byte
+	branch    []chainhash.Hash
+	clean     bool
+}
+
+// message is any message from the server.
+type message struct {
+	ID     *int              `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	Result json.RawMessage   `json:"result"`
+	Error  []interface{}     `json:"error"`
+}
+
+// dialTestMiner connects a simulated miner to the passed server.
+func dialTestMiner(t *testing.T, s *Server) *testMiner {
+	conn, err := net.Dial("tcp", s.cfg.Listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	return &testMiner{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// read reads the next message from the server, and handles notifications.
+func (m *testMiner) read() *message {
+	m.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	line, err := m.reader.ReadBytes('\n')
+	if err != nil {
+		m.t.Fatalf("unable to read message: %v", err)
+	}
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		m.t.Fatalf("malformed message %s: %v", line, err)
+	}
+
+	switch msg.Method {
+	case "mining.set_difficulty":
+		if err := json.Unmarshal(msg.Params[0], &m.difficulty); err != nil {
+			m.t.Fatalf("malformed difficulty %s: %v", line, err)
+		}
+	case "mining.notify":
+		m.job = m.parseJob(msg.Params)
+	}
+	return &msg
+}
+
+// parseJob returns the job of the parameters of a mining.notify message,
+// decoding the header independently of the server.
+func (m *testMiner) parseJob(params []json.RawMessage) *testJob {
+	var (
+		j                                         testJob
+		prevHash, claimTrie, coinbase1, coinbase2 string
+		branch                                    []string
+		version, bits, timestamp                  string
+	)
+	fields := []interface{}{&j.id, &prevHash, &claimTrie, &coinbase1,
+		&coinbase2, &branch, &version, &bits, &timestamp, &j.clean}
+	if len(params) != len(fields) {
+		m.t.Fatalf("mining.notify has %d parameters", len(params))
+	}
+	for i := range fields {
+		if err := json.Unmarshal(params[i], fields[i]); err != nil {
+			m.t.Fatalf("malformed parameter %d of mining.notify: %v",
+				i, err)
+		}
+	}
+
+	// The hashes are sent with the bytes of each 32-bit word swapped.
+	decodeHash := func(s string) chainhash.Hash {
+		b := m.decodeHex(s)
+		var hash chainhash.Hash
+		for i := 0; i+4 <= len(b) && i+4 <= len(hash); i += 4 {
+			hash[i], hash[i+1], hash[i+2], hash[i+3] =
+				b[i+3], b[i+2], b[i+1], b[i]
+		}
+		return hash
+	}
+	decodeUint32 := func(s string) uint32 {
+		n, err := parseUint32Hex(s)
+		if err != nil {
+			m.t.Fatalf("malformed number %q: %v", s, err)
+		}
+		return n
+	}
+	j.header.Version = int32(decodeUint32(version))
+	j.header.PrevBlock = decodeHash(prevHash)
+	j.header.ClaimTrie = decodeHash(claimTrie)
+	j.header.Bits = decodeUint32(bits)
+	j.header.Timestamp = time.Unix(int64(decodeUint32(timestamp)), 0)
+	j.coinbase1 = m.decodeHex(coinbase1)
+	j.coinbase2 = m.decodeHex(coinbase2)
+	for _, s := range branch {
+		var hash chainhash.Hash
+		copy(hash[:], m.decodeHex(s))
+		j.branch = append(j.branch, hash)
+	}
+	return &j
+}
+
+// decodeHex decodes the passed hex string.
+func (m *testMiner) decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		m.t.Fatalf("malformed hex %q: %v", s, err)
+	}
+	return b
+}
+
+// call sends a request and returns its response, handling the notifications
+// received in the meantime.
+func (m *testMiner) call(method string, params ...interface{}) *message {
+	m.nextID++
+	req := map[string]interface{}{
+		"id":     m.nextID,
+		"method": method,
+		"params": params,
+	}
+	serialized, err := json.Marshal(req)
+	if err != nil {
+		m.t.Fatalf("unable to marshal request: %v", err)
+	}
+	if _, err := m.conn.Write(append(serialized, '\n')); err != nil {
+		m.t.Fatalf("unable to send request: %v", err)
+	}
+	for {
+		msg := m.read()
+		if msg.ID != nil && *msg.ID == m.nextID {
+			return msg
+		}
+	}
+}
+
+// waitJob reads messages until a job is received for which the passed function
+// returns true.
+func (m *testMiner) waitJob(ok func(*testJob) bool) *testJob {
+	for m.job == nil || !ok(m.job) {
+		m.read()
+	}
+	return m.job
+}
+
+// solve returns the header of the current job for the passed extra nonce and
+// the first nonce whose proof of work hash is at most the passed target when
+// below is set, or above it otherwise.
+func (m *testMiner) solve(extraNonce2 []byte, target *big.Int, below bool) wire.BlockHeader {
+	j := m.job
+	var coinbase []byte
+	coinbase = append(coinbase, j.coinbase1...)
+	coinbase = append(coinbase, m.extraNonce1...)
+	coinbase = append(coinbase, extraNonce2...)
+	coinbase = append(coinbase, j.coinbase2...)
+	merkleRoot := chainhash.DoubleHashH(coinbase)
+	for i := range j.branch {
+		merkleRoot = *blockchain.HashMerkleBranches(&merkleRoot,
+			&j.branch[i])
+	}
+
+	header := j.header
+	header.MerkleRoot = merkleRoot
+	for nonce := uint32(0); ; nonce++ {
+		header.Nonce = nonce
+		hash := header.BlockPoWHash()
+		if (blockchain.HashToBig(&hash).Cmp(target) <= 0) == below {
+			return header
+		}
+	}
+}
+
+// submit submits the passed share of the current job and returns the error code
+// of the response, which is zero when the share was accepted.
+func (m *testMiner) submit(jobID string, extraNonce2 []byte, header *wire.BlockHeader) int {
+	msg := m.call("mining.submit", "worker", jobID,
+		hex.EncodeToString(extraNonce2),
+		uint32Hex(uint32(header.Timestamp.Unix())),
+		uint32Hex(header.Nonce))
+	if msg.Error != nil {
+		return int(msg.Error[0].(float64))
+	}
+	var accepted bool
+	if err := json.Unmarshal(msg.Result, &accepted); err != nil || !accepted {
+		m.t.Fatalf("unexpected submit result %s", msg.Result)
+	}
+	return 0
+}
+
+// subscribe subscribes and authorizes the miner, and waits for its first job.
+func (m *testMiner) subscribe() {
+	msg := m.call("mining.subscribe", "testminer/1.0")
+	var result []json.RawMessage
+	if err := json.Unmarshal(msg.Result, &result); err != nil || len(result) != 3 {
+		m.t.Fatalf("unexpected subscribe result %s", msg.Result)
+	}
+	var extraNonce1 string
+	var extraNonce2Len int
+	json.Unmarshal(result[1], &extraNonce1)
+	json.Unmarshal(result[2], &extraNonce2Len)
+	m.extraNonce1 = m.decodeHex(extraNonce1)
+	if len(m.extraNonce1) != extraNonce1Size || extraNonce2Len != extraNonce2Size {
+		m.t.Fatalf("unexpected subscribe result %s", msg.Result)
+	}
+
+	msg = m.call("mining.authorize", "worker", "x")
+	if string(msg.Result) != "true" {
+		m.t.Fatalf("unexpected authorize result %s", msg.Result)
+	}
+	m.waitJob(func(*testJob) bool { return true })
+	if m.difficulty == 0 {
+		m.t.Fatal("no difficulty received before the first job")
+	}
+}
+
+// TestStratumBlocks ensures a simulated miner is handed out jobs whose blocks
+// are accepted by the chain, and that shares are validated against the LBRY
+// proof of work.
+func TestStratumBlocks(t *testing.T) {
+	// The minimum difficulty exceeds the one of the network, so all shares
+	// have to solve a block.
+	server, chain, teardown := newTestServer(t, 1)
+	defer teardown()
+
+	m := dialTestMiner(t, server)
+	defer m.conn.Close()
+	if code := m.call("mining.submit", "worker", "0", "00000000",
+		"00000000", "00000000").Error; code == nil || code[0].(float64) != errNotSubscribed {
+		t.Fatalf("unexpected error for submit before subscribing: %v", code)
+	}
+	m.subscribe()
+	target := blockchain.CompactToBig(m.job.header.Bits)
+	if m.difficulty != targetDifficulty(target) {
+		t.Fatalf("difficulty %g instead of the network difficulty %g",
+			m.difficulty, targetDifficulty(target))
+	}
+
+	for height := int32(1); height <= 3; height++ {
+		j := m.waitJob(func(j *testJob) bool {
+			return j.header.PrevBlock == chain.BestSnapshot().Hash
+		})
+		extraNonce2 := []byte{0, 0, 0, byte(height)}
+
+		// A share above the target of the network is rejected.
+		header := m.solve(extraNonce2, target, false)
+		if code := m.submit(j.id, extraNonce2, &header); code != errLowDifficulty {
+			t.Fatalf("unexpected error code %d for low difficulty "+
+				"share", code)
+		}
+
+		header = m.solve(extraNonce2, target, true)
+		if code := m.submit(j.id, extraNonce2, &header); code != 0 {
+			t.Fatalf("block share rejected with error code %d", code)
+		}
+		best := chain.BestSnapshot()
+		if best.Height != height || best.Hash != header.BlockHash() {
+			t.Fatalf("best block %v at height %d instead of %v at %d",
+				best.Hash, best.Height, header.BlockHash(), height)
+		}
+
+		// The job no longer builds on the tip of the main chain.
+		if code := m.submit(j.id, extraNonce2, &header); code != errJobNotFound {
+			t.Fatalf("unexpected error code %d for stale share", code)
+		}
+		next := m.waitJob(func(j *testJob) bool {
+			return j.header.PrevBlock == best.Hash
+		})
+		if !next.clean {
+			t.Fatal("job for the new tip does not abandon old jobs")
+		}
+	}
+}
+
+// TestStratumShares ensures shares below the difficulty of the network are
+// accepted once, and don't change the chain.
+func TestStratumShares(t *testing.T) {
+	server, chain, teardown := newTestServer(t, 1e-10)
+	defer teardown()
+
+	m := dialTestMiner(t, server)
+	defer m.conn.Close()
+	m.subscribe()
+	if m.difficulty != 1e-10 {
+		t.Fatalf("difficulty %g instead of the minimum", m.difficulty)
+	}
+
+	extraNonce2 := []byte{0, 0, 0, 1}
+	target := blockchain.CompactToBig(m.job.header.Bits)
+	header := m.solve(extraNonce2, target, false)
+	if code := m.submit(m.job.id, extraNonce2, &header); code != 0 {
+		t.Fatalf("share rejected with error code %d", code)
+	}
+	if code := m.submit(m.job.id, extraNonce2, &header); code != errDuplicateShare {
+		t.Fatalf("unexpected error code %d for duplicate share", code)
+	}
+	if code := m.submit("unknown", extraNonce2, &header); code != errJobNotFound {
+		t.Fatalf("unexpected error code %d for unknown job", code)
+	}
+	if height := chain.BestSnapshot().Height; height != 0 {
+		t.Fatalf("share changed the chain to height %d", height)
+	}
+}
+
+// TestMerkleBranch ensures the merkle root calculated from the merkle branch of
+// a job matches the one of the transactions.
+func TestMerkleBranch(t *testing.T) {
+	for numTxns := 1; numTxns <= 9; numTxns++ {
+		var txns []*btcutil.Tx
+		var msgTxns []*wire.MsgTx
+		for i := 0; i < numTxns; i++ {
+			tx := wire.NewMsgTx(wire.TxVersion)
+			tx.LockTime = uint32(i)
+			txns = append(txns, btcutil.NewTx(tx))
+			msgTxns = append(msgTxns, tx)
+		}
+		merkles := blockchain.BuildMerkleTreeStore(txns, false)
+		want := *merkles[len(merkles)-1]
+
+		root := msgTxns[0].TxHash()
+		branch := merkleBranch(msgTxns)
+		for i := range branch {
+			root = *blockchain.HashMerkleBranches(&root, &branch[i])
+		}
+		if root != want {
+			t.Errorf("merkle root of %d transactions: got %v, want %v",
+				numTxns, root, want)
+		}
+	}
+}
+
+// TestRetargetDifficulty ensures the difficulty of miners follows the rate of
+// their shares within the allowed factor.
+func TestRetargetDifficulty(t *testing.T) {
+	tests := []struct {
+		difficulty float64
+		shares     int
+		elapsed    time.Duration
+		want       float64
+	}{
+		// Shares at the target rate keep the difficulty.
+		{8, 9, 90 * time.Second, 8},
+		// Twice as many shares double it.
+		{8, 18, 90 * time.Second, 16},
+		// Half as many shares halve it.
+		{8, 3, 60 * time.Second, 4},
+		// The change is limited.
+		{8, 30, 10 * time.Second, 32},
+		{8, 0, 90 * time.Second, 2},
+		// No time has passed.
+		{8, 5, 0, 8},
+	}
+	for i, test := range tests {
+		got := retargetDifficulty(test.difficulty, test.shares,
+			test.elapsed)
+		if got != test.want {
+			t.Errorf("test %d: got difficulty %g, want %g", i, got,
+				test.want)
+		}
+	}
+
+	if got := targetDifficulty(diff1Target); got != 1 {
+		t.Errorf("difficulty of the difficulty 1 target is %g", got)
+	}
+	if got := difficultyTarget(2); got.Cmp(new(big.Int).Rsh(diff1Target, 1)) != 0 {
+		t.Errorf("target of difficulty 2 is %x", got)
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// isClosed returns whether the passed channel is closed.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// templateHasTx returns whether the passed block template includes the passed
+// transaction.
+func templateHasTx(template *mining.BlockTemplate, hash *chainhash.Hash) bool {
+	for _, tx := range template.Block.Transactions[1:] {
+		if tx.TxHash() == *hash {
+			return true
+		}
+	}
+	return false
+}
+
+// TestTemplateCache ensures the block template generator hands out copies of
+// its cached template until the memory pool or the best chain changes, and
+// notifies about new templates.
+func TestTemplateCache(t *testing.T) {
+	h := newTestHarness(t, int(chaincfg.RegressionNetParams.CoinbaseMaturity)+3)
+	defer h.teardown()
+
+	prevOut, amount := h.coinbaseOutput(1)
+	tx1 := h.createTx(prevOut, amount, 1, 10)
+	h.addTx(tx1)
+
+	template, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	best := h.chain.BestSnapshot()
+	if !strings.HasPrefix(template.ID, best.Hash.String()+"-") {
+		t.Fatalf("template ID %s doesn't start with the previous "+
+			"block hash %s", template.ID, best.Hash)
+	}
+	if !templateHasTx(template, tx1.Hash()) {
+		t.Fatalf("template doesn't include transaction %v", tx1.Hash())
+	}
+	changed := h.generator.TemplateChanged(template.ID)
+	if isClosed(changed) {
+		t.Fatal("template changed without a new template")
+	}
+	if !isClosed(h.generator.TemplateChanged("unknown")) {
+		t.Fatal("template didn't change for an unknown ID")
+	}
+
+	// Without changes, the cached template is handed out again as a copy
+	// which can be modified freely.
+	cached, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	if cached.ID != template.ID {
+		t.Fatalf("template ID changed from %s to %s without changes",
+			template.ID, cached.ID)
+	}
+	if cached.Block == template.Block ||
+		cached.Block.Transactions[0] == template.Block.Transactions[0] {
+
+		t.Fatal("cached template isn't copied")
+	}
+	if cached.Block.Header.MerkleRoot != template.Block.Header.MerkleRoot {
+		t.Fatal("merkle root of cached template differs")
+	}
+	err = h.generator.UpdateExtraNonce(cached.Block, cached.Height, 1)
+	if err != nil {
+		t.Fatalf("unable to update extra nonce: %v", err)
+	}
+	if isClosed(changed) {
+		t.Fatal("template changed without a new template")
+	}
+
+	// A template with a coinbase redeemable by anyone is made from the
+	// cached one as well.
+	anyone, err := h.generator.NewBlockTemplate(nil)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	if anyone.ID != template.ID || anyone.ValidPayAddress {
+		t.Fatalf("unexpected template %s (valid pay address %v) for "+
+			"nil address", anyone.ID, anyone.ValidPayAddress)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		btcutil.NewBlock(anyone.Block).Transactions(), false)
+	if anyone.Block.Header.MerkleRoot != *merkles[len(merkles)-1] {
+		t.Fatal("merkle root doesn't commit to the replaced coinbase")
+	}
+
+	// A new transaction in the memory pool causes a new template, which
+	// still includes the first one.
+	prevOut, amount = h.coinbaseOutput(2)
+	tx2 := h.createTx(prevOut, amount, 1, 10)
+	h.addTx(tx2)
+	updated, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	if updated.ID == template.ID {
+		t.Fatal("template ID didn't change after memory pool update")
+	}
+	if !isClosed(changed) {
+		t.Fatal("template change wasn't notified")
+	}
+	for _, tx := range []*btcutil.Tx{tx1, tx2} {
+		if !templateHasTx(updated, tx.Hash()) {
+			t.Fatalf("updated template doesn't include transaction "+
+				"%v", tx.Hash())
+		}
+	}
+
+	// A new block causes a new template building on it.
+	changed = h.generator.TemplateChanged(updated.ID)
+	block := h.mineBlock()
+	if isClosed(changed) {
+		t.Fatal("template changed without a new template")
+	}
+	next, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	if !strings.HasPrefix(next.ID, block.Hash().String()+"-") ||
+		next.Block.Header.PrevBlock != *block.Hash() {
+
+		t.Fatalf("template %s doesn't build on new block %v", next.ID,
+			block.Hash())
+	}
+	if !isClosed(changed) {
+		t.Fatal("template change wasn't notified")
+	}
+	if len(next.Block.Transactions) != 1 {
+		t.Fatalf("template has %d transactions instead of only the "+
+			"coinbase", len(next.Block.Transactions))
+	}
+}
+
+// TestCoinbasePayouts ensures the coinbase of block templates splits its value
+// among the payouts of the policy and carries the coinbase tag, while templates
+// without a payment address pay the whole value to a single output.
+func TestCoinbasePayouts(t *testing.T) {
+	h := newTestHarness(t, int(chaincfg.RegressionNetParams.CoinbaseMaturity)+2)
+	defer h.teardown()
+
+	prevOut, amount := h.coinbaseOutput(1)
+	tx := h.createTx(prevOut, amount, 1, 10)
+	h.addTx(tx)
+
+	payoutAddr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), h.params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	payoutScript, err := txscript.PayToAddrScript(payoutAddr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	h.policy.CoinbaseTag = "/pool/"
+	h.policy.CoinbasePayouts = []mining.CoinbasePayout{
+		{Address: payoutAddr, Share: 500},
+	}
+	h.policy.AlwaysWitnessCommitment = true
+	h.generator = mining.NewBlkTmplGenerator(h.policy, h.params, h.txPool,
+		h.chain, blockchain.NewMedianTime(), txscript.NewSigCache(1000),
+		txscript.NewHashCache(1000))
+
+	// checkMerkleRoot ensures the merkle root of the passed template commits
+	// to its coinbase.
+	checkMerkleRoot := func(template *mining.BlockTemplate) {
+		t.Helper()
+		merkles := blockchain.BuildMerkleTreeStore(
+			btcutil.NewBlock(template.Block).Transactions(), false)
+		if template.Block.Header.MerkleRoot != *merkles[len(merkles)-1] {
+			t.Fatal("merkle root doesn't commit to the coinbase")
+		}
+	}
+
+	// The payout gets 5% of the subsidy along with the fees, and the rest
+	// is paid to the address of the template.  Segwit is not active, so
+	// there is no witness commitment.
+	template, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	value := blockchain.CalcBlockSubsidy(template.Height, h.params) -
+		template.Fees[0]
+	coinbase := template.Block.Transactions[0]
+	if len(coinbase.TxOut) != 2 || template.WitnessCommitment != nil {
+		t.Fatalf("coinbase has %d outputs instead of 2", len(coinbase.TxOut))
+	}
+	wantPayout := value * 500 / mining.CoinbaseShares
+	if coinbase.TxOut[1].Value != wantPayout ||
+		!bytes.Equal(coinbase.TxOut[1].PkScript, payoutScript) {
+
+		t.Fatalf("payout of %d to script %x instead of %d to %x",
+			coinbase.TxOut[1].Value, coinbase.TxOut[1].PkScript,
+			wantPayout, payoutScript)
+	}
+	if coinbase.TxOut[0].Value != value-wantPayout ||
+		!bytes.Equal(coinbase.TxOut[0].PkScript, h.pkScript) {
+
+		t.Fatalf("pays %d to script %x instead of %d to %x",
+			coinbase.TxOut[0].Value, coinbase.TxOut[0].PkScript,
+			value-wantPayout, h.pkScript)
+	}
+	flags := []byte(mining.CoinbaseFlags + "/pool/")
+	if !bytes.Contains(coinbase.TxIn[0].SignatureScript, flags) {
+		t.Fatalf("coinbase script %x doesn't include the tag",
+			coinbase.TxIn[0].SignatureScript)
+	}
+	if h.generator.CoinbaseFlags() != string(flags) {
+		t.Fatalf("coinbase flags are %q instead of %q",
+			h.generator.CoinbaseFlags(), flags)
+	}
+	err = h.generator.UpdateExtraNonce(template.Block, template.Height, 1)
+	if err != nil {
+		t.Fatalf("unable to update extra nonce: %v", err)
+	}
+	if !bytes.Contains(coinbase.TxIn[0].SignatureScript, flags) {
+		t.Fatal("updated coinbase script doesn't include the tag")
+	}
+
+	// A template without a payment address pays the whole value to a
+	// single output, and gets the payouts once it is paid to an address.
+	anyone, err := h.generator.NewBlockTemplate(nil)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	coinbase = anyone.Block.Transactions[0]
+	if len(coinbase.TxOut) != 1 || coinbase.TxOut[0].Value != value {
+		t.Fatalf("coinbase without address has %d outputs paying %d",
+			len(coinbase.TxOut), coinbase.TxOut[0].Value)
+	}
+	checkMerkleRoot(anyone)
+	err = h.generator.UpdateCoinbasePayouts(anyone, h.addr)
+	if err != nil {
+		t.Fatalf("unable to update coinbase payouts: %v", err)
+	}
+	coinbase = anyone.Block.Transactions[0]
+	if !anyone.ValidPayAddress || len(coinbase.TxOut) != 2 ||
+		coinbase.TxOut[1].Value != wantPayout {
+
+		t.Fatalf("updated coinbase has %d outputs", len(coinbase.TxOut))
+	}
+	checkMerkleRoot(anyone)
+
+	// The blocks with the payouts are valid.
+	block := h.mineBlock()
+	if len(block.MsgBlock().Transactions[0].TxOut) != 2 {
+		t.Fatal("mined block has no payout")
+	}
+}
+
+// TestNewBlockTemplateWithTxs ensures block templates with passed transactions
+// hold exactly those in the passed order regardless of their fees, collect the
+// fees which are actually paid without touching the fee deltas of prioritised
+// transactions, and reject transactions which can't be included.
+func TestNewBlockTemplateWithTxs(t *testing.T) {
+	h := newTestHarness(t, int(chaincfg.RegressionNetParams.CoinbaseMaturity)+3)
+	defer h.teardown()
+
+	// Create a transaction paying no fee spent by another one, and an
+	// independent one paying a high fee, which is also in the memory pool
+	// but must not be included twice:
+	//
+	//   P -- C      I
+	prevOut, amount := h.coinbaseOutput(1)
+	p := h.createTx(prevOut, amount, 1, 0)
+	pOut := p.MsgTx().TxOut[0]
+	c := h.createTx(wire.OutPoint{Hash: *p.Hash()}, pOut.Value, 1, 1)
+	prevOut, amount = h.coinbaseOutput(2)
+	i := h.createTx(prevOut, amount, 1, 100)
+	h.addTx(i)
+
+	// Prioritise I along with P, which is not in the memory pool.
+	prioritised := []*btcutil.Tx{p, i}
+	for _, tx := range prioritised {
+		h.txPool.PrioritiseTransaction(tx.Hash(), btcutil.SatoshiPerBitcoin)
+	}
+
+	txns := []*btcutil.Tx{p, c, i}
+	template, err := h.generator.NewBlockTemplateWithTxs(h.addr, txns)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	if len(template.Block.Transactions) != len(txns)+1 {
+		t.Fatalf("template has %d transactions instead of %d",
+			len(template.Block.Transactions), len(txns)+1)
+	}
+	for j, tx := range txns {
+		if template.Block.Transactions[j+1].TxHash() != *tx.Hash() {
+			t.Fatalf("transaction %d of the template is %v instead "+
+				"of %v", j+1, template.Block.Transactions[j+1].TxHash(),
+				tx.Hash())
+		}
+	}
+	if fees := templateFees(template); fees != amount-
+		i.MsgTx().TxOut[0].Value+pOut.Value-c.MsgTx().TxOut[0].Value {
+
+		t.Fatalf("template has %d in fees", fees)
+	}
+	if template.Fees[3] != amount-i.MsgTx().TxOut[0].Value {
+		t.Fatalf("template has fee %d for I instead of the one paid",
+			template.Fees[3])
+	}
+	for _, tx := range prioritised {
+		delta := h.txPool.FeeDelta(tx.Hash())
+		if delta != btcutil.SatoshiPerBitcoin {
+			t.Fatalf("fee delta of %v changed to %d", tx.Hash(), delta)
+		}
+	}
+	for _, desc := range h.txPool.MiningDescs() {
+		if *desc.Tx.Hash() == *i.Hash() &&
+			desc.FeeDelta != btcutil.SatoshiPerBitcoin {
+
+			t.Fatalf("memory pool has fee delta %d for I",
+				desc.FeeDelta)
+		}
+	}
+
+	// The block is valid, and the template of the generator is unaffected.
+	cached, err := h.generator.NewBlockTemplate(h.addr)
+	if err != nil {
+		t.Fatalf("unable to create block template: %v", err)
+	}
+	if len(cached.Block.Transactions) != 2 {
+		t.Fatalf("template has %d transactions instead of 2",
+			len(cached.Block.Transactions))
+	}
+	header := &template.Block.Header
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		hash := header.BlockPoWHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		header.Nonce++
+	}
+	_, isOrphan, err := h.chain.ProcessBlock(btcutil.NewBlock(template.Block),
+		blockchain.BFNone)
+	if err != nil || isOrphan {
+		t.Fatalf("block rejected (orphan %v): %v", isOrphan, err)
+	}
+
+	// Transactions spending unknown outputs or outputs of the ones after
+	// them, and duplicate transactions are rejected.
+	prevOut, amount = h.coinbaseOutput(3)
+	p = h.createTx(prevOut, amount, 1, 1)
+	c = h.createTx(wire.OutPoint{Hash: *p.Hash()}, amount, 1, 1)
+	tests := []struct {
+		name string
+		txns []*btcutil.Tx
+	}{
+		{"spends a later transaction", []*btcutil.Tx{c, p}},
+		{"spends a mined transaction", []*btcutil.Tx{i}},
+		{"included twice", []*btcutil.Tx{p, p}},
+	}
+	for _, test := range tests {
+		_, err := h.generator.NewBlockTemplateWithTxs(h.addr, test.txns)
+		if err == nil {
+			t.Fatalf("%s: template created", test.name)
+		}
+	}
+}
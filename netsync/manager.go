@@ -5,7 +5,6 @@
 package netsync
 
 import (
-	"container/list"
 	"math/rand"
 	"net"
 	"sync"
@@ -23,10 +22,15 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
+	// maxBlocksInFlightPerPeer is the maximum number of blocks which are
+	// requested from a single peer at once.
+	maxBlocksInFlightPerPeer = 16
+
+	// blockDownloadWindow is the number of blocks of the best header chain,
+	// starting with the first one which hasn't been downloaded yet, that
+	// are downloaded at once.  Blocks further ahead are not requested, which
+	// limits the number of blocks held back until their parents arrive.
+	blockDownloadWindow = 1024
 
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
@@ -40,13 +44,21 @@ const (
 	// hashes to store in memory.
 	maxRequestedTxns = wire.MaxInvPerMsg
 
-	// maxStallDuration is the time after which we will disconnect our
-	// current sync peer if we haven't made progress.
+	// maxStallDuration is the time after which a request for blocks or
+	// headers which has not been answered is considered to have stalled.
+	// The peer it was sent to is disconnected when it has more blocks than
+	// us, and the request is sent to another peer.
 	maxStallDuration = 3 * time.Minute
 
+	// maxWindowStallDuration is the time after which a peer is considered
+	// to be stalling the block download when the download window can't
+	// move past the block requested from it, even though other peers are
+	// ready to download more blocks.
+	maxWindowStallDuration = 30 * time.Second
+
 	// stallSampleInterval the interval at which we will check to see if our
 	// sync has stalled.
-	stallSampleInterval = 30 * time.Second
+	stallSampleInterval = 10 * time.Second
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -131,20 +143,13 @@ type pauseMsg struct {
 	unpause <-chan struct{}
 }
 
-// headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
-type headerNode struct {
-	height int32
-	hash   *chainhash.Hash
-}
-
 // peerSyncState stores additional information that the SyncManager tracks
 // about a peer.
 type peerSyncState struct {
 	syncCandidate   bool
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
-	requestedBlocks map[chainhash.Hash]struct{}
+	requestedBlocks map[chainhash.Hash]time.Time
 }
 
 // SyncManager is used to communicate block related messages with peers. The
@@ -165,69 +170,28 @@ type SyncManager struct {
 	quit           chan struct{}
 
 	// These fields should only be accessed from the blockHandler thread
-	rejectedTxns     map[chainhash.Hash]struct{}
-	requestedTxns    map[chainhash.Hash]struct{}
-	requestedBlocks  map[chainhash.Hash]struct{}
-	syncPeer         *peerpkg.Peer
-	peerStates       map[*peerpkg.Peer]*peerSyncState
-	lastProgressTime time.Time
-
-	// The following fields are used for headers-first mode.
-	headersFirstMode bool
-	headerList       *list.List
-	startHeader      *list.Element
-	nextCheckpoint   *chaincfg.Checkpoint
-
-	// An optional fee estimator.
-	feeEstimator *mempool.FeeEstimator
-}
-
-// resetHeaderState sets the headers-first mode state to values appropriate for
-// syncing from a new peer.
-func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	sm.startHeader = nil
-
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if sm.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		sm.headerList.PushBack(&node)
-	}
-}
+	rejectedTxns    map[chainhash.Hash]struct{}
+	requestedTxns   map[chainhash.Hash]struct{}
+	requestedBlocks map[chainhash.Hash]struct{}
+	syncPeer        *peerpkg.Peer
+	peerStates      map[*peerpkg.Peer]*peerSyncState
 
-// findNextHeaderCheckpoint returns the next checkpoint after the passed height.
-// It returns nil when there is not one either because the height is already
-// later than the final checkpoint or some other reason such as disabled
-// checkpoints.
-func (sm *SyncManager) findNextHeaderCheckpoint(height int32) *chaincfg.Checkpoint {
-	checkpoints := sm.chain.Checkpoints()
-	if len(checkpoints) == 0 {
-		return nil
-	}
+	// headersRequestTime is the time the headers were last requested from
+	// the sync peer, or zero when they have been received.
+	headersRequestTime time.Time
 
-	// There is no next checkpoint if the height is already after the final
-	// checkpoint.
-	finalCheckpoint := &checkpoints[len(checkpoints)-1]
-	if height >= finalCheckpoint.Height {
-		return nil
-	}
+	// pendingBlocks holds the blocks which arrived before their parents,
+	// keyed by the hash of the parent.  A parent may have several children
+	// when the best header chain changes during the download.
+	pendingBlocks map[chainhash.Hash][]*blockMsg
 
-	// Find the next checkpoint.
-	nextCheckpoint := finalCheckpoint
-	for i := len(checkpoints) - 2; i >= 0; i-- {
-		if height >= checkpoints[i].Height {
-			break
-		}
-		nextCheckpoint = &checkpoints[i]
-	}
-	return nextCheckpoint
+	// An optional fee estimator.
+	feeEstimator *mempool.FeeEstimator
 }
 
 // startSync will choose the best peer among the available candidate peers to
-// download/sync the blockchain from.  When syncing is already running, it
+// download the headers of the blockchain from.  The blocks themselves are
+// downloaded from all candidate peers.  When syncing is already running, it
 // simply returns.  It also examines the candidates for any which are no longer
 // candidates and removes them as needed.
 func (sm *SyncManager) startSync() {
@@ -248,7 +212,9 @@ func (sm *SyncManager) startSync() {
 	best := sm.chain.BestSnapshot()
 	var higherPeers, equalPeers []*peerpkg.Peer
 	for peer, state := range sm.peerStates {
-		if !state.syncCandidate {
+		// Skip the peers which have been disconnected, such as a sync
+		// peer which stalled, but are not done yet.
+		if !state.syncCandidate || !peer.Connected() {
 			continue
 		}
 
@@ -299,56 +265,31 @@ func (sm *SyncManager) startSync() {
 
 	// Start syncing from the best peer if one was selected.
 	if bestPeer != nil {
-		// Clear the requestedBlocks if the sync peer changes, otherwise
-		// we may ignore blocks we need that the last sync peer failed
-		// to send.
-		sm.requestedBlocks = make(map[chainhash.Hash]struct{})
-
-		locator, err := sm.chain.LatestBlockLocator()
-		if err != nil {
-			log.Errorf("Failed to get block locator for the "+
-				"latest block: %v", err)
-			return
-		}
-
 		log.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
-		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
-		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
-			sm.chainParams != &chaincfg.RegressionNetParams {
-
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-			sm.headersFirstMode = true
-			log.Infof("Downloading headers for blocks %d to "+
-				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
-		} else {
-			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
+		// Always download the headers of the blocks first.  They are
+		// validated and added to the block index on their own, which
+		// makes the chain with the most cumulative work known before
+		// its blocks are downloaded.  The blocks along it are then
+		// requested from all candidate peers as the headers come in.
+		// This is possible since each header contains the hash of the
+		// previous header and a merkle root.  Once the full blocks are
+		// downloaded, the merkle root is computed and compared against
+		// the value in the header which proves the full block hasn't
+		// been tampered with.
+		locator := sm.chain.LatestHeaderLocator()
+		err := bestPeer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Errorf("Failed to send getheaders message to "+
+				"peer %s: %v", bestPeer.Addr(), err)
+			return
 		}
+		_, bestHeaderHeight := sm.chain.BestHeader()
+		log.Infof("Downloading headers for blocks after height %d "+
+			"from peer %s", bestHeaderHeight, bestPeer.Addr())
 		sm.syncPeer = bestPeer
-
-		// Reset the last progress time now that we have a non-nil
-		// syncPeer to avoid instantly detecting it as stalled in the
-		// event the progress time hasn't been updated recently.
-		sm.lastProgressTime = time.Now()
+		sm.headersRequestTime = time.Now()
 	} else {
 		log.Warnf("No sync peer candidates available")
 	}
@@ -360,7 +301,7 @@ func (sm *SyncManager) isSyncCandidate(peer *peerpkg.Peer) bool {
 	// Typically a peer is not a candidate for sync if it's not a full node,
 	// however regression test is special in that the regression tool is
 	// not a full node and still needs to be considered a sync candidate.
-	if sm.chainParams == &chaincfg.RegressionNetParams {
+	if sm.chainParams.Net == chaincfg.RegressionNetParams.Net {
 		// The peer is not a candidate if it's not coming from localhost
 		// or the hostname can't be determined for some reason.
 		host, _, err := net.SplitHostPort(peer.Addr())
@@ -407,53 +348,114 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	sm.peerStates[peer] = &peerSyncState{
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]time.Time),
 	}
 
 	// Start syncing by choosing the best candidate if needed.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
 	}
+
+	// Download blocks from the new peer too.
+	if isSyncCandidate {
+		sm.scheduleBlockRequests(nil)
+	}
 }
 
-// handleStallSample will switch to a new sync peer if the current one has
-// stalled. This is detected when by comparing the last progress timestamp with
-// the current time, and disconnecting the peer if we stalled before reaching
-// their highest advertised block.
+// handleStallSample detects the requests to peers which have stalled.  Each
+// block request which hasn't been answered in time is sent to another peer, and
+// the sync peer is replaced when it doesn't answer a request for headers.  The
+// stalled peers are disconnected if we stalled before reaching their highest
+// advertised block.  Peers which are too slow to deliver the block which holds
+// up the block download window are disconnected too.
 func (sm *SyncManager) handleStallSample() {
 	if atomic.LoadInt32(&sm.shutdown) != 0 {
 		return
 	}
 
-	// If we don't have an active sync peer, exit early.
-	if sm.syncPeer == nil {
-		return
+	// Find the block requests which have stalled.  All of the blocks in
+	// flight from a peer which failed to deliver one of them in time are
+	// requested elsewhere.
+	for peer, state := range sm.peerStates {
+		stalled := false
+		for _, requested := range state.requestedBlocks {
+			if time.Since(requested) > maxStallDuration {
+				stalled = true
+				break
+			}
+		}
+		if !stalled {
+			continue
+		}
+
+		log.Infof("Block request to peer %s stalled", peer)
+		sm.clearRequestedBlocks(state)
+		if sm.shouldDCStalledPeer(peer) {
+			peer.Disconnect()
+		}
 	}
 
-	// If the stall timeout has not elapsed, exit early.
-	if time.Since(sm.lastProgressTime) <= maxStallDuration {
-		return
+	sm.handleWindowStall()
+
+	// Replace the sync peer when it doesn't answer a request for headers.
+	if sm.syncPeer != nil && !sm.headersRequestTime.IsZero() &&
+		time.Since(sm.headersRequestTime) > maxStallDuration {
+
+		log.Infof("Headers request to sync peer %s stalled", sm.syncPeer)
+		sm.updateSyncPeer(sm.shouldDCStalledPeer(sm.syncPeer))
 	}
 
-	// Check to see that the peer's sync state exists.
-	state, exists := sm.peerStates[sm.syncPeer]
-	if !exists {
+	sm.scheduleBlockRequests(nil)
+}
+
+// handleWindowStall disconnects the peer which holds up the block download
+// window.  That's the case when the first block of the window has been in
+// flight from the peer for longer than maxWindowStallDuration, and every other
+// block of the window has been requested already while some peers are ready to
+// download more blocks.
+func (sm *SyncManager) handleWindowStall() {
+	hashes := sm.chain.BlocksToDownload(blockDownloadWindow)
+	if len(hashes) < blockDownloadWindow {
 		return
 	}
+	pending := sm.pendingBlockHashes()
+	for _, hash := range hashes {
+		_, isRequested := sm.requestedBlocks[*hash]
+		_, isPending := pending[*hash]
+		if !isRequested && !isPending {
+			return
+		}
+	}
 
-	sm.clearRequestedState(state)
+	var staller *peerpkg.Peer
+	idle := false
+	for peer, state := range sm.peerStates {
+		requested, exists := state.requestedBlocks[*hashes[0]]
+		if exists && time.Since(requested) > maxWindowStallDuration {
+			staller = peer
+		} else if sm.isDownloadPeer(peer, state) &&
+			len(state.requestedBlocks) < maxBlocksInFlightPerPeer {
+
+			idle = true
+		}
+	}
+	if staller == nil || !idle {
+		return
+	}
 
-	disconnectSyncPeer := sm.shouldDCStalledSyncPeer()
-	sm.updateSyncPeer(disconnectSyncPeer)
+	log.Infof("Peer %s is stalling the block download -- disconnecting",
+		staller)
+	sm.clearRequestedBlocks(sm.peerStates[staller])
+	staller.Disconnect()
 }
 
-// shouldDCStalledSyncPeer determines whether or not we should disconnect a
-// stalled sync peer. If the peer has stalled and its reported height is greater
-// than our own best height, we will disconnect it. Otherwise, we will keep the
-// peer connected in case we are already at tip.
-func (sm *SyncManager) shouldDCStalledSyncPeer() bool {
-	lastBlock := sm.syncPeer.LastBlock()
-	startHeight := sm.syncPeer.StartingHeight()
+// shouldDCStalledPeer determines whether or not we should disconnect a stalled
+// peer. If the peer has stalled and its reported height is greater than our own
+// best height, we will disconnect it. Otherwise, we will keep the peer connected
+// in case we are already at tip.
+func (sm *SyncManager) shouldDCStalledPeer(peer *peerpkg.Peer) bool {
+	lastBlock := peer.LastBlock()
+	startHeight := peer.StartingHeight()
 
 	var peerHeight int32
 	if lastBlock > startHeight {
@@ -462,8 +464,8 @@ func (sm *SyncManager) shouldDCStalledSyncPeer() bool {
 		peerHeight = startHeight
 	}
 
-	// If we've stalled out yet the sync peer reports having more blocks for
-	// us we will disconnect them. This allows us at tip to not disconnect
+	// If we've stalled out yet the peer reports having more blocks for us
+	// we will disconnect them. This allows us at tip to not disconnect
 	// peers when we are equal or they temporarily lag behind us.
 	best := sm.chain.BestSnapshot()
 	return peerHeight > best.Height
@@ -492,6 +494,10 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
 	}
+
+	// Request the blocks which were in flight from the peer from the
+	// remaining peers.
+	sm.scheduleBlockRequests(nil)
 }
 
 // clearRequestedState wipes all expected transactions and blocks from the sync
@@ -504,34 +510,29 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 		delete(sm.requestedTxns, txHash)
 	}
 
-	// Remove requested blocks from the global map so that they will be
-	// fetched from elsewhere next time we get an inv.
-	// TODO: we could possibly here check which peers have these blocks
-	// and request them now to speed things up a little.
+	sm.clearRequestedBlocks(state)
+}
+
+// clearRequestedBlocks wipes all expected blocks from the sync manager's
+// requested maps that were requested under a peer's sync state.  This allows the
+// block download scheduler to request them from other peers.
+func (sm *SyncManager) clearRequestedBlocks(state *peerSyncState) {
 	for blockHash := range state.requestedBlocks {
 		delete(sm.requestedBlocks, blockHash)
+		delete(state.requestedBlocks, blockHash)
 	}
 }
 
 // updateSyncPeer choose a new sync peer to replace the current one. If
 // dcSyncPeer is true, this method will also disconnect the current sync peer.
-// If we are in header first mode, any header state related to prefetching is
-// also reset in preparation for the next sync peer.
 func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
-	log.Debugf("Updating sync peer, no progress for: %v",
-		time.Since(sm.lastProgressTime))
+	log.Debugf("Updating sync peer %s", sm.syncPeer)
 
 	// First, disconnect the current sync peer if requested.
 	if dcSyncPeer {
 		sm.syncPeer.Disconnect()
 	}
 
-	// Reset any header state before we choose our next active sync peer.
-	if sm.headersFirstMode {
-		best := sm.chain.BestSnapshot()
-		sm.resetHeaderState(&best.Hash, best.Height)
-	}
-
 	sm.syncPeer = nil
 	sm.startSync()
 }
@@ -642,7 +643,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// the peer or ignore the block when we're in regression test
 		// mode in this case so the chain code is actually fed the
 		// duplicate blocks.
-		if sm.chainParams != &chaincfg.RegressionNetParams {
+		if sm.chainParams.Net != chaincfg.RegressionNetParams.Net {
 			log.Warnf("Got unrequested block %v from %s -- "+
 				"disconnecting", blockHash, peer.Addr())
 			peer.Disconnect()
@@ -650,36 +651,66 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
-	behaviorFlags := blockchain.BFNone
-	if sm.headersFirstMode {
-		firstNodeEl := sm.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				behaviorFlags |= blockchain.BFFastAdd
-				if firstNode.hash.IsEqual(sm.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					sm.headerList.Remove(firstNodeEl)
-				}
-			}
-		}
-	}
-
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
 
+	// Blocks are downloaded from several peers at once, so they don't
+	// necessarily arrive in order.  Hold back a block while the data of its
+	// parent, whose header is known, is still being downloaded, rather than
+	// turning it into an orphan.  Otherwise, process the block along with
+	// the blocks which have been waiting for it, in order of height.
+	prevHash := &bmsg.block.MsgBlock().Header.PrevBlock
+	if sm.isBlockMissing(prevHash) {
+		log.Debugf("Holding back block %v until its parent %v arrives",
+			blockHash, prevHash)
+		sm.pendingBlocks[*prevHash] = append(sm.pendingBlocks[*prevHash],
+			bmsg)
+	} else {
+		queue := []*blockMsg{bmsg}
+		for len(queue) > 0 {
+			bmsg, queue = queue[0], queue[1:]
+			if !sm.processPeerBlock(bmsg) {
+				continue
+			}
+			hash := bmsg.block.Hash()
+			queue = append(queue, sm.pendingBlocks[*hash]...)
+			delete(sm.pendingBlocks, *hash)
+		}
+	}
+
+	// Request more blocks of the best header chain now that there is room
+	// for them.
+	sm.scheduleBlockRequests(nil)
+}
+
+// isBlockMissing returns whether the header of the block with the passed hash
+// is known, but its data has not been processed yet.  Such blocks are
+// downloaded along the best header chain.
+func (sm *SyncManager) isBlockMissing(hash *chainhash.Hash) bool {
+	if _, err := sm.chain.HeaderByHash(hash); err != nil {
+		return false
+	}
+	haveBlock, err := sm.chain.HaveBlock(hash)
+	return err == nil && !haveBlock
+}
+
+// processPeerBlock processes a block received from a peer, and returns whether
+// it has been accepted into the block chain.  Orphan blocks and blocks which
+// are rejected are not.
+func (sm *SyncManager) processPeerBlock(bmsg *blockMsg) bool {
+	peer := bmsg.peer
+	blockHash := bmsg.block.Hash()
+
+	// The headers of the blocks covered by the latest checkpoint are known
+	// to link to it, so the blocks only need a few checks.
+	behaviorFlags := blockchain.BFNone
+	if sm.chain.IsCheckpointed(blockHash) {
+		behaviorFlags |= blockchain.BFFastAdd
+	}
+
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
 	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
@@ -704,7 +735,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// send it.
 		code, reason := mempool.ErrToRejectErr(err)
 		peer.PushRejectMsg(wire.CmdBlock, code, reason, blockHash, false)
-		return
+		return false
 	}
 
 	// Meta-data about the new block this peer is reporting. We use this
@@ -719,7 +750,9 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	var heightUpdate int32
 	var blkHashUpdate *chainhash.Hash
 
-	// Request the parents for the orphan block from the peer that sent it.
+	// Request the headers of the parents for the orphan block from the peer
+	// that sent it.  The parents are then downloaded along with the rest of
+	// the best header chain.
 	if isOrphan {
 		// We've just received an orphan block from a peer. In order
 		// to update the height of the peer, we try to extract the
@@ -742,18 +775,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 
 		orphanRoot := sm.chain.GetOrphanRoot(blockHash)
-		locator, err := sm.chain.LatestBlockLocator()
+		locator := sm.chain.LatestHeaderLocator()
+		err := peer.PushGetHeadersMsg(locator, orphanRoot)
 		if err != nil {
-			log.Warnf("Failed to get block locator for the "+
-				"latest block: %v", err)
-		} else {
-			peer.PushGetBlocksMsg(locator, orphanRoot)
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
 		}
 	} else {
-		if peer == sm.syncPeer {
-			sm.lastProgressTime = time.Now()
-		}
-
 		// When the block is not an orphan, log information about it and
 		// update the chain state.
 		sm.progressLogger.LogBlockHeight(bmsg.block)
@@ -780,114 +808,130 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// Nothing more to do if we aren't in headers-first mode.
-	if !sm.headersFirstMode {
-		return
-	}
+	return !isOrphan
+}
 
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
+// pendingBlockHashes returns the set of hashes of the blocks which are held back
+// until their parents arrive.
+func (sm *SyncManager) pendingBlockHashes() map[chainhash.Hash]struct{} {
+	hashes := make(map[chainhash.Hash]struct{}, len(sm.pendingBlocks))
+	for _, children := range sm.pendingBlocks {
+		for _, bmsg := range children {
+			hashes[*bmsg.block.Hash()] = struct{}{}
 		}
-		return
 	}
+	return hashes
+}
 
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := sm.nextCheckpoint.Height
-	prevHash := sm.nextCheckpoint.Hash
-	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
-	if sm.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-		if err != nil {
-			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
-			return
-		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
+// isDownloadPeer returns whether blocks may be requested from the passed peer.
+// That's the case for the sync candidates which are not behind the main chain.
+func (sm *SyncManager) isDownloadPeer(peer *peerpkg.Peer, state *peerSyncState) bool {
+	return state.syncCandidate && peer.Connected() &&
+		peer.LastBlock() >= sm.chain.BestSnapshot().Height
+}
+
+// scheduleBlockRequests spreads requests for the blocks of the best header
+// chain which are neither downloaded nor requested yet across the peers.  Only
+// the blocks in the download window are requested, and each peer has at most
+// maxBlocksInFlightPerPeer blocks in flight.  The blocks are assigned to the
+// peers with the fewest blocks in flight, starting with the preferred peer, if
+// any, which is typically the one announcing the blocks.
+func (sm *SyncManager) scheduleBlockRequests(preferred *peerpkg.Peer) {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
 		return
 	}
 
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	log.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
-	if err != nil {
-		log.Warnf("Failed to send getblocks message to peer %s: %v",
-			peer.Addr(), err)
-		return
+	hashes := sm.chain.BlocksToDownload(blockDownloadWindow)
+
+	// Drop the blocks held back for parents which are no longer part of
+	// the best header chain.
+	if len(sm.pendingBlocks) > 0 {
+		inWindow := make(map[chainhash.Hash]struct{}, len(hashes))
+		for _, hash := range hashes {
+			inWindow[*hash] = struct{}{}
+		}
+		for prevHash := range sm.pendingBlocks {
+			if _, ok := inWindow[prevHash]; !ok {
+				delete(sm.pendingBlocks, prevHash)
+			}
+		}
 	}
-}
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
-func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
-		return
+	var peers []*peerpkg.Peer
+	if state, exists := sm.peerStates[preferred]; exists &&
+		sm.isDownloadPeer(preferred, state) {
+
+		peers = append(peers, preferred)
+	}
+	for peer, state := range sm.peerStates {
+		if peer != preferred && sm.isDownloadPeer(peer, state) {
+			peers = append(peers, peer)
+		}
 	}
 
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			log.Warn("Header list node type is not a headerNode")
+	pending := sm.pendingBlockHashes()
+	requests := make(map[*peerpkg.Peer]*wire.MsgGetData)
+	for _, hash := range hashes {
+		if _, exists := sm.requestedBlocks[*hash]; exists {
+			continue
+		}
+		if _, exists := pending[*hash]; exists {
 			continue
 		}
 
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
+		// Orphan blocks are already known, but they are not stored
+		// until their parents are.
+		iv := wire.NewInvVect(wire.InvTypeBlock, hash)
 		haveInv, err := sm.haveInventory(iv)
 		if err != nil {
 			log.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
+				"existing inventory during block download "+
+				"scheduling: %v", err)
+		}
+		if haveInv {
+			continue
 		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
 
-			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
+		// Pick the peer with the fewest blocks in flight.
+		var peer *peerpkg.Peer
+		var state *peerSyncState
+		for _, p := range peers {
+			s := sm.peerStates[p]
+			if len(s.requestedBlocks) < maxBlocksInFlightPerPeer &&
+				(state == nil ||
+					len(s.requestedBlocks) < len(state.requestedBlocks)) {
 
-			// If we're fetching from a witness enabled peer
-			// post-fork, then ensure that we receive all the
-			// witness data in the blocks.
-			if sm.syncPeer.IsWitnessEnabled() {
-				iv.Type = wire.InvTypeWitnessBlock
+				peer, state = p, s
 			}
-
-			gdmsg.AddInvVect(iv)
-			numRequested++
 		}
-		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
+		if peer == nil {
 			break
 		}
+
+		sm.requestedBlocks[*hash] = struct{}{}
+		state.requestedBlocks[*hash] = time.Now()
+
+		// If we're fetching from a witness enabled peer post-fork, then
+		// ensure that we receive all the witness data in the blocks.
+		if peer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+
+		gdmsg, exists := requests[peer]
+		if !exists {
+			gdmsg = wire.NewMsgGetDataSizeHint(maxBlocksInFlightPerPeer)
+			requests[peer] = gdmsg
+		}
+		gdmsg.AddInvVect(iv)
 	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
+	for peer, gdmsg := range requests {
+		peer.QueueMessage(gdmsg, nil)
 	}
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
-// requested when performing a headers-first sync.
+// requested from the sync peer to download the headers of the best chain
+// before its blocks, and are also used by peers to announce new blocks.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
 	_, exists := sm.peerStates[peer]
@@ -896,102 +940,80 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// The remote peer is misbehaving if we didn't request headers.
+	// Process all of the received headers, which validates them and adds
+	// them to the block index.
 	msg := hmsg.headers
 	numHeaders := len(msg.Headers)
-	if !sm.headersFirstMode {
-		log.Warnf("Got %d unrequested headers from %s -- "+
-			"disconnecting", numHeaders, peer.Addr())
-		peer.Disconnect()
-		return
-	}
-
-	// Nothing to do for an empty headers message.
-	if numHeaders == 0 {
-		return
-	}
-
-	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
 	var finalHash *chainhash.Hash
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
-
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
-			peer.Disconnect()
-			return
-		}
-
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
+		err := sm.chain.ProcessBlockHeader(blockHeader, blockchain.BFNone)
+		if err != nil {
+			// A header which doesn't connect to the block index
+			// announces a block whose parents are unknown, so
+			// request the headers leading up to it.
+			ruleErr, ok := err.(blockchain.RuleError)
+			if ok && ruleErr.ErrorCode == blockchain.ErrPreviousBlockUnknown {
+				locator := sm.chain.LatestHeaderLocator()
+				err := peer.PushGetHeadersMsg(locator, &blockHash)
+				if err != nil {
+					log.Warnf("Failed to send getheaders "+
+						"message to peer %s: %v",
+						peer.Addr(), err)
+				}
+				return
 			}
-		} else {
-			log.Warnf("Received block header that does not "+
-				"properly connect to the chain from peer %s "+
-				"-- disconnecting", peer.Addr())
-			peer.Disconnect()
-			return
-		}
 
-		// Verify the header at the next checkpoint height matches.
-		if node.height == sm.nextCheckpoint.Height {
-			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				log.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
-				log.Warnf("Block header at height %d/hash "+
-					"%s from peer %s does NOT match "+
-					"expected checkpoint hash of %s -- "+
-					"disconnecting", node.height,
-					node.hash, peer.Addr(),
-					sm.nextCheckpoint.Hash)
+			if ok {
+				log.Warnf("Received invalid block header %v "+
+					"from peer %s -- disconnecting: %v",
+					blockHash, peer.Addr(), err)
 				peer.Disconnect()
-				return
+			} else {
+				log.Errorf("Failed to process block header "+
+					"%v: %v", blockHash, err)
 			}
-			break
+			if dbErr, ok := err.(database.Error); ok && dbErr.ErrorCode ==
+				database.ErrCorruption {
+				panic(dbErr)
+			}
+			return
 		}
+		finalHash = &blockHash
 	}
 
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		sm.headerList.Remove(sm.headerList.Front())
-		log.Infof("Received %v block headers: Fetching blocks",
-			sm.headerList.Len())
-		sm.progressLogger.SetLastLogTime(time.Now())
-		sm.fetchHeaderBlocks()
-		return
+	// Update the last announced block for this peer the same way block
+	// inventory does.
+	if finalHash != nil && (peer != sm.syncPeer || sm.current()) {
+		peer.UpdateLastAnnouncedBlock(finalHash)
 	}
 
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-	if err != nil {
-		log.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", peer.Addr(), err)
-		return
+	if peer == sm.syncPeer {
+		sm.headersRequestTime = time.Time{}
+	}
+
+	// A full headers message means the remote peer has more headers, so
+	// request the next batch starting from the latest received header.
+	if numHeaders == wire.MaxBlockHeadersPerMsg {
+		locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		} else if peer == sm.syncPeer {
+			sm.headersRequestTime = time.Now()
+		}
+	} else if peer == sm.syncPeer {
+		bestHeaderHash, bestHeaderHeight := sm.chain.BestHeader()
+		log.Debugf("Received all headers from peer %s, best header "+
+			"%v (height %d)", peer.Addr(), bestHeaderHash,
+			bestHeaderHeight)
 	}
+
+	// Download the blocks of the best header chain from all peers while
+	// the headers are still coming in.  The peer which sent the headers is
+	// asked first since it's known to have the blocks.
+	sm.scheduleBlockRequests(peer)
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1115,11 +1137,6 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		// for the peer.
 		peer.AddKnownInventory(iv)
 
-		// Ignore inventory when we're in headers-first mode.
-		if sm.headersFirstMode {
-			continue
-		}
-
 		// Request the inventory if we don't already have it.
 		haveInv, err := sm.haveInventory(iv)
 		if err != nil {
@@ -1146,6 +1163,15 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 				continue
 			}
 
+			// While syncing, the blocks announced by the sync peer
+			// are downloaded along with the rest of the best header
+			// chain, so only request the headers up to them.
+			if iv.Type == wire.InvTypeBlock && !sm.current() {
+				locator := sm.chain.LatestHeaderLocator()
+				peer.PushGetHeadersMsg(locator, &iv.Hash)
+				continue
+			}
+
 			// Add it to the request queue.
 			state.requestQueue = append(state.requestQueue, iv)
 			continue
@@ -1163,18 +1189,12 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			// to signal there are more missing blocks that need to
 			// be requested.
 			if sm.chain.IsKnownOrphan(&iv.Hash) {
-				// Request blocks starting at the latest known
+				// Request headers starting at the latest known
 				// up to the root of the orphan that just came
 				// in.
 				orphanRoot := sm.chain.GetOrphanRoot(&iv.Hash)
-				locator, err := sm.chain.LatestBlockLocator()
-				if err != nil {
-					log.Errorf("PEER: Failed to get block "+
-						"locator for the latest block: "+
-						"%v", err)
-					continue
-				}
-				peer.PushGetBlocksMsg(locator, orphanRoot)
+				locator := sm.chain.LatestHeaderLocator()
+				peer.PushGetHeadersMsg(locator, orphanRoot)
 				continue
 			}
 
@@ -1183,11 +1203,11 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			// should only happen if we're on a really long side
 			// chain.
 			if i == lastBlock {
-				// Request blocks after this one up to the
+				// Request headers after this one up to the
 				// final one the remote peer knows about (zero
 				// stop hash).
 				locator := sm.chain.BlockLocatorFromHash(&iv.Hash)
-				peer.PushGetBlocksMsg(locator, &zeroHash)
+				peer.PushGetHeadersMsg(locator, &zeroHash)
 			}
 		}
 	}
@@ -1211,7 +1231,7 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			if _, exists := sm.requestedBlocks[iv.Hash]; !exists {
 				sm.requestedBlocks[iv.Hash] = struct{}{}
 				sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
-				state.requestedBlocks[iv.Hash] = struct{}{}
+				state.requestedBlocks[iv.Hash] = time.Now()
 
 				if peer.IsWitnessEnabled() {
 					iv.Type = wire.InvTypeWitnessBlock
@@ -1389,9 +1409,11 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		// new transactions.  Finally, remove any transaction that is
 		// no longer an orphan. Transactions which depend on a confirmed
 		// transaction are NOT removed recursively because they are still
-		// valid.
+		// valid.  The fee deltas of the confirmed transactions aren't
+		// needed anymore either.
 		for _, tx := range block.Transactions()[1:] {
 			sm.txMemPool.RemoveTransaction(tx, false)
+			sm.txMemPool.ClearPrioritisation(tx.Hash())
 			sm.txMemPool.RemoveDoubleSpends(tx)
 			sm.txMemPool.RemoveOrphan(tx)
 			sm.peerNotifier.TransactionConfirmed(tx)
@@ -1582,21 +1604,14 @@ func New(config *Config) (*SyncManager, error) {
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
 		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
+		pendingBlocks:   make(map[chainhash.Hash][]*blockMsg),
 		progressLogger:  newBlockProgressLogger("Processed", log),
 		msgChan:         make(chan interface{}, config.MaxPeers*3),
-		headerList:      list.New(),
 		quit:            make(chan struct{}),
 		feeEstimator:    config.FeeEstimator,
 	}
 
-	best := sm.chain.BestSnapshot()
-	if !config.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(best.Height)
-		if sm.nextCheckpoint != nil {
-			sm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	if config.DisableCheckpoints {
 		log.Info("Checkpoints are disabled")
 	}
 
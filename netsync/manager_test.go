@@ -0,0 +1,659 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/fullblocktests"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testParams are the chain parameters of the blocks generated by the
+// fullblocktests package, which the tests sync.
+var testParams = fullblocktests.RegressionNetParams
+
+var (
+	mainChainOnce   sync.Once
+	mainChainBlocks []*btcutil.Block
+	mainChainErr    error
+)
+
+// newTestChain returns a new chain which only has the genesis block, along with
+// a teardown function.
+func newTestChain(t *testing.T) (*blockchain.BlockChain, func()) {
+	dbPath, err := ioutil.TempDir("", "netsync")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, testParams.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("database.Create: %v", err)
+	}
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbPath)
+		t.Fatalf("claimtrie.NewMemory: %v", err)
+	}
+	teardown := func() {
+		ct.Close()
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	params := *testParams
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+		ClaimTrie:   ct,
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("blockchain.New: %v", err)
+	}
+	return chain, teardown
+}
+
+// generatedMainChain returns the blocks of the main chain generated by the
+// fullblocktests package, starting at height 1.  The ClaimTrie parameters of
+// the generator must be in effect.
+func generatedMainChain(t *testing.T) []*btcutil.Block {
+	mainChainOnce.Do(func() {
+		tests, err := fullblocktests.Generate(false)
+		if err != nil {
+			mainChainErr = err
+			return
+		}
+		chain, teardown := newTestChain(t)
+		defer teardown()
+		for _, test := range tests {
+			for _, item := range test {
+				var block *wire.MsgBlock
+				switch item := item.(type) {
+				case fullblocktests.AcceptedBlock:
+					block = item.Block
+				case fullblocktests.RejectedBlock:
+					block = item.Block
+				case fullblocktests.OrphanOrRejectedBlock:
+					block = item.Block
+				default:
+					continue
+				}
+				chain.ProcessBlock(btcutil.NewBlock(block),
+					blockchain.BFNone)
+			}
+		}
+		best := chain.BestSnapshot()
+		for height := int32(1); height <= best.Height; height++ {
+			block, err := chain.BlockByHeight(height)
+			if err != nil {
+				mainChainErr = err
+				return
+			}
+			mainChainBlocks = append(mainChainBlocks, block)
+		}
+	})
+	if mainChainErr != nil {
+		t.Fatalf("failed to generate the main chain: %v", mainChainErr)
+	}
+	return mainChainBlocks
+}
+
+// blockHeaders returns the headers of the passed blocks.
+func blockHeaders(blocks []*btcutil.Block) *wire.MsgHeaders {
+	msg := wire.NewMsgHeaders()
+	for _, block := range blocks {
+		msg.AddBlockHeader(&block.MsgBlock().Header)
+	}
+	return msg
+}
+
+// solve increments the nonce of the passed header until it has a valid proof of
+// work.
+func solve(header *wire.BlockHeader) {
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		hash := header.BlockPoWHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+		header.Nonce++
+	}
+}
+
+// solveHeader returns a header after the passed one, with the passed timestamp,
+// which has a valid proof of work.
+func solveHeader(prev *wire.BlockHeader, timestamp time.Time) *wire.BlockHeader {
+	header := &wire.BlockHeader{
+		Version:   4,
+		PrevBlock: prev.BlockHash(),
+		Timestamp: timestamp,
+		Bits:      prev.Bits,
+	}
+	solve(header)
+	return header
+}
+
+// testNotifier is a PeerNotifier which ignores all notifications.
+type testNotifier struct{}
+
+func (testNotifier) AnnounceNewTransactions([]*mempool.TxDesc)               {}
+func (testNotifier) UpdatePeerHeights(*chainhash.Hash, int32, *peerpkg.Peer) {}
+func (testNotifier) RelayInventory(*wire.InvVect, interface{})               {}
+func (testNotifier) TransactionConfirmed(*btcutil.Tx)                        {}
+
+// newTestSyncManager returns a sync manager for the passed chain, with logging
+// disabled.  It isn't started, so the tests call its handlers directly.
+func newTestSyncManager(t *testing.T, chain *blockchain.BlockChain) *SyncManager {
+	DisableLog()
+	sm, err := New(&Config{
+		PeerNotifier: testNotifier{},
+		Chain:        chain,
+		TxMemPool:    mempool.New(&mempool.Config{ChainParams: testParams}),
+		ChainParams:  testParams,
+		MaxPeers:     8,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return sm
+}
+
+// pipeConn is one end of a pipe which reports a remote address, as peers
+// require one.
+type pipeConn struct {
+	net.Conn
+}
+
+func (pipeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 29246}
+}
+
+// testPeer is a peer of the sync manager whose remote end is driven by the
+// test, which records the requests for headers and blocks it receives.
+type testPeer struct {
+	*peerpkg.Peer
+	getHeaders chan *wire.MsgGetHeaders
+	getData    chan *wire.MsgGetData
+}
+
+// newTestPeer returns a peer whose remote end advertises the passed height.
+func newTestPeer(t *testing.T, height int32) *testPeer {
+	p := &testPeer{
+		getHeaders: make(chan *wire.MsgGetHeaders, 100),
+		getData:    make(chan *wire.MsgGetData, 100),
+	}
+	verack := make(chan struct{}, 1)
+	cfg := &peerpkg.Config{
+		ChainParams: testParams,
+		Services:    wire.SFNodeNetwork | wire.SFNodeWitness,
+		Listeners: peerpkg.MessageListeners{
+			OnVerAck: func(*peerpkg.Peer, *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+	}
+	local, err := peerpkg.NewOutboundPeer(cfg, "127.0.0.1:29246")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: %v", err)
+	}
+
+	// The remote end answers the version message of the local peer, and
+	// then records the requests it receives until the pipe is closed.
+	localConn, remote := net.Pipe()
+	go func() {
+		defer remote.Close()
+		pver := wire.ProtocolVersion
+		if _, _, err := wire.ReadMessage(remote, pver, testParams.Net); err != nil {
+			return
+		}
+		addr := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 29246,
+			wire.SFNodeNetwork|wire.SFNodeWitness)
+		version := wire.NewMsgVersion(addr, addr, 1, height)
+		version.Services = wire.SFNodeNetwork | wire.SFNodeWitness
+		for _, msg := range []wire.Message{version, wire.NewMsgVerAck()} {
+			if err := wire.WriteMessage(remote, msg, pver, testParams.Net); err != nil {
+				return
+			}
+		}
+		for {
+			msg, _, err := wire.ReadMessage(remote, pver, testParams.Net)
+			if err != nil {
+				return
+			}
+			switch msg := msg.(type) {
+			case *wire.MsgGetHeaders:
+				p.getHeaders <- msg
+			case *wire.MsgGetData:
+				p.getData <- msg
+			}
+		}
+	}()
+	local.AssociateConnection(pipeConn{localConn})
+	select {
+	case <-verack:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout negotiating with the test peer")
+	}
+	p.Peer = local
+	return p
+}
+
+// expectGetHeaders returns the next getheaders message received by the remote
+// peer.
+func (p *testPeer) expectGetHeaders(t *testing.T) *wire.MsgGetHeaders {
+	t.Helper()
+	select {
+	case msg := <-p.getHeaders:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no getheaders message sent to peer %s", p)
+	}
+	return nil
+}
+
+// expectGetData returns the hashes of the blocks requested by the next getdata
+// message received by the remote peer.
+func (p *testPeer) expectGetData(t *testing.T) []chainhash.Hash {
+	t.Helper()
+	select {
+	case msg := <-p.getData:
+		hashes := make([]chainhash.Hash, 0, len(msg.InvList))
+		for _, iv := range msg.InvList {
+			hashes = append(hashes, iv.Hash)
+		}
+		return hashes
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no getdata message sent to peer %s", p)
+	}
+	return nil
+}
+
+// expectNoRequests ensures the remote peer doesn't receive any further
+// requests for headers or blocks.
+func (p *testPeer) expectNoRequests(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-p.getHeaders:
+		t.Fatalf("unexpected getheaders message %v", msg.BlockLocatorHashes)
+	case msg := <-p.getData:
+		t.Fatalf("unexpected getdata message for %d blocks",
+			len(msg.InvList))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestHeadersFirstSync ensures the headers of the best chain are requested
+// from the sync peer, and that the blocks along them are then requested and
+// connected as they arrive.
+func TestHeadersFirstSync(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+	blocks := generatedMainChain(t)
+	byHash := make(map[chainhash.Hash]*btcutil.Block)
+	for _, block := range blocks {
+		byHash[*block.Hash()] = block
+	}
+	tip := blocks[len(blocks)-1]
+
+	chain, teardown := newTestChain(t)
+	defer teardown()
+	sm := newTestSyncManager(t, chain)
+	p := newTestPeer(t, tip.Height())
+	defer p.Disconnect()
+
+	// The new peer becomes the sync peer, and the headers after the
+	// genesis block are requested from it.
+	sm.handleNewPeerMsg(p.Peer)
+	if sm.syncPeer != p.Peer {
+		t.Fatalf("peer is not the sync peer")
+	}
+	getHeaders := p.expectGetHeaders(t)
+	if len(getHeaders.BlockLocatorHashes) != 1 ||
+		*getHeaders.BlockLocatorHashes[0] != *testParams.GenesisHash ||
+		getHeaders.HashStop != zeroHash {
+
+		t.Fatalf("unexpected getheaders message %+v", getHeaders)
+	}
+	p.expectNoRequests(t)
+
+	// Once the headers arrive, the blocks are requested and connected in
+	// order as they are delivered.
+	sm.handleHeadersMsg(&headersMsg{headers: blockHeaders(blocks), peer: p.Peer})
+	if !sm.headersRequestTime.IsZero() {
+		t.Fatalf("headers request still outstanding")
+	}
+	if hash, height := chain.BestHeader(); *hash != *tip.Hash() ||
+		height != tip.Height() {
+
+		t.Fatalf("best header %v at height %d, want %v at %d", hash,
+			height, tip.Hash(), tip.Height())
+	}
+	for chain.BestSnapshot().Height < tip.Height() {
+		hashes := p.expectGetData(t)
+		if len(hashes) > maxBlocksInFlightPerPeer {
+			t.Fatalf("%d blocks requested at once", len(hashes))
+		}
+		for _, hash := range hashes {
+			block, ok := byHash[hash]
+			if !ok {
+				t.Fatalf("unknown block %v requested", hash)
+			}
+			sm.handleBlockMsg(&blockMsg{block: block, peer: p.Peer})
+		}
+	}
+	if best := chain.BestSnapshot(); best.Hash != *tip.Hash() {
+		t.Fatalf("best block %v, want %v", best.Hash, tip.Hash())
+	}
+	p.expectNoRequests(t)
+
+	// A header which doesn't connect announces a block whose parents are
+	// unknown, so the headers leading up to it are requested.
+	unknown := solveHeader(&tip.MsgBlock().Header, tip.MsgBlock().Header.Timestamp.Add(time.Second))
+	announced := solveHeader(unknown, unknown.Timestamp.Add(time.Second))
+	msg := wire.NewMsgHeaders()
+	msg.AddBlockHeader(announced)
+	sm.handleHeadersMsg(&headersMsg{headers: msg, peer: p.Peer})
+	getHeaders = p.expectGetHeaders(t)
+	if *getHeaders.BlockLocatorHashes[0] != *tip.Hash() ||
+		getHeaders.HashStop != announced.BlockHash() {
+
+		t.Fatalf("unexpected getheaders message %+v", getHeaders)
+	}
+
+	// An invalid header gets the peer disconnected.
+	invalid := solveHeader(&tip.MsgBlock().Header, blocks[0].MsgBlock().Header.Timestamp)
+	msg = wire.NewMsgHeaders()
+	msg.AddBlockHeader(invalid)
+	sm.handleHeadersMsg(&headersMsg{headers: msg, peer: p.Peer})
+	if p.Connected() {
+		t.Fatalf("peer sending an invalid header is still connected")
+	}
+	invalidHash := invalid.BlockHash()
+	if _, err := chain.HeaderByHash(&invalidHash); err == nil {
+		t.Fatalf("invalid header added to the block index")
+	}
+}
+
+// deliverBlocks delivers the blocks requested from the passed peers, except for
+// the withheld ones, until numBlocks blocks have been delivered.
+func deliverBlocks(t *testing.T, sm *SyncManager, byHash map[chainhash.Hash]*btcutil.Block,
+	withheld map[chainhash.Hash]bool, numBlocks int, peers ...*testPeer) {
+
+	t.Helper()
+	for numBlocks > 0 {
+		var p *testPeer
+		var msg *wire.MsgGetData
+		select {
+		case msg = <-peers[0].getData:
+			p = peers[0]
+		case msg = <-peers[len(peers)-1].getData:
+			p = peers[len(peers)-1]
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d blocks not requested", numBlocks)
+		}
+		for _, iv := range msg.InvList {
+			if withheld[iv.Hash] {
+				continue
+			}
+			block, ok := byHash[iv.Hash]
+			if !ok {
+				t.Fatalf("unknown block %v requested", iv.Hash)
+			}
+			sm.handleBlockMsg(&blockMsg{block: block, peer: p.Peer})
+			numBlocks--
+		}
+	}
+}
+
+// TestScheduleBlockRequests ensures the blocks of the best header chain are
+// spread across the peers, and that blocks which arrive before their parents,
+// including several children of the same parent, are processed once the parent
+// arrives.
+func TestScheduleBlockRequests(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+	blocks := generatedMainChain(t)
+	tip := blocks[len(blocks)-1]
+
+	chain, teardown := newTestChain(t)
+	defer teardown()
+	sm := newTestSyncManager(t, chain)
+	p1 := newTestPeer(t, tip.Height())
+	defer p1.Disconnect()
+	p2 := newTestPeer(t, tip.Height())
+	defer p2.Disconnect()
+	sm.handleNewPeerMsg(p1.Peer)
+	p1.expectGetHeaders(t)
+	sm.handleNewPeerMsg(p2.Peer)
+
+	// The blocks are requested from the peer sending the headers first,
+	// and then from the peer with the fewest blocks in flight, with at
+	// most maxBlocksInFlightPerPeer blocks in flight from each.
+	sm.handleHeadersMsg(&headersMsg{headers: blockHeaders(blocks), peer: p1.Peer})
+	hashes1 := p1.expectGetData(t)
+	hashes2 := p2.expectGetData(t)
+	if len(hashes1) != maxBlocksInFlightPerPeer ||
+		len(hashes2) != maxBlocksInFlightPerPeer {
+
+		t.Fatalf("got %d and %d blocks in flight, want %d", len(hashes1),
+			len(hashes2), maxBlocksInFlightPerPeer)
+	}
+	for i := 0; i < maxBlocksInFlightPerPeer; i++ {
+		if hashes1[i] != *blocks[2*i].Hash() ||
+			hashes2[i] != *blocks[2*i+1].Hash() {
+
+			t.Fatalf("blocks %d and %d requested out of order", 2*i+1,
+				2*i+2)
+		}
+	}
+	p1.expectNoRequests(t)
+
+	// Hold back the second block, and a sibling of it with the same
+	// transactions, until the first block arrives.
+	siblingMsg := *blocks[1].MsgBlock()
+	siblingMsg.Header.Nonce++
+	solve(&siblingMsg.Header)
+	sibling := btcutil.NewBlock(&siblingMsg)
+	sm.requestedBlocks[*sibling.Hash()] = struct{}{}
+	sm.peerStates[p2.Peer].requestedBlocks[*sibling.Hash()] = time.Now()
+	sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: p2.Peer})
+	sm.handleBlockMsg(&blockMsg{block: sibling, peer: p2.Peer})
+	if n := len(sm.pendingBlocks[*blocks[0].Hash()]); n != 2 {
+		t.Fatalf("%d blocks held back, want 2", n)
+	}
+	if best := chain.BestSnapshot(); best.Height != 0 {
+		t.Fatalf("blocks processed before their parent arrived")
+	}
+
+	// The blocks held back don't count against the blocks in flight.
+	hashes2 = p2.expectGetData(t)
+	if len(hashes2) != 1 || hashes2[0] != *blocks[2*maxBlocksInFlightPerPeer].Hash() {
+		t.Fatalf("unexpected blocks requested %v", hashes2)
+	}
+
+	sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: p1.Peer})
+	if best := chain.BestSnapshot(); best.Hash != *blocks[1].Hash() {
+		t.Fatalf("best block %v, want %v", best.Hash, blocks[1].Hash())
+	}
+	if haveBlock, err := chain.HaveBlock(sibling.Hash()); err != nil || !haveBlock {
+		t.Fatalf("sibling held back with the block not processed")
+	}
+	if len(sm.pendingBlocks) != 0 {
+		t.Fatalf("%d blocks still held back", len(sm.pendingBlocks))
+	}
+}
+
+// TestStallSample ensures requests for headers and blocks which aren't answered
+// in time are sent elsewhere, and that the stalled peers are disconnected when
+// they have more blocks than us.
+func TestStallSample(t *testing.T) {
+	defer claimtrie.SetParams(claimtrie.SetParams(fullblocktests.ClaimTrieParams))
+	blocks := generatedMainChain(t)
+	tip := blocks[len(blocks)-1]
+	stalled := time.Now().Add(-maxStallDuration - time.Second)
+	stall := func(state *peerSyncState) {
+		for hash := range state.requestedBlocks {
+			state.requestedBlocks[hash] = stalled
+		}
+	}
+
+	chain, teardown := newTestChain(t)
+	defer teardown()
+	sm := newTestSyncManager(t, chain)
+	p1 := newTestPeer(t, tip.Height())
+	defer p1.Disconnect()
+	p2 := newTestPeer(t, tip.Height())
+	defer p2.Disconnect()
+
+	// The sync peer is replaced when it doesn't answer the request for
+	// headers in time.
+	sm.handleNewPeerMsg(p1.Peer)
+	p1.expectGetHeaders(t)
+	sm.handleNewPeerMsg(p2.Peer)
+	sm.headersRequestTime = stalled
+	sm.handleStallSample()
+	if p1.Connected() || sm.syncPeer != p2.Peer {
+		t.Fatalf("sync peer stalling the headers not replaced")
+	}
+	p2.expectGetHeaders(t)
+	sm.handleDonePeerMsg(p1.Peer)
+
+	// The blocks in flight from a peer which doesn't deliver them in time
+	// are requested from another peer.
+	sm.handleHeadersMsg(&headersMsg{headers: blockHeaders(blocks), peer: p2.Peer})
+	p2.expectGetData(t)
+	stall(sm.peerStates[p2.Peer])
+	sm.handleStallSample()
+	if p2.Connected() || len(sm.peerStates[p2.Peer].requestedBlocks) != 0 {
+		t.Fatalf("peer stalling the blocks not disconnected")
+	}
+	sm.handleDonePeerMsg(p2.Peer)
+	p3 := newTestPeer(t, tip.Height())
+	defer p3.Disconnect()
+	sm.handleNewPeerMsg(p3.Peer)
+	p3.expectGetHeaders(t)
+	if hashes := p3.expectGetData(t); hashes[0] != *blocks[0].Hash() {
+		t.Fatalf("stalled blocks not requested again")
+	}
+
+	// Peers which don't have more blocks than us stay connected, and their
+	// requests are sent again.
+	p4 := newTestPeer(t, 0)
+	defer p4.Disconnect()
+	sm.handleNewPeerMsg(p4.Peer)
+	next := *blocks[maxBlocksInFlightPerPeer].Hash()
+	if hashes := p4.expectGetData(t); hashes[0] != next {
+		t.Fatalf("blocks not requested from peer without more blocks")
+	}
+	stall(sm.peerStates[p4.Peer])
+	sm.handleStallSample()
+	if !p4.Connected() {
+		t.Fatalf("peer without more blocks disconnected")
+	}
+	if hashes := p4.expectGetData(t); hashes[0] != next {
+		t.Fatalf("stalled blocks not requested again")
+	}
+}
+
+// TestWindowStall ensures the peer which holds up the block download window is
+// disconnected once every other block of the window has been downloaded, and
+// that the block is then requested from another peer.
+func TestWindowStall(t *testing.T) {
+	// The headers of the window, along with a few more, are mined on top
+	// of the genesis block.  Their blocks are held back until the first
+	// one arrives, so only their headers need to be valid.
+	const numHeaders = blockDownloadWindow + 10
+	headers := wire.NewMsgHeaders()
+	byHash := make(map[chainhash.Hash]*btcutil.Block)
+	prev := &testParams.GenesisBlock.Header
+	for i := 0; i < numHeaders; i++ {
+		header := solveHeader(prev, prev.Timestamp.Add(time.Second))
+		headers.AddBlockHeader(header)
+		block := btcutil.NewBlock(&wire.MsgBlock{Header: *header})
+		byHash[*block.Hash()] = block
+		prev = header
+	}
+	first := headers.Headers[0].BlockHash()
+
+	chain, teardown := newTestChain(t)
+	defer teardown()
+	sm := newTestSyncManager(t, chain)
+	p1 := newTestPeer(t, numHeaders)
+	defer p1.Disconnect()
+	p2 := newTestPeer(t, numHeaders)
+	defer p2.Disconnect()
+	sm.handleNewPeerMsg(p1.Peer)
+	p1.expectGetHeaders(t)
+	sm.handleNewPeerMsg(p2.Peer)
+	sm.handleHeadersMsg(&headersMsg{headers: headers, peer: p1.Peer})
+
+	// Download every block of the window but the first one.
+	withheld := map[chainhash.Hash]bool{first: true}
+	deliverBlocks(t, sm, byHash, withheld, blockDownloadWindow-1, p1, p2)
+	p1.expectNoRequests(t)
+	p2.expectNoRequests(t)
+
+	// The peer isn't considered to be stalling the window until the block
+	// has been in flight for long enough.
+	sm.handleStallSample()
+	if !p1.Connected() {
+		t.Fatalf("peer disconnected before stalling the window")
+	}
+	sm.peerStates[p1.Peer].requestedBlocks[first] =
+		time.Now().Add(-maxWindowStallDuration - time.Second)
+	sm.handleStallSample()
+	if p1.Connected() {
+		t.Fatalf("peer stalling the window not disconnected")
+	}
+	if hashes := p2.expectGetData(t); len(hashes) != 1 || hashes[0] != first {
+		t.Fatalf("block stalling the window not requested again")
+	}
+}
+
+// TestRegressionNetSyncCandidate ensures a copy of the regression test network
+// parameters, such as the one made for --deployment, still lets peers which
+// aren't full nodes sync from localhost only.
+func TestRegressionNetSyncCandidate(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	sm := &SyncManager{chainParams: &params}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:18444", true},
+		{"localhost:18444", true},
+		{"10.0.0.1:18444", false},
+	}
+	for _, test := range tests {
+		peer, err := peerpkg.NewOutboundPeer(&peerpkg.Config{
+			ChainParams: &params,
+		}, test.addr)
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: %v", err)
+		}
+		if got := sm.isSyncCandidate(peer); got != test.want {
+			t.Errorf("isSyncCandidate(%s): got %v, want %v",
+				test.addr, got, test.want)
+		}
+	}
+}
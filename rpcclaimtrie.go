@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -15,6 +17,15 @@ var (
 	errNoError = errors.New("no error")
 )
 
+// claimsInTrieBatchSize is the maximum number of names getclaimsintrie
+// collects from the ClaimTrie at a time while the chain lock is held.
+const claimsInTrieBatchSize = 1000
+
+// defaultClaimScheduleWindow is the number of blocks covered by the
+// getclaimschedule command when the upper bound is not specified.
+// It is roughly a week worth of blocks.
+const defaultClaimScheduleWindow = 4032
+
 func amountToLBC(amt claimtrie.Amount) string {
 	sign := ""
 	if amt < 0 {
@@ -26,9 +37,79 @@ func amountToLBC(amt claimtrie.Amount) string {
 	return fmt.Sprintf("%s%d.%08d", sign, quotient, remainder)
 }
 
-// handleGetClaimsInTrie returns all claims in the name trie.
+// handleGetClaimsInTrie returns the claims in the name trie.
+// The names can be filtered by prefix and paginated with startafter and limit.
+// The result is streamed to the client one batch of names at a time.
 func handleGetClaimsInTrie(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	res := btcjson.GetClaimsInTrieResult{}
+	c := cmd.(*btcjson.GetClaimsInTrieCmd)
+
+	var prefix, startAfter string
+	var limit int32
+	if c.Prefix != nil {
+		prefix = *c.Prefix
+	}
+	if c.StartAfter != nil {
+		startAfter = *c.StartAfter
+	}
+	if c.Limit != nil {
+		limit = *c.Limit
+	}
+	if limit < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "limit must not be negative",
+		}
+	}
+
+	produce := claimsInTrieProducer(s.cfg.Chain.ViewClaimTrie, prefix,
+		startAfter, limit, claimsInTrieBatchSize)
+	return newStreamedArray(produce), nil
+}
+
+// claimsInTrieProducer returns a producer of the entries claimsInTrie returns
+// for the passed arguments.  The names are collected through view in batches
+// of at most batchSize names, each of which is emitted before the next one is
+// collected, so the ClaimTrie is only locked while a batch is collected and a
+// single batch is held in memory at a time.  Each batch reflects the ClaimTrie
+// at the block which is the end of the main chain when it is collected.
+func claimsInTrieProducer(view func(func(*claimtrie.ClaimTrie) error) error,
+	prefix, startAfter string, limit, batchSize int32) func(emit func(v interface{}) error) error {
+
+	return func(emit func(v interface{}) error) error {
+		var emitted int32
+		for limit == 0 || emitted < limit {
+			n := batchSize
+			if limit != 0 && limit-emitted < n {
+				n = limit - emitted
+			}
+			var entries []btcjson.ClaimsInTrieEntry
+			err := view(func(ct *claimtrie.ClaimTrie) error {
+				entries = claimsInTrie(ct, prefix, startAfter, n)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if err := emit(e); err != nil {
+					return err
+				}
+			}
+			if int32(len(entries)) < n {
+				break
+			}
+			emitted += n
+			startAfter = entries[len(entries)-1].Name
+		}
+		return nil
+	}
+}
+
+// claimsInTrie returns the claims of the names in the ClaimTrie, which have
+// the specified prefix and sort after startAfter, in lexicographical order of
+// names.  At most limit names are returned unless limit is zero.
+func claimsInTrie(ct *claimtrie.ClaimTrie, prefix, startAfter string, limit int32) []btcjson.ClaimsInTrieEntry {
+	var entries []btcjson.ClaimsInTrieEntry
 	fn := func(n *claimtrie.Node) bool {
 		e := btcjson.ClaimsInTrieEntry{
 			Name:   n.Name,
@@ -45,11 +126,11 @@ func handleGetClaimsInTrie(s *rpcServer, cmd interface{}, closeChan <-chan struc
 			}
 			e.Claims = append(e.Claims, clm)
 		}
-		res = append(res, e)
-		return false
+		entries = append(entries, e)
+		return limit > 0 && int32(len(entries)) >= limit
 	}
-	s.cfg.Chain.ClaimTrie().Visit(fn)
-	return res, nil
+	ct.VisitRange(prefix, startAfter, fn)
+	return entries
 }
 
 // handleGetClaimTrie returns the entire name trie.
@@ -60,8 +141,11 @@ func handleGetClaimTrie(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 // handleGetValueForName returns the value associated with a name, if one exists.
 func handleGetValueForName(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	name := cmd.(*btcjson.GetValueForNameCmd).Name
-	ct := s.cfg.Chain.ClaimTrie()
-	n := ct.Node(name)
+	var n *claimtrie.Node
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		n = ct.Node(name)
+		return nil
+	})
 	if n == nil || n.BestClaim == nil {
 		return btcjson.GetValueForNameResult{}, nil
 	}
@@ -82,11 +166,11 @@ func handleGetValueForName(s *rpcServer, cmd interface{}, closeChan <-chan struc
 func handleGetClaimsForName(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	name := cmd.(*btcjson.GetClaimsForNameCmd).Name
 	res := btcjson.GetClaimsForNameResult{}
-	ct := s.cfg.Chain.ClaimTrie()
-	n := ct.Node(name)
-	if n == nil {
-		return res, nil
-	}
+	var n *claimtrie.Node
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		n = ct.Node(name)
+		return nil
+	})
 
 	matched := map[wire.OutPoint]bool{}
 	for _, c := range n.Claims {
@@ -99,6 +183,8 @@ func handleGetClaimsForName(s *rpcServer, cmd interface{}, closeChan <-chan stru
 			Amount:          c.Amount,
 			EffectiveAmount: c.EffectiveAmount,
 			Supports:        []btcjson.SupportOfClaim{},
+			ExpiresAt:       c.ExpireAt(),
+			BlocksToExpiry:  blocksToExpiry(c, n.Height),
 		}
 		for _, s := range n.Supports {
 			if s.ID != c.ID {
@@ -139,7 +225,12 @@ func handleGetClaimsForName(s *rpcServer, cmd interface{}, closeChan <-chan stru
 
 // handleGetTotalClaimedNames returns the total number of names that have been successfully claimed, and therefore exist in the trie
 func handleGetTotalClaimedNames(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return s.cfg.Chain.ClaimTrie().Size(), nil
+	var size int
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		size = ct.Size()
+		return nil
+	})
+	return size, nil
 }
 
 // handleGetTotalClaims returns the total number of active claims in the trie.
@@ -149,7 +240,10 @@ func handleGetTotalClaims(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		cnt += len(n.Claims)
 		return false
 	}
-	s.cfg.Chain.ClaimTrie().Visit(fn)
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		ct.Visit(fn)
+		return nil
+	})
 	return int64(cnt), nil
 }
 
@@ -170,7 +264,10 @@ func handleGetTotalValueOfClaims(s *rpcServer, cmd interface{}, closeChan <-chan
 			return false
 		}
 	}
-	s.cfg.Chain.ClaimTrie().Visit(fn)
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		ct.Visit(fn)
+		return nil
+	})
 	return amt, nil
 }
 
@@ -183,7 +280,7 @@ func handleGetClaimsForTx(s *rpcServer, cmd interface{}, closeChan <-chan struct
 			Message: err.Error(),
 		}
 	}
-	ht := claimtrie.Height(s.cfg.Chain.BestSnapshot().Height)
+	var ht claimtrie.Height
 	res := btcjson.GetClaimsForTxResult{}
 	fn := func(n *claimtrie.Node) bool {
 		for _, c := range n.Claims {
@@ -232,7 +329,11 @@ func handleGetClaimsForTx(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		}
 		return false
 	}
-	s.cfg.Chain.ClaimTrie().Visit(fn)
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		ht = ct.Height()
+		ct.Visit(fn)
+		return nil
+	})
 	return res, nil
 }
 
@@ -286,22 +387,36 @@ func handleGetClaimByID(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 		}
 		return false
 	}
-	s.cfg.Chain.ClaimTrie().Visit(fn)
-	if node == nil {
+	var ht claimtrie.Height
+	s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		ht = ct.Height()
+		ct.Visit(fn)
+
+		// Keep a copy of the node, which can be used once the chain
+		// lock is released.
+		if node != nil {
+			node = ct.Node(node.Name)
+			clm = claimtrie.Find(claimtrie.ByID(id), node.Claims)
+		}
+		return nil
+	})
+	if node == nil || clm == nil {
 		return btcjson.EmptyResult{}, nil
 	}
 
 	res := btcjson.GetClaimByIDResult{
-		Name:        node.Name,
-		Value:       string(clm.Value),
-		ClaimID:     id.String(),
-		TxID:        clm.OutPoint.Hash.String(),
-		N:           clm.OutPoint.Index,
-		Amount:      clm.Amount,
-		EffAmount:   clm.EffectiveAmount,
-		Supports:    []btcjson.ClaimByIDSupport{},
-		Height:      clm.Accepted,
-		ValidHeight: clm.ActiveAt,
+		Name:           node.Name,
+		Value:          string(clm.Value),
+		ClaimID:        id.String(),
+		TxID:           clm.OutPoint.Hash.String(),
+		N:              clm.OutPoint.Index,
+		Amount:         clm.Amount,
+		EffAmount:      clm.EffectiveAmount,
+		Supports:       []btcjson.ClaimByIDSupport{},
+		Height:         clm.Accepted,
+		ValidHeight:    clm.ActiveAt,
+		ExpiresAt:      clm.ExpireAt(),
+		BlocksToExpiry: blocksToExpiry(clm, ht),
 	}
 	for _, s := range node.Supports {
 		if s.ID != id {
@@ -319,3 +434,135 @@ func handleGetClaimByID(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 
 	return res, nil
 }
+
+// blocksToExpiry returns the number of blocks left before the claim expires,
+// or zero if it has already expired at height ht.
+func blocksToExpiry(c *claimtrie.Claim, ht claimtrie.Height) claimtrie.Height {
+	if left := c.ExpireAt() - ht; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// handleGetClaimSchedule returns the names and claims scheduled to activate,
+// expire or take over within a range of future heights.
+func handleGetClaimSchedule(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetClaimScheduleCmd)
+
+	var from, to claimtrie.Height
+	var updates []claimtrie.ScheduledUpdate
+	err := s.cfg.Chain.ViewClaimTrie(func(ct *claimtrie.ClaimTrie) error {
+		from = ct.Height() + 1
+		if c.FromHeight != nil {
+			from = claimtrie.Height(*c.FromHeight)
+		}
+		to = from + defaultClaimScheduleWindow - 1
+		if c.ToHeight != nil {
+			to = claimtrie.Height(*c.ToHeight)
+		}
+		var err error
+		updates, err = ct.Schedule(from, to)
+		return err
+	})
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	res := btcjson.GetClaimScheduleResult{
+		FromHeight: from,
+		ToHeight:   to,
+		Updates:    []btcjson.ClaimScheduleEntry{},
+	}
+	for _, u := range updates {
+		e := btcjson.ClaimScheduleEntry{
+			Height:  u.Height,
+			Event:   u.Kind.String(),
+			Name:    u.Name,
+			Type:    "claim",
+			ClaimID: u.Claim.ID.String(),
+			TxID:    u.Claim.OutPoint.Hash.String(),
+			N:       u.Claim.OutPoint.Index,
+			Amount:  u.Claim.Amount,
+		}
+		if u.IsSupport {
+			e.Type = "support"
+		}
+		res.Updates = append(res.Updates, e)
+	}
+	return res, nil
+}
+
+// handleExportClaimTrie writes a snapshot of the ClaimTrie at a height of the
+// main chain to a file.
+func handleExportClaimTrie(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ExportClaimTrieCmd)
+
+	height := s.cfg.Chain.BestSnapshot().Height
+	if c.Height != nil {
+		height = *c.Height
+	}
+
+	// Write to a temporary file first so a partial snapshot is never left
+	// behind under the requested name.
+	tmpPath := c.Path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	hdr, err := s.cfg.Chain.ExportClaimTrie(f, height)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, c.Path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("can't export ClaimTrie: %v", err),
+		}
+	}
+
+	return btcjson.ClaimTrieSnapshotResult{
+		Path:      c.Path,
+		Height:    hdr.Height,
+		BlockHash: hdr.BlockHash.String(),
+		ClaimTrie: hdr.MerkleRoot.String(),
+	}, nil
+}
+
+// handleImportClaimTrie replaces the ClaimTrie with a snapshot read from a file.
+func handleImportClaimTrie(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ImportClaimTrieCmd)
+
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	defer f.Close()
+
+	hdr, err := s.cfg.Chain.ImportClaimTrie(bufio.NewReader(f))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCVerify,
+			Message: fmt.Sprintf("can't import ClaimTrie: %v", err),
+		}
+	}
+
+	return btcjson.ClaimTrieSnapshotResult{
+		Path:      c.Path,
+		Height:    hdr.Height,
+		BlockHash: hdr.BlockHash.String(),
+		ClaimTrie: hdr.MerkleRoot.String(),
+	}, nil
+}
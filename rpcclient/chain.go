@@ -342,6 +342,132 @@ func (c *Client) GetBlockChainInfo() (*btcjson.GetBlockChainInfoResult, error) {
 	return c.GetBlockChainInfoAsync().Receive()
 }
 
+// FutureGetChainTipsResult is a future promise to deliver the result of a
+// GetChainTipsAsync RPC invocation (or an applicable error).
+type FutureGetChainTipsResult chan *response
+
+// Receive waits for the response promised by the future and returns the tips
+// of the block tree known to the server.
+func (r FutureGetChainTipsResult) Receive() ([]*btcjson.GetChainTipsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as an array of chain tips.
+	var chainTips []*btcjson.GetChainTipsResult
+	err = json.Unmarshal(res, &chainTips)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainTips, nil
+}
+
+// GetChainTipsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetChainTips for the blocking version and more details.
+func (c *Client) GetChainTipsAsync() FutureGetChainTipsResult {
+	cmd := btcjson.NewGetChainTipsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetChainTips returns all of the tips of the block tree known to the server,
+// including the main chain, the side chains, and the chains of which only the
+// headers are known.
+func (c *Client) GetChainTips() ([]*btcjson.GetChainTipsResult, error) {
+	return c.GetChainTipsAsync().Receive()
+}
+
+// FutureGetDeploymentInfoResult is a future promise to deliver the result of a
+// GetDeploymentInfoAsync RPC invocation (or an applicable error).
+type FutureGetDeploymentInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the state
+// of the deployments at the requested block.
+func (r FutureGetDeploymentInfoResult) Receive() (*btcjson.GetDeploymentInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a getdeploymentinfo result object.
+	var deploymentInfo btcjson.GetDeploymentInfoResult
+	err = json.Unmarshal(res, &deploymentInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deploymentInfo, nil
+}
+
+// GetDeploymentInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetDeploymentInfo for the blocking version and more details.
+func (c *Client) GetDeploymentInfoAsync(blockHash *chainhash.Hash) FutureGetDeploymentInfoResult {
+	var hash *string
+	if blockHash != nil {
+		hash = btcjson.String(blockHash.String())
+	}
+
+	cmd := btcjson.NewGetDeploymentInfoCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetDeploymentInfo returns the state of the soft-fork deployments at the block
+// with the given hash, or at the best block when it is nil, along with the
+// signalling statistics of the current window.
+func (c *Client) GetDeploymentInfo(blockHash *chainhash.Hash) (*btcjson.GetDeploymentInfoResult, error) {
+	return c.GetDeploymentInfoAsync(blockHash).Receive()
+}
+
+// FutureGetBlockStatsResult is a future promise to deliver the result of a
+// GetBlockStatsAsync RPC invocation (or an applicable error).
+type FutureGetBlockStatsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the requested block.
+func (r FutureGetBlockStatsResult) Receive() (*btcjson.GetBlockStatsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as block statistics.
+	var blockStats btcjson.GetBlockStatsResult
+	err = json.Unmarshal(res, &blockStats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockStats, nil
+}
+
+// GetBlockStatsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetBlockStats for the blocking version and more details.
+func (c *Client) GetBlockStatsAsync(hashOrHeight interface{}, stats *[]string) FutureGetBlockStatsResult {
+	if hash, ok := hashOrHeight.(*chainhash.Hash); ok {
+		hashOrHeight = hash.String()
+	}
+
+	cmd := btcjson.NewGetBlockStatsCmd(hashOrHeight, stats)
+	return c.sendCmd(cmd)
+}
+
+// GetBlockStats returns the statistics of the main chain block with the given
+// hash or height.  Only the named statistics are returned when stats is not
+// nil, leaving the other fields of the result at their zero values.
+func (c *Client) GetBlockStats(hashOrHeight interface{}, stats *[]string) (*btcjson.GetBlockStatsResult, error) {
+	return c.GetBlockStatsAsync(hashOrHeight, stats).Receive()
+}
+
 // FutureGetBlockHashResult is a future promise to deliver the result of a
 // GetBlockHashAsync RPC invocation (or an applicable error).
 type FutureGetBlockHashResult chan *response
@@ -678,7 +804,7 @@ func (r FutureVerifyChainResult) Receive() (bool, error) {
 //
 // See VerifyChain for the blocking version and more details.
 func (c *Client) VerifyChainAsync() FutureVerifyChainResult {
-	cmd := btcjson.NewVerifyChainCmd(nil, nil)
+	cmd := btcjson.NewVerifyChainCmd(nil, nil, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -696,7 +822,7 @@ func (c *Client) VerifyChain() (bool, error) {
 //
 // See VerifyChainLevel for the blocking version and more details.
 func (c *Client) VerifyChainLevelAsync(checkLevel int32) FutureVerifyChainResult {
-	cmd := btcjson.NewVerifyChainCmd(&checkLevel, nil)
+	cmd := btcjson.NewVerifyChainCmd(&checkLevel, nil, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -719,7 +845,7 @@ func (c *Client) VerifyChainLevel(checkLevel int32) (bool, error) {
 //
 // See VerifyChainBlocks for the blocking version and more details.
 func (c *Client) VerifyChainBlocksAsync(checkLevel, numBlocks int32) FutureVerifyChainResult {
-	cmd := btcjson.NewVerifyChainCmd(&checkLevel, &numBlocks)
+	cmd := btcjson.NewVerifyChainCmd(&checkLevel, &numBlocks, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -738,6 +864,46 @@ func (c *Client) VerifyChainBlocks(checkLevel, numBlocks int32) (bool, error) {
 	return c.VerifyChainBlocksAsync(checkLevel, numBlocks).Receive()
 }
 
+// FutureVerifyChainVerboseResult is a future promise to deliver the result of
+// a VerifyChainVerboseAsync RPC invocation (or an applicable error).
+type FutureVerifyChainVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns the report
+// of the chain verification.
+func (r FutureVerifyChainVerboseResult) Receive() (*btcjson.VerifyChainResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a verifychain result object.
+	var result btcjson.VerifyChainResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// VerifyChainVerboseAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See VerifyChainVerbose for the blocking version and more details.
+func (c *Client) VerifyChainVerboseAsync(checkLevel, numBlocks int32) FutureVerifyChainVerboseResult {
+	cmd := btcjson.NewVerifyChainCmd(&checkLevel, &numBlocks, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// VerifyChainVerbose requests the server to verify the block chain database
+// using the passed check level and number of blocks to verify, and returns a
+// report of the blocks which failed the checks.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) VerifyChainVerbose(checkLevel, numBlocks int32) (*btcjson.VerifyChainResult, error) {
+	return c.VerifyChainVerboseAsync(checkLevel, numBlocks).Receive()
+}
+
 // FutureGetTxOutResult is a future promise to deliver the result of a
 // GetTxOutAsync RPC invocation (or an applicable error).
 type FutureGetTxOutResult chan *response
@@ -787,6 +953,107 @@ func (c *Client) GetTxOut(txHash *chainhash.Hash, index uint32, mempool bool) (*
 	return c.GetTxOutAsync(txHash, index, mempool).Receive()
 }
 
+// FutureGetTxOutSetInfoResult is a future promise to deliver the result of a
+// GetTxOutSetInfoAsync RPC invocation (or an applicable error).
+type FutureGetTxOutSetInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the unspent transaction output set.
+func (r FutureGetTxOutSetInfoResult) Receive() (*btcjson.GetTxOutSetInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as utxo set statistics.
+	var txOutSetInfo btcjson.GetTxOutSetInfoResult
+	err = json.Unmarshal(res, &txOutSetInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txOutSetInfo, nil
+}
+
+// GetTxOutSetInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOutSetInfo for the blocking version and more details.
+func (c *Client) GetTxOutSetInfoAsync(hashType *string, hashOrHeight interface{}, useIndex *bool) FutureGetTxOutSetInfoResult {
+	if hash, ok := hashOrHeight.(*chainhash.Hash); ok {
+		hashOrHeight = hash.String()
+	}
+
+	cmd := btcjson.NewGetTxOutSetInfoCmd(hashType, hashOrHeight, useIndex)
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutSetInfo returns the statistics of the unspent transaction output set
+// along with its hash of the given type.  The statistics are those at the best
+// block when hashOrHeight is nil, and otherwise at the main chain block with
+// the given hash or height, which requires the server to maintain the coinstats
+// index.
+func (c *Client) GetTxOutSetInfo(hashType *string, hashOrHeight interface{}, useIndex *bool) (*btcjson.GetTxOutSetInfoResult, error) {
+	return c.GetTxOutSetInfoAsync(hashType, hashOrHeight, useIndex).Receive()
+}
+
+// FutureTxOutSetSnapshotResult is a future promise to deliver the result of a
+// DumpTxOutSetAsync or LoadTxOutSetAsync RPC invocation (or an applicable
+// error).
+type FutureTxOutSetSnapshotResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// description of the utxo set snapshot.
+func (r FutureTxOutSetSnapshotResult) Receive() (*btcjson.TxOutSetSnapshotResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a utxo set snapshot result object.
+	var snapshot btcjson.TxOutSetSnapshotResult
+	err = json.Unmarshal(res, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// DumpTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See DumpTxOutSet for the blocking version and more details.
+func (c *Client) DumpTxOutSetAsync(path string) FutureTxOutSetSnapshotResult {
+	cmd := btcjson.NewDumpTxOutSetCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// DumpTxOutSet writes a snapshot of the unspent transaction outputs and the
+// claimtrie at the best block to the passed path on the server.
+func (c *Client) DumpTxOutSet(path string) (*btcjson.TxOutSetSnapshotResult, error) {
+	return c.DumpTxOutSetAsync(path).Receive()
+}
+
+// LoadTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See LoadTxOutSet for the blocking version and more details.
+func (c *Client) LoadTxOutSetAsync(path string) FutureTxOutSetSnapshotResult {
+	cmd := btcjson.NewLoadTxOutSetCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// LoadTxOutSet loads the utxo set snapshot at the passed path on the server.
+// The server continues its chain from the snapshot block while it validates
+// the blocks below it in the background.
+func (c *Client) LoadTxOutSet(path string) (*btcjson.TxOutSetSnapshotResult, error) {
+	return c.LoadTxOutSetAsync(path).Receive()
+}
+
 // FutureRescanBlocksResult is a future promise to deliver the result of a
 // RescanBlocksAsync RPC invocation (or an applicable error).
 //
@@ -874,6 +1141,39 @@ func (c *Client) InvalidateBlock(blockHash *chainhash.Hash) error {
 	return c.InvalidateBlockAsync(blockHash).Receive()
 }
 
+// FutureReconsiderBlockResult is a future promise to deliver the result of a
+// ReconsiderBlockAsync RPC invocation (or an applicable error).
+type FutureReconsiderBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block could not be reconsidered.
+func (r FutureReconsiderBlockResult) Receive() error {
+	_, err := receiveFuture(r)
+
+	return err
+}
+
+// ReconsiderBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ReconsiderBlock for the blocking version and more details.
+func (c *Client) ReconsiderBlockAsync(blockHash *chainhash.Hash) FutureReconsiderBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := btcjson.NewReconsiderBlockCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// ReconsiderBlock removes the invalid status of a specific block, which was
+// set by InvalidateBlock, along with the one of its ancestors and descendants.
+func (c *Client) ReconsiderBlock(blockHash *chainhash.Hash) error {
+	return c.ReconsiderBlockAsync(blockHash).Receive()
+}
+
 // FutureGetCFilterResult is a future promise to deliver the result of a
 // GetCFilterAsync RPC invocation (or an applicable error).
 type FutureGetCFilterResult chan *response
@@ -268,6 +268,9 @@ func (c *Client) trackRegisteredNtfns(cmd interface{}) {
 	case *btcjson.NotifyBlocksCmd:
 		c.ntfnState.notifyBlocks = true
 
+	case *btcjson.NotifyReorgsCmd:
+		c.ntfnState.notifyReorgs = true
+
 	case *btcjson.NotifyNewTransactionsCmd:
 		if bcmd.Verbose != nil && *bcmd.Verbose {
 			c.ntfnState.notifyNewTxVerbose = true
@@ -538,6 +541,14 @@ func (c *Client) reregisterNtfns() error {
 		}
 	}
 
+	// Reregister notifyreorgs if needed.
+	if stateCopy.notifyReorgs {
+		log.Debugf("Reregistering [notifyreorgs]")
+		if err := c.NotifyReorgs(); err != nil {
+			return err
+		}
+	}
+
 	// Reregister notifynewtransactions if needed.
 	if stateCopy.notifyNewTx || stateCopy.notifyNewTxVerbose {
 		log.Debugf("Reregistering [notifynewtransactions] (verbose=%v)",
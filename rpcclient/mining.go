@@ -61,6 +61,63 @@ func (c *Client) Generate(numBlocks uint32) ([]*chainhash.Hash, error) {
 	return c.GenerateAsync(numBlocks).Receive()
 }
 
+// GenerateToAddressAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GenerateToAddress for the blocking version and more details.
+func (c *Client) GenerateToAddressAsync(numBlocks uint32, address btcutil.Address, maxTries *int64) FutureGenerateResult {
+	cmd := btcjson.NewGenerateToAddressCmd(numBlocks, address.EncodeAddress(),
+		maxTries)
+	return c.sendCmd(cmd)
+}
+
+// GenerateToAddress generates numBlocks blocks paying to the passed address and
+// returns their hashes.  At most maxTries nonces are tried for all blocks, or
+// the server default when it is nil, so fewer blocks may be generated.
+func (c *Client) GenerateToAddress(numBlocks uint32, address btcutil.Address, maxTries *int64) ([]*chainhash.Hash, error) {
+	return c.GenerateToAddressAsync(numBlocks, address, maxTries).Receive()
+}
+
+// FutureGenerateBlockResult is a future promise to deliver the result of a
+// GenerateBlockAsync RPC invocation (or an applicable error).
+type FutureGenerateBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns the hash of
+// the generated block.
+func (r FutureGenerateBlockResult) Receive() (*chainhash.Hash, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a generateblock result object.
+	var result btcjson.GenerateBlockResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHashFromStr(result.Hash)
+}
+
+// GenerateBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GenerateBlock for the blocking version and more details.
+func (c *Client) GenerateBlockAsync(address btcutil.Address, txns []string) FutureGenerateBlockResult {
+	cmd := btcjson.NewGenerateBlockCmd(address.EncodeAddress(), txns)
+	return c.sendCmd(cmd)
+}
+
+// GenerateBlock generates a block paying to the passed address with exactly the
+// passed transactions, which are given as hashes of transactions in the memory
+// pool of the server or as hex-encoded raw transactions, and returns its hash.
+func (c *Client) GenerateBlock(address btcutil.Address, txns []string) (*chainhash.Hash, error) {
+	return c.GenerateBlockAsync(address, txns).Receive()
+}
+
 // FutureGetGenerateResult is a future promise to deliver the result of a
 // GetGenerateAsync RPC invocation (or an applicable error).
 type FutureGetGenerateResult chan *response
@@ -414,4 +471,37 @@ func (c *Client) SubmitBlock(block *btcutil.Block, options *btcjson.SubmitBlockO
 	return c.SubmitBlockAsync(block, options).Receive()
 }
 
+// FuturePrioritiseTransactionResult is a future promise to deliver the result
+// of a PrioritiseTransactionAsync RPC invocation (or an applicable error).
+type FuturePrioritiseTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns an error if
+// any occurred when prioritising the transaction.
+func (r FuturePrioritiseTransactionResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// PrioritiseTransactionAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See PrioritiseTransaction for the blocking version and more details.
+func (c *Client) PrioritiseTransactionAsync(txHash *chainhash.Hash, feeDelta int64) FuturePrioritiseTransactionResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := btcjson.NewPrioritiseTransactionCmd(hash, feeDelta)
+	return c.sendCmd(cmd)
+}
+
+// PrioritiseTransaction adds the passed fee delta in satoshis to the fee of the
+// transaction with the passed hash when the server selects transactions for
+// the blocks it mines.
+func (c *Client) PrioritiseTransaction(txHash *chainhash.Hash, feeDelta int64) error {
+	return c.PrioritiseTransactionAsync(txHash, feeDelta).Receive()
+}
+
 // TODO(davec): Implement GetBlockTemplate
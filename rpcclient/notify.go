@@ -33,6 +33,7 @@ var (
 // reconnect.
 type notificationState struct {
 	notifyBlocks       bool
+	notifyReorgs       bool
 	notifyNewTx        bool
 	notifyNewTxVerbose bool
 	notifyReceived     map[string]struct{}
@@ -43,6 +44,7 @@ type notificationState struct {
 func (s *notificationState) Copy() *notificationState {
 	var stateCopy notificationState
 	stateCopy.notifyBlocks = s.notifyBlocks
+	stateCopy.notifyReorgs = s.notifyReorgs
 	stateCopy.notifyNewTx = s.notifyNewTx
 	stateCopy.notifyNewTxVerbose = s.notifyNewTxVerbose
 	stateCopy.notifyReceived = make(map[string]struct{})
@@ -121,6 +123,16 @@ type NotificationHandlers struct {
 	// OnBlockDisconnected: it receives the block's height and header.
 	OnFilteredBlockDisconnected func(height int32, header *wire.BlockHeader)
 
+	// OnChainReorganized is invoked when blocks are disconnected from the
+	// longest (best) chain, once all of the blocks of the reorganization
+	// have been disconnected and connected.  It receives the last block
+	// the old and new chains have in common, the disconnected blocks from
+	// the old tip down, and the connected blocks up to the new tip.  It
+	// will only be invoked if a preceding call to NotifyReorgs has been
+	// made to register for the notification and the function is non-nil.
+	OnChainReorganized func(forkHash *chainhash.Hash, forkHeight int32,
+		disconnected, connected []*chainhash.Hash)
+
 	// OnRecvTx is invoked when a transaction that receives funds to a
 	// registered address is received into the memory pool and also
 	// connected to the longest (best) chain.  It will only be invoked if a
@@ -290,6 +302,25 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 		c.ntfnHandlers.OnFilteredBlockDisconnected(blockHeight,
 			blockHeader)
 
+	// OnChainReorganized
+	case btcjson.ChainReorganizedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnChainReorganized == nil {
+			return
+		}
+
+		forkHash, forkHeight, disconnected, connected, err :=
+			parseChainReorganizedParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid chain reorganized "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnChainReorganized(forkHash, forkHeight,
+			disconnected, connected)
+
 	// OnRecvTx
 	case btcjson.RecvTxNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -615,6 +646,55 @@ func parseFilteredBlockDisconnectedParams(params []json.RawMessage) (int32,
 	return blockHeight, &blockHeader, nil
 }
 
+// parseChainReorganizedParams parses out the fork point and the lists of
+// disconnected and connected block hashes from the parameters of a
+// chainreorganized notification.
+func parseChainReorganizedParams(params []json.RawMessage) (*chainhash.Hash,
+	int32, []*chainhash.Hash, []*chainhash.Hash, error) {
+
+	if len(params) != 4 {
+		return nil, 0, nil, nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a string.
+	var forkHashStr string
+	err := json.Unmarshal(params[0], &forkHashStr)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	forkHash, err := chainhash.NewHashFromStr(forkHashStr)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	// Unmarshal second parameter as an integer.
+	var forkHeight int32
+	err = json.Unmarshal(params[1], &forkHeight)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	// Unmarshal the third and fourth parameters as slices of strings.
+	var hashLists [2][]*chainhash.Hash
+	for i := range hashLists {
+		var hashStrs []string
+		err = json.Unmarshal(params[2+i], &hashStrs)
+		if err != nil {
+			return nil, 0, nil, nil, err
+		}
+		hashLists[i] = make([]*chainhash.Hash, 0, len(hashStrs))
+		for _, hashStr := range hashStrs {
+			hash, err := chainhash.NewHashFromStr(hashStr)
+			if err != nil {
+				return nil, 0, nil, nil, err
+			}
+			hashLists[i] = append(hashLists[i], hash)
+		}
+	}
+
+	return forkHash, forkHeight, hashLists[0], hashLists[1], nil
+}
+
 func parseHexParam(param json.RawMessage) ([]byte, error) {
 	var s string
 	err := json.Unmarshal(param, &s)
@@ -902,6 +982,55 @@ func (c *Client) NotifyBlocks() error {
 	return c.NotifyBlocksAsync().Receive()
 }
 
+// FutureNotifyReorgsResult is a future promise to deliver the result of a
+// NotifyReorgsAsync RPC invocation (or an applicable error).
+type FutureNotifyReorgsResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the registration was not successful.
+func (r FutureNotifyReorgsResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// NotifyReorgsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See NotifyReorgs for the blocking version and more details.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyReorgsAsync() FutureNotifyReorgsResult {
+	// Not supported in HTTP POST mode.
+	if c.config.HTTPPostMode {
+		return newFutureError(ErrWebsocketsRequired)
+	}
+
+	// Ignore the notification if the client is not interested in
+	// notifications.
+	if c.ntfnHandlers == nil {
+		return newNilFutureResult()
+	}
+
+	cmd := btcjson.NewNotifyReorgsCmd()
+	return c.sendCmd(cmd)
+}
+
+// NotifyReorgs registers the client to receive a notification whenever blocks
+// are disconnected from the main chain, which describes the whole
+// reorganization.  The notifications are delivered to the notification
+// handlers associated with the client.  Calling this function has no effect if
+// there are no notification handlers and will result in an error if the client
+// is configured to run in HTTP POST mode.
+//
+// The notifications delivered as a result of this call will be via
+// OnChainReorganized.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyReorgs() error {
+	return c.NotifyReorgsAsync().Receive()
+}
+
 // FutureNotifySpentResult is a future promise to deliver the result of a
 // NotifySpentAsync RPC invocation (or an applicable error).
 //
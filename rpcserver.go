@@ -86,16 +86,6 @@ var (
 		"time", "transactions/add", "prevblock", "coinbase/append",
 	}
 
-	// gbtCoinbaseAux describes additional data that miners should include
-	// in the coinbase signature script.  It is declared here to avoid the
-	// overhead of creating a new object on every invocation for constant
-	// data.
-	gbtCoinbaseAux = &btcjson.GetBlockTemplateResultAux{
-		Flags: hex.EncodeToString(builderScript(txscript.
-			NewScriptBuilder().
-			AddData([]byte(mining.CoinbaseFlags)))),
-	}
-
 	// gbtCapabilities describes additional capabilities returned with a
 	// block template generated by the getblocktemplate RPC.    It is
 	// declared here to avoid the overhead of creating the slice on every
@@ -132,8 +122,11 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"debuglevel":            handleDebugLevel,
 	"decoderawtransaction":  handleDecodeRawTransaction,
 	"decodescript":          handleDecodeScript,
+	"dumptxoutset":          handleDumpTxOutSet,
 	"estimatefee":           handleEstimateFee,
 	"generate":              handleGenerate,
+	"generateblock":         handleGenerateBlock,
+	"generatetoaddress":     handleGenerateToAddress,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
@@ -142,11 +135,14 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getblockcount":         handleGetBlockCount,
 	"getblockhash":          handleGetBlockHash,
 	"getblockheader":        handleGetBlockHeader,
+	"getblockstats":         handleGetBlockStats,
 	"getblocktemplate":      handleGetBlockTemplate,
 	"getcfilter":            handleGetCFilter,
 	"getcfilterheader":      handleGetCFilterHeader,
+	"getchaintips":          handleGetChainTips,
 	"getconnectioncount":    handleGetConnectionCount,
 	"getcurrentnet":         handleGetCurrentNet,
+	"getdeploymentinfo":     handleGetDeploymentInfo,
 	"getdifficulty":         handleGetDifficulty,
 	"getgenerate":           handleGetGenerate,
 	"gethashespersec":       handleGetHashesPerSec,
@@ -160,9 +156,14 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getrawmempool":         handleGetRawMempool,
 	"getrawtransaction":     handleGetRawTransaction,
 	"gettxout":              handleGetTxOut,
+	"gettxoutsetinfo":       handleGetTxOutSetInfo,
 	"help":                  handleHelp,
+	"invalidateblock":       handleInvalidateBlock,
+	"loadtxoutset":          handleLoadTxOutSet,
 	"node":                  handleNode,
 	"ping":                  handlePing,
+	"prioritisetransaction": handlePrioritiseTransaction,
+	"reconsiderblock":       handleReconsiderBlock,
 	"searchrawtransactions": handleSearchRawTransactions,
 	"sendrawtransaction":    handleSendRawTransaction,
 	"setgenerate":           handleSetGenerate,
@@ -183,6 +184,9 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getclaimsfortx":        handleGetClaimsForTx,
 	"getnameproof":          handleGetNameProof,
 	"getclaimbyid":          handleGetClaimByID,
+	"getclaimschedule":      handleGetClaimSchedule,
+	"exportclaimtrie":       handleExportClaimTrie,
+	"importclaimtrie":       handleImportClaimTrie,
 }
 
 // list of commands that we recognize, but for which btcd has no support because
@@ -205,7 +209,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getreceivedbyaccount":         {},
 	"getreceivedbyaddress":         {},
 	"gettransaction":               {},
-	"gettxoutsetinfo":              {},
 	"getunconfirmedbalance":        {},
 	"getwalletinfo":                {},
 	"importprivkey":                {},
@@ -237,13 +240,10 @@ var rpcAskWallet = map[string]struct{}{
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
-	"getchaintips":     {},
 	"getmempoolentry":  {},
 	"getnetworkinfo":   {},
 	"getwork":          {},
-	"invalidateblock":  {},
 	"preciousblock":    {},
-	"reconsiderblock":  {},
 }
 
 // Commands that are available to a limited user
@@ -301,6 +301,7 @@ var rpcLimited = map[string]struct{}{
 	"getclaimsfortx":        {},
 	"getnameproof":          {},
 	"getclaimbyid":          {},
+	"getclaimschedule":      {},
 }
 
 // builderScript is a convenience function which is used for hard-coded scripts
@@ -346,6 +347,14 @@ func rpcNoTxInfoError(txHash *chainhash.Hash) *btcjson.RPCError {
 			txHash))
 }
 
+// rpcPrunedBlockError is a convenience function for returning a nicely
+// formatted RPC error which indicates the data of the provided block has been
+// deleted by pruning.
+func rpcPrunedBlockError(hash *chainhash.Hash) *btcjson.RPCError {
+	return btcjson.NewRPCError(btcjson.ErrRPCMisc,
+		fmt.Sprintf("Block %v not available (pruned data)", hash))
+}
+
 // gbtWorkState houses state that is used in between multiple RPC invocations to
 // getblocktemplate.
 type gbtWorkState struct {
@@ -355,15 +364,18 @@ type gbtWorkState struct {
 	prevHash      *chainhash.Hash
 	minTimestamp  time.Time
 	template      *mining.BlockTemplate
-	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
+	longPollers   int
+	generator     *mining.BlkTmplGenerator
 	timeSource    blockchain.MedianTimeSource
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
 // fields initialized and ready to use.
-func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+func newGbtWorkState(generator *mining.BlkTmplGenerator,
+	timeSource blockchain.MedianTimeSource) *gbtWorkState {
+
 	return &gbtWorkState{
-		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
+		generator:  generator,
 		timeSource: timeSource,
 	}
 }
@@ -877,6 +889,51 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DumpTxOutSetCmd)
+
+	// Write to a temporary file first so a partial snapshot is never left
+	// behind under the requested name.
+	tmpPath := c.Path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	snapshot, err := s.cfg.Chain.DumpUtxoSnapshot(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, c.Path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("can't dump utxo set: %v", err),
+		}
+	}
+
+	return txOutSetSnapshotResult(c.Path, snapshot), nil
+}
+
+// txOutSetSnapshotResult returns the reply to the dumptxoutset and
+// loadtxoutset commands for the passed utxo snapshot.
+func txOutSetSnapshotResult(path string, snapshot *blockchain.UtxoSnapshot) *btcjson.TxOutSetSnapshotResult {
+	return &btcjson.TxOutSetSnapshotResult{
+		Path:         path,
+		Height:       snapshot.Height,
+		BlockHash:    snapshot.BlockHash.String(),
+		NumUtxos:     snapshot.NumUtxos,
+		UtxoSetHash:  snapshot.UtxoSetHash.String(),
+		ChainTxCount: snapshot.ChainTxCount,
+	}
+}
+
 // handleEstimateFee handles estimatefee commands.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.EstimateFeeCmd)
@@ -913,14 +970,8 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 	// Respond with an error if there's virtually 0 chance of mining a block
 	// with the CPU.
-	if !s.cfg.ChainParams.GenerateSupported {
-		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCDifficulty,
-			Message: fmt.Sprintf("No support for `generate` on "+
-				"the current network, %s, as it's unlikely to "+
-				"be possible to mine a block with the CPU.",
-				s.cfg.ChainParams.Net),
-		}
+	if err := checkGenerateSupported(s, "generate"); err != nil {
+		return nil, err
 	}
 
 	c := cmd.(*btcjson.GenerateCmd)
@@ -953,6 +1004,155 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return reply, nil
 }
 
+// checkGenerateSupported returns an error for the passed generating command when
+// there's virtually 0 chance of mining a block with the CPU on the current
+// network.
+func checkGenerateSupported(s *rpcServer, method string) error {
+	if s.cfg.ChainParams.GenerateSupported {
+		return nil
+	}
+	return &btcjson.RPCError{
+		Code: btcjson.ErrRPCDifficulty,
+		Message: fmt.Sprintf("No support for `%s` on the current "+
+			"network, %s, as it's unlikely to be possible to mine "+
+			"a block with the CPU.", method, s.cfg.ChainParams.Net),
+	}
+}
+
+// decodeGenerateAddress decodes the address the blocks of a generating command
+// are paid to and ensures it is for the current network.
+func decodeGenerateAddress(s *rpcServer, encodedAddr string) (btcutil.Address, error) {
+	addr, err := btcutil.DecodeAddress(encodedAddr, s.cfg.ChainParams)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	if !addr.IsForNet(s.cfg.ChainParams) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + encodedAddr +
+				" is for the wrong network",
+		}
+	}
+	return addr, nil
+}
+
+// handleGenerateBlock handles generateblock commands.
+func handleGenerateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := checkGenerateSupported(s, "generateblock"); err != nil {
+		return nil, err
+	}
+
+	c := cmd.(*btcjson.GenerateBlockCmd)
+	addr, err := decodeGenerateAddress(s, c.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	// The transactions are either hashes of transactions in the memory
+	// pool or raw transactions, which don't have to be in it.
+	txns := make([]*btcutil.Tx, 0, len(c.Transactions))
+	for _, str := range c.Transactions {
+		if len(str) == chainhash.MaxHashStringSize {
+			hash, err := chainhash.NewHashFromStr(str)
+			if err != nil {
+				return nil, rpcDecodeHexError(str)
+			}
+			tx, err := s.cfg.TxMemPool.FetchTransaction(hash)
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidAddressOrKey,
+					Message: "Transaction " + str +
+						" not in mempool",
+				}
+			}
+			txns = append(txns, tx)
+			continue
+		}
+
+		serializedTx, err := hex.DecodeString(str)
+		if err != nil {
+			return nil, rpcDecodeHexError(str)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, btcutil.NewTx(&msgTx))
+	}
+
+	// Create a block template with exactly the passed transactions, which
+	// also ensures the block is valid, and solve it.
+	template, err := s.cfg.Generator.NewBlockTemplateWithTxs(addr, txns)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCVerify,
+			Message: "Failed to create block: " + err.Error(),
+		}
+	}
+	hash, err := s.cfg.CPUMiner.GenerateBlock(template)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	return &btcjson.GenerateBlockResult{Hash: hash.String()}, nil
+}
+
+// handleGenerateToAddress handles generatetoaddress commands.
+func handleGenerateToAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := checkGenerateSupported(s, "generatetoaddress"); err != nil {
+		return nil, err
+	}
+
+	c := cmd.(*btcjson.GenerateToAddressCmd)
+	addr, err := decodeGenerateAddress(s, c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Respond with an error if the client is requesting 0 blocks to be
+	// generated or no tries at all.
+	if c.NumBlocks == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: "Please request a nonzero number of blocks to generate.",
+		}
+	}
+	if *c.MaxTries <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The maximum number of tries must be positive.",
+		}
+	}
+
+	blockHashes, err := s.cfg.CPUMiner.GenerateNBlocksToAddress(
+		c.NumBlocks, addr, uint64(*c.MaxTries))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	// Fewer blocks than requested are generated when the tries are used
+	// up.
+	reply := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		reply[i] = hash.String()
+	}
+
+	return reply, nil
+}
+
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
 func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
@@ -1098,6 +1298,9 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return err
 	})
 	if err != nil {
+		if s.cfg.Chain.BlockPruned(hash) {
+			return nil, rpcPrunedBlockError(hash)
+		}
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCBlockNotFound,
 			Message: "Block not found",
@@ -1211,19 +1414,28 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	params := s.cfg.ChainParams
 	chain := s.cfg.Chain
 	chainSnapshot := chain.BestSnapshot()
+	_, bestHeaderHeight := chain.BestHeader()
 
 	chainInfo := &btcjson.GetBlockChainInfoResult{
 		Chain:         params.Name,
 		Blocks:        chainSnapshot.Height,
-		Headers:       chainSnapshot.Height,
+		Headers:       bestHeaderHeight,
 		BestBlockHash: chainSnapshot.Hash.String(),
 		Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
 		MedianTime:    chainSnapshot.MedianTime.Unix(),
-		Pruned:        false,
+		Pruned:        chain.IsPruned(),
 		SoftForks: &btcjson.SoftForks{
 			Bip9SoftForks: make(map[string]*btcjson.Bip9SoftForkDescription),
 		},
 	}
+	if chainInfo.Pruned {
+		chainInfo.PruneHeight = chain.PruneHeight()
+	}
+	assumeValid, assumeValidActive := chain.AssumeValid()
+	if assumeValid != nil {
+		chainInfo.AssumeValid = assumeValid.String()
+		chainInfo.AssumeValidActive = assumeValidActive
+	}
 
 	// Next, populate the response with information describing the current
 	// status of soft-forks deployed via the super-majority block
@@ -1262,26 +1474,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	// Finally, query the BIP0009 version bits state for all currently
 	// defined BIP0009 soft-fork deployments.
 	for deployment, deploymentDetails := range params.Deployments {
-		// Map the integer deployment ID into a human readable
-		// fork-name.
-		var forkName string
-		switch deployment {
-		case chaincfg.DeploymentTestDummy:
-			forkName = "dummy"
-
-		case chaincfg.DeploymentCSV:
-			forkName = "csv"
-
-		case chaincfg.DeploymentSegwit:
-			forkName = "segwit"
-
-		default:
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInternal.Code,
-				Message: fmt.Sprintf("Unknown deployment %v "+
-					"detected", deployment),
-			}
-		}
+		forkName := deploymentDetails.Name
 
 		// Query the chain for the current status of the deployment as
 		// identified by its deployment ID.
@@ -1404,17 +1597,180 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	return blockHeaderReply, nil
 }
 
-// encodeTemplateID encodes the passed details into an ID that can be used to
-// uniquely identify a block template.
-func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
-	return fmt.Sprintf("%s-%d", prevHash.String(), lastGenerated.Unix())
+// blockStats returns the statistics of the main chain block with the passed
+// hash, from the block statistics index when it's enabled, or else calculated
+// from the block and its spend journal.
+func blockStats(s *rpcServer, hash *chainhash.Hash) (*blockchain.BlockStats, error) {
+	if s.cfg.StatsIndex != nil {
+		stats, err := s.cfg.StatsIndex.StatsByBlockHash(hash)
+		if err != nil {
+			context := "Failed to load block statistics"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if stats != nil {
+			return stats, nil
+		}
+	}
+
+	block, err := s.cfg.Chain.BlockByHash(hash)
+	if err != nil {
+		if s.cfg.Chain.BlockPruned(hash) {
+			return nil, rpcPrunedBlockError(hash)
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+	height, err := s.cfg.Chain.BlockHeightByHash(hash)
+	if err != nil {
+		context := "Failed to obtain block height"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	block.SetHeight(height)
+
+	stxos, err := s.cfg.Chain.FetchSpendJournal(block)
+	if err != nil {
+		if s.cfg.Chain.BlockPruned(hash) {
+			return nil, rpcPrunedBlockError(hash)
+		}
+		context := "Failed to load spend journal"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	stats, err := blockchain.CalcBlockStats(block, stxos, s.cfg.ChainParams)
+	if err != nil {
+		context := "Failed to calculate block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return stats, nil
+}
+
+// handleGetBlockStats implements the getblockstats command.
+func handleGetBlockStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockStatsCmd)
+
+	// Resolve the block, which is specified by either its hash or its
+	// height in the main chain.
+	var hash *chainhash.Hash
+	switch val := c.HashOrHeight.Value.(type) {
+	case string:
+		var err error
+		hash, err = chainhash.NewHashFromStr(val)
+		if err != nil {
+			return nil, rpcDecodeHexError(val)
+		}
+
+	case int32:
+		best := s.cfg.Chain.BestSnapshot()
+		if val < 0 || val > best.Height {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Target block height %d is "+
+					"not in the range 0 to %d", val, best.Height),
+			}
+		}
+		var err error
+		hash, err = s.cfg.Chain.BlockHashByHeight(val)
+		if err != nil {
+			context := "Failed to obtain block hash"
+			return nil, internalRPCError(err.Error(), context)
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The block must be specified by hash or height",
+		}
+	}
+
+	stats, err := blockStats(s, hash)
+	if err != nil {
+		return nil, err
+	}
+	medianTime, err := s.cfg.Chain.BlockMedianTimeByHash(hash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	// The averages exclude the coinbase transaction just like the rest of
+	// the fee and size statistics.
+	reply := btcjson.GetBlockStatsResult{
+		BlockHash:          hash.String(),
+		FeeRatePercentiles: stats.FeeRatePercentiles[:],
+		Height:             int64(stats.Height),
+		Ins:                stats.Ins,
+		MaxFee:             stats.MaxFee,
+		MaxFeeRate:         stats.MaxFeeRate,
+		MaxTxSize:          stats.MaxTxSize,
+		MedianFee:          stats.MedianFee,
+		MedianTime:         medianTime.Unix(),
+		MinFee:             stats.MinFee,
+		MinFeeRate:         stats.MinFeeRate,
+		MinTxSize:          stats.MinTxSize,
+		Outs:               stats.Outs,
+		Subsidy:            stats.Subsidy,
+		SegWitTotalSize:    stats.SegWitTotalSize,
+		SegWitTotalWeight:  stats.SegWitTotalWeight,
+		SegWitTxs:          stats.SegWitTxs,
+		Time:               stats.Time,
+		TotalOut:           stats.TotalOut,
+		TotalSize:          stats.TotalSize,
+		TotalWeight:        stats.TotalWeight,
+		TotalFee:           stats.TotalFee,
+		Txs:                stats.Txs,
+		UtxoIncrease:       stats.UtxoIncrease,
+		UtxoSizeIncrease:   stats.UtxoSizeIncrease,
+		Claims:             stats.Claims,
+		Supports:           stats.Supports,
+		Updates:            stats.Updates,
+		Staked:             stats.Staked,
+	}
+	if stats.Txs > 1 {
+		reply.AvgFee = stats.TotalFee / (stats.Txs - 1)
+		reply.AvgTxSize = stats.TotalSize / (stats.Txs - 1)
+	}
+	if stats.TotalWeight > 0 {
+		reply.AvgFeeRate = stats.TotalFee * blockchain.WitnessScaleFactor /
+			stats.TotalWeight
+	}
+	if c.Stats == nil || len(*c.Stats) == 0 {
+		return reply, nil
+	}
+
+	// Only return the requested statistics, which are named by the keys of
+	// the full reply.
+	marshalled, err := json.Marshal(reply)
+	if err != nil {
+		context := "Failed to marshal block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(marshalled, &all); err != nil {
+		context := "Failed to unmarshal block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	filtered := make(map[string]json.RawMessage, len(*c.Stats))
+	for _, name := range *c.Stats {
+		value, ok := all[name]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid selected statistic %s", name),
+			}
+		}
+		filtered[name] = value
+	}
+	return filtered, nil
 }
 
 // decodeTemplateID decodes an ID that is used to uniquely identify a block
 // template.  This is mainly used as a mechanism to track when to update clients
 // that are using long polling for block templates.  The ID consists of the
-// previous block hash for the associated template and the time the associated
-// template was generated.
+// previous block hash for the associated template and the sequence number the
+// block template generator assigned to the template.
 func decodeTemplateID(templateID string) (*chainhash.Hash, int64, error) {
 	fields := strings.Split(templateID, "-")
 	if len(fields) != 2 {
@@ -1433,51 +1789,18 @@ func decodeTemplateID(templateID string) (*chainhash.Hash, int64, error) {
 	return prevHash, lastGenerated, nil
 }
 
-// notifyLongPollers notifies any channels that have been registered to be
-// notified when block templates are stale.
+// regenerateTemplate has the block template generator create a new block
+// template when any long poll clients are waiting for their template to be
+// replaced.  This notifies them since the new template has another ID.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, lastGenerated time.Time) {
-	// Notify anything that is waiting for a block template update from a
-	// hash which is not the hash of the tip of the best chain since their
-	// work is now invalid.
-	for hash, channels := range state.notifyMap {
-		if !hash.IsEqual(latestHash) {
-			for _, c := range channels {
-				close(c)
-			}
-			delete(state.notifyMap, hash)
-		}
-	}
-
-	// Return now if the provided last generated timestamp has not been
-	// initialized.
-	if lastGenerated.IsZero() {
+func (state *gbtWorkState) regenerateTemplate() {
+	if state.longPollers == 0 {
 		return
 	}
 
-	// Return now if there is nothing registered for updates to the current
-	// best block hash.
-	channels, ok := state.notifyMap[*latestHash]
-	if !ok {
-		return
-	}
-
-	// Notify anything that is waiting for a block template update from a
-	// block template generated before the most recently generated block
-	// template.
-	lastGeneratedUnix := lastGenerated.Unix()
-	for lastGen, c := range channels {
-		if lastGen < lastGeneratedUnix {
-			close(c)
-			delete(channels, lastGen)
-		}
-	}
-
-	// Remove the entry altogether if there are no more registered
-	// channels.
-	if len(channels) == 0 {
-		delete(state.notifyMap, *latestHash)
+	if _, err := state.generator.NewBlockTemplate(nil); err != nil {
+		rpcsLog.Errorf("Failed to create new block template: %v", err)
 	}
 }
 
@@ -1489,7 +1812,13 @@ func (state *gbtWorkState) NotifyBlockConnected(blockHash *chainhash.Hash) {
 		state.Lock()
 		defer state.Unlock()
 
-		state.notifyLongPollers(blockHash, state.lastTxUpdate)
+		// No need to notify anything unless the block extends the best
+		// chain.
+		if !blockHash.IsEqual(&state.generator.BestSnapshot().Hash) {
+			return
+		}
+
+		state.regenerateTemplate()
 	}()
 }
 
@@ -1508,46 +1837,20 @@ func (state *gbtWorkState) NotifyMempoolTx(lastUpdated time.Time) {
 			return
 		}
 
-		if time.Now().After(state.lastGenerated.Add(time.Second *
-			gbtRegenerateSeconds)) {
+		if lastUpdated != state.lastTxUpdate &&
+			time.Now().After(state.lastGenerated.Add(time.Second*
+				gbtRegenerateSeconds)) {
 
-			state.notifyLongPollers(state.prevHash, lastUpdated)
+			state.regenerateTemplate()
 		}
 	}()
 }
 
-// templateUpdateChan returns a channel that will be closed once the block
-// template associated with the passed previous hash and last generated time
-// is stale.  The function will return existing channels for duplicate
-// parameters which allows multiple clients to wait for the same block template
-// without requiring a different channel for each client.
-//
-// This function MUST be called with the state locked.
-func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGenerated int64) chan struct{} {
-	// Either get the current list of channels waiting for updates about
-	// changes to block template for the previous hash or create a new one.
-	channels, ok := state.notifyMap[*prevHash]
-	if !ok {
-		m := make(map[int64]chan struct{})
-		state.notifyMap[*prevHash] = m
-		channels = m
-	}
-
-	// Get the current channel associated with the time the block template
-	// was last generated or create a new one.
-	c, ok := channels[lastGenerated]
-	if !ok {
-		c = make(chan struct{})
-		channels[lastGenerated] = c
-	}
-
-	return c
-}
-
 // updateBlockTemplate creates or updates a block template for the work state.
 // A new block template will be generated when the current best block has
-// changed or the transactions in the memory pool have been updated and it has
-// been long enough since the last template was generated.  Otherwise, the
+// changed, the transactions in the memory pool have been updated and it has
+// been long enough since the last template was generated, or the block template
+// generator has created a new template in the meantime.  Otherwise, the
 // timestamp for the existing block template is updated (and possibly the
 // difficulty on testnet per the consesus rules).  Finally, if the
 // useCoinbaseValue flag is false and the existing block template does not
@@ -1571,8 +1874,16 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	var targetDifficulty string
 	latestHash := &s.cfg.Chain.BestSnapshot().Hash
 	template := state.template
+	var replaced bool
+	if template != nil {
+		select {
+		case <-generator.TemplateChanged(template.ID):
+			replaced = true
+		default:
+		}
+	}
 	if template == nil || state.prevHash == nil ||
-		!state.prevHash.IsEqual(latestHash) ||
+		!state.prevHash.IsEqual(latestHash) || replaced ||
 		(state.lastTxUpdate != lastTxUpdate &&
 			time.Now().After(state.lastGenerated.Add(time.Second*
 				gbtRegenerateSeconds))) {
@@ -1619,14 +1930,10 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		state.prevHash = latestHash
 		state.minTimestamp = minTimestamp
 
-		rpcsLog.Debugf("Generated block template (timestamp %v, "+
-			"target %s, merkle root %s)",
+		rpcsLog.Debugf("Generated block template %s (timestamp %v, "+
+			"target %s, merkle root %s)", template.ID,
 			msgBlock.Header.Timestamp, targetDifficulty,
 			msgBlock.Header.MerkleRoot)
-
-		// Notify any clients that are long polling about the new
-		// template.
-		state.notifyLongPollers(latestHash, lastTxUpdate)
 	} else {
 		// At this point, there is a saved block template and another
 		// request for a template was made, but either the available
@@ -1644,20 +1951,15 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 			// Choose a payment address at random.
 			payToAddr := cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
 
-			// Update the block coinbase output of the template to
-			// pay to the randomly selected payment address.
-			pkScript, err := txscript.PayToAddrScript(payToAddr)
+			// Update the block coinbase outputs of the template to
+			// pay to the randomly selected payment address along
+			// with the configured payouts.  This also updates the
+			// merkle root.
+			err := generator.UpdateCoinbasePayouts(template, payToAddr)
 			if err != nil {
-				context := "Failed to create pay-to-addr script"
+				context := "Failed to update coinbase payouts"
 				return internalRPCError(err.Error(), context)
 			}
-			template.Block.Transactions[0].TxOut[0].PkScript = pkScript
-			template.ValidPayAddress = true
-
-			// Update the merkle root.
-			block := btcutil.NewBlock(template.Block)
-			merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
-			template.Block.Header.MerkleRoot = *merkles[len(merkles)-1]
 		}
 
 		// Set locals for convenience.
@@ -1760,7 +2062,6 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 	//  Including MinTime -> time/decrement
 	//  Omitting CoinbaseTxn -> coinbase, generation
 	targetDifficulty := fmt.Sprintf("%064x", blockchain.CompactToBig(header.Bits))
-	templateID := encodeTemplateID(state.prevHash, state.lastGenerated)
 	reply := btcjson.GetBlockTemplateResult{
 		Bits:         strconv.FormatInt(int64(header.Bits), 16),
 		CurTime:      header.Timestamp.Unix(),
@@ -1771,7 +2072,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 		SizeLimit:    wire.MaxBlockPayload,
 		Transactions: transactions,
 		Version:      header.Version,
-		LongPollID:   templateID,
+		LongPollID:   template.ID,
 		SubmitOld:    submitOld,
 		Target:       targetDifficulty,
 		MinTime:      state.minTimestamp.Unix(),
@@ -1787,7 +2088,13 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 	}
 
 	if useCoinbaseValue {
-		reply.CoinbaseAux = gbtCoinbaseAux
+		// Miners should include the coinbase flags along with the
+		// configured coinbase tag in the coinbase signature script.
+		reply.CoinbaseAux = &btcjson.GetBlockTemplateResultAux{
+			Flags: hex.EncodeToString(builderScript(txscript.
+				NewScriptBuilder().
+				AddData([]byte(state.generator.CoinbaseFlags())))),
+		}
 		reply.CoinbaseValue = &msgBlock.Transactions[0].TxOut[0].Value
 	} else {
 		// Ensure the template has a valid payment address associated
@@ -1848,7 +2155,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 
 	// Just return the current block template if the long poll ID provided by
 	// the caller is invalid.
-	prevHash, lastGenerated, err := decodeTemplateID(longPollID)
+	prevHash, _, err := decodeTemplateID(longPollID)
 	if err != nil {
 		result, err := state.blockTemplateResult(useCoinbaseValue, nil)
 		if err != nil {
@@ -1864,8 +2171,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// identified by the long poll ID no longer matches the current block
 	// template as this means the provided template is stale.
 	prevTemplateHash := &state.template.Block.Header.PrevBlock
-	if !prevHash.IsEqual(prevTemplateHash) ||
-		lastGenerated != state.lastGenerated.Unix() {
+	if longPollID != state.template.ID {
 
 		// Include whether or not it is valid to submit work against the
 		// old block template depending on whether or not a solution has
@@ -1882,17 +2188,21 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 		return result, nil
 	}
 
-	// Register the previous hash and last generated time for notifications
 	// Get a channel that will be notified when the template associated with
 	// the provided ID is stale and a new block template should be returned to
-	// the caller.
-	longPollChan := state.templateUpdateChan(prevHash, lastGenerated)
+	// the caller.  The number of waiting clients is tracked so new templates
+	// are only generated in response to notifications when needed.
+	longPollChan := s.cfg.Generator.TemplateChanged(longPollID)
+	state.longPollers++
 	state.Unlock()
 
 	select {
 	// When the client closes before it's time to send a reply, just return
 	// now so the goroutine doesn't hang around.
 	case <-closeChan:
+		state.Lock()
+		state.longPollers--
+		state.Unlock()
 		return nil, ErrClientQuit
 
 	// Wait until signal received to send the reply.
@@ -1903,6 +2213,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// Get the lastest block template
 	state.Lock()
 	defer state.Unlock()
+	state.longPollers--
 
 	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
 		return nil, err
@@ -2256,11 +2567,129 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hash.String(), nil
 }
 
+// handleGetChainTips implements the getchaintips command.
+func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	tips := s.cfg.Chain.ChainTips()
+	results := make([]btcjson.GetChainTipsResult, 0, len(tips))
+	for _, tip := range tips {
+		results = append(results, btcjson.GetChainTipsResult{
+			Height:    tip.Height,
+			Hash:      tip.Hash.String(),
+			BranchLen: tip.BranchLen,
+			Status:    tip.Status.String(),
+		})
+	}
+	return results, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
 }
 
+// handleGetDeploymentInfo implements the getdeploymentinfo command.
+func handleGetDeploymentInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetDeploymentInfoCmd)
+	params := s.cfg.ChainParams
+	chain := s.cfg.Chain
+
+	// Default to the best block of the main chain.
+	hash := &chain.BestSnapshot().Hash
+	if c.BlockHash != nil {
+		var err error
+		hash, err = chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		if _, err := chain.HeaderByHash(hash); err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
+	}
+
+	result := &btcjson.GetDeploymentInfoResult{
+		Hash:        hash.String(),
+		Deployments: make(map[string]*btcjson.DeploymentInfo),
+	}
+	for id, deployment := range params.Deployments {
+		info, err := chain.DeploymentInfo(hash, uint32(id))
+		if err != nil {
+			context := "Failed to obtain deployment status"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		result.Height = info.Height
+
+		status, err := softForkStatus(info.State)
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "")
+		}
+		statusNext, err := softForkStatus(info.NextState)
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "")
+		}
+		bip9 := &btcjson.Bip9DeploymentInfo{
+			Bit:                 deployment.BitNumber,
+			MinActivationHeight: deployment.MinActivationHeight,
+			Status:              status,
+			Since:               info.Since,
+			StatusNext:          statusNext,
+		}
+		if deployment.HeightBased() {
+			bip9.StartHeight = deployment.StartHeight
+			bip9.TimeoutHeight = deployment.TimeoutHeight
+		} else {
+			bip9.StartTime = int64(deployment.StartTime)
+			bip9.Timeout = int64(deployment.ExpireTime)
+		}
+		if stats := info.Stats; stats != nil {
+			bip9.Statistics = &btcjson.Bip9Statistics{
+				Period:    stats.Period,
+				Threshold: stats.Threshold,
+				Elapsed:   stats.Elapsed,
+				Count:     stats.Count,
+				Possible:  stats.Possible,
+			}
+		}
+
+		// The rules are enforced from the first block with the active
+		// state on.
+		d := &btcjson.DeploymentInfo{
+			Type:   "bip9",
+			Active: info.NextState == blockchain.ThresholdActive,
+			Bip9:   bip9,
+		}
+		switch {
+		case info.State == blockchain.ThresholdActive:
+			d.Height = info.Since
+		case d.Active:
+			d.Height = info.Height + 1
+		}
+		result.Deployments[deployment.Name] = d
+	}
+
+	// The soft-forks deployed via the super-majority block signalling
+	// mechanism are buried at fixed heights.
+	buried := []struct {
+		name   string
+		height int32
+	}{
+		{"bip34", params.BIP0034Height},
+		{"bip66", params.BIP0066Height},
+		{"bip65", params.BIP0065Height},
+	}
+	for _, b := range buried {
+		result.Deployments[b.name] = &btcjson.DeploymentInfo{
+			Type:   "buried",
+			Height: b.height,
+			Active: result.Height+1 >= b.height,
+		}
+	}
+
+	return result, nil
+}
+
 // handleGetCurrentNet implements the getcurrentnet command.
 func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ChainParams.Net, nil
@@ -2544,8 +2973,25 @@ func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	c := cmd.(*btcjson.GetRawMempoolCmd)
 	mp := s.cfg.TxMemPool
 
+	// The verbose result is streamed one transaction at a time since it
+	// can be large on a busy node.
 	if c.Verbose != nil && *c.Verbose {
-		return mp.RawMempoolVerbose(), nil
+		descs := mp.TxDescs()
+		produce := func(emit streamEmitFunc) error {
+			for _, desc := range descs {
+				mpd, ok := mp.RawMempoolVerboseTx(desc.Tx.Hash())
+				if !ok {
+					// Removed from the pool since the
+					// snapshot was taken.
+					continue
+				}
+				if err := emit(desc.Tx.Hash().String(), mpd); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return newStreamedObject(produce), nil
 	}
 
 	// The response is simply an array of the transaction hashes if the
@@ -2784,6 +3230,135 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
+// handleGetTxOutSetInfo handles gettxoutsetinfo commands.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutSetInfoCmd)
+
+	hashType := blockchain.UtxoSetHashSerialized
+	if c.HashType != nil {
+		switch *c.HashType {
+		case "hash_serialized":
+			hashType = blockchain.UtxoSetHashSerialized
+		case "muhash":
+			hashType = blockchain.UtxoSetHashMuHash
+		case "none":
+			hashType = blockchain.UtxoSetHashNone
+		default:
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Unknown hash type %q, "+
+					"expected hash_serialized, muhash or "+
+					"none", *c.HashType),
+			}
+		}
+	}
+	useIndex := s.cfg.CoinStatsIndex != nil &&
+		(c.UseIndex == nil || *c.UseIndex) &&
+		hashType != blockchain.UtxoSetHashSerialized
+
+	// Resolve the block, which is specified by either its hash or its
+	// height in the main chain.  The statistics at blocks other than the
+	// best one are only available from the index.
+	var hash *chainhash.Hash
+	if c.HashOrHeight != nil {
+		switch val := c.HashOrHeight.Value.(type) {
+		case string:
+			var err error
+			hash, err = chainhash.NewHashFromStr(val)
+			if err != nil {
+				return nil, rpcDecodeHexError(val)
+			}
+			if !s.cfg.Chain.MainChainHasBlock(hash) {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCBlockNotFound,
+					Message: "Block not found in the main chain",
+				}
+			}
+
+		case int32:
+			best := s.cfg.Chain.BestSnapshot()
+			if val < 0 || val > best.Height {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Target block height %d "+
+						"is not in the range 0 to %d", val,
+						best.Height),
+				}
+			}
+			var err error
+			hash, err = s.cfg.Chain.BlockHashByHeight(val)
+			if err != nil {
+				context := "Failed to obtain block hash"
+				return nil, internalRPCError(err.Error(), context)
+			}
+
+		default:
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "The block must be specified by hash or height",
+			}
+		}
+
+		if !useIndex {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: "Querying a specific block requires the " +
+					"coinstats index (--coinstatsindex), " +
+					"use_index and a hash type other than " +
+					"hash_serialized",
+			}
+		}
+	}
+
+	var stats *blockchain.UtxoSetStats
+	if useIndex {
+		if hash == nil {
+			hash = &s.cfg.Chain.BestSnapshot().Hash
+		}
+		var err error
+		stats, err = s.cfg.CoinStatsIndex.StatsByBlockHash(hash)
+		if err != nil {
+			context := "Failed to load utxo set statistics"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if stats == nil {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Utxo set statistics of block "+
+					"%v are not indexed yet", hash),
+			}
+		}
+		if hashType == blockchain.UtxoSetHashNone {
+			stats.HashType = blockchain.UtxoSetHashNone
+		}
+	} else {
+		var err error
+		stats, err = s.cfg.Chain.CalcUtxoSetStats(hashType)
+		if err != nil {
+			context := "Failed to calculate utxo set statistics"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+
+	reply := &btcjson.GetTxOutSetInfoResult{
+		Height:         stats.Height,
+		BestBlock:      stats.BlockHash.String(),
+		TxOuts:         stats.NumUtxos,
+		SerializedSize: stats.SerializedSize,
+		TotalAmount:    btcutil.Amount(stats.TotalAmount).ToBTC(),
+		ClaimAmount:    btcutil.Amount(stats.ClaimAmount).ToBTC(),
+		SupportAmount:  btcutil.Amount(stats.SupportAmount).ToBTC(),
+		PlainAmount:    btcutil.Amount(stats.PlainAmount()).ToBTC(),
+	}
+	switch stats.HashType {
+	case blockchain.UtxoSetHashSerialized:
+		reply.HashSerialized = stats.Hash.String()
+	case blockchain.UtxoSetHashMuHash:
+		reply.MuHash = stats.Hash.String()
+	}
+	return reply, nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.HelpCmd)
@@ -2823,6 +3398,54 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.InvalidateBlockCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.InvalidateBlock(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: "Unable to invalidate block: " + err.Error(),
+		}
+	}
+
+	return nil, nil
+}
+
+// handleLoadTxOutSet implements the loadtxoutset command.
+func handleLoadTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.LoadTxOutSetCmd)
+
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	defer f.Close()
+
+	snapshot, err := s.cfg.Chain.LoadUtxoSnapshot(f)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCVerify,
+			Message: fmt.Sprintf("can't load utxo set: %v", err),
+		}
+	}
+
+	return txOutSetSnapshotResult(c.Path, snapshot), nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2836,6 +3459,49 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+	hash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+	if c.Dummy != 0 {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "Priority is no longer supported, dummy " +
+				"argument to prioritisetransaction must be 0",
+		}
+	}
+
+	s.cfg.TxMemPool.PrioritiseTransaction(hash, c.FeeDelta)
+	return true, nil
+}
+
+// handleReconsiderBlock implements the reconsiderblock command.
+func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ReconsiderBlockCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.ReconsiderBlock(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: "Unable to reconsider block: " + err.Error(),
+		}
+	}
+
+	return nil, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -3523,41 +4189,6 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return result, nil
 }
 
-func verifyChain(s *rpcServer, level, depth int32) error {
-	best := s.cfg.Chain.BestSnapshot()
-	finishHeight := best.Height - depth
-	if finishHeight < 0 {
-		finishHeight = 0
-	}
-	rpcsLog.Infof("Verifying chain for %d blocks at level %d",
-		best.Height-finishHeight, level)
-
-	for height := best.Height; height > finishHeight; height-- {
-		// Level 0 just looks up the block.
-		block, err := s.cfg.Chain.BlockByHeight(height)
-		if err != nil {
-			rpcsLog.Errorf("Verify is unable to fetch block at "+
-				"height %d: %v", height, err)
-			return err
-		}
-
-		// Level 1 does basic chain sanity checks.
-		if level > 0 {
-			err := blockchain.CheckBlockSanity(block,
-				s.cfg.ChainParams.PowLimit, s.cfg.TimeSource)
-			if err != nil {
-				rpcsLog.Errorf("Verify is unable to validate "+
-					"block at hash %v height %d: %v",
-					block.Hash(), height, err)
-				return err
-			}
-		}
-	}
-	rpcsLog.Infof("Chain verify completed successfully")
-
-	return nil
-}
-
 // handleVerifyChain implements the verifychain command.
 func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.VerifyChainCmd)
@@ -3570,8 +4201,33 @@ func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		checkDepth = *c.CheckDepth
 	}
 
-	err := verifyChain(s, checkLevel, checkDepth)
-	return err == nil, nil
+	report, err := s.cfg.Chain.VerifyChain(checkLevel, checkDepth)
+	if err != nil {
+		context := "Failed to verify chain"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	// When the verbose flag isn't set, simply return whether or not the
+	// chain verified.
+	if c.Verbose == nil || !*c.Verbose {
+		return report.Valid(), nil
+	}
+
+	result := &btcjson.VerifyChainResult{
+		Valid:         report.Valid(),
+		CheckLevel:    report.Level,
+		CheckedBlocks: report.Checked,
+		Failures:      make([]btcjson.VerifyChainFailure, 0, len(report.Failures)),
+	}
+	for _, failure := range report.Failures {
+		result.Failures = append(result.Failures, btcjson.VerifyChainFailure{
+			Height: failure.Height,
+			Hash:   failure.Hash.String(),
+			Level:  failure.Level,
+			Error:  failure.Err.Error(),
+		})
+	}
+	return result, nil
 }
 
 // handleVerifyMessage implements the verifymessage command.
@@ -4038,6 +4694,24 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 		}
 	}
 
+	// Stream the response when the result is too large to be marshalled
+	// at once.
+	if sr, ok := result.(*streamedResult); ok && jsonErr == nil {
+		err = s.writeHTTPResponseHeaders(r, w.Header(), http.StatusOK, buf)
+		if err != nil {
+			rpcsLog.Error(err)
+			return
+		}
+		if err := writeStreamedReply(buf, responseID, sr); err != nil {
+			rpcsLog.Errorf("Failed to write streamed reply: %v", err)
+			return
+		}
+		if err := buf.WriteByte('\n'); err != nil {
+			rpcsLog.Errorf("Failed to append terminating newline to reply: %v", err)
+		}
+		return
+	}
+
 	// Marshal the response.
 	msg, err := createMarshalledReply(responseID, result, jsonErr)
 	if err != nil {
@@ -4314,9 +4988,11 @@ type rpcserverConfig struct {
 
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
-	TxIndex   *indexers.TxIndex
-	AddrIndex *indexers.AddrIndex
-	CfIndex   *indexers.CfIndex
+	TxIndex        *indexers.TxIndex
+	AddrIndex      *indexers.AddrIndex
+	CfIndex        *indexers.CfIndex
+	StatsIndex     *indexers.StatsIndex
+	CoinStatsIndex *indexers.CoinStatsIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -4328,7 +5004,7 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(config.TimeSource),
+		gbtWorkState:           newGbtWorkState(config.Generator, config.TimeSource),
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
@@ -4384,6 +5060,17 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 
 		// Notify registered websocket clients.
 		s.ntfnMgr.NotifyBlockDisconnected(block)
+
+	case blockchain.NTChainReorganized:
+		reorg, ok := notification.Data.(*blockchain.ChainReorganization)
+		if !ok {
+			rpcsLog.Warnf("Chain reorganized notification is not a " +
+				"reorganization.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		s.ntfnMgr.NotifyChainReorganized(reorg)
 	}
 }
 
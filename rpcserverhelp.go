@@ -115,6 +115,18 @@ var helpDescsEnUS = map[string]string{
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes the unspent transaction outputs and the claimtrie at the best block to a snapshot file on the server.",
+	"dumptxoutset-path":      "The path of the snapshot file",
+
+	// TxOutSetSnapshotResult help.
+	"txoutsetsnapshotresult-path":         "The path of the snapshot file",
+	"txoutsetsnapshotresult-height":       "The height of the block of the snapshot",
+	"txoutsetsnapshotresult-blockhash":    "The hash of the block of the snapshot",
+	"txoutsetsnapshotresult-numutxos":     "The number of unspent transaction outputs in the snapshot",
+	"txoutsetsnapshotresult-utxosethash":  "The hash of the serialized unspent transaction outputs",
+	"txoutsetsnapshotresult-chaintxcount": "The number of transactions in the chain up to and including the block of the snapshot",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -130,6 +142,23 @@ var helpDescsEnUS = map[string]string{
 	"generate-numblocks": "Number of blocks to generate",
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
+	// GenerateBlockCmd help.
+	"generateblock--synopsis": "Mines a block with exactly the passed transactions in the passed order (simnet or regtest only).\n" +
+		"Transactions may only spend the outputs of the ones before them, and the block must be valid.",
+	"generateblock-output":       "The address to pay the block to",
+	"generateblock-transactions": "The hashes of transactions in the memory pool or hex-encoded raw transactions to include in the block",
+
+	// GenerateBlockResult help.
+	"generateblockresult-hash": "The hash of the generated block",
+
+	// GenerateToAddressCmd help.
+	"generatetoaddress--synopsis": "Generates a set number of blocks paying to an address (simnet or regtest only) and returns a JSON\n" +
+		" array of their hashes.",
+	"generatetoaddress-numblocks": "Number of blocks to generate",
+	"generatetoaddress-address":   "The address to pay the blocks to",
+	"generatetoaddress-maxtries":  "The maximum number of nonces to try for all blocks, after which fewer blocks are generated",
+	"generatetoaddress--result0":  "The hashes, in order, of blocks generated by the call",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -182,6 +211,8 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-pruned":               "A bool that indicates if the node is pruned or not",
 	"getblockchaininforesult-pruneheight":          "The lowest block retained in the current pruned chain",
 	"getblockchaininforesult-chainwork":            "The total cumulative work in the best chain",
+	"getblockchaininforesult-assumevalid":          "The hash of the block whose scripts, along with the ones of its ancestors, are assumed to be valid",
+	"getblockchaininforesult-assumevalidactive":    "Whether the scripts of the next block to be connected are assumed to be valid and won't be checked",
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
 
@@ -286,6 +317,53 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 
+	// GetBlockStatsCmd help.
+	"getblockstats--synopsis":       "Returns statistics about the transactions of a block in the main chain, excluding the coinbase unless noted otherwise.",
+	"getblockstats-hashorheight":    "The hash or the height of the block",
+	"getblockstats-stats":           "The statistics to return, all of them when omitted",
+	"getblockstats--condition0":     "stats omitted",
+	"getblockstats--condition1":     "stats specified",
+	"getblockstats--result1--desc":  "The selected statistics, with the same keys and values as in the full result",
+	"getblockstats--result1--key":   "The name of the statistic",
+	"getblockstats--result1--value": "The value of the statistic",
+
+	// HashOrHeight help.
+	"hashorheight-value": "The hash of the block as a string, or its height as a number",
+
+	// GetBlockStatsResult help.
+	"getblockstatsresult-avgfee":              "The average fee in satoshi",
+	"getblockstatsresult-avgfeerate":          "The average fee rate in satoshi per virtual byte",
+	"getblockstatsresult-avgtxsize":           "The average transaction size in bytes",
+	"getblockstatsresult-blockhash":           "The hash of the block",
+	"getblockstatsresult-feerate_percentiles": "The 10th, 25th, 50th, 75th, and 90th percentiles of the fee rates in satoshi per virtual byte, weighted by transaction weight",
+	"getblockstatsresult-height":              "The height of the block",
+	"getblockstatsresult-ins":                 "The number of inputs",
+	"getblockstatsresult-maxfee":              "The highest fee in satoshi",
+	"getblockstatsresult-maxfeerate":          "The highest fee rate in satoshi per virtual byte",
+	"getblockstatsresult-maxtxsize":           "The size of the largest transaction in bytes",
+	"getblockstatsresult-medianfee":           "The median fee in satoshi",
+	"getblockstatsresult-mediantime":          "The median block time of the block and the ones before it in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-minfee":              "The lowest fee in satoshi",
+	"getblockstatsresult-minfeerate":          "The lowest fee rate in satoshi per virtual byte",
+	"getblockstatsresult-mintxsize":           "The size of the smallest transaction in bytes",
+	"getblockstatsresult-outs":                "The number of outputs, including the ones of the coinbase",
+	"getblockstatsresult-subsidy":             "The block subsidy in satoshi",
+	"getblockstatsresult-swtotal_size":        "The total size of the transactions with witness data in bytes",
+	"getblockstatsresult-swtotal_weight":      "The total weight of the transactions with witness data",
+	"getblockstatsresult-swtxs":               "The number of transactions with witness data",
+	"getblockstatsresult-time":                "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-total_out":           "The total amount of the outputs in satoshi",
+	"getblockstatsresult-total_size":          "The total size of the transactions in bytes",
+	"getblockstatsresult-total_weight":        "The total weight of the transactions",
+	"getblockstatsresult-totalfee":            "The total fee in satoshi",
+	"getblockstatsresult-txs":                 "The number of transactions, including the coinbase",
+	"getblockstatsresult-utxo_increase":       "The change in the number of unspent transaction outputs",
+	"getblockstatsresult-utxo_size_inc":       "The estimated change in the size of the unspent transaction output set in bytes",
+	"getblockstatsresult-claims":              "The number of claim outputs, including the ones of the coinbase",
+	"getblockstatsresult-supports":            "The number of support outputs, including the ones of the coinbase",
+	"getblockstatsresult-updates":             "The number of claim update outputs, including the ones of the coinbase",
+	"getblockstatsresult-staked":              "The total amount of the claim, support, and claim update outputs in satoshi",
+
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
 	"templaterequest-capabilities": "List of capabilities",
@@ -356,6 +434,15 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetChainTipsCmd help.
+	"getchaintips--synopsis": "Returns information about all known tips in the block tree, including the main chain and the side chains.",
+
+	// GetChainTipsResult help.
+	"getchaintipsresult-height":    "The height of the chain tip",
+	"getchaintipsresult-hash":      "The block hash of the chain tip",
+	"getchaintipsresult-branchlen": "The length of the branch connecting the tip to the main chain, zero for the main chain",
+	"getchaintipsresult-status":    "The status of the chain (active, valid-fork, valid-headers, headers-only, invalid)",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -364,6 +451,43 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDeploymentInfoCmd help.
+	"getdeploymentinfo--synopsis": "Returns the state of the soft-fork deployments at a block.",
+	"getdeploymentinfo-blockhash": "The hash of the block (default: the best block)",
+
+	// GetDeploymentInfoResult help.
+	"getdeploymentinforesult-hash":               "The hash of the block",
+	"getdeploymentinforesult-height":             "The height of the block",
+	"getdeploymentinforesult-deployments":        "The deployments keyed by their names",
+	"getdeploymentinforesult-deployments--key":   "The name of the deployment",
+	"getdeploymentinforesult-deployments--value": "An object describing the deployment",
+	"getdeploymentinforesult-deployments--desc":  "JSON object describing the state of each deployment",
+
+	// DeploymentInfo help.
+	"deploymentinfo-type":   "The type of the deployment (buried, bip9)",
+	"deploymentinfo-height": "The height of the first block which enforces the rules (only for buried deployments and active bip9 deployments)",
+	"deploymentinfo-active": "Whether the rules are enforced for the block after the block",
+	"deploymentinfo-bip9":   "The version bits details of a bip9 deployment",
+
+	// Bip9DeploymentInfo help.
+	"bip9deploymentinfo-bit":                   "The bit of the block version which signals the deployment",
+	"bip9deploymentinfo-start_time":            "The median block time after which voting starts (only for time based deployments)",
+	"bip9deploymentinfo-timeout":               "The median block time after which the deployment fails if it has not been locked in (only for time based deployments)",
+	"bip9deploymentinfo-start_height":          "The height from which on voting starts (only for height based deployments)",
+	"bip9deploymentinfo-timeout_height":        "The height from which on the deployment fails if it has not been locked in (only for height based deployments)",
+	"bip9deploymentinfo-min_activation_height": "The height before which the deployment does not become active",
+	"bip9deploymentinfo-status":                "The state of the deployment at the block (defined, started, lockedin, active, failed)",
+	"bip9deploymentinfo-since":                 "The height of the first block with the state",
+	"bip9deploymentinfo-status_next":           "The state of the deployment for the block after the block",
+	"bip9deploymentinfo-statistics":            "The signalling within the window of the block (only when started or locked in)",
+
+	// Bip9Statistics help.
+	"bip9statistics-period":    "The number of blocks in a window",
+	"bip9statistics-threshold": "The number of signalling blocks in a window required to lock in the deployment",
+	"bip9statistics-elapsed":   "The number of blocks of the window up to the block",
+	"bip9statistics-count":     "The number of signalling blocks of the window up to the block",
+	"bip9statistics-possible":  "Whether the threshold can still be reached within the window",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
@@ -482,6 +606,7 @@ var helpDescsEnUS = map[string]string{
 	// GetRawMempoolVerboseResult help.
 	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
 	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
+	"getrawmempoolverboseresult-modifiedfee":      "Transaction fee in bitcoins along with the fee delta set via prioritisetransaction",
 	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
 	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
 	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
@@ -519,6 +644,24 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":          "The height of the block the statistics are for",
+	"gettxoutsetinforesult-bestblock":       "The hash of the block the statistics are for",
+	"gettxoutsetinforesult-txouts":          "The number of unspent transaction outputs",
+	"gettxoutsetinforesult-serialized_size": "The size in bytes of the serialized unspent transaction outputs",
+	"gettxoutsetinforesult-hash_serialized": "The double sha256 of the serialized unspent transaction outputs (only with hashtype=hash_serialized)",
+	"gettxoutsetinforesult-muhash":          "The MuHash of the serialized unspent transaction outputs (only with hashtype=muhash)",
+	"gettxoutsetinforesult-total_amount":    "The total amount of all unspent transaction outputs in LBC",
+	"gettxoutsetinforesult-claim_amount":    "The amount held by claims and updates of claims in LBC",
+	"gettxoutsetinforesult-support_amount":  "The amount held by supports in LBC",
+	"gettxoutsetinforesult-plain_amount":    "The amount held by outputs which are not claims, updates or supports in LBC",
+
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis":    "Returns statistics about the unspent transaction output set.",
+	"gettxoutsetinfo-hashtype":     "The hash of the set to calculate: hash_serialized, muhash or none",
+	"gettxoutsetinfo-hashorheight": "The hash or the height of a main chain block to return the statistics at, which requires the coinstats index (default: the best block)",
+	"gettxoutsetinfo-useindex":     "Use the coinstats index when it is enabled and the hash type is not hash_serialized",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -527,10 +670,36 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// InvalidateBlockCmd help.
+	"invalidateblock--synopsis": "Permanently marks a block and all of its descendants as invalid.\n" +
+		"When the block is in the main chain, it is disconnected along with its descendants, and the best remaining chain becomes the main chain.",
+	"invalidateblock-blockhash": "The hash of the block to mark as invalid",
+
+	// LoadTxOutSetCmd help.
+	"loadtxoutset--synopsis": "Loads a utxo set snapshot from a file on the server into a node which has not connected any blocks yet.\n" +
+		"The snapshot is refused unless its block and hash are pinned in the chain parameters and its headers are known.\n" +
+		"No network has built-in snapshots yet, so only the ones added with --addassumeutxo can be loaded.\n" +
+		"The chain continues from the snapshot block right away, while the blocks below it are downloaded and validated in the background.",
+	"loadtxoutset-path": "The path of the snapshot file",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Adds a fee delta to a transaction, which doesn't have to be in the memory pool yet.\n" +
+		"The fee delta is added to the fee of the transaction when selecting the transactions of a block template and when it replaces or is replaced by other transactions, but not to the fees collected by the block.\n" +
+		"Fee deltas accumulate, are kept across restarts, and are removed once the transaction is included in a block.",
+	"prioritisetransaction-txid":     "The hash of the transaction",
+	"prioritisetransaction-dummy":    "Unused, must be 0",
+	"prioritisetransaction-feedelta": "The fee delta in satoshis, which is negative to penalize the transaction",
+	"prioritisetransaction--result0": "Always true",
+
+	// ReconsiderBlockCmd help.
+	"reconsiderblock--synopsis": "Removes the invalid status of a block, its ancestors, and its descendants, which was set by invalidateblock.\n" +
+		"The best chain is then selected again, which validates the blocks that were not validated before.",
+	"reconsiderblock-blockhash": "The hash of the block to reconsider",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -588,10 +757,28 @@ var helpDescsEnUS = map[string]string{
 		"The actual checks performed by the checklevel parameter are implementation specific.\n" +
 		"For btcd this is:\n" +
 		"checklevel=0 - Look up each block and ensure it can be loaded from the database.\n" +
-		"checklevel=1 - Perform basic context-free sanity checks on each block.",
-	"verifychain-checklevel": "How thorough the block verification is",
-	"verifychain-checkdepth": "The number of blocks to check",
-	"verifychain--result0":   "Whether or not the chain verified",
+		"checklevel=1 - Perform basic context-free sanity checks on each block.\n" +
+		"checklevel=2 - Ensure the undo data of each block can be loaded and is consistent with the block.\n" +
+		"checklevel=3 - Disconnect the blocks and reconnect them in a scratch utxo view and ClaimTrie, comparing the spent outputs, ClaimTrie roots and resulting utxo set.\n" +
+		"checklevel=4 - Additionally perform all of the checks of connecting each block, including its scripts.",
+	"verifychain-checklevel":  "How thorough the block verification is",
+	"verifychain-checkdepth":  "The number of blocks to check",
+	"verifychain-verbose":     "Specifies a report of the failures is returned instead of a boolean (btcd extension)",
+	"verifychain--condition0": "verbose=false",
+	"verifychain--condition1": "verbose=true",
+	"verifychain--result0":    "Whether or not the chain verified",
+
+	// VerifyChainResult help.
+	"verifychainresult-valid":         "Whether or not the chain verified",
+	"verifychainresult-checklevel":    "The check level which was used",
+	"verifychainresult-checkedblocks": "The number of blocks which were checked",
+	"verifychainresult-failures":      "The blocks which failed the checks",
+
+	// VerifyChainFailure help.
+	"verifychainfailure-height": "The height of the block",
+	"verifychainfailure-hash":   "The hash of the block",
+	"verifychainfailure-level":  "The check level which detected the failure",
+	"verifychainfailure-error":  "The reason of the failure",
 
 	// VerifyMessageCmd help.
 	"verifymessage--synopsis": "Verify a signed message.",
@@ -612,6 +799,12 @@ var helpDescsEnUS = map[string]string{
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
 
+	// NotifyReorgsCmd help.
+	"notifyreorgs--synopsis": "Request a chainreorganized notification whenever blocks are disconnected from the main (best) chain, which lists the fork point along with all of the disconnected and connected blocks.",
+
+	// StopNotifyReorgsCmd help.
+	"stopnotifyreorgs--synopsis": "Cancel registered notifications for whenever the main (best) chain is reorganized.",
+
 	// NotifyNewTransactionsCmd help.
 	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
 	"notifynewtransactions-verbose":   "Specifies which type of notification to receive. If verbose is true, then the caller receives txacceptedverbose, otherwise the caller receives txaccepted",
@@ -686,7 +879,10 @@ var helpDescsEnUS = map[string]string{
 	// -------- ClaimTrie-specific help --------
 
 	// GetClaimsInTrieCmd help.
-	"getclaimsintrie--synopsis":  "Returns all claims in the name trie.",
+	"getclaimsintrie--synopsis":  "Returns the claims in the name trie, ordered by name.",
+	"getclaimsintrie-prefix":     "Only include the names starting with this prefix",
+	"getclaimsintrie-startafter": "Only include the names sorting after this name, which is usually the last name of the previous page",
+	"getclaimsintrie-limit":      "The maximum number of names to return (0 = all)",
 	"claimsintrieentry-name":     "The name claimed",
 	"claimsintrieentry-claims":   "The claims for this name",
 	"claimsintriedetail-value":   "The value of this claim",
@@ -730,6 +926,8 @@ var helpDescsEnUS = map[string]string{
 	"claimforname-nAmount":                       "The amount of the claim",
 	"claimforname-nEffectiveAmount":              "The total effective amount of the claim, taking into effect whether the claim or support has reached its nValidAtHeight",
 	"claimforname-supports":                      "supports for this claim",
+	"claimforname-expires_at":                    "The height at which the claim expires",
+	"claimforname-blocks_to_expiry":              "The number of blocks left before the claim expires",
 	"supportofclaim-txid":                        "The txid of the support",
 	"supportofclaim-n":                           "The index of the support in the transaction's list of outputs",
 	"supportofclaim-nHeight":                     "The height at which the support was included in the blockchain",
@@ -792,11 +990,47 @@ var helpDescsEnUS = map[string]string{
 	"getclaimbyidresult-height":           "The height of the block in which this claim transaction is located",
 	"getclaimbyidresult-supports":         "Supports for this claim",
 	"getclaimbyidresult-valid at height":  "The height at which the claim is valid",
+	"getclaimbyidresult-expires_at":       "The height at which the claim expires",
+	"getclaimbyidresult-blocks_to_expiry": "The number of blocks left before the claim expires",
 	"claimbyidsupport-txid":               "The txid of the support",
 	"claimbyidsupport-n":                  "The index of the support in the transaction's list of outputs",
 	"claimbyidsupport-height":             "The height at which the support was included in the blockchain",
 	"claimbyidsupport-valid at height":    "The height at which the support is valid",
 	"claimbyidsupport-amount":             "The amount of the support",
+
+	// GetClaimScheduleCmd help.
+	"getclaimschedule--synopsis":        "Returns the claims and supports scheduled to activate or expire, and the predicted takeovers, within a range of future heights.",
+	"getclaimschedule-fromheight":       "The first height of the range (default: the next block, must be above the current height)",
+	"getclaimschedule-toheight":         "The last height of the range (default: fromheight + 4031)",
+	"getclaimscheduleresult-fromheight": "The first height of the range",
+	"getclaimscheduleresult-toheight":   "The last height of the range",
+	"getclaimscheduleresult-updates":    "The scheduled updates ordered by height and name",
+	"claimscheduleentry-height":         "The height at which the update happens",
+	"claimscheduleentry-event":          "'activation', 'expiration' or 'takeover'",
+	"claimscheduleentry-name":           "The name affected by the update",
+	"claimscheduleentry-type":           "'claim' or 'support'",
+	"claimscheduleentry-claimId":        "The claimId of the claim, or the claimId supported by the support",
+	"claimscheduleentry-txid":           "The txid of the claim or support",
+	"claimscheduleentry-n":              "The index of the claim or support in the transaction's list of outputs",
+	"claimscheduleentry-amount":         "The amount of the claim or support",
+
+	// ExportClaimTrieCmd help.
+	"exportclaimtrie--synopsis": "Writes a snapshot of the claimtrie at a block of the main chain to a file on the server.",
+	"exportclaimtrie-path":      "The path of the snapshot file",
+	"exportclaimtrie-height":    "The height of the block (default: the best block)",
+
+	// ImportClaimTrieCmd help.
+	"importclaimtrie--synopsis": "Replaces the claimtrie with a snapshot read from a file on the server.\n" +
+		"The snapshot is refused unless its block is in the best header chain and the rebuilt claimtrie root matches the header of that block.\n" +
+		"The block doesn't have to be downloaded yet, in which case the claims of the blocks up to it are skipped as they are connected.\n" +
+		"Otherwise, the claims of the blocks after the snapshot are replayed up to the best block.",
+	"importclaimtrie-path": "The path of the snapshot file",
+
+	// ClaimTrieSnapshotResult help.
+	"claimtriesnapshotresult-path":      "The path of the snapshot file",
+	"claimtriesnapshotresult-height":    "The height of the block the snapshot was taken at",
+	"claimtriesnapshotresult-blockhash": "The hash of the block the snapshot was taken at",
+	"claimtriesnapshotresult-claimtrie": "The claimtrie root at the block",
 }
 
 // rpcResultTypes specifies the result types that each RPC command can return.
@@ -808,8 +1042,11 @@ var rpcResultTypes = map[string][]interface{}{
 	"debuglevel":            {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":  {(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
+	"dumptxoutset":          {(*btcjson.TxOutSetSnapshotResult)(nil)},
 	"estimatefee":           {(*float64)(nil)},
 	"generate":              {(*[]string)(nil)},
+	"generateblock":         {(*btcjson.GenerateBlockResult)(nil)},
+	"generatetoaddress":     {(*[]string)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
 	"getbestblock":          {(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":      {(*string)(nil)},
@@ -817,12 +1054,15 @@ var rpcResultTypes = map[string][]interface{}{
 	"getblockcount":         {(*int64)(nil)},
 	"getblockhash":          {(*string)(nil)},
 	"getblockheader":        {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockstats":         {(*btcjson.GetBlockStatsResult)(nil), (*map[string]interface{})(nil)},
 	"getblocktemplate":      {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
 	"getblockchaininfo":     {(*btcjson.GetBlockChainInfoResult)(nil)},
 	"getcfilter":            {(*string)(nil)},
 	"getcfilterheader":      {(*string)(nil)},
+	"getchaintips":          {(*[]btcjson.GetChainTipsResult)(nil)},
 	"getconnectioncount":    {(*int32)(nil)},
 	"getcurrentnet":         {(*uint32)(nil)},
+	"getdeploymentinfo":     {(*btcjson.GetDeploymentInfoResult)(nil)},
 	"getdifficulty":         {(*float64)(nil)},
 	"getgenerate":           {(*bool)(nil)},
 	"gethashespersec":       {(*float64)(nil)},
@@ -836,9 +1076,14 @@ var rpcResultTypes = map[string][]interface{}{
 	"getrawmempool":         {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":     {(*string)(nil), (*btcjson.TxRawResult)(nil)},
 	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
+	"gettxoutsetinfo":       {(*btcjson.GetTxOutSetInfoResult)(nil)},
 	"node":                  nil,
 	"help":                  {(*string)(nil), (*string)(nil)},
+	"invalidateblock":       nil,
+	"loadtxoutset":          {(*btcjson.TxOutSetSnapshotResult)(nil)},
 	"ping":                  nil,
+	"prioritisetransaction": {(*bool)(nil)},
+	"reconsiderblock":       nil,
 	"searchrawtransactions": {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":    {(*string)(nil)},
 	"setgenerate":           nil,
@@ -846,7 +1091,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"submitblock":           {nil, (*string)(nil)},
 	"uptime":                {(*int64)(nil)},
 	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
-	"verifychain":           {(*bool)(nil)},
+	"verifychain":           {(*bool)(nil), (*btcjson.VerifyChainResult)(nil)},
 	"verifymessage":         {(*bool)(nil)},
 	"version":               {(*map[string]btcjson.VersionResult)(nil)},
 
@@ -855,6 +1100,8 @@ var rpcResultTypes = map[string][]interface{}{
 	"session":                   {(*btcjson.SessionResult)(nil)},
 	"notifyblocks":              nil,
 	"stopnotifyblocks":          nil,
+	"notifyreorgs":              nil,
+	"stopnotifyreorgs":          nil,
 	"notifynewtransactions":     nil,
 	"stopnotifynewtransactions": nil,
 	"notifyreceived":            nil,
@@ -875,6 +1122,9 @@ var rpcResultTypes = map[string][]interface{}{
 	"getclaimsfortx":        {(*btcjson.GetClaimsForTxResult)(nil)},
 	"getnameproof":          {(*btcjson.GetNameProofResult)(nil)},
 	"getclaimbyid":          {(*btcjson.GetClaimByIDResult)(nil)},
+	"getclaimschedule":      {(*btcjson.GetClaimScheduleResult)(nil)},
+	"exportclaimtrie":       {(*btcjson.ClaimTrieSnapshotResult)(nil)},
+	"importclaimtrie":       {(*btcjson.ClaimTrieSnapshotResult)(nil)},
 }
 
 // helpCacher provides a concurrent safe type that provides help and usage for
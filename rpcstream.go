@@ -0,0 +1,154 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// streamEmitFunc is called by the producer of a streamed result for each
+// element.  The key is only used when the result is a JSON object.
+type streamEmitFunc func(key string, v interface{}) error
+
+// streamedResult is returned by command handlers whose results can be too
+// large to be marshalled in memory at once.  Rather than building the whole
+// result, the handler provides a producer which emits the elements one at a
+// time.  The HTTP server writes each element to the connection as soon as it
+// is produced, so the memory used is bounded by the largest element.
+//
+// Other transports, such as websockets, fall back to marshalling the whole
+// result through the json.Marshaler interface.
+type streamedResult struct {
+	object  bool
+	produce func(emit streamEmitFunc) error
+}
+
+// newStreamedArray returns a streamed result which is encoded as a JSON array
+// of the values emitted by produce.
+func newStreamedArray(produce func(emit func(v interface{}) error) error) *streamedResult {
+	return &streamedResult{
+		produce: func(emit streamEmitFunc) error {
+			return produce(func(v interface{}) error {
+				return emit("", v)
+			})
+		},
+	}
+}
+
+// newStreamedObject returns a streamed result which is encoded as a JSON object
+// of the key/value pairs emitted by produce.  The producer is responsible for
+// not emitting duplicate keys.
+func newStreamedObject(produce func(emit streamEmitFunc) error) *streamedResult {
+	return &streamedResult{object: true, produce: produce}
+}
+
+// writeTo encodes the streamed result to w as the elements are produced.
+func (r *streamedResult) writeTo(w io.Writer) error {
+	if _, err := w.Write([]byte{r.delims()[0]}); err != nil {
+		return err
+	}
+
+	first := true
+	emit := func(key string, v interface{}) error {
+		// Marshal the element before writing anything so a failure
+		// doesn't leave a partial element behind.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if r.object {
+			k, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			b = append(append(k, ':'), b...)
+		}
+		if !first {
+			b = append([]byte{','}, b...)
+		}
+		first = false
+		_, err = w.Write(b)
+		return err
+	}
+	if err := r.produce(emit); err != nil {
+		return err
+	}
+
+	_, err := w.Write([]byte{r.delims()[1]})
+	return err
+}
+
+// delims returns the opening and closing delimiters of the result.
+func (r *streamedResult) delims() string {
+	if r.object {
+		return "{}"
+	}
+	return "[]"
+}
+
+// MarshalJSON marshals the whole streamed result in memory.  It is used by
+// the transports which don't support streaming.
+//
+// This is part of the json.Marshaler interface.
+func (r *streamedResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.writeTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// connWriter wraps the writer of a connection and keeps the first error
+// returned by it, so that write failures can be told apart from failures of
+// the producer of a streamed result.
+type connWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write writes p to the underlying writer unless a previous write failed.
+//
+// This is part of the io.Writer interface.
+func (cw *connWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.err = err
+	return n, err
+}
+
+// writeStreamedReply writes a JSON-RPC response with a streamed result to w.
+// The response has the same layout as btcjson.Response.  Since the elements
+// already written can't be taken back, an error returned while producing the
+// result terminates the partial result and is reported in the error field.
+func writeStreamedReply(w io.Writer, id interface{}, result *streamedResult) error {
+	marshalledID, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+
+	cw := &connWriter{w: w}
+	io.WriteString(cw, `{"result":`)
+
+	var jsonErr *btcjson.RPCError
+	if err := result.writeTo(cw); err != nil && cw.err == nil {
+		rpcsLog.Errorf("Failed to produce streamed result: %v", err)
+		jsonErr = internalRPCError(err.Error(), "")
+		cw.Write([]byte{result.delims()[1]})
+	}
+
+	marshalledErr, err := json.Marshal(jsonErr)
+	if err != nil {
+		return err
+	}
+	io.WriteString(cw, `,"error":`+string(marshalledErr)+
+		`,"id":`+string(marshalledID)+"}")
+	return cw.err
+}
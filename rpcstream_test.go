@@ -0,0 +1,324 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/claimtrie"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// arrayOf returns a producer of a streamed array which emits the passed
+// values, and then returns err.
+func arrayOf(err error, vals ...interface{}) func(emit func(v interface{}) error) error {
+	return func(emit func(v interface{}) error) error {
+		for _, v := range vals {
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+// TestStreamedResult ensures streamed arrays and objects are framed as the
+// JSON encoding of the emitted elements.
+func TestStreamedResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *streamedResult
+		want   string
+	}{
+		{
+			name:   "empty array",
+			result: newStreamedArray(arrayOf(nil)),
+			want:   `[]`,
+		},
+		{
+			name:   "array",
+			result: newStreamedArray(arrayOf(nil, 1, "a", []int{2})),
+			want:   `[1,"a",[2]]`,
+		},
+		{
+			name: "empty object",
+			result: newStreamedObject(func(emit streamEmitFunc) error {
+				return nil
+			}),
+			want: `{}`,
+		},
+		{
+			name: "object",
+			result: newStreamedObject(func(emit streamEmitFunc) error {
+				if err := emit("a", 1); err != nil {
+					return err
+				}
+				return emit(`"b"`, map[string]int{"c": 2})
+			}),
+			want: `{"a":1,"\"b\"":{"c":2}}`,
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.result.writeTo(&buf); err != nil {
+			t.Errorf("%s: writeTo: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: writeTo: got %s, want %s", test.name, got,
+				test.want)
+		}
+
+		b, err := json.Marshal(test.result)
+		if err != nil {
+			t.Errorf("%s: MarshalJSON: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		if got := string(b); got != test.want {
+			t.Errorf("%s: MarshalJSON: got %s, want %s", test.name,
+				got, test.want)
+		}
+	}
+
+	// An element which can't be marshalled fails the result without
+	// writing any part of it.
+	var buf bytes.Buffer
+	r := newStreamedArray(arrayOf(nil, 1, make(chan int)))
+	if err := r.writeTo(&buf); err == nil {
+		t.Errorf("writeTo: expected an error for an invalid element")
+	}
+	if got := buf.String(); got != `[1` {
+		t.Errorf("writeTo: got %s after a failed element, want [1", got)
+	}
+}
+
+// failingWriter fails every write once limit bytes have been written.
+type failingWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, errWriteFailed
+	}
+	return w.buf.Write(p)
+}
+
+// TestWriteStreamedReply ensures streamed replies are valid JSON-RPC
+// responses, including when the result fails part way through.
+func TestWriteStreamedReply(t *testing.T) {
+	// The failed results are logged.
+	defer func(l btclog.Logger) { rpcsLog = l }(rpcsLog)
+	rpcsLog = btclog.Disabled
+
+	type reply struct {
+		Result []int             `json:"result"`
+		Error  *btcjson.RPCError `json:"error"`
+		ID     interface{}       `json:"id"`
+	}
+
+	tests := []struct {
+		name    string
+		produce func(emit func(v interface{}) error) error
+		want    reply
+	}{
+		{
+			name:    "complete result",
+			produce: arrayOf(nil, 1, 2, 3),
+			want:    reply{Result: []int{1, 2, 3}, ID: "id"},
+		},
+		{
+			name:    "empty result",
+			produce: arrayOf(nil),
+			want:    reply{Result: []int{}, ID: "id"},
+		},
+		{
+			name:    "error mid-stream",
+			produce: arrayOf(errors.New("failed"), 1, 2),
+			want: reply{
+				Result: []int{1, 2},
+				Error: btcjson.NewRPCError(
+					btcjson.ErrRPCInternal.Code, "failed"),
+				ID: "id",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := writeStreamedReply(&buf, "id", newStreamedArray(test.produce))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		var got reply
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Errorf("%s: invalid reply %s: %v", test.name,
+				buf.String(), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got,
+				test.want)
+		}
+	}
+
+	// A failure of the connection is returned, and nothing else is
+	// written after it.
+	w := &failingWriter{limit: 13}
+	r := newStreamedArray(arrayOf(nil, 1, 2, 3))
+	if err := writeStreamedReply(w, "id", r); err != errWriteFailed {
+		t.Errorf("got error %v, want %v", err, errWriteFailed)
+	}
+	if got := w.buf.String(); got != `{"result":[1` {
+		t.Errorf("got %s written before the failure", got)
+	}
+}
+
+// TestClaimsInTrie ensures the names returned by getclaimsintrie are filtered
+// by prefix and paginated with startafter and limit.
+func TestClaimsInTrie(t *testing.T) {
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	defer ct.Close()
+
+	names := []string{"b", "ab", "a", "abc", "ac"}
+	for i, name := range names {
+		op := wire.OutPoint{Hash: chainhash.Hash{byte(i)}}
+		if err := ct.AddClaim(name, op, 1, []byte(name)); err != nil {
+			t.Fatalf("AddClaim: %v", err)
+		}
+	}
+	ct.Commit(1)
+
+	tests := []struct {
+		name       string
+		prefix     string
+		startAfter string
+		limit      int32
+		want       []string
+	}{
+		{name: "all", want: []string{"a", "ab", "abc", "ac", "b"}},
+		{name: "prefix", prefix: "ab", want: []string{"ab", "abc"}},
+		{name: "no match", prefix: "c"},
+		{name: "startafter", startAfter: "ab", want: []string{"abc", "ac", "b"}},
+		{name: "limit", limit: 2, want: []string{"a", "ab"}},
+		{
+			name:       "page",
+			prefix:     "a",
+			startAfter: "ab",
+			limit:      1,
+			want:       []string{"abc"},
+		},
+	}
+
+	for _, test := range tests {
+		entries := claimsInTrie(ct, test.prefix, test.startAfter, test.limit)
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name)
+			if len(e.Claims) != 1 || e.Claims[0].Value != e.Name {
+				t.Errorf("%s: unexpected claims of %q: %+v",
+					test.name, e.Name, e.Claims)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got names %q, want %q", test.name, got,
+				test.want)
+		}
+	}
+}
+
+// TestClaimsInTrieProducer ensures getclaimsintrie collects the names in
+// batches, each through a view of its own, and emits all of them in order.
+func TestClaimsInTrieProducer(t *testing.T) {
+	ct, err := claimtrie.NewMemory()
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	defer ct.Close()
+
+	names := []string{"b", "ab", "a", "abc", "ac"}
+	for i, name := range names {
+		op := wire.OutPoint{Hash: chainhash.Hash{byte(i)}}
+		if err := ct.AddClaim(name, op, 1, []byte(name)); err != nil {
+			t.Fatalf("AddClaim: %v", err)
+		}
+	}
+	ct.Commit(1)
+
+	tests := []struct {
+		name       string
+		startAfter string
+		limit      int32
+		want       []string
+		views      int
+	}{
+		{
+			name:  "all",
+			want:  []string{"a", "ab", "abc", "ac", "b"},
+			views: 3,
+		},
+		{
+			name:  "limit",
+			limit: 3,
+			want:  []string{"a", "ab", "abc"},
+			views: 2,
+		},
+		{
+			name:  "limit at batch boundary",
+			limit: 4,
+			want:  []string{"a", "ab", "abc", "ac"},
+			views: 2,
+		},
+		{
+			name:       "startafter",
+			startAfter: "ab",
+			want:       []string{"abc", "ac", "b"},
+			views:      2,
+		},
+	}
+
+	for _, test := range tests {
+		var views int
+		view := func(fn func(*claimtrie.ClaimTrie) error) error {
+			views++
+			return fn(ct)
+		}
+		produce := claimsInTrieProducer(view, "", test.startAfter,
+			test.limit, 2)
+		var got []string
+		err := produce(func(v interface{}) error {
+			got = append(got, v.(btcjson.ClaimsInTrieEntry).Name)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got names %q, want %q", test.name, got,
+				test.want)
+		}
+		if views != test.views {
+			t.Errorf("%s: got %d views, want %d", test.name, views,
+				test.views)
+		}
+	}
+}
@@ -68,10 +68,12 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"notifyblocks":              handleNotifyBlocks,
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyreceived":            handleNotifyReceived,
+	"notifyreorgs":              handleNotifyReorgs,
 	"notifyspent":               handleNotifySpent,
 	"session":                   handleSession,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
+	"stopnotifyreorgs":          handleStopNotifyReorgs,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
 	"rescan":                    handleRescan,
@@ -226,6 +228,19 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *btcutil.Block) {
 	}
 }
 
+// NotifyChainReorganized passes a reorganization of the best chain to the
+// notification manager for reorganization notification processing.
+func (m *wsNotificationManager) NotifyChainReorganized(reorg *blockchain.ChainReorganization) {
+	// As NotifyChainReorganized will be called by the block manager
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationChainReorganized)(reorg):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -447,6 +462,7 @@ func (f *wsClientFilter) removeUnspentOutPoint(op *wire.OutPoint) {
 // Notification types
 type notificationBlockConnected btcutil.Block
 type notificationBlockDisconnected btcutil.Block
+type notificationChainReorganized blockchain.ChainReorganization
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
@@ -457,6 +473,8 @@ type notificationRegisterClient wsClient
 type notificationUnregisterClient wsClient
 type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
+type notificationRegisterReorgs wsClient
+type notificationUnregisterReorgs wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
 type notificationRegisterSpent struct {
@@ -490,6 +508,7 @@ func (m *wsNotificationManager) notificationHandler() {
 	// Where possible, the quit channel is used as the unique id for a client
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
+	reorgNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
@@ -532,6 +551,10 @@ out:
 						block)
 				}
 
+			case *notificationChainReorganized:
+				reorg := (*blockchain.ChainReorganization)(n)
+				m.notifyChainReorganized(reorgNotifications, reorg)
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -547,6 +570,14 @@ out:
 				wsc := (*wsClient)(n)
 				delete(blockNotifications, wsc.quit)
 
+			case *notificationRegisterReorgs:
+				wsc := (*wsClient)(n)
+				reorgNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterReorgs:
+				wsc := (*wsClient)(n)
+				delete(reorgNotifications, wsc.quit)
+
 			case *notificationRegisterClient:
 				wsc := (*wsClient)(n)
 				clients[wsc.quit] = wsc
@@ -556,6 +587,7 @@ out:
 				// Remove any requests made by the client as well as
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
+				delete(reorgNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
 				for k := range wsc.spentRequests {
 					op := k
@@ -625,6 +657,18 @@ func (m *wsNotificationManager) UnregisterBlockUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterBlocks)(wsc)
 }
 
+// RegisterReorgUpdates requests chain reorganization notifications to the
+// passed websocket client.
+func (m *wsNotificationManager) RegisterReorgUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterReorgs)(wsc)
+}
+
+// UnregisterReorgUpdates removes chain reorganization notifications for the
+// passed websocket client.
+func (m *wsNotificationManager) UnregisterReorgUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterReorgs)(wsc)
+}
+
 // subscribedClients returns the set of all websocket client quit channels that
 // are registered to receive notifications regarding tx, either due to tx
 // spending a watched output or outputting to a watched address.  Matching
@@ -807,6 +851,39 @@ func (*wsNotificationManager) notifyFilteredBlockDisconnected(clients map[chan s
 	}
 }
 
+// notifyChainReorganized notifies websocket clients that have registered for
+// reorganization updates when blocks are disconnected from the main chain.
+func (*wsNotificationManager) notifyChainReorganized(clients map[chan struct{}]*wsClient,
+	reorg *blockchain.ChainReorganization) {
+
+	// Skip notification creation if no clients have requested
+	// reorganization notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	// Notify interested websocket clients about the reorganization.
+	disconnected := make([]string, 0, len(reorg.DetachedBlocks))
+	for _, block := range reorg.DetachedBlocks {
+		disconnected = append(disconnected, block.Hash().String())
+	}
+	connected := make([]string, 0, len(reorg.AttachedBlocks))
+	for _, block := range reorg.AttachedBlocks {
+		connected = append(connected, block.Hash().String())
+	}
+	ntfn := btcjson.NewChainReorganizedNtfn(reorg.ForkHash.String(),
+		reorg.ForkHeight, disconnected, connected)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal chain reorganized "+
+			"notification: %v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterNewMempoolTxsUpdates requests notifications to the passed websocket
 // client when new transactions are added to the memory pool.
 func (m *wsNotificationManager) RegisterNewMempoolTxsUpdates(wsc *wsClient) {
@@ -1832,6 +1909,13 @@ func handleNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	return nil, nil
 }
 
+// handleNotifyReorgs implements the notifyreorgs command extension for
+// websocket connections.
+func handleNotifyReorgs(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterReorgUpdates(wsc)
+	return nil, nil
+}
+
 // handleSession implements the session command extension for websocket
 // connections.
 func handleSession(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -1845,6 +1929,13 @@ func handleStopNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error
 	return nil, nil
 }
 
+// handleStopNotifyReorgs implements the stopnotifyreorgs command extension for
+// websocket connections.
+func handleStopNotifyReorgs(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterReorgUpdates(wsc)
+	return nil, nil
+}
+
 // handleNotifySpent implements the notifyspent command extension for
 // websocket connections.
 func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -2247,6 +2338,9 @@ func handleRescanBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	for i := range blockHashes {
 		block, err := bc.BlockByHash(blockHashes[i])
 		if err != nil {
+			if bc.BlockPruned(blockHashes[i]) {
+				return nil, rpcPrunedBlockError(blockHashes[i])
+			}
 			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCBlockNotFound,
 				Message: "Failed to fetch block: " + err.Error(),
@@ -2573,6 +2667,12 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		}
 	}
 
+	// Pruning deletes the oldest blocks first, so the rescan can't proceed
+	// unless the data of the first block is still available.
+	if chain.BlockPruned(minBlockHash) {
+		return nil, rpcPrunedBlockError(minBlockHash)
+	}
+
 	maxBlock := int32(math.MaxInt32)
 	if cmd.EndBlock != nil {
 		maxBlockHash, err := chainhash.NewHashFromStr(*cmd.EndBlock)
@@ -32,6 +32,7 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/mining/stratum"
 	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/txscript"
@@ -215,6 +216,7 @@ type server struct {
 	chain                *blockchain.BlockChain
 	txMemPool            *mempool.TxPool
 	cpuMiner             *cpuminer.CPUMiner
+	stratumServer        *stratum.Server
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
@@ -234,9 +236,11 @@ type server struct {
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex        *indexers.TxIndex
+	addrIndex      *indexers.AddrIndex
+	cfIndex        *indexers.CfIndex
+	statsIndex     *indexers.StatsIndex
+	coinStatsIndex *indexers.CoinStatsIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -2344,6 +2348,11 @@ func (s *server) Start() {
 	if cfg.Generate {
 		s.cpuMiner.Start()
 	}
+
+	// Start the Stratum server if it's enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Start()
+	}
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2360,15 +2369,22 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop the Stratum server if it's enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Stop()
+	}
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
 	}
 
-	// Save fee estimator state in the database.
+	// Save fee estimator state and the fee deltas of the mempool in the
+	// database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
 		metadata.Put(mempool.EstimateFeeDatabaseKey, s.feeEstimator.Save())
+		metadata.Put(mempool.FeeDeltasDatabaseKey, s.txMemPool.SaveFeeDeltas())
 
 		return nil
 	})
@@ -2521,6 +2537,28 @@ out:
 	s.wg.Done()
 }
 
+// setupStratumListeners returns a slice of listeners that are configured for
+// use with the Stratum server depending on the configuration settings for
+// listen addresses.
+func setupStratumListeners() ([]net.Listener, error) {
+	netAddrs, err := parseListeners(cfg.StratumListeners)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(netAddrs))
+	for _, addr := range netAddrs {
+		listener, err := net.Listen(addr.Network(), addr.String())
+		if err != nil {
+			strmLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
 // setupRPCListeners returns a slice of listeners that are configured for use
 // with the RPC server depending on the configuration settings for listen
 // addresses and TLS.
@@ -2584,6 +2622,12 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.Prune != 0 {
+		// Only the most recent blocks can be served once the older ones
+		// have been pruned.
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
 
@@ -2661,6 +2705,16 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
 		indexes = append(indexes, s.cfIndex)
 	}
+	if cfg.StatsIndex {
+		indxLog.Info("Block statistics index is enabled")
+		s.statsIndex = indexers.NewStatsIndex(db, chainParams)
+		indexes = append(indexes, s.statsIndex)
+	}
+	if cfg.CoinStatsIndex {
+		indxLog.Info("Utxo set statistics index is enabled")
+		s.coinStatsIndex = indexers.NewCoinStatsIndex(db)
+		indexes = append(indexes, s.coinStatsIndex)
+	}
 
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
@@ -2677,14 +2731,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:               s.db,
+		Interrupt:        interrupt,
+		ChainParams:      s.chainParams,
+		Checkpoints:      checkpoints,
+		AssumeValid:      cfg.assumeValid,
+		TimeSource:       s.timeSource,
+		SigCache:         s.sigCache,
+		IndexManager:     indexManager,
+		HashCache:        s.hashCache,
+		UtxoCacheMaxSize: uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+		Prune:            cfg.Prune * 1024 * 1024,
+		ReorgWarnDepth:   int32(cfg.ReorgWarnDepth),
 	})
 	if err != nil {
 		return nil, err
@@ -2747,6 +2805,21 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 	s.txMemPool = mempool.New(&txC)
 
+	// Restore the fee deltas of transactions prioritised before the last
+	// shutdown.
+	db.Update(func(tx database.Tx) error {
+		metadata := tx.Metadata()
+		feeDeltas := metadata.Get(mempool.FeeDeltasDatabaseKey)
+		if feeDeltas == nil {
+			return nil
+		}
+		err := s.txMemPool.RestoreFeeDeltas(feeDeltas)
+		if err != nil {
+			srvrLog.Errorf("Failed to restore fee deltas: %v", err)
+		}
+		return metadata.Delete(mempool.FeeDeltasDatabaseKey)
+	})
+
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
 		Chain:              s.chain,
@@ -2766,12 +2839,15 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
 	// created before calling the function to create the CPU miner.
 	policy := mining.Policy{
-		BlockMinWeight:    cfg.BlockMinWeight,
-		BlockMaxWeight:    cfg.BlockMaxWeight,
-		BlockMinSize:      cfg.BlockMinSize,
-		BlockMaxSize:      cfg.BlockMaxSize,
-		BlockPrioritySize: cfg.BlockPrioritySize,
-		TxMinFreeFee:      cfg.minRelayTxFee,
+		BlockMinWeight:          cfg.BlockMinWeight,
+		BlockMaxWeight:          cfg.BlockMaxWeight,
+		BlockMinSize:            cfg.BlockMinSize,
+		BlockMaxSize:            cfg.BlockMaxSize,
+		BlockPrioritySize:       cfg.BlockPrioritySize,
+		TxMinFreeFee:            cfg.minRelayTxFee,
+		CoinbaseTag:             cfg.CoinbaseTag,
+		CoinbasePayouts:         cfg.coinbasePayouts,
+		AlwaysWitnessCommitment: cfg.WitnessCommitment,
 	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.txMemPool, s.chain, s.timeSource,
@@ -2785,6 +2861,29 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		IsCurrent:              s.syncManager.IsCurrent,
 	})
 
+	if len(cfg.StratumListeners) > 0 {
+		stratumListeners, err := setupStratumListeners()
+		if err != nil {
+			return nil, err
+		}
+		if len(stratumListeners) == 0 {
+			return nil, errors.New("STRM: No valid listen address")
+		}
+
+		s.stratumServer, err = stratum.New(&stratum.Config{
+			ChainParams:            chainParams,
+			BlockTemplateGenerator: blockTemplateGenerator,
+			MiningAddrs:            cfg.miningAddrs,
+			ProcessBlock:           s.syncManager.ProcessBlock,
+			IsCurrent:              s.syncManager.IsCurrent,
+			Listeners:              stratumListeners,
+			MinDifficulty:          cfg.StratumDifficulty,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Only setup a function to return new addresses to connect to when
 	// not running in connect-only mode.  The simulation network is always
 	// in connect-only mode since it is only intended to connect to
@@ -2882,21 +2981,23 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 
 		s.rpcServer, err = newRPCServer(&rpcserverConfig{
-			Listeners:    rpcListeners,
-			StartupTime:  s.startupTime,
-			ConnMgr:      &rpcConnManager{&s},
-			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
-			TimeSource:   s.timeSource,
-			Chain:        s.chain,
-			ChainParams:  chainParams,
-			DB:           db,
-			TxMemPool:    s.txMemPool,
-			Generator:    blockTemplateGenerator,
-			CPUMiner:     s.cpuMiner,
-			TxIndex:      s.txIndex,
-			AddrIndex:    s.addrIndex,
-			CfIndex:      s.cfIndex,
-			FeeEstimator: s.feeEstimator,
+			Listeners:      rpcListeners,
+			StartupTime:    s.startupTime,
+			ConnMgr:        &rpcConnManager{&s},
+			SyncMgr:        &rpcSyncMgr{&s, s.syncManager},
+			TimeSource:     s.timeSource,
+			Chain:          s.chain,
+			ChainParams:    chainParams,
+			DB:             db,
+			TxMemPool:      s.txMemPool,
+			Generator:      blockTemplateGenerator,
+			CPUMiner:       s.cpuMiner,
+			TxIndex:        s.txIndex,
+			AddrIndex:      s.addrIndex,
+			CfIndex:        s.cfIndex,
+			StatsIndex:     s.statsIndex,
+			CoinStatsIndex: s.coinStatsIndex,
+			FeeEstimator:   s.feeEstimator,
 		})
 		if err != nil {
 			return nil, err
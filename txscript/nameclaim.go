@@ -51,6 +51,9 @@ func UpdateClaimScript(name string, claimID []byte, value string) ([]byte, error
 
 // DecodeClaimScript ...
 func DecodeClaimScript(script []byte) (*ClaimScript, error) {
+	if len(script) == 0 {
+		return nil, ErrNotClaimScript
+	}
 	op := script[0]
 	if op != OP_CLAIMNAME && op != OP_SUPPORTCLAIM && op != OP_UPDATECLAIM {
 		return nil, ErrNotClaimScript
@@ -132,8 +135,13 @@ func StripClaimScriptPrefix(script []byte) []byte {
 }
 
 // ClaimScriptSize returns size of the claim script minus the script pubkey part.
+// It is 0 if script is not a claimtrie transaction, and the size of the whole
+// script if it is an invalid one.
 func ClaimScriptSize(script []byte) int {
 	cs, err := DecodeClaimScript(script)
+	if err == ErrNotClaimScript {
+		return 0
+	}
 	if err != nil {
 		return len(script)
 	}
@@ -0,0 +1,67 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestClaimScriptSize ensures ClaimScriptSize, which limits the size of claim
+// scripts in blocks, only counts the claim part of claimtrie scripts, counts
+// invalid claimtrie scripts entirely, and ignores other scripts of any size.
+func TestClaimScriptSize(t *testing.T) {
+	p2pkh := hexToBytes("76a914" + "0000000000000000000000000000000000000000" +
+		"88ac")
+	claim, err := ClaimNameScript("name", "value")
+	if err != nil {
+		t.Fatalf("ClaimNameScript: %v", err)
+	}
+	support, err := SupportClaimScript("name", make([]byte, 20))
+	if err != nil {
+		t.Fatalf("SupportClaimScript: %v", err)
+	}
+	update, err := UpdateClaimScript("name", make([]byte, 20), "value")
+	if err != nil {
+		t.Fatalf("UpdateClaimScript: %v", err)
+	}
+
+	// A claim with a value larger than MaxClaimScriptSize, which has to be
+	// pushed with OP_PUSHDATA2.
+	value := make([]byte, MaxClaimScriptSize)
+	largeClaim := []byte{OP_CLAIMNAME, OP_DATA_4, 'n', 'a', 'm', 'e',
+		OP_PUSHDATA2, byte(len(value)), byte(len(value) >> 8)}
+	largeClaim = append(largeClaim, value...)
+	largeClaim = append(largeClaim, OP_2DROP, OP_DROP)
+
+	// A script without claimtrie opcodes larger than MaxClaimScriptSize.
+	largeScript := append(bytes.Repeat([]byte{OP_TRUE, OP_DROP},
+		MaxClaimScriptSize), OP_TRUE)
+
+	concat := func(scripts ...[]byte) []byte {
+		return bytes.Join(scripts, nil)
+	}
+	tests := []struct {
+		name   string
+		script []byte
+		want   int
+	}{
+		{"empty", nil, 0},
+		{"p2pkh", p2pkh, 0},
+		{"large non-claim", largeScript, 0},
+		{"claim", concat(claim[:len(claim)-1], p2pkh), 14},
+		{"support", concat(support[:len(support)-1], p2pkh), 29},
+		{"update", concat(update[:len(update)-1], p2pkh), 35},
+		{"large claim", concat(largeClaim, p2pkh),
+			len(largeClaim) + len(p2pkh)},
+		{"malformed claim", []byte{OP_CLAIMNAME, OP_DATA_4}, 2},
+	}
+	for _, test := range tests {
+		if got := ClaimScriptSize(test.script); got != test.want {
+			t.Errorf("%s: got size %d, want %d", test.name, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestBlockSerializeSize ensures the serialized size of a block, which
+// consensus limits the blocks with, counts the whole header including the
+// ClaimTrie root.
+func TestBlockSerializeSize(t *testing.T) {
+	header := BlockHeader{
+		Version:    1,
+		PrevBlock:  chainhash.Hash{0x01},
+		MerkleRoot: chainhash.Hash{0x02},
+		ClaimTrie:  chainhash.Hash{0x03},
+		Timestamp:  time.Unix(0x5b8d80a5, 0),
+		Bits:       0x207fffff,
+		Nonce:      1,
+	}
+	var buf bytes.Buffer
+	if err := header.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if buf.Len() != blockHeaderLen || buf.Len() != MaxBlockHeaderPayload {
+		t.Fatalf("serialized header is %d bytes, want %d", buf.Len(),
+			blockHeaderLen)
+	}
+
+	tx := NewMsgTx(1)
+	tx.AddTxIn(&TxIn{
+		PreviousOutPoint: OutPoint{Index: 0xffffffff},
+		SignatureScript:  []byte{0x51},
+		Witness:          TxWitness{make([]byte, 32)},
+		Sequence:         0xffffffff,
+	})
+	tx.AddTxOut(&TxOut{Value: 1, PkScript: []byte{0x51}})
+
+	tests := []struct {
+		name  string
+		block *MsgBlock
+	}{
+		{"no transactions", NewMsgBlock(&header)},
+		{"witness transaction", &MsgBlock{
+			Header:       header,
+			Transactions: []*MsgTx{tx},
+		}},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		if err := test.block.Serialize(&buf); err != nil {
+			t.Fatalf("%s: Serialize: %v", test.name, err)
+		}
+		if size := test.block.SerializeSize(); size != buf.Len() {
+			t.Errorf("%s: SerializeSize is %d, serialized %d bytes",
+				test.name, size, buf.Len())
+		}
+
+		buf.Reset()
+		if err := test.block.SerializeNoWitness(&buf); err != nil {
+			t.Fatalf("%s: SerializeNoWitness: %v", test.name, err)
+		}
+		if size := test.block.SerializeSizeStripped(); size != buf.Len() {
+			t.Errorf("%s: SerializeSizeStripped is %d, serialized %d "+
+				"bytes", test.name, size, buf.Len())
+		}
+	}
+}